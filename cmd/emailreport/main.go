@@ -0,0 +1,118 @@
+// emailreport выводит пользователей, чьи email совпадают после канонизации.
+// Такие записи миграция 8_addUserEmailCanonical оставляет без email_canonical,
+// их нужно разобрать вручную: объединить аккаунты или поменять адрес.
+//
+// С -fix отчёт заодно пересчитывает email_canonical по правилам из конфига сервиса
+// (email.provider_canonicalization): миграция заполнила колонку только адресом в нижнем регистре.
+// Пользователям из групп совпадений колонка очищается, они входят по самому адресу.
+// Запускать после миграции 8 и после каждого изменения email.provider_canonicalization.
+//
+// Запуск: go run ./cmd/emailreport -config ./config/example_config.yaml [-fix]
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/DenisBochko/yandex_SSO/internal/config"
+	"github.com/DenisBochko/yandex_SSO/internal/domain/models"
+	postgresql "github.com/DenisBochko/yandex_SSO/internal/storage/postgres"
+	"github.com/DenisBochko/yandex_SSO/lib/emailaddr"
+	"github.com/DenisBochko/yandex_SSO/pkg/postgres"
+)
+
+func main() {
+	fix := flag.Bool("fix", false, "Recompute email_canonical with the configured rules")
+	cfg := config.MustLoad()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	conn, err := postgres.New(ctx, cfg.Postgres)
+	if err != nil {
+		log.Fatalf("could not connect to database: %v", err)
+	}
+	defer conn.Close()
+
+	st := postgresql.New(conn)
+
+	users, err := st.UserEmails(ctx)
+	if err != nil {
+		log.Fatalf("could not load users: %v", err)
+	}
+
+	normalizer := emailaddr.Normalizer{ProviderRules: cfg.Email.ProviderCanonicalization}
+
+	// Группируем по канонической форме, посчитанной текущими правилами,
+	// а не по сохранённой колонке: правила могли поменяться после миграции
+	groups := make(map[string][]models.User)
+	var invalid []models.User
+	for _, user := range users {
+		canonical, err := normalizer.Canonical(user.Email)
+		if err != nil {
+			invalid = append(invalid, user)
+			continue
+		}
+		groups[canonical] = append(groups[canonical], user)
+	}
+
+	keys := make([]string, 0, len(groups))
+	for canonical, group := range groups {
+		if len(group) > 1 {
+			keys = append(keys, canonical)
+		}
+	}
+	sort.Strings(keys)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "CANONICAL\tUSER ID\tEMAIL\tSTORED CANONICAL")
+	for _, canonical := range keys {
+		for _, user := range groups[canonical] {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", canonical, user.ID, user.Email, orDash(user.EmailCanonical))
+		}
+	}
+	for _, user := range invalid {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", "(invalid)", user.ID, user.Email, orDash(user.EmailCanonical))
+	}
+	w.Flush()
+
+	fmt.Printf("\n%d collision group(s), %d invalid address(es), %d user(s) checked\n", len(keys), len(invalid), len(users))
+
+	if *fix {
+		// у некорректных адресов email_canonical не трогаем
+		canonicals := make(map[string]string)
+		for canonical, group := range groups {
+			if len(group) > 1 {
+				canonical = ""
+			}
+			for _, user := range group {
+				if user.EmailCanonical != canonical {
+					canonicals[user.ID] = canonical
+				}
+			}
+		}
+
+		updated, err := st.SetEmailCanonicals(ctx, canonicals)
+		if err != nil {
+			log.Fatalf("could not update email_canonical: %v", err)
+		}
+		fmt.Printf("email_canonical updated for %d user(s)\n", updated)
+	}
+
+	if len(keys) > 0 || len(invalid) > 0 {
+		os.Exit(1)
+	}
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
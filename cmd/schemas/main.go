@@ -0,0 +1,50 @@
+// schemas ведёт локальный реестр схем событий (каталог schemas/).
+//
+// Без флагов регистрирует новые версии схем, которые публикует сервис (internal/adapter.Schemas):
+// после изменения сообщения в proto/events нужно поднять его версию в internal/adapter/schemas.go
+// и запустить эту команду. Несовместимое изменение или изменение без новой версии - ошибка.
+// С -check только проверяет реестр, как это делает сервис при старте.
+//
+// Запуск: go run ./cmd/schemas -dir ./schemas [-check]
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+
+	"github.com/DenisBochko/yandex_SSO/internal/adapter"
+	"github.com/DenisBochko/yandex_SSO/lib/schemaregistry"
+)
+
+func main() {
+	dir := flag.String("dir", "./schemas", "schema registry directory")
+	check := flag.Bool("check", false, "only check the registry, do not register new versions")
+	flag.Parse()
+
+	registry, err := schemaregistry.Open(*dir)
+	if err != nil {
+		log.Fatalf("could not open schema registry: %v", err)
+	}
+
+	if !*check {
+		for _, schema := range adapter.Schemas() {
+			added, err := registry.Register(schema)
+			if err != nil {
+				log.Fatalf("could not register schema: %v", err)
+			}
+			if added {
+				fmt.Printf("registered %s v%d\n", schema.Subject, schema.Version)
+			}
+		}
+	}
+
+	if err := registry.CheckHistory(); err != nil {
+		log.Fatalf("schema history is broken: %v", err)
+	}
+	if err := registry.Check(adapter.Schemas()...); err != nil {
+		log.Fatalf("schemas are not registered: %v", err)
+	}
+
+	fmt.Printf("%d subject(s) ok\n", len(registry.Subjects()))
+}
@@ -2,6 +2,9 @@ package main
 
 import (
 	"context"
+	"flag"
+	"fmt"
+	"os"
 	"os/signal"
 	"syscall"
 	"github.com/DenisBochko/yandex_SSO/internal/app"
@@ -25,13 +28,35 @@ func main() {
 	logger := logger.SetupLogger(cfg.Env)
 	defer logger.Sync()
 
+	// sso migrate ... управляет схемой бд вместо запуска сервиса
+	if args := flag.Args(); len(args) > 0 {
+		if args[0] != "migrate" {
+			fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s\n", args[0], migrateUsage)
+			os.Exit(2)
+		}
+		if err := runMigrate(ctx, cfg, args[1:]); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	logger.Info("Starting SSO service",
 		zap.String("Environment", cfg.Env),
 	)
 
 	// инициализация приложения и его запуск
-	application := app.New(ctx, logger, cfg)
+	application, err := app.New(ctx, logger, cfg)
+	if err != nil {
+		logger.Error("failed to start SSO service", zap.Error(err))
+		os.Exit(1)
+	}
 	go application.GRPCServer.Run()
+	go application.Janitor.Run()
+	go application.Outbox.Run()
+	go application.Webhooks.Run()
+	go application.Consumer.Run()
+	go application.Metrics.Run()
 
 	// graceful shutdown
 	// Ожидаем сигнал завершения
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/DenisBochko/yandex_SSO/internal/config"
+	"github.com/DenisBochko/yandex_SSO/internal/migrations"
+)
+
+const migrateUsage = `usage: sso [--config path] migrate <command>
+
+commands:
+  up                   apply all pending migrations
+  down [N]             roll back N migrations (default 1)
+  status               show schema version and pending migrations
+  force VERSION        set schema version without running migrations and clear the dirty flag
+  create [-dir DIR] NAME
+                       add an empty N_NAME.up.sql / N_NAME.down.sql pair`
+
+// runMigrate выполняет sso migrate: управление схемой основного хранилища (storage.backend)
+// вместо запуска сервиса. Миграции встроены в бинарник, рабочий каталог не важен, кроме create.
+func runMigrate(ctx context.Context, cfg *config.Config, args []string) error {
+	if cfg.Dev {
+		return errors.New("migrations are not used in --dev mode")
+	}
+	if len(args) == 0 {
+		return errors.New(migrateUsage)
+	}
+
+	command, args := args[0], args[1:]
+
+	// create работает с исходниками и к бд не подключается
+	if command == "create" {
+		flags := flag.NewFlagSet("create", flag.ContinueOnError)
+		dir := flags.String("dir", migrations.Dir(cfg.Storage.Backend), "migrations source directory")
+		if err := flags.Parse(args); err != nil {
+			return err
+		}
+		if flags.NArg() != 1 {
+			return errors.New(migrateUsage)
+		}
+
+		up, down, err := migrations.Create(*dir, flags.Arg(0))
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("created %s\ncreated %s\n", up, down)
+		return nil
+	}
+
+	m, err := migrations.New(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	defer m.Close()
+
+	switch command {
+	case "up":
+		if err := m.Up(ctx); err != nil {
+			return err
+		}
+	case "down":
+		steps := 1
+		if len(args) > 0 {
+			if steps, err = strconv.Atoi(args[0]); err != nil {
+				return fmt.Errorf("invalid number of migrations %q", args[0])
+			}
+		}
+		if err := m.Down(ctx, steps); err != nil {
+			return err
+		}
+	case "force":
+		if len(args) != 1 {
+			return errors.New(migrateUsage)
+		}
+		version, err := strconv.Atoi(args[0])
+		if err != nil {
+			return fmt.Errorf("invalid version %q", args[0])
+		}
+		if err := m.Force(ctx, version); err != nil {
+			return err
+		}
+	case "status":
+	default:
+		return fmt.Errorf("unknown migrate command %q\n\n%s", command, migrateUsage)
+	}
+
+	status, err := m.Status(ctx)
+	if err != nil {
+		return err
+	}
+
+	printStatus(status)
+	return nil
+}
+
+// printStatus выводит версию схемы и состояние каждой миграции сборки
+func printStatus(status migrations.Status) {
+	state := "ok"
+	if err := status.Compatible(); err != nil {
+		state = err.Error()
+	}
+	fmt.Printf("schema version %d, latest %d: %s\n\n", status.Version, status.Latest(), state)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, migration := range status.Migrations {
+		applied := "applied"
+		switch {
+		case migration.Version > status.Version:
+			applied = "pending"
+		case migration.Version == status.Version && status.Dirty:
+			applied = "dirty"
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\n", migration.Version, migration.Name, applied)
+	}
+	w.Flush()
+}
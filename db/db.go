@@ -0,0 +1,15 @@
+// Package db встраивает миграции схемы в бинарник, поэтому они не зависят от рабочего каталога.
+// Применяются командой sso migrate (см. internal/migrations).
+package db
+
+import "embed"
+
+// Postgres - миграции postgres, каталог migrations
+//
+//go:embed migrations/*.sql
+var Postgres embed.FS
+
+// Sqlite - миграции sqlite, каталог sqlite_migrations
+//
+//go:embed sqlite_migrations/*.sql
+var Sqlite embed.FS
@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS security_events (
+    id BIGSERIAL PRIMARY KEY,
+    user_id UUID REFERENCES users(id) ON DELETE CASCADE, -- NULL для входов с несуществующим логином
+    type VARCHAR(32) NOT NULL,
+    login VARCHAR(255) NOT NULL DEFAULT '',
+    ip VARCHAR(64) NOT NULL DEFAULT '',
+    user_agent TEXT NOT NULL DEFAULT '',
+    details JSONB NOT NULL DEFAULT '{}',
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+-- лента пользователя читается от новых к старым
+CREATE INDEX IF NOT EXISTS security_events_user_id_idx ON security_events (user_id, id DESC);
+-- для удаления по сроку хранения
+CREATE INDEX IF NOT EXISTS security_events_created_at_idx ON security_events (created_at);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS session_revoke_tokens;
+DROP TABLE IF EXISTS known_devices;
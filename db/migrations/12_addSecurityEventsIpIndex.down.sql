@@ -0,0 +1 @@
+DROP INDEX IF EXISTS security_events_ip_idx;
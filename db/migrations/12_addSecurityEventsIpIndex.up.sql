@@ -0,0 +1,2 @@
+-- оценка риска считает неудачные входы с одного адреса
+CREATE INDEX IF NOT EXISTS security_events_ip_idx ON security_events (ip, created_at) WHERE ip <> '';
@@ -0,0 +1,18 @@
+-- сообщения для Kafka, записанные в одной транзакции с изменением данных.
+-- Их публикует relay (internal/app/outbox), сообщения одного aggregate_id уходят строго по порядку id.
+CREATE TABLE IF NOT EXISTS outbox (
+    id BIGSERIAL PRIMARY KEY,
+    aggregate_id VARCHAR(64) NOT NULL, -- ключ сообщения, обычно id пользователя
+    topic VARCHAR(255) NOT NULL,
+    kind VARCHAR(64) NOT NULL,
+    payload BYTEA NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    attempts INT NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    last_error TEXT NOT NULL DEFAULT '',
+    published_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX IF NOT EXISTS outbox_pending_idx ON outbox (id) WHERE published_at IS NULL;
+CREATE INDEX IF NOT EXISTS outbox_pending_aggregate_idx ON outbox (aggregate_id, id) WHERE published_at IS NULL;
+CREATE INDEX IF NOT EXISTS outbox_published_at_idx ON outbox (published_at) WHERE published_at IS NOT NULL;
@@ -0,0 +1,2 @@
+-- заголовки сообщения Kafka: метаданные события (id, тип, версия схемы, trace id...)
+ALTER TABLE outbox ADD COLUMN IF NOT EXISTS headers JSONB NOT NULL DEFAULT '{}'::jsonb;
@@ -0,0 +1,3 @@
+ALTER TABLE users DROP COLUMN IF EXISTS email_status_at;
+ALTER TABLE users DROP COLUMN IF EXISTS email_status_reason;
+ALTER TABLE users DROP COLUMN IF EXISTS email_status;
@@ -0,0 +1,5 @@
+-- доставляемость email по отчётам почтового сервиса: ok | bounced | complained.
+-- На bounced и complained письма не отправляются, при смене email статус сбрасывается.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS email_status VARCHAR(16) NOT NULL DEFAULT 'ok';
+ALTER TABLE users ADD COLUMN IF NOT EXISTS email_status_reason TEXT NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN IF NOT EXISTS email_status_at TIMESTAMP WITH TIME ZONE;
@@ -0,0 +1,14 @@
+-- входящие команды над учётными записями (топик KAFKA_COMMANDS_TOPIC).
+-- id - ключ идемпотентности отправителя: повторная команда с тем же id не выполняется.
+CREATE TABLE IF NOT EXISTS account_commands (
+    id VARCHAR(128) PRIMARY KEY,
+    command VARCHAR(32) NOT NULL,
+    user_id TEXT NOT NULL,
+    requested_by TEXT NOT NULL DEFAULT '',
+    status VARCHAR(16) NOT NULL, -- ok | rejected
+    error TEXT NOT NULL DEFAULT '',
+    changed BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS account_commands_created_at_idx ON account_commands (created_at);
@@ -0,0 +1,4 @@
+ALTER TABLE verification_codes
+    DROP COLUMN IF EXISTS issues,
+    DROP COLUMN IF EXISTS window_started_at,
+    DROP COLUMN IF EXISTS issued_at;
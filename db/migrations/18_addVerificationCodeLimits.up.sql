@@ -0,0 +1,6 @@
+-- счётчики выпуска кодов: попытки ввода и выпуски копятся в окне window_started_at,
+-- повторная отправка кода их не сбрасывает. Для старых кодов окно считается давно начавшимся
+ALTER TABLE verification_codes
+    ADD COLUMN IF NOT EXISTS issued_at TIMESTAMP NOT NULL DEFAULT 'epoch',
+    ADD COLUMN IF NOT EXISTS window_started_at TIMESTAMP NOT NULL DEFAULT 'epoch',
+    ADD COLUMN IF NOT EXISTS issues INT NOT NULL DEFAULT 1;
@@ -0,0 +1,3 @@
+-- вход по самому адресу без учёта регистра: для пользователей без email_canonical
+-- и с email_canonical, посчитанным по прежним правилам
+CREATE INDEX IF NOT EXISTS users_email_lower_idx ON users(lower(email));
@@ -0,0 +1,4 @@
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS status VARCHAR(32) NOT NULL DEFAULT 'active',
+    ADD COLUMN IF NOT EXISTS status_reason TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS suspended_until TIMESTAMP WITH TIME ZONE;
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS verification_tokens_expires_at_idx;
+DROP INDEX IF EXISTS verification_tokens_user_id_idx;
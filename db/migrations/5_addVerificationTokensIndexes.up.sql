@@ -0,0 +1,2 @@
+CREATE INDEX IF NOT EXISTS verification_tokens_user_id_idx ON verification_tokens(user_id);
+CREATE INDEX IF NOT EXISTS verification_tokens_expires_at_idx ON verification_tokens(expires_at);
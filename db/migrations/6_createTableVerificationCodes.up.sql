@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS verification_codes (
+    user_id UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    code_hash BYTEA NOT NULL,
+    attempts INT NOT NULL DEFAULT 0,
+    expires_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS verification_codes_expires_at_idx ON verification_codes(expires_at);
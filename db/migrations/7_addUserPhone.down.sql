@@ -0,0 +1,22 @@
+-- у пользователей, зарегистрированных по телефону, нет email и пароля: без них откат невозможен.
+-- Удалять их молча нельзя, поэтому откат останавливается, пока их не перенесут или не удалят вручную
+DO $$
+BEGIN
+    IF EXISTS (SELECT 1 FROM users WHERE email IS NULL) THEN
+        RAISE EXCEPTION 'users without email exist (registered by phone), migrate or delete them before rolling back';
+    END IF;
+END $$;
+
+DELETE FROM verification_codes WHERE channel <> 'email';
+
+ALTER TABLE verification_codes
+    DROP CONSTRAINT verification_codes_pkey,
+    DROP COLUMN IF EXISTS channel,
+    ADD PRIMARY KEY (user_id);
+
+ALTER TABLE users
+    DROP CONSTRAINT IF EXISTS users_email_or_phone_check,
+    ALTER COLUMN pass_hash SET NOT NULL,
+    ALTER COLUMN email SET NOT NULL,
+    DROP COLUMN IF EXISTS phone_verified,
+    DROP COLUMN IF EXISTS phone;
@@ -0,0 +1,15 @@
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS phone VARCHAR(16) UNIQUE,
+    ADD COLUMN IF NOT EXISTS phone_verified BOOLEAN NOT NULL DEFAULT FALSE,
+    ALTER COLUMN email DROP NOT NULL,
+    ALTER COLUMN pass_hash DROP NOT NULL;
+
+-- пользователь, зарегистрированный по телефону, может не иметь ни email, ни пароля
+ALTER TABLE users
+    ADD CONSTRAINT users_email_or_phone_check CHECK (email IS NOT NULL OR phone IS NOT NULL);
+
+-- у пользователя может быть по одному действующему коду на каждый канал (email, sms)
+ALTER TABLE verification_codes
+    ADD COLUMN IF NOT EXISTS channel VARCHAR(16) NOT NULL DEFAULT 'email',
+    DROP CONSTRAINT verification_codes_pkey,
+    ADD PRIMARY KEY (user_id, channel);
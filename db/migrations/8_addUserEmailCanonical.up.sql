@@ -0,0 +1,14 @@
+-- email_canonical - адрес в нижнем регистре (и с правилами провайдеров, если они включены),
+-- по нему ищутся пользователи и проверяется уникальность без учёта регистра
+ALTER TABLE users ADD COLUMN IF NOT EXISTS email_canonical VARCHAR(256);
+
+-- заполняем только адреса без коллизий. Адреса, совпадающие без учёта регистра,
+-- остаются с NULL (вход по точному совпадению email) и попадают в отчёт cmd/emailreport
+UPDATE users u SET email_canonical = lower(trim(u.email))
+WHERE u.email IS NOT NULL
+  AND NOT EXISTS (
+      SELECT 1 FROM users o
+      WHERE o.id <> u.id AND lower(trim(o.email)) = lower(trim(u.email))
+  );
+
+CREATE UNIQUE INDEX IF NOT EXISTS users_email_canonical_key ON users(email_canonical);
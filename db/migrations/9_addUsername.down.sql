@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS username_history;
+
+ALTER TABLE users
+    DROP COLUMN IF EXISTS username_changed_at,
+    DROP COLUMN IF EXISTS username_skeleton,
+    DROP COLUMN IF EXISTS username;
@@ -0,0 +1,19 @@
+-- username - уникальный хэндл для ссылок на профиль, в нижнем регистре.
+-- username_skeleton - форма со склеенными похожими символами (см. lib/handle), уникальность проверяется по ней.
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS username VARCHAR(30) UNIQUE,
+    ADD COLUMN IF NOT EXISTS username_skeleton VARCHAR(60) UNIQUE,
+    ADD COLUMN IF NOT EXISTS username_changed_at TIMESTAMP WITH TIME ZONE;
+
+-- прежние хэндлы пользователей. Пока не наступил held_until, хэндл может вернуть себе только прежний владелец.
+CREATE TABLE IF NOT EXISTS username_history (
+    id BIGSERIAL PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    username VARCHAR(30) NOT NULL,
+    username_skeleton VARCHAR(60) NOT NULL,
+    changed_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT NOW(),
+    held_until TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS username_history_skeleton_idx ON username_history (username_skeleton, held_until);
+CREATE INDEX IF NOT EXISTS username_history_user_id_idx ON username_history (user_id);
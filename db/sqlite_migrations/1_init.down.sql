@@ -0,0 +1,12 @@
+DROP TABLE IF EXISTS account_commands;
+DROP TABLE IF EXISTS webhook_delivery_attempts;
+DROP TABLE IF EXISTS webhook_deliveries;
+DROP TABLE IF EXISTS webhook_subscriptions;
+DROP TABLE IF EXISTS outbox;
+DROP TABLE IF EXISTS session_revoke_tokens;
+DROP TABLE IF EXISTS known_devices;
+DROP TABLE IF EXISTS security_events;
+DROP TABLE IF EXISTS username_history;
+DROP TABLE IF EXISTS verification_codes;
+DROP TABLE IF EXISTS verification_tokens;
+DROP TABLE IF EXISTS users;
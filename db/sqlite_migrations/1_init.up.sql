@@ -0,0 +1,178 @@
+-- Схема SQLite повторяет схему postgres (db/migrations) на момент миграции 17.
+-- id пользователей и подписок - uuid, их генерирует приложение.
+-- Время хранится в микросекундах unix (UTC), логические значения - 0 и 1, JSON - текстом.
+
+CREATE TABLE IF NOT EXISTS users (
+    id TEXT PRIMARY KEY,
+    name TEXT NOT NULL,
+    email TEXT UNIQUE,
+    -- адрес в нижнем регистре (и с правилами провайдеров, если они включены), по нему проверяется уникальность
+    email_canonical TEXT UNIQUE,
+    pass_hash BLOB,
+    verify INTEGER NOT NULL DEFAULT 0,
+    avatar TEXT NOT NULL DEFAULT '',
+    phone TEXT UNIQUE,
+    phone_verified INTEGER NOT NULL DEFAULT 0,
+    -- хэндл и его скелет (см. lib/handle), уникальность проверяется по скелету
+    username TEXT UNIQUE,
+    username_skeleton TEXT UNIQUE,
+    username_changed_at INTEGER,
+    status TEXT NOT NULL DEFAULT 'active',
+    status_reason TEXT NOT NULL DEFAULT '',
+    suspended_until INTEGER,
+    -- доставляемость email: ok | bounced | complained
+    email_status TEXT NOT NULL DEFAULT 'ok',
+    email_status_reason TEXT NOT NULL DEFAULT '',
+    email_status_at INTEGER,
+    created_at INTEGER NOT NULL,
+    -- пользователь, зарегистрированный по телефону, может не иметь ни email, ни пароля
+    CHECK (email IS NOT NULL OR phone IS NOT NULL)
+);
+
+CREATE TABLE IF NOT EXISTS verification_tokens (
+    token TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    expires_at INTEGER NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS verification_tokens_user_id_idx ON verification_tokens (user_id);
+CREATE INDEX IF NOT EXISTS verification_tokens_expires_at_idx ON verification_tokens (expires_at);
+
+-- у пользователя может быть по одному действующему коду на каждый канал (email, sms)
+CREATE TABLE IF NOT EXISTS verification_codes (
+    user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    channel TEXT NOT NULL DEFAULT 'email',
+    code_hash BLOB NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    expires_at INTEGER NOT NULL,
+    PRIMARY KEY (user_id, channel)
+);
+
+CREATE INDEX IF NOT EXISTS verification_codes_expires_at_idx ON verification_codes (expires_at);
+
+-- прежние хэндлы пользователей. Пока не наступил held_until, хэндл может вернуть себе только прежний владелец.
+CREATE TABLE IF NOT EXISTS username_history (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    username TEXT NOT NULL,
+    username_skeleton TEXT NOT NULL,
+    changed_at INTEGER NOT NULL,
+    held_until INTEGER NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS username_history_skeleton_idx ON username_history (username_skeleton, held_until);
+CREATE INDEX IF NOT EXISTS username_history_user_id_idx ON username_history (user_id);
+
+CREATE TABLE IF NOT EXISTS security_events (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id TEXT REFERENCES users(id) ON DELETE CASCADE, -- NULL для входов с несуществующим логином
+    type TEXT NOT NULL,
+    login TEXT NOT NULL DEFAULT '',
+    ip TEXT NOT NULL DEFAULT '',
+    user_agent TEXT NOT NULL DEFAULT '',
+    details TEXT NOT NULL DEFAULT '{}',
+    created_at INTEGER NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS security_events_user_id_idx ON security_events (user_id, id DESC);
+CREATE INDEX IF NOT EXISTS security_events_created_at_idx ON security_events (created_at);
+CREATE INDEX IF NOT EXISTS security_events_ip_idx ON security_events (ip, created_at) WHERE ip <> '';
+
+CREATE TABLE IF NOT EXISTS known_devices (
+    user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    fingerprint TEXT NOT NULL,
+    user_agent TEXT NOT NULL DEFAULT '',
+    ip TEXT NOT NULL DEFAULT '',
+    first_seen_at INTEGER NOT NULL,
+    last_seen_at INTEGER NOT NULL,
+    PRIMARY KEY (user_id, fingerprint)
+);
+
+-- токены ссылки "это был не я" из уведомления о новом входе
+CREATE TABLE IF NOT EXISTS session_revoke_tokens (
+    token TEXT PRIMARY KEY,
+    user_id TEXT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    fingerprint TEXT NOT NULL,
+    expires_at INTEGER NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS session_revoke_tokens_user_id_idx ON session_revoke_tokens (user_id);
+CREATE INDEX IF NOT EXISTS session_revoke_tokens_expires_at_idx ON session_revoke_tokens (expires_at);
+
+-- сообщения для транспорта событий, записанные в одной транзакции с изменением данных
+CREATE TABLE IF NOT EXISTS outbox (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    aggregate_id TEXT NOT NULL, -- ключ сообщения, обычно id пользователя
+    topic TEXT NOT NULL,
+    kind TEXT NOT NULL,
+    headers TEXT NOT NULL DEFAULT '{}',
+    payload BLOB NOT NULL,
+    created_at INTEGER NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    next_attempt_at INTEGER NOT NULL,
+    last_error TEXT NOT NULL DEFAULT '',
+    published_at INTEGER
+);
+
+CREATE INDEX IF NOT EXISTS outbox_pending_idx ON outbox (id) WHERE published_at IS NULL;
+CREATE INDEX IF NOT EXISTS outbox_pending_aggregate_idx ON outbox (aggregate_id, id) WHERE published_at IS NULL;
+CREATE INDEX IF NOT EXISTS outbox_published_at_idx ON outbox (published_at) WHERE published_at IS NOT NULL;
+
+-- подписки партнёров на события пользователей, event_types - JSON массив
+CREATE TABLE IF NOT EXISTS webhook_subscriptions (
+    id TEXT PRIMARY KEY,
+    url TEXT NOT NULL,
+    event_types TEXT NOT NULL,
+    secret TEXT NOT NULL, -- ключ HMAC-SHA256 подписи запросов
+    description TEXT NOT NULL DEFAULT '',
+    active INTEGER NOT NULL DEFAULT 1,
+    created_at INTEGER NOT NULL,
+    updated_at INTEGER NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    subscription_id TEXT NOT NULL REFERENCES webhook_subscriptions(id) ON DELETE CASCADE,
+    event_id TEXT NOT NULL,
+    event_type TEXT NOT NULL,
+    payload TEXT NOT NULL, -- тело запроса
+    status TEXT NOT NULL DEFAULT 'pending', -- pending | delivered | dead
+    attempts INTEGER NOT NULL DEFAULT 0,
+    next_attempt_at INTEGER NOT NULL,
+    last_error TEXT NOT NULL DEFAULT '',
+    created_at INTEGER NOT NULL,
+    delivered_at INTEGER,
+    UNIQUE (subscription_id, event_id)
+);
+
+CREATE INDEX IF NOT EXISTS webhook_deliveries_pending_idx ON webhook_deliveries (next_attempt_at) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS webhook_deliveries_subscription_idx ON webhook_deliveries (subscription_id, id DESC);
+CREATE INDEX IF NOT EXISTS webhook_deliveries_created_at_idx ON webhook_deliveries (created_at) WHERE status <> 'pending';
+
+-- журнал попыток доставки
+CREATE TABLE IF NOT EXISTS webhook_delivery_attempts (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    delivery_id INTEGER NOT NULL REFERENCES webhook_deliveries(id) ON DELETE CASCADE,
+    attempt INTEGER NOT NULL,
+    status_code INTEGER NOT NULL DEFAULT 0, -- 0, если ответа не было
+    error TEXT NOT NULL DEFAULT '',
+    response_body TEXT NOT NULL DEFAULT '', -- начало тела ответа
+    duration_ms INTEGER NOT NULL DEFAULT 0,
+    created_at INTEGER NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS webhook_delivery_attempts_delivery_idx ON webhook_delivery_attempts (delivery_id, attempt);
+
+-- входящие команды над учётными записями, id - ключ идемпотентности отправителя
+CREATE TABLE IF NOT EXISTS account_commands (
+    id TEXT PRIMARY KEY,
+    command TEXT NOT NULL,
+    user_id TEXT NOT NULL,
+    requested_by TEXT NOT NULL DEFAULT '',
+    status TEXT NOT NULL, -- ok | rejected
+    error TEXT NOT NULL DEFAULT '',
+    changed INTEGER NOT NULL DEFAULT 0,
+    created_at INTEGER NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS account_commands_created_at_idx ON account_commands (created_at);
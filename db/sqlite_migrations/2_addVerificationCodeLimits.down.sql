@@ -0,0 +1,3 @@
+ALTER TABLE verification_codes DROP COLUMN issues;
+ALTER TABLE verification_codes DROP COLUMN window_started_at;
+ALTER TABLE verification_codes DROP COLUMN issued_at;
@@ -0,0 +1,5 @@
+-- счётчики выпуска кодов: попытки ввода и выпуски копятся в окне window_started_at,
+-- повторная отправка кода их не сбрасывает. Для старых кодов окно считается давно начавшимся
+ALTER TABLE verification_codes ADD COLUMN issued_at INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE verification_codes ADD COLUMN window_started_at INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE verification_codes ADD COLUMN issues INTEGER NOT NULL DEFAULT 1;
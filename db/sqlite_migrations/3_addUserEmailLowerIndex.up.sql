@@ -0,0 +1,2 @@
+-- вход по самому адресу без учёта регистра
+CREATE INDEX IF NOT EXISTS users_email_lower_idx ON users(lower(email));
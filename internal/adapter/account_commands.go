@@ -0,0 +1,132 @@
+package adapter
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/DenisBochko/yandex_SSO/internal/domain/models"
+	"github.com/DenisBochko/yandex_SSO/internal/services/commands"
+
+	"github.com/IBM/sarama"
+	"go.uber.org/zap"
+)
+
+// Заголовки сообщения в dead letter топике. Исходные заголовки сохраняются.
+const (
+	HeaderDeadLetterTopic     = "dlq-original-topic"
+	HeaderDeadLetterPartition = "dlq-original-partition"
+	HeaderDeadLetterOffset    = "dlq-original-offset"
+	HeaderDeadLetterError     = "dlq-error"
+	HeaderDeadLetterFailedAt  = "dlq-failed-at"
+
+	// HeaderIdempotencyKey - ключ идемпотентности команды, если его нет в теле
+	HeaderIdempotencyKey = "idempotency-key"
+)
+
+const kindDeadLetter = "dead_letter"
+
+type AccountCommandsService interface {
+	Execute(ctx context.Context, cmd models.AccountCommand) error
+}
+
+// accountCommandMessage - команда в топике KAFKA_COMMANDS_TOPIC (JSON)
+type accountCommandMessage struct {
+	CommandID   string     `json:"command_id"` // ключ идемпотентности, можно передать заголовком idempotency-key
+	Type        string     `json:"type"`       // suspend | unsuspend | delete | force_logout
+	UserID      string     `json:"user_id"`
+	Reason      string     `json:"reason"`
+	Until       *time.Time `json:"until"` // для suspend, без него блокировка бессрочная
+	RequestedBy string     `json:"requested_by"`
+}
+
+// AccountCommandHandler разбирает команды других сервисов и передаёт их сервису команд.
+// Сообщения, которые невозможно разобрать или выполнить при любом повторе, уходят в
+// dead letter топик (KAFKA_DEAD_LETTER_TOPIC) вместе с причиной и не задерживают партицию.
+type AccountCommandHandler struct {
+	log             *zap.Logger
+	service         AccountCommandsService
+	publisher       Publisher
+	deadLetterTopic string
+}
+
+func NewAccountCommandHandler(log *zap.Logger, service AccountCommandsService, publisher Publisher, deadLetterTopic string) *AccountCommandHandler {
+	return &AccountCommandHandler{
+		log:             log.With(zap.String("component", "account-commands")),
+		service:         service,
+		publisher:       publisher,
+		deadLetterTopic: deadLetterTopic,
+	}
+}
+
+func (h *AccountCommandHandler) Handle(ctx context.Context, msg *sarama.ConsumerMessage) error {
+	var m accountCommandMessage
+	if err := json.Unmarshal(msg.Value, &m); err != nil {
+		return h.deadLetter(ctx, msg, fmt.Errorf("malformed command: %w", err))
+	}
+
+	cmd := models.AccountCommand{
+		ID:          m.CommandID,
+		Type:        models.AccountCommandType(m.Type),
+		UserID:      m.UserID,
+		Reason:      m.Reason,
+		RequestedBy: m.RequestedBy,
+	}
+	if cmd.ID == "" {
+		cmd.ID = header(msg, HeaderIdempotencyKey)
+	}
+	if m.Until != nil {
+		cmd.Until = m.Until.UTC()
+	}
+
+	err := h.service.Execute(ctx, cmd)
+	if errors.Is(err, commands.ErrInvalidCommand) {
+		return h.deadLetter(ctx, msg, err)
+	}
+
+	return err
+}
+
+// deadLetter перекладывает сообщение в dead letter топик. Ошибка публикации возвращается:
+// сообщение будет обработано повторно, а не потеряно.
+func (h *AccountCommandHandler) deadLetter(ctx context.Context, msg *sarama.ConsumerMessage, reason error) error {
+	headers := make(map[string]string, len(msg.Headers)+5)
+	for _, hdr := range msg.Headers {
+		if hdr != nil {
+			headers[string(hdr.Key)] = string(hdr.Value)
+		}
+	}
+	headers[HeaderDeadLetterTopic] = msg.Topic
+	headers[HeaderDeadLetterPartition] = strconv.FormatInt(int64(msg.Partition), 10)
+	headers[HeaderDeadLetterOffset] = strconv.FormatInt(msg.Offset, 10)
+	headers[HeaderDeadLetterError] = reason.Error()
+	headers[HeaderDeadLetterFailedAt] = time.Now().UTC().Format(time.RFC3339Nano)
+
+	h.log.Warn("moving message to dead letter topic",
+		zap.Int32("partition", msg.Partition), zap.Int64("offset", msg.Offset), zap.Error(reason))
+
+	err := h.publisher.Publish(ctx, models.OutboxMessage{
+		AggregateID: string(msg.Key),
+		Topic:       h.deadLetterTopic,
+		Kind:        kindDeadLetter,
+		Headers:     headers,
+		Payload:     msg.Value,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to publish dead letter: %w", err)
+	}
+
+	return nil
+}
+
+func header(msg *sarama.ConsumerMessage, key string) string {
+	for _, hdr := range msg.Headers {
+		if hdr != nil && string(hdr.Key) == key {
+			return string(hdr.Value)
+		}
+	}
+	return ""
+}
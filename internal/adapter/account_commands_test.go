@@ -0,0 +1,71 @@
+package adapter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/DenisBochko/yandex_SSO/internal/domain/models"
+	"github.com/DenisBochko/yandex_SSO/internal/services/commands"
+
+	"github.com/IBM/sarama"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+type commandRecorder struct {
+	got []models.AccountCommand
+	err error
+}
+
+func (r *commandRecorder) Execute(ctx context.Context, cmd models.AccountCommand) error {
+	r.got = append(r.got, cmd)
+	if cmd.ID == "" {
+		return fmt.Errorf("%w: command id must be set", commands.ErrInvalidCommand)
+	}
+	return r.err
+}
+
+func TestAccountCommandHandler(t *testing.T) {
+	recorder := &commandRecorder{}
+	publisher := NewMemoryPublisher(0)
+	handler := NewAccountCommandHandler(zap.NewNop(), recorder, publisher, "dlq")
+
+	messages := []*sarama.ConsumerMessage{
+		{Value: []byte(`{"command_id":"c1","type":"suspend","user_id":"u1","reason":"chargeback","until":"2030-01-02T03:04:05+03:00","requested_by":"billing"}`)},
+		{
+			Value:   []byte(`{"type":"force_logout","user_id":"u2"}`),
+			Headers: []*sarama.RecordHeader{{Key: []byte(HeaderIdempotencyKey), Value: []byte("c2")}},
+		},
+		{Topic: "commands", Partition: 1, Offset: 7, Key: []byte("u3"), Value: []byte(`not json`)},
+		{Topic: "commands", Partition: 1, Offset: 8, Value: []byte(`{"type":"delete","user_id":"u4"}`)},
+	}
+	for _, m := range messages {
+		require.NoError(t, handler.Handle(context.Background(), m))
+	}
+
+	require.Equal(t, []models.AccountCommand{
+		{
+			ID: "c1", Type: models.AccountCommandSuspend, UserID: "u1", Reason: "chargeback",
+			Until: time.Date(2030, 1, 2, 0, 4, 5, 0, time.UTC), RequestedBy: "billing",
+		},
+		{ID: "c2", Type: models.AccountCommandForceLogout, UserID: "u2"},
+		{Type: models.AccountCommandDelete, UserID: "u4"},
+	}, recorder.got)
+
+	dead := publisher.Messages("dlq")
+	require.Len(t, dead, 2)
+	require.Equal(t, "u3", dead[0].AggregateID)
+	require.Equal(t, "not json", string(dead[0].Payload))
+	require.Equal(t, "commands", dead[0].Headers[HeaderDeadLetterTopic])
+	require.Equal(t, "7", dead[0].Headers[HeaderDeadLetterOffset])
+	require.Contains(t, dead[0].Headers[HeaderDeadLetterError], "malformed command")
+	require.Contains(t, dead[1].Headers[HeaderDeadLetterError], "command id must be set")
+
+	// временный сбой не уводит сообщение в dead letter топик, а возвращается для повтора
+	recorder.err = errors.New("database is down")
+	require.Error(t, handler.Handle(context.Background(), messages[0]))
+	require.Len(t, publisher.Messages("dlq"), 2)
+}
@@ -0,0 +1,66 @@
+package adapter
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/DenisBochko/yandex_SSO/internal/domain/models"
+
+	"github.com/IBM/sarama"
+	"go.uber.org/zap"
+)
+
+type EmailFeedbackService interface {
+	ApplyEmailFeedback(ctx context.Context, feedback models.EmailFeedback) error
+}
+
+// emailFeedbackMessage - отчёт почтового сервиса в топике KAFKA_DELIVERY_STATUS_TOPIC (JSON)
+type emailFeedbackMessage struct {
+	EventID    string    `json:"event_id"`
+	Type       string    `json:"type"` // delivered | bounce | complaint
+	Email      string    `json:"email"`
+	UserID     string    `json:"user_id"`     // необязательный
+	BounceType string    `json:"bounce_type"` // для bounce: permanent | transient
+	Reason     string    `json:"reason"`
+	OccurredAt time.Time `json:"occurred_at"`
+}
+
+// EmailFeedbackHandler разбирает отчёты о доставке писем и передаёт их сервису пользователей.
+// Сообщения, которые невозможно разобрать, пропускаются с записью в лог: повтор их не исправит.
+type EmailFeedbackHandler struct {
+	log     *zap.Logger
+	service EmailFeedbackService
+}
+
+func NewEmailFeedbackHandler(log *zap.Logger, service EmailFeedbackService) *EmailFeedbackHandler {
+	return &EmailFeedbackHandler{
+		log:     log.With(zap.String("component", "email-feedback")),
+		service: service,
+	}
+}
+
+func (h *EmailFeedbackHandler) Handle(ctx context.Context, msg *sarama.ConsumerMessage) error {
+	log := h.log.With(zap.Int32("partition", msg.Partition), zap.Int64("offset", msg.Offset))
+
+	var m emailFeedbackMessage
+	if err := json.Unmarshal(msg.Value, &m); err != nil {
+		log.Warn("skipping malformed email feedback", zap.Error(err))
+		return nil
+	}
+
+	if m.Email == "" {
+		log.Warn("skipping email feedback without address", zap.String("eventID", m.EventID))
+		return nil
+	}
+
+	return h.service.ApplyEmailFeedback(ctx, models.EmailFeedback{
+		EventID:    m.EventID,
+		Type:       m.Type,
+		Email:      m.Email,
+		UserID:     m.UserID,
+		Permanent:  m.BounceType == "permanent",
+		Reason:     m.Reason,
+		OccurredAt: m.OccurredAt,
+	})
+}
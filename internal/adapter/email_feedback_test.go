@@ -0,0 +1,45 @@
+package adapter
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DenisBochko/yandex_SSO/internal/domain/models"
+
+	"github.com/IBM/sarama"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+type feedbackRecorder struct {
+	got []models.EmailFeedback
+}
+
+func (r *feedbackRecorder) ApplyEmailFeedback(ctx context.Context, feedback models.EmailFeedback) error {
+	r.got = append(r.got, feedback)
+	return nil
+}
+
+func TestEmailFeedbackHandler(t *testing.T) {
+	recorder := &feedbackRecorder{}
+	handler := NewEmailFeedbackHandler(zap.NewNop(), recorder)
+
+	messages := []string{
+		`{"event_id":"e1","type":"bounce","bounce_type":"permanent","email":"ann@example.com","user_id":"u1","reason":"550 no such user","occurred_at":"2025-01-02T03:04:05Z"}`,
+		`{"event_id":"e2","type":"complaint","email":"bob@example.com"}`,
+		`not json`,
+		`{"event_id":"e3","type":"bounce"}`,
+	}
+	for _, m := range messages {
+		require.NoError(t, handler.Handle(context.Background(), &sarama.ConsumerMessage{Value: []byte(m)}))
+	}
+
+	require.Equal(t, []models.EmailFeedback{
+		{
+			EventID: "e1", Type: models.EmailFeedbackBounce, Email: "ann@example.com", UserID: "u1", Permanent: true,
+			Reason: "550 no such user", OccurredAt: time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC),
+		},
+		{EventID: "e2", Type: models.EmailFeedbackComplaint, Email: "bob@example.com"},
+	}, recorder.got)
+}
@@ -0,0 +1,104 @@
+package adapter
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/DenisBochko/yandex_SSO/internal/domain/models"
+	"github.com/DenisBochko/yandex_SSO/lib/envelope"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// FilePublisher пишет сообщения строками JSON в файл или stdout - для локальной разработки.
+// Полезная нагрузка известных событий раскодируется из protobuf, чтобы её можно было прочитать.
+type FilePublisher struct {
+	mu     sync.Mutex
+	w      io.Writer
+	closer io.Closer
+}
+
+type fileRecord struct {
+	Time    time.Time         `json:"time"`
+	Topic   string            `json:"topic"`
+	Key     string            `json:"key,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Event   json.RawMessage   `json:"event,omitempty"`
+	Payload []byte            `json:"payload,omitempty"` // base64, если событие не удалось раскодировать
+}
+
+// NewFilePublisher открывает файл для дозаписи. Пустой путь или "-" - stdout.
+func NewFilePublisher(path string) (*FilePublisher, error) {
+	if path == "" || path == "-" {
+		return &FilePublisher{w: os.Stdout}, nil
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open events file: %w", err)
+	}
+
+	return &FilePublisher{w: f, closer: f}, nil
+}
+
+func (p *FilePublisher) Publish(ctx context.Context, message models.OutboxMessage) error {
+	record := fileRecord{
+		Time:    time.Now().UTC(),
+		Topic:   message.Topic,
+		Key:     message.AggregateID,
+		Headers: message.Headers,
+	}
+
+	if event, ok := decodeEvent(message); ok {
+		record.Event = event
+	} else {
+		record.Payload = message.Payload
+	}
+
+	line, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to marshal message: %w", err)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if _, err := p.w.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("failed to write message: %w", err)
+	}
+
+	return nil
+}
+
+// decodeEvent переводит полезную нагрузку в JSON по схеме из заголовка event-type
+func decodeEvent(message models.OutboxMessage) (json.RawMessage, bool) {
+	schema, ok := eventSchemas[message.Headers[envelope.HeaderEventType]]
+	if !ok {
+		return nil, false
+	}
+
+	payload := schema.message.ProtoReflect().New().Interface()
+	if err := proto.Unmarshal(message.Payload, payload); err != nil {
+		return nil, false
+	}
+
+	data, err := protojson.Marshal(payload)
+	if err != nil {
+		return nil, false
+	}
+
+	return data, true
+}
+
+func (p *FilePublisher) Close() error {
+	if p.closer == nil {
+		return nil
+	}
+	return p.closer.Close()
+}
@@ -2,43 +2,198 @@ package adapter
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
+	"time"
+	eventsv1 "github.com/DenisBochko/yandex_SSO/gen/go/events/v1"
 	"github.com/DenisBochko/yandex_SSO/internal/domain/models"
+	"github.com/DenisBochko/yandex_SSO/lib/clientinfo"
+	"github.com/DenisBochko/yandex_SSO/lib/envelope"
 	"github.com/DenisBochko/yandex_SSO/pkg/kafka"
 
-	"github.com/IBM/sarama"
+	"github.com/google/uuid"
 	"go.uber.org/zap"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
+// Publisher доставляет сериализованное сообщение: сразу в Kafka (KafkaPublisher)
+// или через таблицу outbox в транзакции с изменением данных (OutboxPublisher)
+type Publisher interface {
+	Publish(ctx context.Context, message models.OutboxMessage) error
+}
+
+// KafkaAdapter переводит доменные сообщения в события (protobuf и заголовки конверта)
+// и отправляет их через Publisher. Несмотря на имя, брокер может быть любым (см. NewTransport).
 type KafkaAdapter struct {
-	Producer sarama.SyncProducer
-	Topic    string
-	log      *zap.Logger
+	Publisher    Publisher
+	Topic        string
+	AccountTopic string
+	SmsTopic     string
+	SignInTopic  string
+	UserTopic    string
+	ResultsTopic string
+	log          *zap.Logger
 }
 
-func New(log *zap.Logger, producer sarama.SyncProducer, topic string) *KafkaAdapter {
+func New(log *zap.Logger, publisher Publisher, cfg kafka.KafkaConfig) *KafkaAdapter {
 	return &KafkaAdapter{
-		Producer: producer,
-		Topic:    topic,
-		log:      log,
+		Publisher:    publisher,
+		Topic:        cfg.Topic,
+		AccountTopic: cfg.AccountTopic,
+		SmsTopic:     cfg.SmsTopic,
+		SignInTopic:  cfg.SignInTopic,
+		UserTopic:    cfg.UserTopic,
+		ResultsTopic: cfg.CommandResultsTopic,
+		log:          log,
 	}
 }
 
 func (k *KafkaAdapter) SendVerificationUserMessage(ctx context.Context, message models.VerificationUserMessage) error {
-	messageJson, err := json.Marshal(message)
+	return k.send(ctx, k.Topic, EventVerificationRequested, message.UserID, event{}, &eventsv1.VerificationRequested{
+		UserId: message.UserID,
+		Name:   message.Name,
+		Email:  message.Email,
+		Token:  message.Token,
+		Code:   message.Code,
+	})
+}
+
+func (k *KafkaAdapter) SendAccountStatusMessage(ctx context.Context, message models.AccountStatusMessage) error {
+	payload := &eventsv1.AccountStatusChanged{
+		UserId: message.UserID,
+		Status: string(message.Status),
+		Reason: message.Reason,
+	}
+	if message.SuspendedUntil != nil {
+		payload.SuspendedUntil = timestamppb.New(*message.SuspendedUntil)
+	}
+
+	return k.send(ctx, k.AccountTopic, EventAccountStatusChanged, message.UserID, event{}, payload)
+}
+
+func (k *KafkaAdapter) SendSmsMessage(ctx context.Context, message models.SmsMessage) error {
+	return k.send(ctx, k.SmsTopic, EventSmsCodeIssued, message.UserID, event{}, &eventsv1.SmsCodeIssued{
+		UserId:  message.UserID,
+		Phone:   message.Phone,
+		Code:    message.Code,
+		Purpose: message.Purpose,
+	})
+}
+
+func (k *KafkaAdapter) SendNewSignInMessage(ctx context.Context, message models.NewSignInMessage) error {
+	return k.send(ctx, k.SignInTopic, EventNewDeviceSignIn, message.UserID, event{occurredAt: message.SignedInAt}, &eventsv1.NewDeviceSignIn{
+		UserId:      message.UserID,
+		Name:        message.Name,
+		Email:       message.Email,
+		Phone:       message.Phone,
+		Ip:          message.IP,
+		UserAgent:   message.UserAgent,
+		SignedInAt:  timestamppb.New(message.SignedInAt),
+		RevokeToken: message.RevokeToken,
+	})
+}
+
+// SendUserEvent публикует событие жизненного цикла пользователя
+func (k *KafkaAdapter) SendUserEvent(ctx context.Context, e models.UserEvent) error {
+	var payload proto.Message
+
+	switch e.Type {
+	case models.UserEventRegistered:
+		payload = &eventsv1.UserRegistered{UserId: e.UserID, Profile: profile(e.Profile)}
+	case models.UserEventVerified:
+		payload = &eventsv1.UserVerified{UserId: e.UserID}
+	case models.UserEventUpdated:
+		payload = &eventsv1.UserUpdated{UserId: e.UserID, Profile: profile(e.Profile)}
+	case models.UserEventAvatarChanged:
+		payload = &eventsv1.UserAvatarChanged{UserId: e.UserID, AvatarUrl: e.AvatarURL}
+	case models.UserEventDeleted:
+		payload = &eventsv1.UserDeleted{UserId: e.UserID}
+	case models.UserEventLoggedIn:
+		payload = &eventsv1.UserLoggedIn{UserId: e.UserID, Method: e.Method, Ip: e.IP}
+	default:
+		return fmt.Errorf("unknown user event type %q", e.Type)
+	}
+
+	return k.send(ctx, k.UserTopic, string(e.Type), e.UserID, event{id: e.ID, occurredAt: e.OccurredAt}, payload)
+}
+
+// SendAccountCommandResult публикует итог входящей команды. Ключ - id пользователя,
+// чтобы результаты команд над одной учётной записью читались по порядку.
+func (k *KafkaAdapter) SendAccountCommandResult(ctx context.Context, result models.AccountCommandResult) error {
+	return k.send(ctx, k.ResultsTopic, EventAccountCommandResult, result.UserID, event{occurredAt: result.CreatedAt}, &eventsv1.AccountCommandResult{
+		CommandId:   result.CommandID,
+		Command:     string(result.Command),
+		UserId:      result.UserID,
+		Status:      string(result.Status),
+		Error:       result.Error,
+		Changed:     result.Changed,
+		RequestedBy: result.RequestedBy,
+	})
+}
+
+func profile(p *models.UserProfile) *eventsv1.UserProfile {
+	if p == nil {
+		return nil
+	}
+
+	return &eventsv1.UserProfile{
+		Name:          p.Name,
+		Email:         p.Email,
+		Username:      p.Username,
+		Phone:         p.Phone,
+		Verified:      p.Verified,
+		PhoneVerified: p.PhoneVerified,
+		Avatar:        p.Avatar,
+	}
+}
 
+// event - метаданные, которые может задать вызывающий; пустые заполняются в send
+type event struct {
+	id         string
+	occurredAt time.Time
+}
+
+// send сериализует полезную нагрузку в protobuf, собирает заголовки конверта (lib/envelope)
+// и передаёт сообщение Publisher'у. key - ключ сообщения в Kafka.
+func (k *KafkaAdapter) send(ctx context.Context, topic string, eventType string, key string, meta event, payload proto.Message) error {
+	schema, ok := eventSchemas[eventType]
+	if !ok || schema.message.ProtoReflect().Descriptor() != payload.ProtoReflect().Descriptor() {
+		return fmt.Errorf("no schema for event %q with payload %s", eventType, payload.ProtoReflect().Descriptor().FullName())
+	}
+
+	data, err := proto.Marshal(payload)
 	if err != nil {
 		return fmt.Errorf("failed to marshal message: %w", err)
 	}
 
-	msg := kafka.PrepareMessage(k.Topic, messageJson)
-	partition, offset, err := k.Producer.SendMessage(msg)
+	if meta.id == "" {
+		meta.id = uuid.New().String()
+	}
+	if meta.occurredAt.IsZero() {
+		meta.occurredAt = time.Now()
+	}
+
+	headers := envelope.Envelope{
+		ID:            meta.id,
+		Type:          eventType,
+		SchemaVersion: schema.version,
+		OccurredAt:    meta.occurredAt,
+		TraceID:       clientinfo.FromContext(ctx).TraceID,
+		Producer:      producer,
+		ContentType:   envelope.ContentTypeProtobuf,
+	}.Headers()
+
+	err = k.Publisher.Publish(ctx, models.OutboxMessage{
+		AggregateID: key,
+		Topic:       topic,
+		Kind:        eventType,
+		Headers:     headers,
+		Payload:     data,
+	})
 	if err != nil {
-		k.log.Info("failed to send message", zap.Error(err))
+		k.log.Info("failed to send message", zap.String("message", eventType), zap.Error(err))
 		return fmt.Errorf("failed to send message: %w", err)
 	}
-	k.log.Info("VerificationUserMessage sent to kafka", zap.String("topic", k.Topic), zap.Int32("partition", partition), zap.Int64("offset", offset))
 
 	return nil
 }
@@ -0,0 +1,232 @@
+package adapter
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+
+	"github.com/DenisBochko/yandex_SSO/internal/domain/models"
+	"github.com/DenisBochko/yandex_SSO/pkg/kafka"
+	"github.com/DenisBochko/yandex_SSO/pkg/metrics"
+
+	"github.com/IBM/sarama"
+	"go.uber.org/zap"
+)
+
+var (
+	asyncDeliveryErrorsTotal = metrics.NewCounter("kafka_async_delivery_errors_total")
+	asyncLostTotal           = metrics.NewCounter("kafka_async_lost_total")
+)
+
+// KafkaPublisher отправляет сообщение в Kafka. В топики из KAFKA_ASYNC_TOPICS сообщения
+// уходят через асинхронный продюсер пачками, в остальные - синхронно с ожиданием подтверждения.
+// Продюсеры создаются при первой отправке и пересоздаются после неудачи,
+// поэтому недоступный брокер не мешает запуску сервиса.
+//
+// Асинхронная отправка не возвращает ошибку доставки. Сообщение, которое продюсер не смог
+// доставить после всех повторов, передаётся undelivered (обычно в outbox, откуда его повторит relay),
+// а если его нет - только пишется в лог. Порядок сообщений при этом не сохраняется.
+type KafkaPublisher struct {
+	cfg         kafka.KafkaConfig
+	log         *zap.Logger
+	async       map[string]bool
+	undelivered Publisher
+
+	topicsMu    sync.Mutex
+	topicsReady bool
+
+	mu       sync.Mutex
+	producer sarama.SyncProducer
+
+	asyncMu       sync.Mutex
+	asyncProducer sarama.AsyncProducer
+	drained       chan struct{} // закрывается, когда прочитаны все ошибки асинхронного продюсера
+
+	newSyncProducer  func() (sarama.SyncProducer, error)
+	newAsyncProducer func() (sarama.AsyncProducer, error)
+}
+
+// NewKafkaPublisher создаёт publisher. undelivered может быть nil.
+func NewKafkaPublisher(log *zap.Logger, cfg kafka.KafkaConfig, undelivered Publisher) *KafkaPublisher {
+	p := &KafkaPublisher{
+		cfg:         cfg,
+		log:         log,
+		async:       make(map[string]bool, len(cfg.AsyncTopics)),
+		undelivered: undelivered,
+	}
+	for _, topic := range cfg.AsyncTopics {
+		p.async[topic] = true
+	}
+
+	p.newSyncProducer = func() (sarama.SyncProducer, error) {
+		return kafka.NewSyncProducer(context.Background(), log, cfg)
+	}
+	p.newAsyncProducer = func() (sarama.AsyncProducer, error) {
+		return kafka.NewAsyncProducer(context.Background(), log, cfg)
+	}
+
+	return p
+}
+
+func (p *KafkaPublisher) Publish(ctx context.Context, message models.OutboxMessage) error {
+	msg := kafka.PrepareMessage(message.Topic, message.Payload)
+	if message.AggregateID != "" {
+		msg.Key = sarama.StringEncoder(message.AggregateID)
+	}
+	for _, name := range slices.Sorted(maps.Keys(message.Headers)) {
+		msg.Headers = append(msg.Headers, sarama.RecordHeader{Key: []byte(name), Value: []byte(message.Headers[name])})
+	}
+
+	if p.async[message.Topic] {
+		return p.publishAsync(ctx, message, msg)
+	}
+
+	producer, err := p.getProducer()
+	if err != nil {
+		return fmt.Errorf("failed to connect to kafka: %w", err)
+	}
+
+	partition, offset, err := producer.SendMessage(msg)
+	if err != nil {
+		return fmt.Errorf("failed to send message to kafka: %w", err)
+	}
+	p.log.Info(message.Kind+" sent to kafka", zap.String("topic", message.Topic), zap.Int32("partition", partition), zap.Int64("offset", offset))
+
+	return nil
+}
+
+// publishAsync ставит сообщение в очередь продюсера. Если очередь заполнена,
+// ждёт, пока освободится место или отменят контекст.
+func (p *KafkaPublisher) publishAsync(ctx context.Context, message models.OutboxMessage, msg *sarama.ProducerMessage) error {
+	msg.Metadata = message
+
+	// блокировка держится и на время ожидания места в очереди, чтобы Close
+	// не закрыл продюсер посреди отправки. Синхронные отправки она не задерживает
+	p.asyncMu.Lock()
+	defer p.asyncMu.Unlock()
+
+	producer, err := p.getAsyncProducerLocked()
+	if err != nil {
+		return fmt.Errorf("failed to connect to kafka: %w", err)
+	}
+
+	select {
+	case producer.Input() <- msg:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("failed to queue message for kafka: %w", ctx.Err())
+	}
+}
+
+// drain читает ошибки асинхронного продюсера, пока он не закрыт
+func (p *KafkaPublisher) drain(producer sarama.AsyncProducer, done chan struct{}) {
+	defer close(done)
+
+	for perr := range producer.Errors() {
+		asyncDeliveryErrorsTotal.Add(1)
+
+		message, ok := perr.Msg.Metadata.(models.OutboxMessage)
+		if !ok {
+			asyncLostTotal.Add(1)
+			p.log.Error("failed to deliver message to kafka", zap.String("topic", perr.Msg.Topic), zap.Error(perr.Err))
+			continue
+		}
+
+		log := p.log.With(zap.String("topic", message.Topic), zap.String("message", message.Kind), zap.Error(perr.Err))
+		if p.undelivered == nil {
+			asyncLostTotal.Add(1)
+			log.Error("failed to deliver message to kafka, message is lost")
+			continue
+		}
+
+		if err := p.undelivered.Publish(context.Background(), message); err != nil {
+			asyncLostTotal.Add(1)
+			log.Error("failed to deliver message to kafka and to save it for retry, message is lost", zap.NamedError("saveError", err))
+			continue
+		}
+		log.Warn("failed to deliver message to kafka, saved for retry")
+	}
+}
+
+func (p *KafkaPublisher) ensureTopics() error {
+	p.topicsMu.Lock()
+	defer p.topicsMu.Unlock()
+
+	if p.topicsReady {
+		return nil
+	}
+
+	if err := kafka.EnsureTopics(p.log, p.cfg); err != nil {
+		return err
+	}
+	p.topicsReady = true
+
+	return nil
+}
+
+func (p *KafkaPublisher) getProducer() (sarama.SyncProducer, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.producer != nil {
+		return p.producer, nil
+	}
+
+	if err := p.ensureTopics(); err != nil {
+		return nil, err
+	}
+
+	producer, err := p.newSyncProducer()
+	if err != nil {
+		return nil, err
+	}
+	p.producer = producer
+
+	return producer, nil
+}
+
+func (p *KafkaPublisher) getAsyncProducerLocked() (sarama.AsyncProducer, error) {
+	if p.asyncProducer != nil {
+		return p.asyncProducer, nil
+	}
+
+	if err := p.ensureTopics(); err != nil {
+		return nil, err
+	}
+
+	producer, err := p.newAsyncProducer()
+	if err != nil {
+		return nil, err
+	}
+	p.asyncProducer = producer
+	p.drained = make(chan struct{})
+	go p.drain(producer, p.drained)
+
+	return producer, nil
+}
+
+// Close отправляет накопленные пачки и закрывает продюсеры
+func (p *KafkaPublisher) Close() error {
+	p.asyncMu.Lock()
+	defer p.asyncMu.Unlock()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var err error
+
+	if p.asyncProducer != nil {
+		// ошибки последних пачек ещё обрабатываются в drain
+		p.asyncProducer.AsyncClose()
+		<-p.drained
+		p.asyncProducer = nil
+	}
+
+	if p.producer != nil {
+		err = p.producer.Close()
+		p.producer = nil
+	}
+
+	return err
+}
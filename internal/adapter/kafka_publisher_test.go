@@ -0,0 +1,46 @@
+package adapter
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/DenisBochko/yandex_SSO/internal/domain/models"
+	"github.com/DenisBochko/yandex_SSO/pkg/kafka"
+
+	"github.com/IBM/sarama"
+	"github.com/IBM/sarama/mocks"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestKafkaPublisherRoutesAsyncTopics(t *testing.T) {
+	undelivered := NewMemoryPublisher(0)
+	publisher := NewKafkaPublisher(zap.NewNop(), kafka.KafkaConfig{AsyncTopics: []string{"user-events"}}, undelivered)
+
+	syncProducer := mocks.NewSyncProducer(t, nil)
+	syncProducer.ExpectSendMessageAndSucceed()
+	publisher.newSyncProducer = func() (sarama.SyncProducer, error) { return syncProducer, nil }
+
+	asyncProducer := mocks.NewAsyncProducer(t, nil)
+	asyncProducer.ExpectInputAndSucceed()
+	asyncProducer.ExpectInputAndFail(errors.New("leader not available"))
+	publisher.newAsyncProducer = func() (sarama.AsyncProducer, error) { return asyncProducer, nil }
+
+	ctx := context.Background()
+	require.NoError(t, publisher.Publish(ctx, models.OutboxMessage{Topic: "account-status", Kind: "account.status_changed", Payload: []byte("1")}))
+	require.NoError(t, publisher.Publish(ctx, models.OutboxMessage{Topic: "user-events", Kind: "user.logged_in", Payload: []byte("2")}))
+
+	failed := models.OutboxMessage{
+		AggregateID: "u1",
+		Topic:       "user-events",
+		Kind:        "user.logged_in",
+		Headers:     map[string]string{"event-id": "e3"},
+		Payload:     []byte("3"),
+	}
+	require.NoError(t, publisher.Publish(ctx, failed))
+
+	// Close дожидается обработки ошибок последних пачек
+	require.NoError(t, publisher.Close())
+	require.Equal(t, []models.OutboxMessage{failed}, undelivered.Messages("user-events"))
+}
@@ -0,0 +1,236 @@
+package adapter
+
+import (
+	"context"
+	"embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/DenisBochko/yandex_SSO/internal/config"
+	"github.com/DenisBochko/yandex_SSO/internal/domain/models"
+	"github.com/DenisBochko/yandex_SSO/lib/clientinfo"
+	"github.com/DenisBochko/yandex_SSO/lib/mailtemplate"
+	"github.com/DenisBochko/yandex_SSO/pkg/smtp"
+
+	"go.uber.org/zap"
+)
+
+// Встроенные шаблоны писем: mailtemplates/<язык>/<имя>.txt и .html
+//
+//go:embed mailtemplates
+var builtinMailTemplates embed.FS
+
+// Имена шаблонов писем
+const (
+	MailVerification = "verification"
+	MailNewDevice    = "new_device"
+)
+
+// MailTopic - тема сообщений outbox с готовыми письмами. В брокер они не попадают:
+// их отправляет MailPublisher
+const MailTopic = "smtp"
+
+type Mailer interface {
+	Send(ctx context.Context, msg smtp.Message) error
+}
+
+// LoadMailTemplates загружает шаблоны из mail.templates_dir или встроенные
+func LoadMailTemplates(cfg config.MailConfig) (*mailtemplate.Set, error) {
+	var fsys fs.FS
+	if cfg.TemplatesDir != "" {
+		fsys = os.DirFS(cfg.TemplatesDir)
+	} else {
+		sub, err := fs.Sub(builtinMailTemplates, "mailtemplates")
+		if err != nil {
+			return nil, err
+		}
+		fsys = sub
+	}
+
+	set, err := mailtemplate.Load(fsys, cfg.DefaultLocale)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, name := range []string{MailVerification, MailNewDevice} {
+		if !set.Has(name) {
+			return nil, fmt.Errorf("%w: %s", mailtemplate.ErrUnknownTemplate, name)
+		}
+	}
+
+	return set, nil
+}
+
+// MailTransport сам отправляет письма по SMTP - для установок без внешнего почтового сервиса,
+// читающего топик register. Подходит вместо KafkaAdapter для сервиса аутентификации:
+// письма о подтверждении email и о входе с нового устройства уходят напрямую,
+// остальные сообщения (SMS, события пользователей) передаются в next.
+//
+// Письмо собирается сразу, а отправляется позже: оно сохраняется в outbox через queue
+// (в транзакции вызова, если она есть), и relay передаёт его в MailPublisher. Так SMTP
+// не задерживает транзакцию, а письмо не уходит, если транзакция откатилась.
+//
+// Язык письма выбирается по Accept-Language запроса (lib/clientinfo).
+type MailTransport struct {
+	log       *zap.Logger
+	templates *mailtemplate.Set
+	cfg       *config.MailConfig
+	queue     Publisher
+	next      *KafkaAdapter
+}
+
+func NewMailTransport(log *zap.Logger, templates *mailtemplate.Set, cfg *config.MailConfig, queue Publisher, next *KafkaAdapter) *MailTransport {
+	return &MailTransport{
+		log:       log.With(zap.String("component", "mail")),
+		templates: templates,
+		cfg:       cfg,
+		queue:     queue,
+		next:      next,
+	}
+}
+
+type verificationMail struct {
+	Product string
+	Name    string
+	Link    string // пустая в режиме только кодов
+	Code    string // пустой в режиме только ссылок
+}
+
+func (m *MailTransport) SendVerificationUserMessage(ctx context.Context, message models.VerificationUserMessage) error {
+	data := verificationMail{
+		Product: m.cfg.ProductName,
+		Name:    message.Name,
+		Code:    message.Code,
+	}
+	if message.Token != "" {
+		data.Link = withToken(m.cfg.VerifyURL, message.Token)
+	}
+
+	return m.send(ctx, MailVerification, message.UserID, message.Email, data)
+}
+
+type newDeviceMail struct {
+	Product    string
+	Name       string
+	Time       string
+	IP         string
+	UserAgent  string
+	RevokeLink string
+}
+
+// SendNewSignInMessage отправляет письмо о входе с нового устройства.
+// Пользователю без email уведомление уходит в next - его доставит SMS-шлюз.
+func (m *MailTransport) SendNewSignInMessage(ctx context.Context, message models.NewSignInMessage) error {
+	if message.Email == "" {
+		return m.next.SendNewSignInMessage(ctx, message)
+	}
+
+	return m.send(ctx, MailNewDevice, message.UserID, message.Email, newDeviceMail{
+		Product:    m.cfg.ProductName,
+		Name:       message.Name,
+		Time:       message.SignedInAt.UTC().Format(time.RFC1123),
+		IP:         message.IP,
+		UserAgent:  message.UserAgent,
+		RevokeLink: withToken(m.cfg.RevokeURL, message.RevokeToken),
+	})
+}
+
+func (m *MailTransport) SendSmsMessage(ctx context.Context, message models.SmsMessage) error {
+	return m.next.SendSmsMessage(ctx, message)
+}
+
+func (m *MailTransport) SendUserEvent(ctx context.Context, event models.UserEvent) error {
+	return m.next.SendUserEvent(ctx, event)
+}
+
+// send собирает письмо и ставит его в очередь outbox. Письма одного пользователя уходят по порядку,
+// но отдельно от его событий: недоступный SMTP не задерживает события в брокер
+func (m *MailTransport) send(ctx context.Context, template string, userID string, to string, data any) error {
+	mail, err := m.templates.Render(template, clientinfo.FromContext(ctx).AcceptLanguage, data)
+	if err != nil {
+		return err
+	}
+
+	payload, err := json.Marshal(smtp.Message{
+		To:      to,
+		Subject: mail.Subject,
+		Text:    mail.Text,
+		HTML:    mail.HTML,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal mail: %w", err)
+	}
+
+	err = m.queue.Publish(ctx, models.OutboxMessage{
+		AggregateID: "mail:" + userID,
+		Topic:       MailTopic,
+		Kind:        template,
+		Payload:     payload,
+	})
+	if err != nil {
+		m.log.Info("failed to queue mail", zap.String("template", template), zap.String("locale", mail.Locale), zap.Error(err))
+		return fmt.Errorf("failed to queue mail: %w", err)
+	}
+
+	return nil
+}
+
+// MailPublisher отправляет по SMTP письма, которые MailTransport поставил в outbox,
+// остальные сообщения передаёт в next. Используется как publisher relay (internal/app/outbox).
+type MailPublisher struct {
+	log    *zap.Logger
+	mailer Mailer
+	next   Publisher
+}
+
+func NewMailPublisher(log *zap.Logger, mailer Mailer, next Publisher) *MailPublisher {
+	return &MailPublisher{
+		log:    log.With(zap.String("component", "mail")),
+		mailer: mailer,
+		next:   next,
+	}
+}
+
+// Publish возвращает ошибку только при временном сбое - relay повторит отправку.
+// Письмо, от которого сервер отказался насовсем (5xx), или повреждённое сообщение
+// записывается в лог и больше не отправляется.
+func (p *MailPublisher) Publish(ctx context.Context, message models.OutboxMessage) error {
+	if message.Topic != MailTopic {
+		return p.next.Publish(ctx, message)
+	}
+
+	var msg smtp.Message
+	if err := json.Unmarshal(message.Payload, &msg); err != nil {
+		p.log.Error("dropping malformed mail", zap.Int64("id", message.ID), zap.Error(err))
+		return nil
+	}
+
+	if err := p.mailer.Send(ctx, msg); err != nil {
+		if errors.Is(err, smtp.ErrPermanent) {
+			p.log.Warn("mail rejected", zap.Int64("id", message.ID), zap.String("template", message.Kind), zap.Error(err))
+			return nil
+		}
+		return fmt.Errorf("failed to send mail: %w", err)
+	}
+
+	return nil
+}
+
+// withToken добавляет токен в параметры ссылки
+func withToken(base string, token string) string {
+	u, err := url.Parse(base)
+	if err != nil {
+		return base + "?token=" + url.QueryEscape(token)
+	}
+
+	q := u.Query()
+	q.Set("token", token)
+	u.RawQuery = q.Encode()
+
+	return u.String()
+}
@@ -0,0 +1,325 @@
+package adapter
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/DenisBochko/yandex_SSO/internal/config"
+	"github.com/DenisBochko/yandex_SSO/internal/domain/models"
+	"github.com/DenisBochko/yandex_SSO/pkg/kafka"
+	"github.com/DenisBochko/yandex_SSO/pkg/smtp"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"google.golang.org/grpc/metadata"
+)
+
+// smtpSink - локальная SMTP-ловушка: принимает письма и складывает их в память.
+// failures - сколько первых соединений отклонить с временной ошибкой 421.
+type smtpSink struct {
+	ln       net.Listener
+	mu       sync.Mutex
+	messages []string
+	failures int
+	rejectTo string // адрес, на который ответить постоянной ошибкой 550
+	conns    int
+}
+
+func newSmtpSink(t *testing.T, failures int, rejectTo string) *smtpSink {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { ln.Close() })
+
+	s := &smtpSink{ln: ln, failures: failures, rejectTo: rejectTo}
+	go s.serve()
+	return s
+}
+
+func (s *smtpSink) port() int {
+	return s.ln.Addr().(*net.TCPAddr).Port
+}
+
+func (s *smtpSink) serve() {
+	for {
+		conn, err := s.ln.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *smtpSink) handle(conn net.Conn) {
+	defer conn.Close()
+
+	s.mu.Lock()
+	s.conns++
+	fail := s.conns <= s.failures
+	s.mu.Unlock()
+
+	if fail {
+		io.WriteString(conn, "421 try again later\r\n")
+		return
+	}
+
+	r := bufio.NewReader(conn)
+	reply := func(line string) { io.WriteString(conn, line+"\r\n") }
+	reply("220 sink ESMTP")
+
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		cmd := strings.ToUpper(strings.TrimSpace(line))
+
+		switch {
+		case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+			reply("250 sink")
+		case strings.HasPrefix(cmd, "MAIL FROM"):
+			reply("250 ok")
+		case strings.HasPrefix(cmd, "RCPT TO"):
+			if s.rejectTo != "" && strings.Contains(cmd, strings.ToUpper(s.rejectTo)) {
+				reply("550 no such user")
+				continue
+			}
+			reply("250 ok")
+		case cmd == "DATA":
+			reply("354 go ahead")
+			var data strings.Builder
+			for {
+				l, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if l == ".\r\n" {
+					break
+				}
+				data.WriteString(strings.TrimPrefix(l, "."))
+			}
+			s.mu.Lock()
+			s.messages = append(s.messages, data.String())
+			s.mu.Unlock()
+			reply("250 queued")
+		case cmd == "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("250 ok")
+		}
+	}
+}
+
+func (s *smtpSink) connections() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.conns
+}
+
+func (s *smtpSink) received() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.messages...)
+}
+
+type parsedMail struct {
+	to, subject, text, html string
+}
+
+func parseMail(t *testing.T, raw string) parsedMail {
+	t.Helper()
+
+	msg, err := mail.ReadMessage(strings.NewReader(raw))
+	require.NoError(t, err)
+
+	subject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	require.NoError(t, err)
+
+	_, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	require.NoError(t, err)
+
+	parsed := parsedMail{to: msg.Header.Get("To"), subject: subject}
+
+	mr := multipart.NewReader(msg.Body, params["boundary"])
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+
+		body, err := io.ReadAll(part)
+		require.NoError(t, err)
+
+		if strings.HasPrefix(part.Header.Get("Content-Type"), "text/html") {
+			parsed.html = string(body)
+		} else {
+			parsed.text = string(body)
+		}
+	}
+
+	return parsed
+}
+
+func testKafkaConfig() kafka.KafkaConfig {
+	return kafka.KafkaConfig{Topic: "register", SmsTopic: "sms", SignInTopic: "new-sign-in", UserTopic: "user-events"}
+}
+
+// testMail - MailTransport с очередью в памяти вместо outbox и MailPublisher, отправляющий её в sink
+type testMail struct {
+	*MailTransport
+	queue     *MemoryPublisher
+	publisher *MailPublisher
+}
+
+func newTestMailTransport(t *testing.T, sink *smtpSink) *testMail {
+	t.Helper()
+
+	client, err := smtp.New(smtp.SmtpConfig{
+		Host:         "127.0.0.1",
+		Port:         sink.port(),
+		From:         "SSO <no-reply@example.com>",
+		TLS:          smtp.TLSNone,
+		Timeout:      time.Second,
+		Retries:      2,
+		RetryBackoff: 10 * time.Millisecond,
+	})
+	require.NoError(t, err)
+
+	cfg := &config.MailConfig{
+		DefaultLocale: "en",
+		ProductName:   "Acme",
+		VerifyURL:     "https://acme.test/verify",
+		RevokeURL:     "https://acme.test/revoke?src=mail",
+	}
+
+	templates, err := LoadMailTemplates(*cfg)
+	require.NoError(t, err)
+
+	queue := NewMemoryPublisher(100)
+	next := New(zap.NewNop(), NewMemoryPublisher(100), testKafkaConfig())
+	return &testMail{
+		MailTransport: NewMailTransport(zap.NewNop(), templates, cfg, queue, next),
+		queue:         queue,
+		publisher:     NewMailPublisher(zap.NewNop(), client, next.Publisher),
+	}
+}
+
+// flush отправляет письма из очереди, как relay outbox
+func (m *testMail) flush(t *testing.T) {
+	t.Helper()
+
+	for _, message := range m.queue.Messages(MailTopic) {
+		require.NoError(t, m.publisher.Publish(context.Background(), message))
+	}
+	m.queue.Reset()
+}
+
+func TestMailTransportVerification(t *testing.T) {
+	sink := newSmtpSink(t, 0, "")
+	transport := newTestMailTransport(t, sink)
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("accept-language", "ru-RU,ru;q=0.9"))
+	err := transport.SendVerificationUserMessage(ctx, models.VerificationUserMessage{
+		UserID: "u1", Name: "Анна", Email: "anna@example.com", Token: "tok/1", Code: "123456",
+	})
+	require.NoError(t, err)
+
+	// письмо только поставлено в очередь: SMTP вызывается relay, вне транзакции вызова
+	require.Empty(t, sink.received())
+	queued := transport.queue.Messages(MailTopic)
+	require.Len(t, queued, 1)
+	require.Equal(t, "mail:u1", queued[0].AggregateID)
+	require.Equal(t, MailVerification, queued[0].Kind)
+
+	transport.flush(t)
+
+	messages := sink.received()
+	require.Len(t, messages, 1)
+
+	m := parseMail(t, messages[0])
+	require.Equal(t, "<anna@example.com>", m.to)
+	require.Equal(t, "Подтвердите email для Acme", m.subject)
+	require.Contains(t, m.text, "https://acme.test/verify?token=tok%2F1")
+	require.Contains(t, m.text, "Код подтверждения: 123456")
+	require.Contains(t, m.html, `href="https://acme.test/verify?token=tok%2F1"`)
+}
+
+func TestMailTransportNewDeviceDefaultLocale(t *testing.T) {
+	sink := newSmtpSink(t, 0, "")
+	transport := newTestMailTransport(t, sink)
+
+	err := transport.SendNewSignInMessage(context.Background(), models.NewSignInMessage{
+		UserID: "u1", Name: "<Ann>", Email: "ann@example.com", IP: "203.0.113.7", UserAgent: "Firefox",
+		SignedInAt: time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC), RevokeToken: "rt",
+	})
+	require.NoError(t, err)
+	transport.flush(t)
+
+	messages := sink.received()
+	require.Len(t, messages, 1)
+
+	m := parseMail(t, messages[0])
+	require.Equal(t, "New sign-in to your Acme account", m.subject)
+	require.Contains(t, m.text, "https://acme.test/revoke?src=mail&token=rt")
+	require.Contains(t, m.html, "Hi &lt;Ann&gt;,")
+}
+
+func TestMailPublisherRetries(t *testing.T) {
+	sink := newSmtpSink(t, 2, "bounce@example.com")
+	transport := newTestMailTransport(t, sink)
+
+	err := transport.SendVerificationUserMessage(context.Background(), models.VerificationUserMessage{Name: "Ann", Email: "ann@example.com", Code: "1"})
+	require.NoError(t, err)
+	transport.flush(t)
+	require.Len(t, sink.received(), 1)
+
+	// постоянный отказ не повторяется и не возвращается relay: иначе письмо отправлялось бы вечно
+	err = transport.SendVerificationUserMessage(context.Background(), models.VerificationUserMessage{Name: "Ann", Email: "bounce@example.com", Code: "1"})
+	require.NoError(t, err)
+	transport.flush(t)
+	require.Len(t, sink.received(), 1)
+	require.Equal(t, 4, sink.connections())
+}
+
+func TestMailPublisherTemporaryFailure(t *testing.T) {
+	sink := newSmtpSink(t, 3, "")
+	transport := newTestMailTransport(t, sink)
+
+	err := transport.SendVerificationUserMessage(context.Background(), models.VerificationUserMessage{Name: "Ann", Email: "ann@example.com", Code: "1"})
+	require.NoError(t, err)
+
+	// временный сбой возвращается, и relay повторит отправку позже
+	err = transport.publisher.Publish(context.Background(), transport.queue.Messages(MailTopic)[0])
+	require.Error(t, err)
+	require.Empty(t, sink.received())
+}
+
+func TestMailPublisherPassesOtherTopics(t *testing.T) {
+	sink := newSmtpSink(t, 0, "")
+	transport := newTestMailTransport(t, sink)
+
+	err := transport.publisher.Publish(context.Background(), models.OutboxMessage{Topic: "user-events", Payload: []byte("event")})
+	require.NoError(t, err)
+	require.Empty(t, sink.received())
+	require.Len(t, transport.next.Publisher.(*MemoryPublisher).Messages("user-events"), 1)
+}
+
+func TestMailTransportPhoneOnlyUserGoesToNext(t *testing.T) {
+	sink := newSmtpSink(t, 0, "")
+	transport := newTestMailTransport(t, sink)
+
+	err := transport.SendNewSignInMessage(context.Background(), models.NewSignInMessage{UserID: "u1", Phone: "+79990000000", RevokeToken: "rt"})
+	require.NoError(t, err)
+	require.Empty(t, transport.queue.Messages(MailTopic))
+	require.Len(t, transport.next.Publisher.(*MemoryPublisher).Messages(testKafkaConfig().SignInTopic), 1)
+}
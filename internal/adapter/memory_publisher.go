@@ -0,0 +1,59 @@
+package adapter
+
+import (
+	"context"
+	"sync"
+
+	"github.com/DenisBochko/yandex_SSO/internal/domain/models"
+)
+
+// MemoryPublisher складывает сообщения в память. Нужен для тестов и запуска одного экземпляра
+// без брокера. Хранит не больше limit последних сообщений.
+type MemoryPublisher struct {
+	mu       sync.Mutex
+	messages []models.OutboxMessage
+	limit    int
+}
+
+func NewMemoryPublisher(limit int) *MemoryPublisher {
+	return &MemoryPublisher{limit: limit}
+}
+
+func (p *MemoryPublisher) Publish(ctx context.Context, message models.OutboxMessage) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.messages = append(p.messages, message)
+	if p.limit > 0 && len(p.messages) > p.limit {
+		p.messages = append([]models.OutboxMessage(nil), p.messages[len(p.messages)-p.limit:]...)
+	}
+
+	return nil
+}
+
+// Messages возвращает сообщения топика в порядке отправки, пустой topic - все сообщения
+func (p *MemoryPublisher) Messages(topic string) []models.OutboxMessage {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var messages []models.OutboxMessage
+	for _, m := range p.messages {
+		if topic == "" || m.Topic == topic {
+			messages = append(messages, m)
+		}
+	}
+
+	return messages
+}
+
+// Reset удаляет все сообщения
+func (p *MemoryPublisher) Reset() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.messages = nil
+}
+
+func (p *MemoryPublisher) Close() error {
+	return nil
+}
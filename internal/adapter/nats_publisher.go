@@ -0,0 +1,47 @@
+package adapter
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/DenisBochko/yandex_SSO/internal/domain/models"
+	"github.com/DenisBochko/yandex_SSO/pkg/nats"
+)
+
+// headerKey - заголовок с ключом сообщения: в NATS нет ключей, как в Kafka
+const headerKey = "key"
+
+// NatsPublisher публикует сообщения в NATS. Subject - имя топика с префиксом из конфига.
+type NatsPublisher struct {
+	conn   *nats.Conn
+	prefix string
+}
+
+func NewNatsPublisher(cfg nats.NatsConfig) (*NatsPublisher, error) {
+	conn, err := nats.New(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return &NatsPublisher{conn: conn, prefix: cfg.SubjectPrefix}, nil
+}
+
+func (p *NatsPublisher) Publish(ctx context.Context, message models.OutboxMessage) error {
+	headers := make(map[string]string, len(message.Headers)+1)
+	for name, value := range message.Headers {
+		headers[name] = value
+	}
+	if message.AggregateID != "" {
+		headers[headerKey] = message.AggregateID
+	}
+
+	if err := p.conn.Publish(ctx, p.prefix+message.Topic, headers, message.Payload); err != nil {
+		return fmt.Errorf("failed to publish message to nats: %w", err)
+	}
+
+	return nil
+}
+
+func (p *NatsPublisher) Close() error {
+	return p.conn.Close()
+}
@@ -0,0 +1,25 @@
+package adapter
+
+import (
+	"context"
+
+	"github.com/DenisBochko/yandex_SSO/internal/domain/models"
+)
+
+type OutboxStorage interface {
+	SaveOutboxMessage(ctx context.Context, message models.OutboxMessage) error
+}
+
+// OutboxPublisher сохраняет сообщение в таблицу outbox. Если контекст несёт транзакцию (Storage.InTx),
+// сообщение фиксируется вместе с изменением данных, а в Kafka его доставит relay (internal/app/outbox).
+type OutboxPublisher struct {
+	storage OutboxStorage
+}
+
+func NewOutboxPublisher(storage OutboxStorage) *OutboxPublisher {
+	return &OutboxPublisher{storage: storage}
+}
+
+func (p *OutboxPublisher) Publish(ctx context.Context, message models.OutboxMessage) error {
+	return p.storage.SaveOutboxMessage(ctx, message)
+}
@@ -0,0 +1,61 @@
+package adapter
+
+import (
+	"sort"
+
+	eventsv1 "github.com/DenisBochko/yandex_SSO/gen/go/events/v1"
+	"github.com/DenisBochko/yandex_SSO/internal/domain/models"
+	"github.com/DenisBochko/yandex_SSO/lib/schemaregistry"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// Типы служебных сообщений. Типы событий пользователя - models.UserEventType.
+const (
+	EventVerificationRequested = "verification.requested"
+	EventAccountStatusChanged  = "account.status_changed"
+	EventSmsCodeIssued         = "sms.code_issued"
+	EventNewDeviceSignIn       = "signin.new_device"
+	EventAccountCommandResult  = "account.command_result"
+)
+
+// producer - значение заголовка producer у всех событий сервиса
+const producer = "sso"
+
+type eventSchema struct {
+	version int
+	message proto.Message
+}
+
+// eventSchemas - текущая версия схемы для каждого типа события.
+// Любое изменение сообщения в proto/events требует новой версии здесь и её регистрации
+// в каталоге schemas/ (go run ./cmd/schemas), иначе сервис не запустится.
+var eventSchemas = map[string]eventSchema{
+	EventVerificationRequested:            {1, &eventsv1.VerificationRequested{}},
+	EventAccountStatusChanged:             {1, &eventsv1.AccountStatusChanged{}},
+	EventSmsCodeIssued:                    {1, &eventsv1.SmsCodeIssued{}},
+	EventNewDeviceSignIn:                  {1, &eventsv1.NewDeviceSignIn{}},
+	EventAccountCommandResult:             {1, &eventsv1.AccountCommandResult{}},
+	string(models.UserEventRegistered):    {1, &eventsv1.UserRegistered{}},
+	string(models.UserEventVerified):      {1, &eventsv1.UserVerified{}},
+	string(models.UserEventUpdated):       {1, &eventsv1.UserUpdated{}},
+	string(models.UserEventAvatarChanged): {1, &eventsv1.UserAvatarChanged{}},
+	string(models.UserEventDeleted):       {1, &eventsv1.UserDeleted{}},
+	string(models.UserEventLoggedIn):      {1, &eventsv1.UserLoggedIn{}},
+}
+
+// Schemas возвращает схемы всех событий, которые публикует сервис, для сверки с реестром
+func Schemas() []schemaregistry.Schema {
+	schemas := make([]schemaregistry.Schema, 0, len(eventSchemas))
+	for eventType, s := range eventSchemas {
+		schemas = append(schemas, schemaregistry.Schema{
+			Subject: eventType,
+			Version: s.version,
+			Message: s.message.ProtoReflect().Descriptor(),
+		})
+	}
+
+	sort.Slice(schemas, func(i, j int) bool { return schemas[i].Subject < schemas[j].Subject })
+
+	return schemas
+}
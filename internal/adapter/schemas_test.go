@@ -0,0 +1,34 @@
+package adapter
+
+import (
+	"testing"
+
+	"github.com/DenisBochko/yandex_SSO/lib/schemaregistry"
+
+	"github.com/stretchr/testify/require"
+)
+
+// Каталог schemas/ - контракт с потребителями: все версии каждого события должны быть
+// совместимы между собой, а текущие сообщения - совпадать с зарегистрированными версиями.
+func TestSchemaRegistry(t *testing.T) {
+	registry, err := schemaregistry.Open("../../schemas")
+	require.NoError(t, err)
+
+	require.NoError(t, registry.CheckHistory())
+	require.NoError(t, registry.Check(Schemas()...), "run go run ./cmd/schemas after changing proto/events")
+}
+
+// Текущая версия каждого события должна читаться потребителями предыдущей
+func TestSchemasCompatibleWithPreviousVersion(t *testing.T) {
+	registry, err := schemaregistry.Open("../../schemas")
+	require.NoError(t, err)
+
+	for _, schema := range Schemas() {
+		for _, prev := range registry.Versions(schema.Subject) {
+			if prev.Version >= schema.Version {
+				continue
+			}
+			require.NoError(t, schemaregistry.Compatible(prev.Message, schema.Message), "%s v%d -> v%d", schema.Subject, prev.Version, schema.Version)
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package adapter
+
+import (
+	"fmt"
+
+	"github.com/DenisBochko/yandex_SSO/internal/config"
+	"github.com/DenisBochko/yandex_SSO/pkg/kafka"
+	"github.com/DenisBochko/yandex_SSO/pkg/nats"
+
+	"go.uber.org/zap"
+)
+
+// Доступные транспорты событий (transport.backend)
+const (
+	TransportKafka  = "kafka"
+	TransportNats   = "nats"
+	TransportFile   = "file"
+	TransportMemory = "memory"
+)
+
+// Transport - Publisher, который держит соединение и закрывается при остановке сервиса
+type Transport interface {
+	Publisher
+	Close() error
+}
+
+// NewTransport создаёт транспорт, выбранный в конфиге. Ни один транспорт не подключается
+// к брокеру при создании, поэтому сервис запускается и при недоступном брокере.
+// undelivered получает сообщения, которые не удалось доставить асинхронно (см. KafkaPublisher).
+func NewTransport(log *zap.Logger, cfg config.TransportConfig, kafkaCfg kafka.KafkaConfig, natsCfg nats.NatsConfig, undelivered Publisher) (Transport, error) {
+	switch cfg.Backend {
+	case TransportKafka:
+		return NewKafkaPublisher(log, kafkaCfg, undelivered), nil
+	case TransportNats:
+		return NewNatsPublisher(natsCfg)
+	case TransportFile:
+		return NewFilePublisher(cfg.File)
+	case TransportMemory:
+		return NewMemoryPublisher(cfg.MemoryLimit), nil
+	}
+
+	return nil, fmt.Errorf("unknown transport backend %q", cfg.Backend)
+}
@@ -0,0 +1,62 @@
+package adapter
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/DenisBochko/yandex_SSO/internal/domain/models"
+	"github.com/DenisBochko/yandex_SSO/lib/envelope"
+)
+
+type WebhookStorage interface {
+	EnqueueWebhookDeliveries(ctx context.Context, eventID string, eventType string, payload []byte) (int64, error)
+}
+
+// webhookPayload - тело запроса вебхука
+type webhookPayload struct {
+	ID            string          `json:"id"`
+	Type          string          `json:"type"`
+	SchemaVersion int             `json:"schema_version"`
+	OccurredAt    time.Time       `json:"occurred_at"`
+	Data          json.RawMessage `json:"data"`
+}
+
+// WebhookPublisher ставит событие в очередь доставки подписчикам вебхуков и передаёт его дальше.
+// Внутри InTx доставки создаются в той же транзакции, что и событие. На какие события
+// можно подписаться, решает сервис вебхуков; сообщения без схемы в очередь не попадают.
+type WebhookPublisher struct {
+	storage WebhookStorage
+	next    Publisher
+}
+
+func NewWebhookPublisher(storage WebhookStorage, next Publisher) *WebhookPublisher {
+	return &WebhookPublisher{storage: storage, next: next}
+}
+
+func (p *WebhookPublisher) Publish(ctx context.Context, message models.OutboxMessage) error {
+	if data, ok := decodeEvent(message); ok {
+		meta, err := envelope.FromHeaders(message.Headers)
+		if err != nil {
+			return fmt.Errorf("failed to read event envelope: %w", err)
+		}
+
+		body, err := json.Marshal(webhookPayload{
+			ID:            meta.ID,
+			Type:          meta.Type,
+			SchemaVersion: meta.SchemaVersion,
+			OccurredAt:    meta.OccurredAt,
+			Data:          data,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to marshal webhook payload: %w", err)
+		}
+
+		if _, err := p.storage.EnqueueWebhookDeliveries(ctx, meta.ID, meta.Type, body); err != nil {
+			return err
+		}
+	}
+
+	return p.next.Publish(ctx, message)
+}
@@ -2,94 +2,234 @@ package app
 
 import (
 	"context"
+	"fmt"
+	"time"
 
 	"github.com/DenisBochko/yandex_SSO/internal/adapter"
+	consumerapp "github.com/DenisBochko/yandex_SSO/internal/app/consumer"
 	grpcapp "github.com/DenisBochko/yandex_SSO/internal/app/grpc"
+	janitorapp "github.com/DenisBochko/yandex_SSO/internal/app/janitor"
+	outboxapp "github.com/DenisBochko/yandex_SSO/internal/app/outbox"
+	webhooksapp "github.com/DenisBochko/yandex_SSO/internal/app/webhooks"
 	"github.com/DenisBochko/yandex_SSO/internal/config"
+	grpcHandlersAdmin "github.com/DenisBochko/yandex_SSO/internal/grpcHandlers/admin"
 	"github.com/DenisBochko/yandex_SSO/internal/services/auth"
+	"github.com/DenisBochko/yandex_SSO/internal/services/commands"
+	"github.com/DenisBochko/yandex_SSO/internal/services/risk"
 	"github.com/DenisBochko/yandex_SSO/internal/services/users"
-	miniostorage "github.com/DenisBochko/yandex_SSO/internal/storage/minio"
-	postgresql "github.com/DenisBochko/yandex_SSO/internal/storage/postgres"
-	redisstorage "github.com/DenisBochko/yandex_SSO/internal/storage/redis"
-	"github.com/DenisBochko/yandex_SSO/pkg/kafka"
-	minio "github.com/DenisBochko/yandex_SSO/pkg/minIO"
-	"github.com/DenisBochko/yandex_SSO/pkg/postgres"
-	redisClient "github.com/DenisBochko/yandex_SSO/pkg/redis"
-
-	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/DenisBochko/yandex_SSO/internal/services/webhooks"
+	"github.com/DenisBochko/yandex_SSO/lib/schemaregistry"
+	"github.com/DenisBochko/yandex_SSO/pkg/metrics"
+	"github.com/DenisBochko/yandex_SSO/pkg/smtp"
+
 	"go.uber.org/zap"
 )
 
 type App struct {
 	GRPCServer *grpcapp.App
-	log        *zap.Logger
-	dbConn     *pgxpool.Pool
+	Janitor    *janitorapp.App
+	Outbox     *outboxapp.App
+	Webhooks   *webhooksapp.App
+	Consumer   *consumerapp.App
+	Metrics    *metrics.Server
+
+	transport adapter.Transport
+	log       *zap.Logger
+	closeDB   func()
 }
 
-func New(ctx context.Context, log *zap.Logger, cfg *config.Config) *App {
-	// Создаём новый экземпляр подключения к бд
-	conn, err := postgres.New(ctx, cfg.Postgres)
-
-	if err != nil {
-		log.Info("failed to connect to database", zap.Error(err))
-		return nil
+// New собирает приложение. Ошибка возвращается, если не удалось подключиться к хранилищам
+// или создать одну из зависимостей; уже открытые подключения при этом закрываются.
+func New(ctx context.Context, log *zap.Logger, cfg *config.Config) (*App, error) {
+	// Проверяем, что схемы публикуемых событий зарегистрированы и совместимы с прежними версиями
+	if err := checkSchemas(cfg.Schemas.Dir); err != nil {
+		return nil, fmt.Errorf("event schemas do not match the registry: %w", err)
 	}
 
-	if conn.Ping(ctx) != nil {
-		log.Info("failed to ping database", zap.Error(err))
-		return nil
+	// Подключаем хранилища: postgres или sqlite, redis и minIO или, в режиме --dev, их реализации в памяти
+	var st *storages
+	if cfg.Dev {
+		log.Info("dev mode: storages are in memory, all data is lost on exit")
+		st = memoryStorages(cfg)
+	} else {
+		var err error
+		st, err = connectStorages(ctx, log, cfg)
+		if err != nil {
+			return nil, fmt.Errorf("failed to connect to storages: %w", err)
+		}
 	}
 
-	// Создаём новый экземпляр minIO клиента
-	minioClient, err := minio.New(ctx, log, cfg.Minio)
-
-	if err != nil {
-		log.Info("failed to connect to minIO", zap.Error(err))
-		return nil
+	// closers освобождают то, что уже создано, если запуск прервался
+	closers := []func(){}
+	if st.closeDB != nil {
+		closers = append(closers, st.closeDB)
+	}
+	fail := func(err error) (*App, error) {
+		for i := len(closers) - 1; i >= 0; i-- {
+			closers[i]()
+		}
+		return nil, err
 	}
 
-	// Создаём новый экземпляр kafka клиента
-	kafkaProducer, err := kafka.NewSyncProducer(ctx, log, cfg.Kafka)
+	// Создаём транспорт событий, выбранный в конфиге (kafka, nats, file, memory).
+	// Брокер подключается при первой отправке, поэтому его недоступность не мешает запуску.
+	// Сообщения, которые асинхронный продюсер kafka не доставил, сохраняются в outbox для повтора
+	transport, err := adapter.NewTransport(log, cfg.Transport, cfg.Kafka, cfg.Nats, adapter.NewOutboxPublisher(st.main))
 	if err != nil {
-		log.Info("failed to connect to kafka", zap.Error(err))
-		return nil
+		return fail(fmt.Errorf("failed to create event transport: %w", err))
 	}
+	closers = append(closers, func() { transport.Close() })
 
-	// Создаём новый экземпляр redis клиента
-	redisClient := redisClient.New(ctx, log, cfg.Redis)
-
-	// Созадаём новый экземпляр хранилища postgresql
-	postgresStorage := postgresql.New(conn)
+	// Сообщения отправляются в транспорт напрямую или через таблицу outbox,
+	// откуда их забирает relay. Во втором случае они пишутся в одной транзакции с данными
+	var publisher adapter.Publisher = transport
+	if cfg.Outbox.Enabled {
+		publisher = adapter.NewOutboxPublisher(st.main)
+	}
 
-	// Создаём новый экземпляр хранилища minIO
-	minIOStorage := miniostorage.New(minioClient, cfg.Minio.Bucket)
+	// События для подписчиков вебхуков ставятся в очередь доставки в той же транзакции.
+	// В режиме --dev вебхуки выключены: у хранилища в памяти их нет
+	if cfg.Webhooks.Enabled {
+		publisher = adapter.NewWebhookPublisher(st.webhooks, publisher)
+	}
 
 	// Создаём новый экземпляр адаптера kafka
-	kafkaAdapter := adapter.New(log, kafkaProducer, cfg.Kafka.Topic)
+	kafkaAdapter := adapter.New(log, publisher, cfg.Kafka)
 
-	// Создаём новый экземпляр хранилища redis
-	redisStorage := redisstorage.New(redisClient, cfg.Jwt.RefreshTokenTTL)
+	// Создаём движок оценки риска входа
+	riskEngine, err := risk.New(log, &cfg.Risk, st.main)
+	if err != nil {
+		return fail(fmt.Errorf("failed to create risk engine: %w", err))
+	}
+
+	// Письма сервиса аутентификации уходят сообщениями для внешнего почтового сервиса
+	// или, если включено mail.enabled, напрямую по SMTP. Во втором случае письма всегда
+	// ставятся в outbox (даже с outbox.enabled: false), а отправляет их relay
+	var authTransport auth.KafkaTransport = kafkaAdapter
+	var relayPublisher adapter.Publisher = transport
+	if cfg.Mail.Enabled {
+		smtpClient, err := smtp.New(cfg.Smtp)
+		if err != nil {
+			return fail(fmt.Errorf("failed to create smtp client: %w", err))
+		}
+
+		templates, err := adapter.LoadMailTemplates(cfg.Mail)
+		if err != nil {
+			return fail(fmt.Errorf("failed to load mail templates: %w", err))
+		}
+
+		authTransport = adapter.NewMailTransport(log, templates, &cfg.Mail, adapter.NewOutboxPublisher(st.main), kafkaAdapter)
+		relayPublisher = adapter.NewMailPublisher(log, smtpClient, transport)
+	}
 
 	// Создаём новый экземпляр сервиса аутентификации
-	authService := auth.New(log, postgresStorage, kafkaAdapter, redisStorage, &cfg.Jwt)
+	authService := auth.New(log, st.main, authTransport, st.sessions, &cfg.Jwt, &cfg.Verify, &cfg.Phone, &cfg.Email, &cfg.Devices, riskEngine)
 
 	// Создаём новый экземпляр сервиса пользователей
-	userService := users.New(log, postgresStorage, minIOStorage, &cfg.Jwt)
+	userService := users.New(log, st.main, st.photos, kafkaAdapter, &cfg.Jwt, &cfg.Email, &cfg.Username)
+
+	// Создаём сервис управления подписками на вебхуки (методы Admin). В режиме --dev хранилища
+	// подписок нет, и интерфейс остаётся nil (а не nil-указателем), чтобы методы это увидели
+	var webhooksService grpcHandlersAdmin.WebhooksService
+	var webhooksStorage webhooksapp.Storage
+	if st.webhooks != nil {
+		webhooksService = webhooks.New(log, st.webhooks, &cfg.Webhooks)
+		webhooksStorage = st.webhooks
+	}
 
 	// Создаём новый gRPC сервер
-	// и регистрируем в нём сервисы аутентификации и пользователей
-	grpcApp := grpcapp.New(log, cfg, authService, userService, cfg.GRPC.Port)
+	// и регистрируем в нём сервисы аутентификации, пользователей и служебный Admin
+	grpcApp := grpcapp.New(log, cfg, authService, userService, userService, webhooksService, authService, cfg.GRPC.Port)
+
+	// Создаём фоновый процесс уборки просроченных данных.
+	// Работает только на реплике, захватившей advisory lock в postgres
+	tasks := []janitorapp.Task{
+		{Name: "verification_tokens", Run: st.main.PurgeExpiredVerificationTokens},
+		// коды хранят счётчики отправок и попыток, поэтому удаляются только после окна, в котором они считаются
+		{Name: "verification_codes", Run: func(ctx context.Context, now time.Time) (int64, error) {
+			return st.main.PurgeExpiredVerificationCodes(ctx, now.Add(-max(cfg.Verify.CodeIssueWindow, cfg.Phone.OTPIssueWindow)))
+		}},
+		{Name: "session_revoke_tokens", Run: st.main.PurgeExpiredSessionRevokeTokens},
+		{Name: "security_events", Run: func(ctx context.Context, now time.Time) (int64, error) {
+			return st.main.PurgeSecurityEvents(ctx, now.Add(-cfg.Events.Retention))
+		}},
+		{Name: "outbox", Run: func(ctx context.Context, now time.Time) (int64, error) {
+			return st.main.PurgePublishedOutbox(ctx, now.Add(-cfg.Outbox.Retention))
+		}},
+		{Name: "account_commands", Run: func(ctx context.Context, now time.Time) (int64, error) {
+			return st.main.PurgeAccountCommands(ctx, now.Add(-cfg.Commands.Retention))
+		}},
+	}
+	if st.webhooks != nil {
+		tasks = append(tasks, janitorapp.Task{Name: "webhook_deliveries", Run: func(ctx context.Context, now time.Time) (int64, error) {
+			return st.webhooks.PurgeWebhookDeliveries(ctx, now.Add(-cfg.Webhooks.Retention))
+		}})
+	}
+	janitorApp := janitorapp.New(log, st.leader("sso-janitor"), cfg.Janitor.Interval, tasks...)
+
+	// Создаём relay, переносящий сообщения из outbox в транспорт (и письма - в SMTP).
+	// Свой advisory lock: relay и janitor могут работать на разных репликах
+	outboxApp := outboxapp.New(log, st.main, relayPublisher, st.leader("sso-outbox-relay"), &cfg.Outbox)
+
+	// Создаём worker доставки вебхуков со своим advisory lock
+	webhooksApp := webhooksapp.New(log, webhooksStorage, st.leader("sso-webhooks"), &cfg.Webhooks)
+
+	// Создаём consumer входящих топиков Kafka
+	handlers := make(map[string]consumerapp.Handler)
+	if cfg.Feedback.Enabled {
+		handlers[cfg.Kafka.DeliveryStatusTopic] = adapter.NewEmailFeedbackHandler(log, userService)
+	}
+	if cfg.Commands.Enabled {
+		commandsService := commands.New(log, st.main, userService, authService, kafkaAdapter)
+		handlers[cfg.Kafka.CommandsTopic] = adapter.NewAccountCommandHandler(log, commandsService, publisher, cfg.Kafka.DeadLetterTopic)
+	}
+	consumerApp := consumerapp.New(log, cfg.Kafka, handlers)
+
+	// Сервер метрик (expvar)
+	metricsServer := metrics.NewServer(log, cfg.Metrics)
 
 	return &App{
 		GRPCServer: grpcApp,
+		Janitor:    janitorApp,
+		Outbox:     outboxApp,
+		Webhooks:   webhooksApp,
+		Consumer:   consumerApp,
+		Metrics:    metricsServer,
+		transport:  transport,
 		log:        log,
-		dbConn:     conn,
+		closeDB:    st.closeDB,
+	}, nil
+}
+
+func checkSchemas(dir string) error {
+	registry, err := schemaregistry.Open(dir)
+	if err != nil {
+		return err
+	}
+
+	if err := registry.CheckHistory(); err != nil {
+		return err
 	}
+
+	return registry.Check(adapter.Schemas()...)
 }
 
 func (a *App) Stop() {
 	a.GRPCServer.Stop()
+	a.Consumer.Stop()
+	a.Janitor.Stop()
+	a.Outbox.Stop()
+	a.Webhooks.Stop()
+	a.Metrics.Stop()
+
+	a.log.Info("closing event transport")
+	if err := a.transport.Close(); err != nil {
+		a.log.Warn("failed to close event transport", zap.Error(err))
+	}
 
-	a.log.Info("stopping database connection")
-	a.dbConn.Close()
+	// в режиме --dev подключения к бд нет
+	if a.closeDB != nil {
+		a.log.Info("stopping database connection")
+		a.closeDB()
+	}
 }
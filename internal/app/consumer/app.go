@@ -0,0 +1,184 @@
+package consumerapp
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/DenisBochko/yandex_SSO/pkg/kafka"
+	"github.com/DenisBochko/yandex_SSO/pkg/metrics"
+
+	"github.com/IBM/sarama"
+	"go.uber.org/zap"
+)
+
+var (
+	consumedTotal      = metrics.NewCounter("consumer_messages_total")
+	consumeErrorsTotal = metrics.NewCounter("consumer_errors_total")
+)
+
+const (
+	retryBackoff    = time.Second
+	maxRetryBackoff = time.Minute
+)
+
+// Handler обрабатывает сообщение топика. Ошибка означает временный сбой: сообщение
+// будет обработано повторно. Некорректные сообщения обработчик должен пропускать сам.
+type Handler interface {
+	Handle(ctx context.Context, msg *sarama.ConsumerMessage) error
+}
+
+// App читает топики в составе consumer group (KAFKA_CONSUMER_GROUP) и передаёт сообщения обработчикам.
+// Партиции распределяются между репликами сервиса самой Kafka, поэтому выбор лидера не нужен.
+// Смещение фиксируется после успешной обработки: доставка at-least-once, обработчики идемпотентны.
+// Пока сообщение не обработано, его партиция стоит, что сохраняет порядок внутри ключа.
+type App struct {
+	log      *zap.Logger
+	cfg      kafka.KafkaConfig
+	handlers map[string]Handler
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// Создаём новый consumer. handlers - обработчик для каждого топика
+func New(log *zap.Logger, cfg kafka.KafkaConfig, handlers map[string]Handler) *App {
+	return &App{
+		log:      log.With(zap.String("component", "consumer")),
+		cfg:      cfg,
+		handlers: handlers,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+// Run блокируется до вызова Stop. Недоступный брокер не мешает запуску:
+// подключение повторяется, пока не получится.
+func (a *App) Run() {
+	defer close(a.done)
+
+	if len(a.handlers) == 0 {
+		<-a.stop
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go func() {
+		<-a.stop
+		cancel()
+	}()
+
+	topics := make([]string, 0, len(a.handlers))
+	for topic := range a.handlers {
+		topics = append(topics, topic)
+	}
+	sort.Strings(topics)
+
+	log := a.log.With(zap.Strings("topics", topics), zap.String("group", a.cfg.ConsumerGroup))
+
+	var group sarama.ConsumerGroup
+	for backoff := retryBackoff; group == nil; backoff = next(backoff) {
+		var err error
+		if group, err = kafka.NewConsumerGroup(a.cfg); err != nil {
+			log.Warn("failed to create consumer group", zap.Error(err), zap.Duration("retryIn", backoff))
+			if !sleep(ctx, backoff) {
+				return
+			}
+		}
+	}
+	defer group.Close()
+
+	go func() {
+		for err := range group.Errors() {
+			consumeErrorsTotal.Add(1)
+			log.Warn("consumer group error", zap.Error(err))
+		}
+	}()
+
+	log.Info("consumer is running")
+
+	// Consume возвращается при каждой перебалансировке, поэтому вызывается в цикле
+	for backoff := retryBackoff; ctx.Err() == nil; {
+		if err := group.Consume(ctx, topics, a); err != nil {
+			if errors.Is(err, sarama.ErrClosedConsumerGroup) {
+				return
+			}
+			log.Warn("consume failed", zap.Error(err), zap.Duration("retryIn", backoff))
+			if !sleep(ctx, backoff) {
+				return
+			}
+			backoff = next(backoff)
+			continue
+		}
+		backoff = retryBackoff
+	}
+}
+
+func (a *App) Setup(sarama.ConsumerGroupSession) error   { return nil }
+func (a *App) Cleanup(sarama.ConsumerGroupSession) error { return nil }
+
+// ConsumeClaim обрабатывает сообщения партиции по порядку. Неудачная обработка повторяется
+// с растущей задержкой, пока не получится или партицию не заберут при перебалансировке.
+func (a *App) ConsumeClaim(session sarama.ConsumerGroupSession, claim sarama.ConsumerGroupClaim) error {
+	handler := a.handlers[claim.Topic()]
+	ctx := session.Context()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case msg, ok := <-claim.Messages():
+			if !ok {
+				return nil
+			}
+
+			for backoff := retryBackoff; ; backoff = next(backoff) {
+				err := handler.Handle(ctx, msg)
+				if err == nil {
+					break
+				}
+
+				consumeErrorsTotal.Add(1)
+				a.log.Warn("failed to handle message",
+					zap.String("topic", msg.Topic), zap.Int32("partition", msg.Partition), zap.Int64("offset", msg.Offset),
+					zap.Error(err), zap.Duration("retryIn", backoff))
+
+				if !sleep(ctx, backoff) {
+					return nil
+				}
+			}
+
+			consumedTotal.Add(1)
+			session.MarkMessage(msg, "")
+		}
+	}
+}
+
+func next(backoff time.Duration) time.Duration {
+	if backoff*2 > maxRetryBackoff {
+		return maxRetryBackoff
+	}
+	return backoff * 2
+}
+
+// sleep ждёт d и возвращает false, если контекст отменён раньше
+func sleep(ctx context.Context, d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-t.C:
+		return true
+	}
+}
+
+func (a *App) Stop() {
+	a.log.Info("stopping consumer")
+	close(a.stop)
+	<-a.done
+}
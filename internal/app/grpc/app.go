@@ -3,14 +3,53 @@ package grpcapp
 import (
 	"fmt"
 	"net"
+	"strings"
+
 	"github.com/DenisBochko/yandex_SSO/internal/config"
+	grpcHandlersAdmin "github.com/DenisBochko/yandex_SSO/internal/grpcHandlers/admin"
 	grpcHandlersAuth "github.com/DenisBochko/yandex_SSO/internal/grpcHandlers/auth"
 	grpcHandlersUsers "github.com/DenisBochko/yandex_SSO/internal/grpcHandlers/users"
+	"github.com/DenisBochko/yandex_SSO/lib/clientinfo"
+	"github.com/DenisBochko/yandex_SSO/lib/iplist"
+	authinterceptor "github.com/DenisBochko/yandex_SSO/pkg/AuthInterceptor"
 
+	adminv1 "github.com/DenisBochko/yandex_SSO/gen/go/admin/v1"
+	authv1 "github.com/DenisBochko/yandex_SSO/gen/go/auth/v1"
+	usersv1 "github.com/DenisBochko/yandex_SSO/gen/go/users/v1"
+	ssov1 "gitlab.crja72.ru/golang/2025/spring/course/projects/go6/contracts/gen/go/sso"
 	"go.uber.org/zap"
 	"google.golang.org/grpc"
 )
 
+// publicRoutes - методы, которые вызываются без access токена
+var publicRoutes = []string{
+	ssov1.Auth_Register_FullMethodName,
+	ssov1.Auth_ResendVerificationToken_FullMethodName,
+	ssov1.Auth_Login_FullMethodName,
+	ssov1.Auth_RefreshToken_FullMethodName,
+	ssov1.Auth_Verify_FullMethodName,
+	ssov1.Auth_Logout_FullMethodName,
+	authv1.Auth_VerifyCode_FullMethodName,
+	authv1.Auth_CompleteLoginChallenge_FullMethodName,
+	authv1.Auth_RevokeSessions_FullMethodName, // по токену из ссылки "это был не я"
+	authv1.Auth_RegisterByPhone_FullMethodName,
+	authv1.Auth_RequestPhoneLogin_FullMethodName,
+	authv1.Auth_LoginByPhone_FullMethodName,
+	usersv1.Users_CheckUsername_FullMethodName,
+
+	// методы Admin проверяют свой токен (admin.token), а не access токен пользователя
+	adminv1.Admin_SetUserStatus_FullMethodName,
+	adminv1.Admin_ResetEmailStatus_FullMethodName,
+	adminv1.Admin_CreateWebhookSubscription_FullMethodName,
+	adminv1.Admin_ListWebhookSubscriptions_FullMethodName,
+	adminv1.Admin_GetWebhookSubscription_FullMethodName,
+	adminv1.Admin_UpdateWebhookSubscription_FullMethodName,
+	adminv1.Admin_DeleteWebhookSubscription_FullMethodName,
+	adminv1.Admin_ListWebhookDeliveries_FullMethodName,
+	adminv1.Admin_ListWebhookDeliveryAttempts_FullMethodName,
+	adminv1.Admin_RedeliverWebhook_FullMethodName,
+}
+
 type App struct {
 	log        *zap.Logger
 	gRPCServer *grpc.Server
@@ -18,20 +57,49 @@ type App struct {
 }
 
 // Создаём новый gRPC сервер
-func New(log *zap.Logger, cfg *config.Config, authService grpcHandlersAuth.Auth, userService grpcHandlersUsers.UsersService, port int) *App {
-	// interceptor, err := authinterceptor.NewAuthInterceptor(cfg.Jwt.AppSecretAccessToken, []string{"/auth.Auth/Register", "/auth.Auth/Login"})
-	// if err != nil {
-	// 	log.Fatal("failed to create auth interceptor", zap.Error(err))
-	// }
+func New(
+	log *zap.Logger,
+	cfg *config.Config,
+	authService grpcHandlersAuth.Auth,
+	userService grpcHandlersUsers.UsersService,
+	adminService grpcHandlersAdmin.UsersService,
+	webhooksService grpcHandlersAdmin.WebhooksService,
+	statusChecker authinterceptor.AccountStatusChecker,
+	port int,
+) *App {
+	interceptorOpts := []authinterceptor.Option{
+		authinterceptor.WithAccountStatusChecker(statusChecker),
+		authinterceptor.WithStepUp(authinterceptor.StepUpPolicy{
+			Methods: cfg.StepUp.Methods,
+			MaxAge:  cfg.StepUp.MaxAge,
+		}),
+	}
+	// Без grpc.auth_interceptor токен не обязателен, но переданный токен проверяется:
+	// access токен заблокированного пользователя отклоняется в любом режиме
+	if !cfg.GRPC.AuthInterceptor {
+		interceptorOpts = append(interceptorOpts, authinterceptor.WithOptionalToken())
+	}
 
-	// gRPCServer := grpc.NewServer(
-	// 	grpc.UnaryInterceptor(interceptor.UnaryAuthMiddleware),
-	// )
+	interceptor, err := authinterceptor.NewAuthInterceptor(cfg.Jwt.AppSecretAccessToken, publicRoutes, interceptorOpts...)
+	if err != nil {
+		log.Fatal("failed to create auth interceptor", zap.Error(err))
+	}
+
+	proxies, err := iplist.Parse(strings.NewReader(strings.Join(cfg.GRPC.TrustedProxies, "\n")))
+	if err != nil {
+		log.Fatal("invalid grpc.trusted_proxies", zap.Error(err))
+	}
 
-	gRPCServer := grpc.NewServer()
+	gRPCServer := grpc.NewServer(grpc.ChainUnaryInterceptor(
+		clientinfo.UnaryServerInterceptor(proxies),
+		interceptor.UnaryAuthMiddleware,
+	))
 
 	grpcHandlersAuth.Register(gRPCServer, authService)
-	grpcHandlersUsers.Register(gRPCServer, userService)
+	grpcHandlersUsers.Register(gRPCServer, userService, cfg.StepUp.EmailChange)
+	if cfg.Admin.Token != "" {
+		grpcHandlersAdmin.Register(gRPCServer, cfg.Admin.Token, adminService, webhooksService)
+	}
 
 	return &App{
 		log:        log,
@@ -0,0 +1,110 @@
+package janitorapp
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Leader - выбор лидера среди реплик, чтобы уборку выполняла только одна из них
+type Leader interface {
+	TryAcquire(ctx context.Context) (bool, error)
+	Release(ctx context.Context) error
+}
+
+// Task - одна задача уборки. Run возвращает количество удалённых записей.
+type Task struct {
+	Name string
+	Run  func(ctx context.Context, now time.Time) (int64, error)
+}
+
+// App периодически выполняет задачи уборки устаревших данных
+type App struct {
+	log      *zap.Logger
+	leader   Leader
+	interval time.Duration
+	tasks    []Task
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// Создаём новый фоновый процесс уборки
+func New(log *zap.Logger, leader Leader, interval time.Duration, tasks ...Task) *App {
+	return &App{
+		log:      log.With(zap.String("component", "janitor")),
+		leader:   leader,
+		interval: interval,
+		tasks:    tasks,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+}
+
+// Run блокируется до вызова Stop
+func (a *App) Run() {
+	defer close(a.done)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go func() {
+		<-a.stop
+		cancel()
+	}()
+
+	a.log.Info("janitor is running", zap.Duration("interval", a.interval))
+
+	ticker := time.NewTicker(a.interval)
+	defer ticker.Stop()
+
+	for {
+		a.runOnce(ctx)
+
+		select {
+		case <-ctx.Done():
+			// контекст уже отменён, отдаём блокировку с отдельным таймаутом
+			releaseCtx, releaseCancel := context.WithTimeout(context.Background(), 5*time.Second)
+			if err := a.leader.Release(releaseCtx); err != nil {
+				a.log.Warn("failed to release leadership", zap.Error(err))
+			}
+			releaseCancel()
+
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (a *App) runOnce(ctx context.Context) {
+	isLeader, err := a.leader.TryAcquire(ctx)
+	if err != nil {
+		a.log.Warn("leader election failed", zap.Error(err))
+		return
+	}
+
+	if !isLeader {
+		a.log.Debug("another replica is the janitor leader, skipping")
+		return
+	}
+
+	now := time.Now()
+	for _, task := range a.tasks {
+		deleted, err := task.Run(ctx, now)
+		if err != nil {
+			a.log.Error("janitor task failed", zap.String("task", task.Name), zap.Error(err))
+			continue
+		}
+
+		if deleted > 0 {
+			a.log.Info("janitor task finished", zap.String("task", task.Name), zap.Int64("deleted", deleted))
+		}
+	}
+}
+
+func (a *App) Stop() {
+	a.log.Info("stopping janitor")
+	close(a.stop)
+	<-a.done
+}
@@ -0,0 +1,68 @@
+package janitorapp
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// leader - общая блокировка, за которую конкурируют реплики в тесте
+type leader struct {
+	mu     *sync.Mutex
+	holder *string
+	name   string
+}
+
+func (l leader) TryAcquire(ctx context.Context) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if *l.holder == "" {
+		*l.holder = l.name
+	}
+	return *l.holder == l.name, nil
+}
+
+func (l leader) Release(ctx context.Context) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if *l.holder == l.name {
+		*l.holder = ""
+	}
+	return nil
+}
+
+func TestOnlyLeaderRunsTasks(t *testing.T) {
+	var mu sync.Mutex
+	var holder string
+
+	var runs [2]atomic.Int32
+	apps := make([]*App, 2)
+	for i := range apps {
+		task := Task{Name: "count", Run: func(ctx context.Context, now time.Time) (int64, error) {
+			runs[i].Add(1)
+			return 0, nil
+		}}
+		apps[i] = New(zap.NewNop(), leader{mu: &mu, holder: &holder, name: string(rune('a' + i))}, 10*time.Millisecond, task)
+	}
+
+	go apps[0].Run()
+	require.Eventually(t, func() bool { return runs[0].Load() >= 2 }, time.Second, 5*time.Millisecond)
+
+	go apps[1].Run()
+	time.Sleep(50 * time.Millisecond)
+	require.Zero(t, runs[1].Load())
+
+	// после остановки лидера блокировку забирает вторая реплика
+	apps[0].Stop()
+	require.Eventually(t, func() bool { return runs[1].Load() > 0 }, time.Second, 5*time.Millisecond)
+
+	apps[1].Stop()
+	require.Empty(t, holder)
+}
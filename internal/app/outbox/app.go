@@ -0,0 +1,209 @@
+package outboxapp
+
+import (
+	"context"
+	"time"
+
+	"github.com/DenisBochko/yandex_SSO/internal/config"
+	"github.com/DenisBochko/yandex_SSO/internal/domain/models"
+	"github.com/DenisBochko/yandex_SSO/pkg/metrics"
+
+	"go.uber.org/zap"
+)
+
+// Метрики доставки. Доставка at-least-once: после сбоя между отправкой и отметкой
+// в outbox сообщение уйдёт повторно, redelivered считает отправки с попыткой не первой.
+var (
+	publishedTotal     = metrics.NewCounter("outbox_published_total")
+	publishErrorsTotal = metrics.NewCounter("outbox_publish_errors_total")
+	redeliveredTotal   = metrics.NewCounter("outbox_redelivered_total")
+	backlog            = metrics.NewGauge("outbox_backlog")
+	oldestPendingAge   = metrics.NewGauge("outbox_oldest_pending_seconds")
+)
+
+type Storage interface {
+	PendingOutboxMessages(ctx context.Context, now time.Time, limit int) ([]models.OutboxMessage, error)
+	MarkOutboxPublished(ctx context.Context, ids []int64, publishedAt time.Time) error
+	MarkOutboxFailed(ctx context.Context, id int64, lastError string, nextAttemptAt time.Time) error
+	OutboxBacklog(ctx context.Context) (int64, time.Time, error)
+}
+
+type Publisher interface {
+	Publish(ctx context.Context, message models.OutboxMessage) error
+}
+
+// Leader - выбор лидера среди реплик: сообщения публикует только одна, иначе порядок внутри ключа не гарантирован
+type Leader interface {
+	TryAcquire(ctx context.Context) (bool, error)
+	Release(ctx context.Context) error
+}
+
+// App переносит сообщения из таблицы outbox в брокер
+type App struct {
+	log       *zap.Logger
+	storage   Storage
+	publisher Publisher
+	leader    Leader
+	cfg       *config.OutboxConfig
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// Создаём новый relay outbox
+func New(log *zap.Logger, storage Storage, publisher Publisher, leader Leader, cfg *config.OutboxConfig) *App {
+	return &App{
+		log:       log.With(zap.String("component", "outbox-relay")),
+		storage:   storage,
+		publisher: publisher,
+		leader:    leader,
+		cfg:       cfg,
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+}
+
+// Run блокируется до вызова Stop
+func (a *App) Run() {
+	defer close(a.done)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go func() {
+		<-a.stop
+		cancel()
+	}()
+
+	a.log.Info("outbox relay is running", zap.Duration("interval", a.cfg.PollInterval))
+
+	ticker := time.NewTicker(a.cfg.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		a.runOnce(ctx)
+
+		select {
+		case <-ctx.Done():
+			releaseCtx, releaseCancel := context.WithTimeout(context.Background(), 5*time.Second)
+			if err := a.leader.Release(releaseCtx); err != nil {
+				a.log.Warn("failed to release leadership", zap.Error(err))
+			}
+			releaseCancel()
+
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (a *App) runOnce(ctx context.Context) {
+	isLeader, err := a.leader.TryAcquire(ctx)
+	if err != nil {
+		a.log.Warn("leader election failed", zap.Error(err))
+		return
+	}
+
+	if !isLeader {
+		return
+	}
+
+	// пока пачки приходят полными, в outbox есть ещё сообщения
+	for ctx.Err() == nil {
+		n, err := a.relayBatch(ctx)
+		if err != nil {
+			a.log.Error("outbox relay failed", zap.Error(err))
+			break
+		}
+		if n < a.cfg.BatchSize {
+			break
+		}
+	}
+
+	a.updateBacklog(ctx)
+}
+
+// relayBatch публикует одну пачку и возвращает количество выбранных сообщений.
+// Если сообщение не ушло, остальные сообщения его ключа в этой пачке пропускаются,
+// чтобы не нарушить порядок, и ждут повторной попытки вместе с ним.
+func (a *App) relayBatch(ctx context.Context) (int, error) {
+	now := time.Now().UTC()
+
+	messages, err := a.storage.PendingOutboxMessages(ctx, now, a.cfg.BatchSize)
+	if err != nil {
+		return 0, err
+	}
+
+	blocked := make(map[string]bool)
+	published := make([]int64, 0, len(messages))
+
+	for _, message := range messages {
+		if blocked[message.AggregateID] {
+			continue
+		}
+
+		if err := a.publisher.Publish(ctx, message); err != nil {
+			blocked[message.AggregateID] = true
+			publishErrorsTotal.Add(1)
+
+			next := now.Add(a.backoff(message.Attempts))
+			a.log.Warn("failed to publish outbox message",
+				zap.Int64("id", message.ID), zap.String("kind", message.Kind), zap.Int("attempts", message.Attempts+1),
+				zap.Time("nextAttemptAt", next), zap.Error(err))
+
+			if err := a.storage.MarkOutboxFailed(ctx, message.ID, err.Error(), next); err != nil {
+				return len(messages), err
+			}
+			continue
+		}
+
+		publishedTotal.Add(1)
+		if message.Attempts > 0 {
+			redeliveredTotal.Add(1)
+		}
+		published = append(published, message.ID)
+	}
+
+	if len(published) > 0 {
+		if err := a.storage.MarkOutboxPublished(ctx, published, time.Now().UTC()); err != nil {
+			// сообщения уже в брокере и будут отправлены ещё раз - потребители должны быть идемпотентны
+			return len(messages), err
+		}
+	}
+
+	return len(messages), nil
+}
+
+// backoff - экспоненциальная задержка перед следующей попыткой, не больше MaxBackoff
+func (a *App) backoff(attempts int) time.Duration {
+	delay := a.cfg.BaseBackoff
+	for i := 0; i < attempts && delay < a.cfg.MaxBackoff; i++ {
+		delay *= 2
+	}
+
+	if delay > a.cfg.MaxBackoff {
+		return a.cfg.MaxBackoff
+	}
+	return delay
+}
+
+func (a *App) updateBacklog(ctx context.Context) {
+	count, oldest, err := a.storage.OutboxBacklog(ctx)
+	if err != nil {
+		a.log.Warn("failed to get outbox backlog", zap.Error(err))
+		return
+	}
+
+	backlog.Set(float64(count))
+	if oldest.IsZero() {
+		oldestPendingAge.Set(0)
+	} else {
+		oldestPendingAge.Set(time.Since(oldest).Seconds())
+	}
+}
+
+func (a *App) Stop() {
+	a.log.Info("stopping outbox relay")
+	close(a.stop)
+	<-a.done
+}
@@ -0,0 +1,162 @@
+package outboxapp
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DenisBochko/yandex_SSO/internal/config"
+	"github.com/DenisBochko/yandex_SSO/internal/domain/models"
+	"github.com/DenisBochko/yandex_SSO/internal/storage/memory"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// publisher запоминает отправленные сообщения и не принимает сообщения ключей из failing
+type publisher struct {
+	failing   map[string]bool
+	published []string
+}
+
+func (p *publisher) Publish(ctx context.Context, message models.OutboxMessage) error {
+	if p.failing[message.AggregateID] {
+		return errors.New("broker is down")
+	}
+
+	p.published = append(p.published, message.Kind)
+	return nil
+}
+
+type leader struct {
+	isLeader bool
+	err      error
+}
+
+func (l leader) TryAcquire(ctx context.Context) (bool, error) {
+	return l.isLeader, l.err
+}
+
+func (l leader) Release(ctx context.Context) error {
+	return nil
+}
+
+func newRelay(t *testing.T, l Leader) (*App, *memory.Storage, *publisher) {
+	t.Helper()
+
+	st := memory.New()
+	pub := &publisher{failing: map[string]bool{}}
+	cfg := &config.OutboxConfig{
+		PollInterval: time.Hour,
+		BatchSize:    10,
+		BaseBackoff:  50 * time.Millisecond,
+		MaxBackoff:   time.Second,
+	}
+
+	return New(zap.NewNop(), st, pub, l, cfg), st, pub
+}
+
+func save(t *testing.T, st *memory.Storage, aggregateID string, kind string) {
+	t.Helper()
+
+	require.NoError(t, st.SaveOutboxMessage(context.Background(), models.OutboxMessage{
+		AggregateID: aggregateID,
+		Topic:       "events",
+		Kind:        kind,
+		Payload:     []byte("{}"),
+	}))
+}
+
+func TestRelayBlocksFailedAggregate(t *testing.T) {
+	a, st, pub := newRelay(t, memory.Leader{})
+	ctx := context.Background()
+
+	save(t, st, "A", "a1")
+	save(t, st, "B", "b1")
+	save(t, st, "A", "a2")
+	save(t, st, "B", "b2")
+
+	published := publishedTotal.Value()
+	errs := publishErrorsTotal.Value()
+	redelivered := redeliveredTotal.Value()
+
+	pub.failing["A"] = true
+	a.runOnce(ctx)
+
+	// a2 ждёт a1, сообщения B не задерживаются
+	require.Equal(t, []string{"b1", "b2"}, pub.published)
+	require.Equal(t, published+2, publishedTotal.Value())
+	require.Equal(t, errs+1, publishErrorsTotal.Value())
+	require.Equal(t, float64(2), backlog.Value())
+
+	// до конца задержки a1 не отправляется повторно
+	pub.failing["A"] = false
+	a.runOnce(ctx)
+	require.Equal(t, []string{"b1", "b2"}, pub.published)
+
+	time.Sleep(a.cfg.BaseBackoff)
+	a.runOnce(ctx)
+
+	require.Equal(t, []string{"b1", "b2", "a1", "a2"}, pub.published)
+	require.Equal(t, redelivered+1, redeliveredTotal.Value())
+	require.Equal(t, float64(0), backlog.Value())
+	require.Equal(t, float64(0), oldestPendingAge.Value())
+}
+
+func TestRelayBackoff(t *testing.T) {
+	a, st, pub := newRelay(t, memory.Leader{})
+	ctx := context.Background()
+
+	save(t, st, "A", "a1")
+	pub.failing["A"] = true
+
+	// каждая неудача удваивает задержку
+	for attempts, want := range []time.Duration{50 * time.Millisecond, 100 * time.Millisecond, 200 * time.Millisecond} {
+		start := time.Now().UTC()
+		_, err := a.relayBatch(ctx)
+		require.NoError(t, err)
+
+		pending, err := st.PendingOutboxMessages(ctx, start.Add(want-time.Millisecond), 10)
+		require.NoError(t, err)
+		require.Empty(t, pending, "attempt %d", attempts+1)
+
+		pending, err = st.PendingOutboxMessages(ctx, time.Now().UTC().Add(want), 10)
+		require.NoError(t, err)
+		require.Len(t, pending, 1, "attempt %d", attempts+1)
+		require.Equal(t, attempts+1, pending[0].Attempts)
+
+		time.Sleep(want)
+	}
+}
+
+func TestBackoffLimit(t *testing.T) {
+	a, _, _ := newRelay(t, memory.Leader{})
+
+	require.Equal(t, 50*time.Millisecond, a.backoff(0))
+	require.Equal(t, 100*time.Millisecond, a.backoff(1))
+	require.Equal(t, 800*time.Millisecond, a.backoff(4))
+	require.Equal(t, time.Second, a.backoff(5))
+	require.Equal(t, time.Second, a.backoff(100))
+}
+
+func TestRelayOnlyLeader(t *testing.T) {
+	ctx := context.Background()
+
+	for name, l := range map[string]leader{
+		"follower":        {isLeader: false},
+		"election failed": {isLeader: true, err: errors.New("redis is down")},
+	} {
+		t.Run(name, func(t *testing.T) {
+			a, st, pub := newRelay(t, l)
+			save(t, st, "A", "a1")
+
+			a.runOnce(ctx)
+			require.Empty(t, pub.published)
+
+			count, _, err := st.OutboxBacklog(ctx)
+			require.NoError(t, err)
+			require.Equal(t, int64(1), count)
+		})
+	}
+}
@@ -0,0 +1,265 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/DenisBochko/yandex_SSO/internal/adapter"
+	outboxapp "github.com/DenisBochko/yandex_SSO/internal/app/outbox"
+	webhooksapp "github.com/DenisBochko/yandex_SSO/internal/app/webhooks"
+	"github.com/DenisBochko/yandex_SSO/internal/config"
+	"github.com/DenisBochko/yandex_SSO/internal/migrations"
+	"github.com/DenisBochko/yandex_SSO/internal/services/auth"
+	"github.com/DenisBochko/yandex_SSO/internal/services/commands"
+	"github.com/DenisBochko/yandex_SSO/internal/services/risk"
+	"github.com/DenisBochko/yandex_SSO/internal/services/users"
+	"github.com/DenisBochko/yandex_SSO/internal/services/webhooks"
+	"github.com/DenisBochko/yandex_SSO/internal/storage/memory"
+	miniostorage "github.com/DenisBochko/yandex_SSO/internal/storage/minio"
+	postgresql "github.com/DenisBochko/yandex_SSO/internal/storage/postgres"
+	redisstorage "github.com/DenisBochko/yandex_SSO/internal/storage/redis"
+	sqlitestorage "github.com/DenisBochko/yandex_SSO/internal/storage/sqlite"
+	"github.com/DenisBochko/yandex_SSO/internal/storage/usercache"
+	minio "github.com/DenisBochko/yandex_SSO/pkg/minIO"
+	"github.com/DenisBochko/yandex_SSO/pkg/postgres"
+	redisClient "github.com/DenisBochko/yandex_SSO/pkg/redis"
+	"github.com/DenisBochko/yandex_SSO/pkg/sqlite"
+
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+// Storage - основное хранилище сервисов и фоновых процессов: postgres, sqlite или, в режиме --dev, память процесса
+type Storage interface {
+	auth.Storage
+	users.Storage
+	risk.Storage
+	commands.Storage
+	outboxapp.Storage
+	adapter.OutboxStorage
+
+	PurgeExpiredVerificationTokens(ctx context.Context, before time.Time) (int64, error)
+	PurgeExpiredVerificationCodes(ctx context.Context, before time.Time) (int64, error)
+	PurgeExpiredSessionRevokeTokens(ctx context.Context, before time.Time) (int64, error)
+	PurgeSecurityEvents(ctx context.Context, before time.Time) (int64, error)
+	PurgePublishedOutbox(ctx context.Context, before time.Time) (int64, error)
+	PurgeAccountCommands(ctx context.Context, before time.Time) (int64, error)
+}
+
+// WebhookStorage - подписки и доставки вебхуков. Есть у postgres и sqlite, у хранилища в памяти нет
+type WebhookStorage interface {
+	webhooks.Storage
+	webhooksapp.Storage
+	adapter.WebhookStorage
+
+	PurgeWebhookDeliveries(ctx context.Context, before time.Time) (int64, error)
+}
+
+// Leader - выбор лидера для фоновых процессов, общий интерфейс janitor, outbox relay и worker'а вебхуков
+type Leader interface {
+	TryAcquire(ctx context.Context) (bool, error)
+	Release(ctx context.Context) error
+}
+
+// storages - хранилища, с которыми работает приложение
+type storages struct {
+	main     Storage
+	sessions auth.RedisStorage
+	photos   users.MinIoStorage
+	leader   func(name string) Leader
+
+	// webhooks - nil в режиме --dev
+	webhooks WebhookStorage
+	// closeDB закрывает подключения к бд и redis и кэш пользователей, в режиме --dev - nil
+	closeDB func()
+}
+
+// connectStorages подключается к основному хранилищу (postgres или sqlite), redis и minIO
+func connectStorages(ctx context.Context, log *zap.Logger, cfg *config.Config) (*storages, error) {
+	// Создаём новый экземпляр redis клиента. Он нужен и postgres: в redis хранятся
+	// отметки о недавних изменениях для чтения с реплик
+	redisClient, err := redisClient.New(ctx, log, cfg.Redis)
+	if err != nil {
+		return nil, err
+	}
+
+	var st *storages
+	switch cfg.Storage.Backend {
+	case config.StorageBackendPostgres:
+		st, err = connectPostgres(ctx, log, cfg, redisClient)
+	case config.StorageBackendSqlite:
+		st, err = connectSqlite(ctx, log, cfg)
+	default:
+		err = fmt.Errorf("unknown storage backend %q", cfg.Storage.Backend)
+	}
+	if err != nil {
+		redisClient.Close()
+		return nil, err
+	}
+	closeDB := st.closeDB
+	st.closeDB = func() {
+		redisClient.Close()
+		closeDB()
+	}
+
+	// Создаём новый экземпляр minIO клиента
+	minioClient, err := minio.New(ctx, log, cfg.Minio)
+	if err != nil {
+		st.closeDB()
+		return nil, fmt.Errorf("failed to connect to minIO: %w", err)
+	}
+
+	// Кэш пользователей перед UserById
+	if cfg.UserCache.Enabled {
+		cache, err := usercache.New(ctx, log, redisClient, &cfg.UserCache)
+		if err != nil {
+			st.closeDB()
+			return nil, err
+		}
+
+		st.main = cachedStorage{Storage: st.main, cache: cache}
+		closeDB := st.closeDB
+		st.closeDB = func() {
+			cache.Close()
+			closeDB()
+		}
+	}
+
+	st.sessions = redisstorage.New(redisClient, cfg.Jwt.RefreshTokenTTL)
+	st.photos = miniostorage.New(minioClient, cfg.Minio.Bucket)
+
+	return st, nil
+}
+
+// connectPostgres подключается к postgres и готовит схему (см. prepareSchema)
+func connectPostgres(ctx context.Context, log *zap.Logger, cfg *config.Config, redisClient redis.UniversalClient) (*storages, error) {
+	// Создаём новый экземпляр подключения к бд
+	conn, err := postgres.New(ctx, cfg.Postgres)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+
+	if err := conn.Ping(ctx); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to ping database: %w", err)
+	}
+
+	migrator, err := migrations.NewPostgres(postgres.URL(cfg.Postgres))
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	defer migrator.Close()
+
+	if err := prepareSchema(ctx, log, cfg.Storage.Migrations, migrator); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	postgresStorage := postgresql.New(conn)
+	closeDB := conn.Close
+
+	// Чтение пользователей уходит на реплики, если они заданы
+	if len(cfg.Postgres.Replicas) > 0 {
+		replicas, err := postgres.NewReplicas(ctx, log, conn, cfg.Postgres)
+		if err != nil {
+			conn.Close()
+			return nil, err
+		}
+
+		marks := redisstorage.NewWriteMarks(redisClient, cfg.Postgres.ReadYourWritesWindow)
+		postgresStorage = postgresql.NewWithReplicas(conn, replicas, marks, cfg.Postgres.ReadYourWritesWindow)
+		closeDB = func() {
+			replicas.Close()
+			conn.Close()
+		}
+	}
+
+	return &storages{
+		main: postgresStorage,
+		// advisory lock в postgres: фоновый процесс работает только на одной реплике
+		leader: func(name string) Leader {
+			return postgres.NewLeader(conn, name)
+		},
+		webhooks: postgresStorage,
+		closeDB:  closeDB,
+	}, nil
+}
+
+// connectSqlite открывает файл sqlite и готовит схему (см. prepareSchema). Файл принадлежит
+// одному процессу, поэтому, как и в режиме --dev, он всегда лидер.
+func connectSqlite(ctx context.Context, log *zap.Logger, cfg *config.Config) (*storages, error) {
+	db, err := sqlite.New(ctx, cfg.Sqlite)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
+
+	migrator, err := migrations.NewSqlite(db)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	if err := prepareSchema(ctx, log, cfg.Storage.Migrations, migrator); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	sqliteStorage := sqlitestorage.New(db)
+
+	return &storages{
+		main: sqliteStorage,
+		leader: func(string) Leader {
+			return memory.Leader{}
+		},
+		webhooks: sqliteStorage,
+		closeDB: func() {
+			db.Close()
+		},
+	}, nil
+}
+
+// prepareSchema применяет миграции (storage.migrations: auto) или только проверяет,
+// что схема совместима со сборкой (check): на нескольких репликах миграции запускает sso migrate up
+func prepareSchema(ctx context.Context, log *zap.Logger, mode string, migrator *migrations.Migrator) error {
+	switch mode {
+	case config.MigrationsAuto:
+		if err := migrator.Up(ctx); err != nil {
+			return fmt.Errorf("failed to migrate database: %w", err)
+		}
+	case config.MigrationsCheck:
+	default:
+		return fmt.Errorf("unknown storage migrations mode %q", mode)
+	}
+
+	status, err := migrator.Status(ctx)
+	if err != nil {
+		return err
+	}
+
+	if err := status.Compatible(); err != nil {
+		return err
+	}
+
+	if status.Version > status.Latest() {
+		log.Info("database schema is newer than this build",
+			zap.Uint("version", status.Version),
+			zap.Uint("latest", status.Latest()),
+		)
+	}
+
+	return nil
+}
+
+// memoryStorages создаёт хранилища в памяти для режима --dev. Процесс один, поэтому он всегда лидер.
+func memoryStorages(cfg *config.Config) *storages {
+	return &storages{
+		main:     memory.New(),
+		sessions: memory.NewSessions(cfg.Jwt.RefreshTokenTTL),
+		photos:   memory.NewObjects(cfg.Minio.Bucket),
+		leader: func(string) Leader {
+			return memory.Leader{}
+		},
+	}
+}
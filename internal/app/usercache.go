@@ -0,0 +1,109 @@
+package app
+
+import (
+	"context"
+	"time"
+
+	"github.com/DenisBochko/yandex_SSO/internal/domain/models"
+	"github.com/DenisBochko/yandex_SSO/internal/storage/usercache"
+)
+
+// cachedStorage - основное хранилище с кэшем пользователей (user_cache): UserById читает через кэш,
+// методы, которые меняют пользователя, сбрасывают его из кэша после успешной записи.
+// Пользователя, которого собираются записать, сервисы читают внутри InTx: там кэш не используется
+type cachedStorage struct {
+	Storage
+	cache *usercache.Cache
+}
+
+func (s cachedStorage) UserById(ctx context.Context, id string) (models.User, error) {
+	return s.cache.User(ctx, id, s.Storage.UserById)
+}
+
+func (s cachedStorage) InTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	return s.cache.InTx(ctx, s.Storage.InTx, fn)
+}
+
+func (s cachedStorage) UpdateUser(ctx context.Context, user models.User) (bool, error) {
+	ok, err := s.Storage.UpdateUser(ctx, user)
+	if err == nil {
+		s.cache.Invalidate(ctx, user.ID)
+	}
+	return ok, err
+}
+
+func (s cachedStorage) DeleteUser(ctx context.Context, id string) (bool, error) {
+	ok, err := s.Storage.DeleteUser(ctx, id)
+	if err == nil {
+		s.cache.Invalidate(ctx, id)
+	}
+	return ok, err
+}
+
+func (s cachedStorage) SetUserStatus(ctx context.Context, id string, status models.UserStatus, reason string, until time.Time) (bool, error) {
+	ok, err := s.Storage.SetUserStatus(ctx, id, status, reason, until)
+	if err == nil {
+		s.cache.Invalidate(ctx, id)
+	}
+	return ok, err
+}
+
+func (s cachedStorage) SetUserPhone(ctx context.Context, id string, phone string) (bool, error) {
+	ok, err := s.Storage.SetUserPhone(ctx, id, phone)
+	if err == nil {
+		s.cache.Invalidate(ctx, id)
+	}
+	return ok, err
+}
+
+func (s cachedStorage) VerifyToken(ctx context.Context, token string) (string, error) {
+	userID, err := s.Storage.VerifyToken(ctx, token)
+	if err == nil {
+		s.cache.Invalidate(ctx, userID)
+	}
+	return userID, err
+}
+
+func (s cachedStorage) ConsumeVerificationCode(ctx context.Context, userID string, channel models.CodeChannel) (bool, error) {
+	ok, err := s.Storage.ConsumeVerificationCode(ctx, userID, channel)
+	if err == nil {
+		s.cache.Invalidate(ctx, userID)
+	}
+	return ok, err
+}
+
+func (s cachedStorage) ChangeUsername(ctx context.Context, userID string, username string, skeleton string, now time.Time, cooldown time.Duration, hold time.Duration) error {
+	err := s.Storage.ChangeUsername(ctx, userID, username, skeleton, now, cooldown, hold)
+	if err == nil {
+		s.cache.Invalidate(ctx, userID)
+	}
+	return err
+}
+
+// SetEmailStatus без userID меняет всех пользователей с адресом emailCanonical: их id ищутся после записи
+func (s cachedStorage) SetEmailStatus(ctx context.Context, userID string, emailCanonical string, status models.EmailStatus, reason string, at time.Time) (int64, error) {
+	n, err := s.Storage.SetEmailStatus(ctx, userID, emailCanonical, status, reason, at)
+	if err != nil || n == 0 {
+		return n, err
+	}
+
+	if userID == "" {
+		user, err := s.Storage.User(ctx, emailCanonical, emailCanonical)
+		if err != nil {
+			// статус записан, в кэше он обновится не позже чем через user_cache.ttl
+			return n, nil
+		}
+		userID = user.ID
+	}
+
+	s.cache.Invalidate(ctx, userID)
+	return n, nil
+}
+
+func (s cachedStorage) ResetEmailStatus(ctx context.Context, userID string) error {
+	err := s.Storage.ResetEmailStatus(ctx, userID)
+	if err == nil {
+		s.cache.Invalidate(ctx, userID)
+	}
+	return err
+}
@@ -0,0 +1,276 @@
+package webhooksapp
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/DenisBochko/yandex_SSO/internal/config"
+	"github.com/DenisBochko/yandex_SSO/internal/domain/models"
+	"github.com/DenisBochko/yandex_SSO/lib/netguard"
+	"github.com/DenisBochko/yandex_SSO/lib/webhooksig"
+	"github.com/DenisBochko/yandex_SSO/pkg/metrics"
+
+	"go.uber.org/zap"
+)
+
+// Метрики доставки вебхуков
+var (
+	deliveredTotal      = metrics.NewCounter("webhooks_delivered_total")
+	failedAttemptsTotal = metrics.NewCounter("webhooks_failed_attempts_total")
+	deadTotal           = metrics.NewCounter("webhooks_dead_total")
+)
+
+// сколько байт ответа сохранять в журнале попыток
+const maxResponseBody = 1024
+
+type Storage interface {
+	PendingWebhookDeliveries(ctx context.Context, now time.Time, limit int) ([]models.WebhookDelivery, error)
+	MarkWebhookDelivered(ctx context.Context, id int64, attempt models.WebhookDeliveryAttempt, deliveredAt time.Time) error
+	MarkWebhookFailed(ctx context.Context, id int64, attempt models.WebhookDeliveryAttempt, nextAttemptAt time.Time, dead bool) error
+}
+
+// Leader - выбор лидера среди реплик, чтобы одна доставка не отправлялась несколькими репликами одновременно
+type Leader interface {
+	TryAcquire(ctx context.Context) (bool, error)
+	Release(ctx context.Context) error
+}
+
+// App отправляет доставки вебхуков: POST с телом события в JSON и подписью HMAC-SHA256
+// в заголовке X-Webhook-Signature (см. lib/webhooksig). Успех - любой ответ 2xx,
+// иначе попытка повторяется с экспоненциальной задержкой, пока не кончатся MaxAttempts.
+// Порядок доставки событий не гарантируется: получатель упорядочивает их по occurred_at.
+type App struct {
+	log     *zap.Logger
+	storage Storage
+	leader  Leader
+	cfg     *config.WebhooksConfig
+	client  *http.Client
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// Создаём новый worker доставки вебхуков
+func New(log *zap.Logger, storage Storage, leader Leader, cfg *config.WebhooksConfig) *App {
+	// адрес проверяется при каждом подключении: подписка могла пройти проверку, а DNS
+	// потом начал отвечать внутренним адресом. Прокси из окружения не используется,
+	// иначе проверялся бы адрес прокси, а не получателя
+	dialer := &net.Dialer{Timeout: cfg.Timeout}
+	if !cfg.AllowPrivate {
+		dialer.Control = netguard.Control
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+
+	return &App{
+		log:     log.With(zap.String("component", "webhooks")),
+		storage: storage,
+		leader:  leader,
+		cfg:     cfg,
+		client: &http.Client{
+			Timeout:   cfg.Timeout,
+			Transport: transport,
+			// перенаправления не выполняются: подпись выдана для адреса подписки
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+}
+
+// Run блокируется до вызова Stop
+func (a *App) Run() {
+	defer close(a.done)
+
+	if !a.cfg.Enabled {
+		a.log.Info("webhooks are disabled")
+		<-a.stop
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go func() {
+		<-a.stop
+		cancel()
+	}()
+
+	a.log.Info("webhook worker is running", zap.Duration("interval", a.cfg.PollInterval), zap.Int("workers", a.cfg.Workers))
+
+	ticker := time.NewTicker(a.cfg.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		a.runOnce(ctx)
+
+		select {
+		case <-ctx.Done():
+			releaseCtx, releaseCancel := context.WithTimeout(context.Background(), 5*time.Second)
+			if err := a.leader.Release(releaseCtx); err != nil {
+				a.log.Warn("failed to release leadership", zap.Error(err))
+			}
+			releaseCancel()
+
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (a *App) runOnce(ctx context.Context) {
+	isLeader, err := a.leader.TryAcquire(ctx)
+	if err != nil {
+		a.log.Warn("leader election failed", zap.Error(err))
+		return
+	}
+
+	if !isLeader {
+		return
+	}
+
+	for ctx.Err() == nil {
+		deliveries, err := a.storage.PendingWebhookDeliveries(ctx, time.Now().UTC(), a.cfg.BatchSize)
+		if err != nil {
+			a.log.Error("failed to get pending webhook deliveries", zap.Error(err))
+			return
+		}
+
+		a.deliverBatch(ctx, deliveries)
+
+		if len(deliveries) < a.cfg.BatchSize {
+			return
+		}
+	}
+}
+
+// deliverBatch отправляет пачку не более чем в Workers потоков
+func (a *App) deliverBatch(ctx context.Context, deliveries []models.WebhookDelivery) {
+	workers := a.cfg.Workers
+	if workers <= 0 {
+		workers = 1
+	}
+
+	sem := make(chan struct{}, workers)
+	var wg sync.WaitGroup
+
+	for _, delivery := range deliveries {
+		sem <- struct{}{}
+		wg.Add(1)
+
+		go func(delivery models.WebhookDelivery) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			a.deliver(ctx, delivery)
+		}(delivery)
+	}
+
+	wg.Wait()
+}
+
+func (a *App) deliver(ctx context.Context, delivery models.WebhookDelivery) {
+	started := time.Now()
+	attempt := a.send(ctx, delivery)
+	attempt.Duration = time.Since(started)
+
+	now := time.Now().UTC()
+
+	if attempt.Error == "" {
+		deliveredTotal.Add(1)
+		if err := a.storage.MarkWebhookDelivered(ctx, delivery.ID, attempt, now); err != nil {
+			// запрос уже выполнен и будет повторён - получатель должен быть идемпотентен по X-Webhook-Event-Id
+			a.log.Error("failed to mark webhook delivered", zap.Int64("deliveryId", delivery.ID), zap.Error(err))
+		}
+		return
+	}
+
+	failedAttemptsTotal.Add(1)
+
+	dead := delivery.Attempts+1 >= a.cfg.MaxAttempts
+	next := now.Add(a.backoff(delivery.Attempts))
+	if dead {
+		deadTotal.Add(1)
+	}
+
+	a.log.Warn("failed to deliver webhook",
+		zap.Int64("deliveryId", delivery.ID), zap.String("subscriptionId", delivery.SubscriptionID),
+		zap.String("eventType", delivery.EventType), zap.Int("attempts", delivery.Attempts+1),
+		zap.Int("statusCode", attempt.StatusCode), zap.String("error", attempt.Error), zap.Bool("dead", dead))
+
+	if err := a.storage.MarkWebhookFailed(ctx, delivery.ID, attempt, next, dead); err != nil {
+		a.log.Error("failed to mark webhook failed", zap.Int64("deliveryId", delivery.ID), zap.Error(err))
+	}
+}
+
+// send выполняет запрос. Ошибка попытки возвращается в поле Error, чтобы попасть в журнал.
+func (a *App) send(ctx context.Context, delivery models.WebhookDelivery) models.WebhookDeliveryAttempt {
+	var attempt models.WebhookDeliveryAttempt
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "sso-webhooks/1.0")
+	req.Header.Set(webhooksig.HeaderSignature, webhooksig.Sign(delivery.Secret, time.Now(), delivery.Payload))
+	req.Header.Set(webhooksig.HeaderEventID, delivery.EventID)
+	req.Header.Set(webhooksig.HeaderEventType, delivery.EventType)
+	req.Header.Set(webhooksig.HeaderDelivery, strconv.FormatInt(delivery.ID, 10))
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, maxResponseBody))
+	// остаток тела дочитываем, чтобы соединение вернулось в пул
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+
+	attempt.StatusCode = resp.StatusCode
+	// postgres не примет в TEXT некорректный UTF-8 и нулевые байты
+	attempt.ResponseBody = strings.ReplaceAll(string(bytes.ToValidUTF8(body, nil)), "\x00", "")
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		attempt.Error = fmt.Sprintf("unexpected status %d", resp.StatusCode)
+	}
+
+	return attempt
+}
+
+// backoff - экспоненциальная задержка перед следующей попыткой, не больше MaxBackoff
+func (a *App) backoff(attempts int) time.Duration {
+	delay := a.cfg.BaseBackoff
+	for i := 0; i < attempts && delay < a.cfg.MaxBackoff; i++ {
+		delay *= 2
+	}
+
+	if delay > a.cfg.MaxBackoff {
+		return a.cfg.MaxBackoff
+	}
+	return delay
+}
+
+func (a *App) Stop() {
+	a.log.Info("stopping webhook worker")
+	close(a.stop)
+	<-a.done
+}
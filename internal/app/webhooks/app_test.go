@@ -0,0 +1,187 @@
+package webhooksapp
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/DenisBochko/yandex_SSO/internal/config"
+	"github.com/DenisBochko/yandex_SSO/internal/domain/models"
+	"github.com/DenisBochko/yandex_SSO/internal/storage/memory"
+	"github.com/DenisBochko/yandex_SSO/lib/netguard"
+	"github.com/DenisBochko/yandex_SSO/lib/webhooksig"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+type result struct {
+	attempt       models.WebhookDeliveryAttempt
+	delivered     bool
+	nextAttemptAt time.Time
+	dead          bool
+}
+
+// deliveries отдаёт заданные доставки один раз и запоминает, чем закончилась каждая
+type deliveries struct {
+	mu      sync.Mutex
+	pending []models.WebhookDelivery
+	results map[int64]result
+}
+
+func (d *deliveries) PendingWebhookDeliveries(ctx context.Context, now time.Time, limit int) ([]models.WebhookDelivery, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	pending := d.pending
+	d.pending = nil
+	return pending, nil
+}
+
+func (d *deliveries) MarkWebhookDelivered(ctx context.Context, id int64, attempt models.WebhookDeliveryAttempt, deliveredAt time.Time) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.results[id] = result{attempt: attempt, delivered: true}
+	return nil
+}
+
+func (d *deliveries) MarkWebhookFailed(ctx context.Context, id int64, attempt models.WebhookDeliveryAttempt, nextAttemptAt time.Time, dead bool) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.results[id] = result{attempt: attempt, nextAttemptAt: nextAttemptAt, dead: dead}
+	return nil
+}
+
+// deliverTo отправляет одну доставку на url и возвращает её итог
+func deliverTo(t *testing.T, cfg config.WebhooksConfig, url string, attempts int) result {
+	t.Helper()
+
+	st := &deliveries{
+		pending: []models.WebhookDelivery{{
+			ID:        1,
+			EventID:   "event-id",
+			EventType: string(models.UserEventRegistered),
+			Payload:   []byte(`{"type":"user.registered"}`),
+			Attempts:  attempts,
+			URL:       url,
+			Secret:    "secret",
+		}},
+		results: map[int64]result{},
+	}
+
+	New(zap.NewNop(), st, memory.Leader{}, &cfg).runOnce(context.Background())
+
+	res, ok := st.results[1]
+	require.True(t, ok, "delivery is not marked")
+	return res
+}
+
+// testConfig разрешает loopback: получатели в тестах - httptest на 127.0.0.1
+func testConfig() config.WebhooksConfig {
+	return config.WebhooksConfig{
+		BatchSize:    10,
+		Workers:      2,
+		Timeout:      5 * time.Second,
+		MaxAttempts:  3,
+		BaseBackoff:  time.Second,
+		MaxBackoff:   time.Minute,
+		AllowHTTP:    true,
+		AllowPrivate: true,
+	}
+}
+
+func TestDelivered(t *testing.T) {
+	headers := make(chan http.Header, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headers <- r.Header.Clone()
+		w.Write([]byte("ok"))
+	}))
+	defer srv.Close()
+
+	delivered := deliveredTotal.Value()
+
+	res := deliverTo(t, testConfig(), srv.URL, 0)
+	require.True(t, res.delivered)
+
+	header := <-headers
+	require.Equal(t, "event-id", header.Get(webhooksig.HeaderEventID))
+	require.NotEmpty(t, header.Get(webhooksig.HeaderSignature))
+	require.Equal(t, http.StatusOK, res.attempt.StatusCode)
+	require.Equal(t, "ok", res.attempt.ResponseBody)
+	require.Equal(t, delivered+1, deliveredTotal.Value())
+}
+
+func TestRetryScheduled(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		w.Write([]byte("try later"))
+	}))
+	defer srv.Close()
+
+	failed := failedAttemptsTotal.Value()
+
+	// вторая неудача: задержка base_backoff * 2
+	start := time.Now().UTC()
+	res := deliverTo(t, testConfig(), srv.URL, 1)
+
+	require.False(t, res.delivered)
+	require.False(t, res.dead)
+	require.Equal(t, http.StatusServiceUnavailable, res.attempt.StatusCode)
+	require.Equal(t, "try later", res.attempt.ResponseBody)
+	require.Equal(t, "unexpected status 503", res.attempt.Error)
+	require.WithinRange(t, res.nextAttemptAt, start.Add(2*time.Second), time.Now().UTC().Add(2*time.Second))
+	require.Equal(t, failed+1, failedAttemptsTotal.Value())
+}
+
+func TestDeadAfterMaxAttempts(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	dead := deadTotal.Value()
+
+	cfg := testConfig()
+	require.False(t, deliverTo(t, cfg, srv.URL, cfg.MaxAttempts-2).dead)
+	require.True(t, deliverTo(t, cfg, srv.URL, cfg.MaxAttempts-1).dead)
+	require.Equal(t, dead+1, deadTotal.Value())
+}
+
+func TestRedirectNotFollowed(t *testing.T) {
+	var hits atomic.Int32
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+	}))
+	defer target.Close()
+
+	srv := httptest.NewServer(http.RedirectHandler(target.URL, http.StatusTemporaryRedirect))
+	defer srv.Close()
+
+	res := deliverTo(t, testConfig(), srv.URL, 0)
+	require.False(t, res.delivered)
+	require.Equal(t, http.StatusTemporaryRedirect, res.attempt.StatusCode)
+	require.Zero(t, hits.Load())
+}
+
+func TestPrivateAddressRefused(t *testing.T) {
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+	}))
+	defer srv.Close()
+
+	cfg := testConfig()
+	cfg.AllowPrivate = false
+
+	res := deliverTo(t, cfg, srv.URL, 0)
+	require.False(t, res.delivered)
+	require.Zero(t, res.attempt.StatusCode)
+	require.Contains(t, res.attempt.Error, netguard.ErrForbiddenAddress.Error())
+	require.Zero(t, hits.Load())
+}
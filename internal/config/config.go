@@ -2,24 +2,53 @@ package config
 
 import (
 	"flag"
+	"fmt"
 	"os"
 	"time"
 	"github.com/DenisBochko/yandex_SSO/pkg/kafka"
+	"github.com/DenisBochko/yandex_SSO/pkg/metrics"
 	minio "github.com/DenisBochko/yandex_SSO/pkg/minIO"
+	"github.com/DenisBochko/yandex_SSO/pkg/nats"
 	"github.com/DenisBochko/yandex_SSO/pkg/postgres"
 	redisClient "github.com/DenisBochko/yandex_SSO/pkg/redis"
+	"github.com/DenisBochko/yandex_SSO/pkg/smtp"
+	"github.com/DenisBochko/yandex_SSO/pkg/sqlite"
 
 	"github.com/ilyakaznacheev/cleanenv"
 )
 
 type Config struct {
-	Env      string                     `yaml:"env" env-default:"local"`
-	Jwt      JwtConfig                  `yaml:"jwt"`
-	GRPC     GRPCConfig                 `yaml:"grpc"`
-	Postgres postgres.PostgresCfg       `yaml:"POSTGRES"`
-	Minio    minio.MinioConfig          `yaml:"MINIO"`
-	Kafka    kafka.KafkaConfig          `yaml:"KAFKA"`
-	Redis    redisClient.RedisClientCfg `yaml:"REDIS"`
+	Env       string                     `yaml:"env" env-default:"local"`
+	Dev       bool                       `yaml:"-"` // режим разработки (флаг --dev), см. applyDevMode
+	Jwt       JwtConfig                  `yaml:"jwt"`
+	Verify    VerificationConfig         `yaml:"verification"`
+	Phone     PhoneConfig                `yaml:"phone"`
+	Email     EmailConfig                `yaml:"email"`
+	Username  UsernameConfig             `yaml:"username"`
+	GRPC      GRPCConfig                 `yaml:"grpc"`
+	Admin     AdminConfig                `yaml:"admin"`
+	StepUp    StepUpConfig               `yaml:"step_up"`
+	Janitor   JanitorConfig              `yaml:"janitor"`
+	Events    SecurityEventsConfig       `yaml:"security_events"`
+	Devices   DevicesConfig              `yaml:"devices"`
+	Risk      RiskConfig                 `yaml:"risk"`
+	Outbox    OutboxConfig               `yaml:"outbox"`
+	Transport TransportConfig            `yaml:"transport"`
+	Webhooks  WebhooksConfig             `yaml:"webhooks"`
+	Mail      MailConfig                 `yaml:"mail"`
+	Feedback  EmailFeedbackConfig        `yaml:"email_feedback"`
+	Commands  CommandsConfig             `yaml:"commands"`
+	Schemas   SchemasConfig              `yaml:"schemas"`
+	Metrics   metrics.MetricsConfig      `yaml:"METRICS"`
+	Storage   StorageConfig              `yaml:"storage"`
+	UserCache UserCacheConfig            `yaml:"user_cache"`
+	Postgres  postgres.PostgresCfg       `yaml:"POSTGRES"`
+	Sqlite    sqlite.SqliteConfig        `yaml:"SQLITE"`
+	Minio     minio.MinioConfig          `yaml:"MINIO"`
+	Kafka     kafka.KafkaConfig          `yaml:"KAFKA"`
+	Nats      nats.NatsConfig            `yaml:"NATS"`
+	Redis     redisClient.RedisClientCfg `yaml:"REDIS"`
+	Smtp      smtp.SmtpConfig            `yaml:"SMTP"`
 }
 
 type JwtConfig struct {
@@ -29,14 +58,203 @@ type JwtConfig struct {
 	RefreshTokenTTL       time.Duration `yaml:"refresh_token_ttl" env-required:"true"`
 }
 
+// Способы подтверждения email
+const (
+	VerificationModeLink = "link" // только ссылка с токеном
+	VerificationModeCode = "code" // только числовой код
+	VerificationModeBoth = "both" // ссылка и код в одном письме
+)
+
+type VerificationConfig struct {
+	Mode        string        `yaml:"mode" env-default:"link"`
+	TTL         time.Duration `yaml:"ttl" env-default:"10m"`             // время жизни ссылки и кода
+	CodeLength  int           `yaml:"code_length" env-default:"6"`       // количество цифр в коде
+	MaxAttempts int           `yaml:"code_max_attempts" env-default:"5"` // попыток ввода за code_issue_window
+
+	CodeResendCooldown time.Duration `yaml:"code_resend_cooldown" env-default:"1m"` // пауза перед повторной отправкой кода
+	CodeIssueWindow    time.Duration `yaml:"code_issue_window" env-default:"1h"`    // окно, в котором считаются отправки и попытки
+	CodeMaxIssues      int           `yaml:"code_max_issues" env-default:"5"`       // кодов на пользователя за окно
+}
+
+type PhoneConfig struct {
+	DefaultCountryCode string        `yaml:"default_country_code" env-default:"7"` // код страны для номеров без +
+	TrunkPrefix        string        `yaml:"trunk_prefix" env-default:"8"`         // префикс междугородней связи в местных номерах
+	OTPTTL             time.Duration `yaml:"otp_ttl" env-default:"5m"`             // время жизни SMS-кода
+	OTPResendCooldown  time.Duration `yaml:"otp_resend_cooldown" env-default:"1m"` // пауза перед повторной отправкой SMS
+	OTPIssueWindow     time.Duration `yaml:"otp_issue_window" env-default:"1h"`    // окно, в котором считаются SMS и попытки ввода
+	OTPMaxIssues       int           `yaml:"otp_max_issues" env-default:"5"`       // SMS на один номер за окно
+	OTPMaxPerIP        int           `yaml:"otp_max_per_ip" env-default:"20"`      // SMS с одного IP за окно, 0 - без ограничения
+}
+
+type EmailConfig struct {
+	// учитывать правила провайдеров при сравнении адресов (точки и +теги в Gmail, алиасы доменов Яндекса)
+	ProviderCanonicalization bool `yaml:"provider_canonicalization" env-default:"false"`
+}
+
+type UsernameConfig struct {
+	Reserved       []string      `yaml:"reserved"`                           // дополнительно к встроенному списку lib/handle
+	ChangeCooldown time.Duration `yaml:"change_cooldown" env-default:"720h"` // минимальный интервал между сменами хэндла
+	HoldPeriod     time.Duration `yaml:"hold_period" env-default:"2160h"`    // сколько прежний хэндл недоступен другим
+}
+
+// AdminConfig - служебный gRPC сервис Admin (proto/admin/v1). Его методы вызываются
+// с заголовком authorization: Bearer <token>; пустой token - сервис не регистрируется
+type AdminConfig struct {
+	Token string `yaml:"token" env:"ADMIN_TOKEN"`
+}
+
+// StepUpConfig - методы, для которых нужен недавний ввод учётных данных (см. Auth.Reauthenticate)
+type StepUpConfig struct {
+	MaxAge  time.Duration `yaml:"max_age" env-default:"5m"`                     // сколько после входа метод доступен без повторной проверки
+	Methods []string      `yaml:"methods" env-default:"/auth.Users/DeleteUser"` // полные имена gRPC методов, [] - без step-up
+	// смена email в UpdateUser. По умолчанию выключено: cleanenv не отличает false в yaml от отсутствующего ключа
+	// и заменил бы его значением по умолчанию. В поставляемых конфигах включено
+	EmailChange bool `yaml:"email_change" env:"STEP_UP_EMAIL_CHANGE" env-default:"false"`
+}
+
 type GRPCConfig struct {
-	Port    int           `yaml:"port"`
-	Timeout time.Duration `yaml:"timeout"`
+	Port            int           `yaml:"port"`
+	Timeout         time.Duration `yaml:"timeout"`
+	AuthInterceptor bool          `yaml:"auth_interceptor" env-default:"false"` // проверка access токена на всех непубличных методах
+	TrustedProxies  []string      `yaml:"trusted_proxies"`                      // адреса и подсети прокси, от которых принимаются x-forwarded-for и x-real-ip
+}
+
+type SecurityEventsConfig struct {
+	Retention time.Duration `yaml:"retention" env-default:"2160h"` // сколько хранятся события безопасности
+}
+
+// DevicesConfig - уведомления о входе с незнакомого устройства. NotifyNewDevice по умолчанию выключен
+// по той же причине, что и StepUpConfig.EmailChange, в поставляемых конфигах он включён
+type DevicesConfig struct {
+	NotifyNewDevice bool          `yaml:"notify_new_device" env:"DEVICES_NOTIFY_NEW_DEVICE" env-default:"false"` // уведомлять о входе с незнакомого устройства
+	RevokeTokenTTL  time.Duration `yaml:"revoke_token_ttl" env-default:"72h"`                                    // время жизни ссылки "это был не я"
+}
+
+// RiskConfig - оценка риска входа (internal/services/risk).
+// Балл от 0 до 100 - сумма весов сработавших признаков.
+type RiskConfig struct {
+	Enabled            bool        `yaml:"enabled" env-default:"false"`
+	ChallengeThreshold int         `yaml:"challenge_threshold" env-default:"40"` // с этого балла вход нужно подтвердить кодом из SMS
+	DenyThreshold      int         `yaml:"deny_threshold" env-default:"80"`      // с этого балла вход запрещён
+	Weights            RiskWeights `yaml:"weights"`
+
+	FailedAttemptsWindow time.Duration `yaml:"failed_attempts_window" env-default:"15m"`
+	FailedAttemptsLimit  int           `yaml:"failed_attempts_limit" env-default:"5"` // столько неудач за окно - полный балл
+	DormantAfter         time.Duration `yaml:"dormant_after" env-default:"2160h"`     // без входов дольше - аккаунт спящий
+	IPBlocklistPath      string        `yaml:"ip_blocklist_path"`                     // адреса и подсети по одной на строку
+	GeoIPPaths           []string      `yaml:"geoip_paths"`                           // CSV с колонками network, latitude, longitude
+	MaxTravelSpeedKmh    float64       `yaml:"max_travel_speed_kmh" env-default:"900"`
+}
+
+type RiskWeights struct {
+	FailedAttempts   int `yaml:"failed_attempts" env-default:"30"`
+	NewDevice        int `yaml:"new_device" env-default:"20"`
+	IPReputation     int `yaml:"ip_reputation" env-default:"50"`
+	Dormancy         int `yaml:"dormant_account" env-default:"10"`
+	ImpossibleTravel int `yaml:"impossible_travel" env-default:"60"`
+}
+
+// OutboxConfig - доставка сообщений в kafka через таблицу outbox.
+// Сообщение пишется в той же транзакции, что и изменение данных, а relay отправляет его в брокер.
+// Enabled по умолчанию выключен, как и StepUpConfig.EmailChange, в поставляемых конфигах outbox включён.
+type OutboxConfig struct {
+	Enabled      bool          `yaml:"enabled" env:"OUTBOX_ENABLED" env-default:"false"`
+	PollInterval time.Duration `yaml:"poll_interval" env-default:"1s"`
+	BatchSize    int           `yaml:"batch_size" env-default:"100"`
+	BaseBackoff  time.Duration `yaml:"base_backoff" env-default:"1s"` // задержка после первой неудачной попытки, дальше удваивается
+	MaxBackoff   time.Duration `yaml:"max_backoff" env-default:"5m"`
+	Retention    time.Duration `yaml:"retention" env-default:"168h"` // сколько хранить уже отправленные сообщения
+}
+
+// TransportConfig - куда отправляются события: kafka, nats, file (строки JSON в файл или stdout)
+// или memory (только в памяти процесса, для тестов и разработки)
+type TransportConfig struct {
+	Backend     string `yaml:"backend" env:"TRANSPORT_BACKEND" env-default:"kafka"`
+	File        string `yaml:"file" env:"TRANSPORT_FILE"`        // для file: путь к файлу, пустой - stdout
+	MemoryLimit int    `yaml:"memory_limit" env-default:"10000"` // для memory: сколько последних сообщений хранить
+}
+
+// WebhooksConfig - доставка событий пользователей партнёрам HTTP-запросами.
+// После MaxAttempts неудачных попыток доставка переходит в dead и ждёт ручной повторной отправки.
+type WebhooksConfig struct {
+	Enabled      bool          `yaml:"enabled" env-default:"false"`
+	PollInterval time.Duration `yaml:"poll_interval" env-default:"1s"`
+	BatchSize    int           `yaml:"batch_size" env-default:"50"`
+	Workers      int           `yaml:"workers" env-default:"8"`       // сколько запросов отправляется одновременно
+	Timeout      time.Duration `yaml:"timeout" env-default:"10s"`     // таймаут одного запроса
+	MaxAttempts  int           `yaml:"max_attempts" env-default:"10"` // после стольких неудач - dead
+	BaseBackoff  time.Duration `yaml:"base_backoff" env-default:"10s"`
+	MaxBackoff   time.Duration `yaml:"max_backoff" env-default:"6h"`
+	Retention    time.Duration `yaml:"retention" env-default:"720h"`      // сколько хранить завершённые доставки и их журнал
+	AllowHTTP    bool          `yaml:"allow_http" env-default:"false"`    // разрешить адреса http:// (для локальной разработки)
+	AllowPrivate bool          `yaml:"allow_private" env-default:"false"` // разрешить loopback, частные и link-local адреса (для локальной разработки)
+}
+
+// MailConfig - отправка писем напрямую по SMTP (SMTP) вместо сообщений для внешнего почтового сервиса.
+// Письма сохраняются в outbox и отправляются relay, поэтому SMTP не задерживает транзакции
+type MailConfig struct {
+	Enabled       bool   `yaml:"enabled" env:"MAIL_ENABLED" env-default:"false"`
+	TemplatesDir  string `yaml:"templates_dir"` // свои шаблоны вместо встроенных (internal/adapter/mailtemplates)
+	DefaultLocale string `yaml:"default_locale" env-default:"en"`
+	ProductName   string `yaml:"product_name" env-default:"SSO"`
+	VerifyURL     string `yaml:"verify_url" env-default:"http://localhost:8080/verify"` // к ссылке добавляется ?token=
+	RevokeURL     string `yaml:"revoke_url" env-default:"http://localhost:8080/revoke"` // ссылка "это был не я"
+}
+
+// EmailFeedbackConfig - чтение отчётов почтового сервиса о доставке (KAFKA_DELIVERY_STATUS_TOPIC).
+// Адреса с постоянным отказом или жалобой на спам исключаются из рассылки.
+type EmailFeedbackConfig struct {
+	Enabled bool `yaml:"enabled" env:"EMAIL_FEEDBACK_ENABLED" env-default:"false"`
+}
+
+// CommandsConfig - выполнение команд других сервисов над учётными записями (KAFKA_COMMANDS_TOPIC).
+// Итоги публикуются в KAFKA_COMMAND_RESULTS_TOPIC, неразборчивые команды - в KAFKA_DEAD_LETTER_TOPIC.
+type CommandsConfig struct {
+	Enabled   bool          `yaml:"enabled" env:"COMMANDS_ENABLED" env-default:"false"`
+	Retention time.Duration `yaml:"retention" env-default:"720h"` // сколько помнить ключи идемпотентности
+}
+
+// Основные хранилища пользователей, событий и outbox
+const (
+	StorageBackendPostgres = "postgres"
+	StorageBackendSqlite   = "sqlite" // один файл (секция SQLITE) для встроенных и edge-развёртываний с одной репликой
+)
+
+// UserCacheConfig - кэш пользователей по id перед основным хранилищем: redis, общий для реплик,
+// и небольшой LRU в памяти процесса. Изменения пользователя сбрасывают обе копии на всех репликах.
+type UserCacheConfig struct {
+	Enabled   bool          `yaml:"enabled" env:"USER_CACHE_ENABLED" env-default:"false"`
+	TTL       time.Duration `yaml:"ttl" env-default:"5m"`        // сколько запись живёт в redis
+	LocalTTL  time.Duration `yaml:"local_ttl" env-default:"10s"` // в памяти процесса: страховка, если сообщение о сбросе потерялось
+	LocalSize int           `yaml:"local_size" env-default:"10000"`
+}
+
+// Что делать со схемой бд при старте (storage.migrations)
+const (
+	MigrationsCheck = "check" // только проверить, что схема не отстаёт от сборки; миграции применяет sso migrate up
+	MigrationsAuto  = "auto"  // применить миграции при старте, для одной реплики и локальной разработки
+)
+
+type StorageConfig struct {
+	Backend    string `yaml:"backend" env:"STORAGE_BACKEND" env-default:"postgres"`
+	Migrations string `yaml:"migrations" env:"STORAGE_MIGRATIONS" env-default:"check"`
+}
+
+// SchemasConfig - каталог реестра схем событий (см. schemas/README.md)
+type SchemasConfig struct {
+	Dir string `yaml:"dir" env-default:"./schemas"`
+}
+
+type JanitorConfig struct {
+	Interval time.Duration `yaml:"interval" env-default:"10m"` // как часто удалять просроченные данные
 }
 
 // Must - значит, что функция не возвращает ошибку, а паникует, если не удалось загрузить конфигурацию
 func MustLoad() *Config {
-	path := fetchConfigPath()
+	path, dev := fetchConfigPath()
+	if path == "" && dev {
+		path = DevConfigPath
+	}
 	if path == "" {
 		panic("config path is empty")
 	}
@@ -52,21 +270,78 @@ func MustLoad() *Config {
 		panic("failed to read config: " + err.Error())
 	}
 
+	if err := config.Validate(); err != nil {
+		panic("invalid config: " + err.Error())
+	}
+
+	if dev {
+		config.applyDevMode()
+	}
+
 	return &config
 }
 
+// Validate проверяет значения, с которыми сервис не сможет работать,
+// чтобы он не запускался и не падал позже на первом обращении к ним
+func (c *Config) Validate() error {
+	if c.Janitor.Interval <= 0 {
+		return fmt.Errorf("janitor.interval must be positive, got %s", c.Janitor.Interval)
+	}
+
+	switch c.Verify.Mode {
+	case VerificationModeLink, VerificationModeCode, VerificationModeBoth:
+	default:
+		return fmt.Errorf("verification.mode must be %q, %q or %q, got %q",
+			VerificationModeLink, VerificationModeCode, VerificationModeBoth, c.Verify.Mode)
+	}
+
+	if c.Verify.CodeIssueWindow <= 0 || c.Verify.CodeMaxIssues <= 0 {
+		return fmt.Errorf("verification.code_issue_window and verification.code_max_issues must be positive")
+	}
+
+	if c.Phone.OTPIssueWindow <= 0 || c.Phone.OTPMaxIssues <= 0 {
+		return fmt.Errorf("phone.otp_issue_window and phone.otp_max_issues must be positive")
+	}
+
+	return nil
+}
+
+// DevConfigPath - конфиг, с которым запускается --dev, если путь не указан явно
+const DevConfigPath = "./config/dev_config.yaml"
+
+// applyDevMode отключает всё, что требует внешних сервисов. Хранилища заменяются реализациями
+// в памяти (internal/storage/memory), события пишутся в stdout, если не выбран транспорт file или memory.
+// Вебхуки, кэш пользователей, чтение топиков Kafka и отправка писем по SMTP выключаются.
+func (c *Config) applyDevMode() {
+	c.Dev = true
+
+	if c.Transport.Backend != "file" && c.Transport.Backend != "memory" {
+		c.Transport.Backend = "file"
+		c.Transport.File = ""
+	}
+
+	c.Webhooks.Enabled = false
+	c.Feedback.Enabled = false
+	c.Commands.Enabled = false
+	c.Mail.Enabled = false
+	c.UserCache.Enabled = false
+}
+
 // fetchConfigPath - получает путь к конфигурации из переменной окружения или флага при запуске
+// и признак режима разработки из флага --dev.
 // Приоритет: флаг > переменная окружения > значение по умолчанию
 // Если не удалось получить путь, возвращает пустую строку
-func fetchConfigPath() string {
+func fetchConfigPath() (string, bool) {
 	var result string
+	var dev bool
 
 	flag.StringVar(&result, "config", "", "Path to config file")
+	flag.BoolVar(&dev, "dev", false, "Run with in-memory storages and no external services")
 	flag.Parse()
 
 	if result == "" {
 		result = os.Getenv("CONFIG_PATH")
 	}
 
-	return result
+	return result, dev
 }
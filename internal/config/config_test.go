@@ -0,0 +1,92 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ilyakaznacheev/cleanenv"
+	"github.com/stretchr/testify/require"
+)
+
+func validConfig() Config {
+	return Config{
+		Janitor: JanitorConfig{Interval: time.Minute},
+		Verify:  VerificationConfig{Mode: VerificationModeLink, CodeIssueWindow: time.Hour, CodeMaxIssues: 5},
+		Phone:   PhoneConfig{OTPIssueWindow: time.Hour, OTPMaxIssues: 5},
+	}
+}
+
+func TestValidate(t *testing.T) {
+	cfg := validConfig()
+	require.NoError(t, cfg.Validate())
+
+	for _, interval := range []time.Duration{0, -time.Second} {
+		cfg := validConfig()
+		cfg.Janitor.Interval = interval
+		require.ErrorContains(t, cfg.Validate(), "janitor.interval")
+	}
+
+	for _, mode := range []string{VerificationModeLink, VerificationModeCode, VerificationModeBoth} {
+		cfg := validConfig()
+		cfg.Verify.Mode = mode
+		require.NoError(t, cfg.Validate())
+	}
+
+	for _, mode := range []string{"", "Code", "sms"} {
+		cfg := validConfig()
+		cfg.Verify.Mode = mode
+		require.ErrorContains(t, cfg.Validate(), "verification.mode")
+	}
+
+	cfg = validConfig()
+	cfg.Phone.OTPMaxIssues = 0
+	require.ErrorContains(t, cfg.Validate(), "phone.otp_max_issues")
+
+	cfg = validConfig()
+	cfg.Verify.CodeIssueWindow = 0
+	require.ErrorContains(t, cfg.Validate(), "verification.code_issue_window")
+}
+
+// sections - секции конфига с флагами, которые проверяет TestBoolFlags. Остальные секции требуют
+// адресов внешних сервисов, а теги у этих полей те же, что и в Config
+type sections struct {
+	StepUp  StepUpConfig  `yaml:"step_up"`
+	Devices DevicesConfig `yaml:"devices"`
+	Outbox  OutboxConfig  `yaml:"outbox"`
+}
+
+// readYAML читает секции из body так же, как MustLoad читает весь конфиг
+func readYAML(t *testing.T, body string) sections {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(body), 0o600))
+
+	var cfg sections
+	require.NoError(t, cleanenv.ReadConfig(path, &cfg))
+
+	return cfg
+}
+
+// Флаги со значением false в yaml не должны заменяться значением по умолчанию
+func TestBoolFlags(t *testing.T) {
+	cfg := readYAML(t, "step_up:\n  email_change: false\n")
+	require.False(t, cfg.StepUp.EmailChange)
+
+	cfg = readYAML(t, "step_up:\n  email_change: true\n")
+	require.True(t, cfg.StepUp.EmailChange)
+
+	cfg = readYAML(t, "devices:\n  notify_new_device: false\n")
+	require.False(t, cfg.Devices.NotifyNewDevice)
+
+	cfg = readYAML(t, "devices:\n  notify_new_device: true\n")
+	require.True(t, cfg.Devices.NotifyNewDevice)
+
+	cfg = readYAML(t, "outbox:\n  enabled: false\n")
+	require.False(t, cfg.Outbox.Enabled)
+
+	cfg = readYAML(t, "outbox:\n  enabled: true\n")
+	require.True(t, cfg.Outbox.Enabled)
+}
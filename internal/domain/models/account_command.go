@@ -0,0 +1,51 @@
+package models
+
+import "time"
+
+// AccountCommandType - команда над учётной записью от другого сервиса
+type AccountCommandType string
+
+const (
+	AccountCommandSuspend     AccountCommandType = "suspend"
+	AccountCommandUnsuspend   AccountCommandType = "unsuspend"
+	AccountCommandDelete      AccountCommandType = "delete"
+	AccountCommandForceLogout AccountCommandType = "force_logout"
+)
+
+func (t AccountCommandType) Valid() bool {
+	switch t {
+	case AccountCommandSuspend, AccountCommandUnsuspend, AccountCommandDelete, AccountCommandForceLogout:
+		return true
+	}
+	return false
+}
+
+// AccountCommand - команда из топика KAFKA_COMMANDS_TOPIC.
+// ID - ключ идемпотентности, его задаёт отправитель.
+type AccountCommand struct {
+	ID          string
+	Type        AccountCommandType
+	UserID      string
+	Reason      string
+	Until       time.Time // для suspend: окончание блокировки, нулевое - бессрочно
+	RequestedBy string    // сервис или сотрудник, от имени которого пришла команда
+}
+
+type AccountCommandStatus string
+
+const (
+	AccountCommandOK       AccountCommandStatus = "ok"
+	AccountCommandRejected AccountCommandStatus = "rejected"
+)
+
+// AccountCommandResult - итог выполнения команды, публикуется в KAFKA_COMMAND_RESULTS_TOPIC
+type AccountCommandResult struct {
+	CommandID   string
+	Command     AccountCommandType
+	UserID      string
+	RequestedBy string
+	Status      AccountCommandStatus
+	Error       string // причина отказа
+	Changed     bool   // false, если учётная запись уже была в нужном состоянии
+	CreatedAt   time.Time
+}
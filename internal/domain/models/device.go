@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// KnownDevice - устройство, с которого пользователь уже входил
+type KnownDevice struct {
+	UserID      string
+	Fingerprint string // см. clientinfo.Info.Fingerprint
+	UserAgent   string
+	IP          string // адрес последнего входа
+	FirstSeenAt time.Time
+	LastSeenAt  time.Time
+}
@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+// Типы отчётов о доставке писем
+const (
+	EmailFeedbackDelivered = "delivered"
+	EmailFeedbackBounce    = "bounce"
+	EmailFeedbackComplaint = "complaint"
+)
+
+// EmailFeedback - отчёт почтового сервиса о судьбе письма.
+// UserID может быть пустым - тогда пользователь ищется по адресу.
+type EmailFeedback struct {
+	EventID    string
+	Type       string
+	Email      string
+	UserID     string
+	Permanent  bool // для bounce: постоянный отказ (hard bounce)
+	Reason     string
+	OccurredAt time.Time
+}
@@ -1,8 +1,48 @@
 package models
 
+import "time"
+
 type VerificationUserMessage struct {
 	UserID string
 	Name   string
 	Email  string
-	Token  string
+	Token  string // ссылка-токен, пустой в режиме только кодов
+	Code   string // числовой код, пустой в режиме только ссылок
+}
+
+type AccountStatusMessage struct {
+	UserID         string
+	Status         UserStatus
+	Reason         string
+	SuspendedUntil *time.Time
+}
+
+// Назначение SMS с кодом
+const (
+	SmsPurposeRegister    = "register"
+	SmsPurposeLogin       = "login"
+	SmsPurposeVerifyPhone = "verify_phone"
+
+	SmsPurposeLoginChallenge = "login_challenge" // подтверждение рискованного входа по паролю
+)
+
+// SmsMessage - одноразовый код для SMS-шлюза. Текст сообщения формирует шлюз по Purpose.
+type SmsMessage struct {
+	UserID  string
+	Phone   string
+	Code    string
+	Purpose string
+}
+
+// NewSignInMessage - уведомление о входе с незнакомого устройства.
+// RevokeToken подставляется в ссылку "это был не я": по ней завершаются все сессии пользователя.
+type NewSignInMessage struct {
+	UserID      string
+	Name        string
+	Email       string
+	Phone       string
+	IP          string
+	UserAgent   string
+	SignedInAt  time.Time
+	RevokeToken string
 }
@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+// OutboxMessage - сериализованное сообщение для брокера.
+// AggregateID служит ключом сообщения: сообщения одного ключа доставляются по порядку.
+type OutboxMessage struct {
+	ID            int64
+	AggregateID   string
+	Topic         string
+	Kind          string
+	Headers       map[string]string // заголовки сообщения Kafka, см. lib/envelope
+	Payload       []byte
+	CreatedAt     time.Time
+	Attempts      int
+	NextAttemptAt time.Time
+}
@@ -0,0 +1,18 @@
+package models
+
+// RiskDecision - что делать со входом по результатам оценки риска
+type RiskDecision string
+
+const (
+	RiskAllow     RiskDecision = "allow"
+	RiskChallenge RiskDecision = "challenge" // токены выдаются только после подтверждения вторым фактором
+	RiskDeny      RiskDecision = "deny"
+)
+
+// RiskAssessment - итог оценки риска входа.
+// Signals - вклад каждого признака от 0 до 1 до умножения на вес.
+type RiskAssessment struct {
+	Score    int
+	Decision RiskDecision
+	Signals  map[string]float64
+}
@@ -0,0 +1,37 @@
+package models
+
+import "time"
+
+// SecurityEventType - тип события безопасности учётной записи
+type SecurityEventType string
+
+const (
+	SecurityEventLoginSuccess     SecurityEventType = "login_success"
+	SecurityEventLoginFailure     SecurityEventType = "login_failure"
+	SecurityEventTokenRefresh     SecurityEventType = "token_refresh"
+	SecurityEventLogout           SecurityEventType = "logout"
+	SecurityEventReauthentication SecurityEventType = "reauthentication"
+	SecurityEventPasswordChange   SecurityEventType = "password_change"
+	SecurityEventMFAChange        SecurityEventType = "mfa_change"
+	SecurityEventLockout          SecurityEventType = "lockout"
+	SecurityEventSessionsRevoked  SecurityEventType = "sessions_revoked"
+	SecurityEventSmsSent          SecurityEventType = "sms_sent"
+
+	// Решения оценки риска пишутся отдельно от login_failure: учётные данные при этом верны,
+	// и отказы не должны попадать в признак failed_attempts следующих оценок
+	SecurityEventRiskDenied    SecurityEventType = "risk_denied"
+	SecurityEventRiskChallenge SecurityEventType = "risk_challenge"
+)
+
+// SecurityEvent - запись в ленте событий безопасности пользователя.
+// UserID пуст у неудачных входов с несуществующим логином, тогда заполнен Login.
+type SecurityEvent struct {
+	ID        int64
+	UserID    string
+	Type      SecurityEventType
+	Login     string // введённый email, хэндл или телефон
+	IP        string
+	UserAgent string
+	Details   map[string]string
+	CreatedAt time.Time
+}
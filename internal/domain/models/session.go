@@ -0,0 +1,27 @@
+package models
+
+import "time"
+
+// Способы аутентификации (claim amr, RFC 8176)
+const (
+	AMRPassword = "pwd"
+	AMROTP      = "otp" // код из письма
+	AMRSMS      = "sms"
+)
+
+// Уровни доверия к аутентификации (claim acr)
+const (
+	ACRSingleFactor = "1"
+	ACRMultiFactor  = "2" // пароль и второй фактор (см. models.RiskChallenge)
+)
+
+// Session - сессия, к которой привязан refresh токен.
+// AuthTime, AMR и ACR описывают последнюю проверку учётных данных и переносятся
+// в каждый выпущенный по этой сессии access токен, обновление токена их не меняет.
+// Нулевой AuthTime означает, что свежей проверки не было и step-up потребуется сразу.
+type Session struct {
+	UserID   string
+	AuthTime time.Time
+	AMR      []string
+	ACR      string
+}
@@ -1,5 +1,36 @@
 package models
 
+import "time"
+
+// UserStatus - состояние учётной записи пользователя
+type UserStatus string
+
+const (
+	UserStatusActive          UserStatus = "active"
+	UserStatusSuspended       UserStatus = "suspended"
+	UserStatusBanned          UserStatus = "banned"
+	UserStatusPendingDeletion UserStatus = "pending_deletion"
+)
+
+// Valid проверяет, что статус входит в список известных
+func (s UserStatus) Valid() bool {
+	switch s {
+	case UserStatusActive, UserStatusSuspended, UserStatusBanned, UserStatusPendingDeletion:
+		return true
+	}
+
+	return false
+}
+
+// EmailStatus - доставляемость email пользователя по отчётам почтового сервиса
+type EmailStatus string
+
+const (
+	EmailStatusOK         EmailStatus = "ok"
+	EmailStatusBounced    EmailStatus = "bounced"    // постоянный отказ: адреса нет или ящик закрыт
+	EmailStatusComplained EmailStatus = "complained" // пользователь пометил письмо как спам
+)
+
 type User struct {
 	ID       string
 	Name     string
@@ -7,4 +38,48 @@ type User struct {
 	PassHash []byte
 	Verified bool
 	Avatar   string
+
+	// EmailCanonical - email в каноническом виде (см. lib/emailaddr), по нему ищется пользователь
+	EmailCanonical string
+
+	// Username - уникальный хэндл в нижнем регистре (см. lib/handle), пустой если не выбран
+	Username          string
+	UsernameChangedAt time.Time
+
+	Phone         string // в формате E.164, пустой если не указан
+	PhoneVerified bool
+
+	Status         UserStatus
+	StatusReason   string
+	SuspendedUntil time.Time // нулевое значение - блокировка бессрочная
+
+	EmailStatus       EmailStatus
+	EmailStatusReason string // причина из отчёта почтового сервиса
+}
+
+// EmailDeliverable сообщает, можно ли отправлять письма на email пользователя
+func (u User) EmailDeliverable() bool {
+	return u.Email != "" && (u.EmailStatus == "" || u.EmailStatus == EmailStatusOK)
+}
+
+// UsernameChange - запись истории смены хэндла.
+// До HeldUntil прежний хэндл не может занять никто, кроме его бывшего владельца.
+type UsernameChange struct {
+	UserID    string
+	Username  string
+	ChangedAt time.Time
+	HeldUntil time.Time
+}
+
+// IsBlocked сообщает, запрещён ли пользователю вход на момент now.
+// Временная блокировка снимается автоматически после SuspendedUntil.
+func (u User) IsBlocked(now time.Time) bool {
+	switch u.Status {
+	case UserStatusBanned, UserStatusPendingDeletion:
+		return true
+	case UserStatusSuspended:
+		return u.SuspendedUntil.IsZero() || now.Before(u.SuspendedUntil)
+	}
+
+	return false
 }
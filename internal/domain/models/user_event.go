@@ -0,0 +1,56 @@
+package models
+
+import "time"
+
+// UserEventType - тип события жизненного цикла пользователя
+type UserEventType string
+
+const (
+	UserEventRegistered    UserEventType = "user.registered"
+	UserEventVerified      UserEventType = "user.verified"
+	UserEventUpdated       UserEventType = "user.updated"
+	UserEventAvatarChanged UserEventType = "user.avatar_changed"
+	UserEventDeleted       UserEventType = "user.deleted"
+	UserEventLoggedIn      UserEventType = "user.logged_in"
+)
+
+// UserEvent - событие жизненного цикла пользователя для других сервисов.
+// Ключ сообщения - UserID, поэтому события одного пользователя приходят по порядку.
+// ID и OccurredAt заполняет адаптер, если сервис их не указал.
+type UserEvent struct {
+	ID         string
+	Type       UserEventType
+	UserID     string
+	OccurredAt time.Time
+
+	// Profile - состояние профиля после изменения: для user.registered и user.updated
+	Profile *UserProfile
+
+	AvatarURL string // user.avatar_changed
+	Method    string // user.logged_in: способ входа (AMR)
+	IP        string // user.logged_in
+}
+
+// UserProfile - публичная часть профиля, которую получают другие сервисы
+type UserProfile struct {
+	Name          string
+	Email         string
+	Username      string
+	Phone         string
+	Verified      bool
+	PhoneVerified bool
+	Avatar        string
+}
+
+// Profile возвращает публичную часть профиля для событий
+func (u User) Profile() *UserProfile {
+	return &UserProfile{
+		Name:          u.Name,
+		Email:         u.Email,
+		Username:      u.Username,
+		Phone:         u.Phone,
+		Verified:      u.Verified,
+		PhoneVerified: u.PhoneVerified,
+		Avatar:        u.Avatar,
+	}
+}
@@ -0,0 +1,37 @@
+package models
+
+import "time"
+
+// CodeChannel - канал, по которому отправлен код. У пользователя может быть
+// одновременно по одному действующему коду на каждый канал.
+type CodeChannel string
+
+const (
+	CodeChannelEmail CodeChannel = "email"
+	CodeChannelSMS   CodeChannel = "sms"
+
+	// CodeChannelLoginChallenge - SMS-код второго фактора для рискованного входа (models.RiskChallenge)
+	CodeChannelLoginChallenge CodeChannel = "login_challenge"
+)
+
+// VerificationCode - числовой код подтверждения. Сам код не хранится, только его хэш.
+type VerificationCode struct {
+	UserID    string
+	Channel   CodeChannel
+	CodeHash  []byte
+	Attempts  int // попытки ввода с начала окна WindowStartedAt, а не только этого кода
+	ExpiresAt time.Time
+
+	IssuedAt        time.Time // когда выпущен последний код
+	WindowStartedAt time.Time // начало окна, в котором считаются выпуски и попытки
+	Issues          int       // сколько кодов выпущено в окне
+}
+
+// CodeLimits ограничивает выпуск кодов одного канала: не чаще раза в ResendCooldown
+// и не больше MaxIssues кодов за Window. Попытки ввода копятся в пределах окна,
+// поэтому повторная отправка кода не даёт новых попыток. Нулевые значения снимают ограничение.
+type CodeLimits struct {
+	ResendCooldown time.Duration
+	Window         time.Duration
+	MaxIssues      int
+}
@@ -0,0 +1,59 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// WebhookSubscription - подписка партнёра на события пользователей.
+// Secret возвращается только при создании подписки.
+type WebhookSubscription struct {
+	ID          string
+	URL         string
+	EventTypes  []string
+	Secret      string
+	Description string
+	Active      bool
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+// WebhookDeliveryStatus - состояние доставки события подписке
+type WebhookDeliveryStatus string
+
+const (
+	WebhookDeliveryPending   WebhookDeliveryStatus = "pending"
+	WebhookDeliveryDelivered WebhookDeliveryStatus = "delivered"
+	WebhookDeliveryDead      WebhookDeliveryStatus = "dead" // попытки исчерпаны, нужна ручная повторная отправка
+)
+
+// WebhookDelivery - доставка одного события одной подписке.
+// URL и Secret заполняются при выборке на отправку.
+type WebhookDelivery struct {
+	ID             int64
+	SubscriptionID string
+	EventID        string
+	EventType      string
+	Payload        json.RawMessage
+	Status         WebhookDeliveryStatus
+	Attempts       int
+	NextAttemptAt  time.Time
+	LastError      string
+	CreatedAt      time.Time
+	DeliveredAt    time.Time
+
+	URL    string
+	Secret string
+}
+
+// WebhookDeliveryAttempt - запись журнала попыток доставки
+type WebhookDeliveryAttempt struct {
+	ID           int64
+	DeliveryID   int64
+	Attempt      int
+	StatusCode   int // 0, если ответа не было
+	Error        string
+	ResponseBody string
+	Duration     time.Duration
+	CreatedAt    time.Time
+}
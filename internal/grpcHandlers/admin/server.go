@@ -0,0 +1,107 @@
+package admin
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/DenisBochko/yandex_SSO/internal/domain/models"
+	"github.com/DenisBochko/yandex_SSO/internal/services/users"
+	"github.com/DenisBochko/yandex_SSO/internal/storage"
+
+	adminv1 "github.com/DenisBochko/yandex_SSO/gen/go/admin/v1"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+type UsersService interface {
+	SetUserStatus(ctx context.Context, id string, status models.UserStatus, reason string, until time.Time) (bool, error)
+	ResetEmailStatus(ctx context.Context, userID string) error
+}
+
+type AdminServerAPI struct {
+	adminv1.UnimplementedAdminServer
+	token           string
+	userService     UsersService
+	webhooksService WebhooksService
+}
+
+// Register регистрирует сервис Admin. Методы принимают только запросы
+// с заголовком authorization: Bearer <token>. webhooksService равен nil, если
+// хранилища подписок нет (режим --dev): методы вебхуков тогда возвращают FAILED_PRECONDITION
+func Register(gRPC *grpc.Server, token string, userService UsersService, webhooksService WebhooksService) {
+	adminv1.RegisterAdminServer(gRPC, &AdminServerAPI{token: token, userService: userService, webhooksService: webhooksService})
+}
+
+func (s *AdminServerAPI) SetUserStatus(ctx context.Context, req *adminv1.SetUserStatusRequest) (*adminv1.SetUserStatusResponse, error) {
+	if err := s.authorize(ctx); err != nil {
+		return nil, err
+	}
+
+	if req.GetUserId() == "" {
+		return nil, status.Error(codes.InvalidArgument, "user id is required")
+	}
+
+	var until time.Time
+	if req.GetSuspendedUntil() != nil {
+		until = req.GetSuspendedUntil().AsTime()
+	}
+
+	_, err := s.userService.SetUserStatus(ctx, req.GetUserId(), models.UserStatus(req.GetStatus()), req.GetReason(), until)
+	if err != nil {
+		if errors.Is(err, users.ErrInvalidStatus) {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return nil, status.Error(codes.NotFound, err.Error())
+		}
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	return &adminv1.SetUserStatusResponse{
+		UserId: req.GetUserId(),
+		Status: req.GetStatus(),
+	}, nil
+}
+
+func (s *AdminServerAPI) ResetEmailStatus(ctx context.Context, req *adminv1.ResetEmailStatusRequest) (*adminv1.ResetEmailStatusResponse, error) {
+	if err := s.authorize(ctx); err != nil {
+		return nil, err
+	}
+
+	if req.GetUserId() == "" {
+		return nil, status.Error(codes.InvalidArgument, "user id is required")
+	}
+
+	if err := s.userService.ResetEmailStatus(ctx, req.GetUserId()); err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return nil, status.Error(codes.NotFound, err.Error())
+		}
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	return &adminv1.ResetEmailStatusResponse{
+		UserId:      req.GetUserId(),
+		EmailStatus: string(models.EmailStatusOK),
+	}, nil
+}
+
+// authorize сравнивает токен из заголовка authorization с admin.token
+func (s *AdminServerAPI) authorize(ctx context.Context) error {
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md.Get("authorization")
+	if len(values) == 0 {
+		return status.Error(codes.Unauthenticated, "admin token is not provided")
+	}
+
+	token := strings.TrimPrefix(values[0], "Bearer ")
+	if subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) != 1 {
+		return status.Error(codes.PermissionDenied, "invalid admin token")
+	}
+
+	return nil
+}
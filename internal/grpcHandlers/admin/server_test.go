@@ -0,0 +1,54 @@
+package admin
+
+import (
+	"context"
+	"testing"
+
+	adminv1 "github.com/DenisBochko/yandex_SSO/gen/go/admin/v1"
+	"github.com/DenisBochko/yandex_SSO/internal/storage"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// emailStatuses сбрасывает статус email только существующему пользователю user-id
+type emailStatuses struct {
+	UsersService
+	reset []string
+}
+
+func (u *emailStatuses) ResetEmailStatus(ctx context.Context, userID string) error {
+	if userID != "user-id" {
+		return storage.ErrUserNotFound
+	}
+
+	u.reset = append(u.reset, userID)
+	return nil
+}
+
+func withToken(token string) context.Context {
+	return metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Bearer "+token))
+}
+
+func TestResetEmailStatus(t *testing.T) {
+	users := &emailStatuses{}
+	s := &AdminServerAPI{token: "admin-token", userService: users}
+	req := &adminv1.ResetEmailStatusRequest{UserId: "user-id"}
+
+	_, err := s.ResetEmailStatus(context.Background(), req)
+	require.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	_, err = s.ResetEmailStatus(withToken("user-access-token"), req)
+	require.Equal(t, codes.PermissionDenied, status.Code(err))
+	require.Empty(t, users.reset)
+
+	resp, err := s.ResetEmailStatus(withToken("admin-token"), req)
+	require.NoError(t, err)
+	require.Equal(t, "ok", resp.GetEmailStatus())
+	require.Equal(t, []string{"user-id"}, users.reset)
+
+	_, err = s.ResetEmailStatus(withToken("admin-token"), &adminv1.ResetEmailStatusRequest{UserId: "other-id"})
+	require.Equal(t, codes.NotFound, status.Code(err))
+}
@@ -0,0 +1,236 @@
+package admin
+
+import (
+	"context"
+	"errors"
+
+	"github.com/DenisBochko/yandex_SSO/internal/domain/models"
+	"github.com/DenisBochko/yandex_SSO/internal/services/webhooks"
+	"github.com/DenisBochko/yandex_SSO/internal/storage"
+
+	adminv1 "github.com/DenisBochko/yandex_SSO/gen/go/admin/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+type WebhooksService interface {
+	CreateSubscription(ctx context.Context, rawURL string, eventTypes []string, secret string, description string) (models.WebhookSubscription, error)
+	ListSubscriptions(ctx context.Context) ([]models.WebhookSubscription, error)
+	GetSubscription(ctx context.Context, id string) (models.WebhookSubscription, error)
+	UpdateSubscription(ctx context.Context, sub models.WebhookSubscription) (models.WebhookSubscription, error)
+	DeleteSubscription(ctx context.Context, id string) error
+	ListDeliveries(ctx context.Context, subscriptionID string, status models.WebhookDeliveryStatus, beforeID int64, limit int) ([]models.WebhookDelivery, error)
+	ListDeliveryAttempts(ctx context.Context, deliveryID int64) ([]models.WebhookDeliveryAttempt, error)
+	Redeliver(ctx context.Context, deliveryID int64) error
+}
+
+func (s *AdminServerAPI) CreateWebhookSubscription(ctx context.Context, req *adminv1.CreateWebhookSubscriptionRequest) (*adminv1.CreateWebhookSubscriptionResponse, error) {
+	if err := s.authorizeWebhooks(ctx); err != nil {
+		return nil, err
+	}
+
+	sub, err := s.webhooksService.CreateSubscription(ctx, req.GetUrl(), req.GetEventTypes(), req.GetSecret(), req.GetDescription())
+	if err != nil {
+		return nil, webhooksError(err)
+	}
+
+	// секрет возвращается только здесь
+	resp := subscriptionToProto(sub)
+	resp.Secret = sub.Secret
+
+	return &adminv1.CreateWebhookSubscriptionResponse{Subscription: resp}, nil
+}
+
+func (s *AdminServerAPI) ListWebhookSubscriptions(ctx context.Context, req *adminv1.ListWebhookSubscriptionsRequest) (*adminv1.ListWebhookSubscriptionsResponse, error) {
+	if err := s.authorizeWebhooks(ctx); err != nil {
+		return nil, err
+	}
+
+	subs, err := s.webhooksService.ListSubscriptions(ctx)
+	if err != nil {
+		return nil, webhooksError(err)
+	}
+
+	resp := &adminv1.ListWebhookSubscriptionsResponse{Subscriptions: make([]*adminv1.WebhookSubscription, 0, len(subs))}
+	for _, sub := range subs {
+		resp.Subscriptions = append(resp.Subscriptions, subscriptionToProto(sub))
+	}
+
+	return resp, nil
+}
+
+func (s *AdminServerAPI) GetWebhookSubscription(ctx context.Context, req *adminv1.GetWebhookSubscriptionRequest) (*adminv1.GetWebhookSubscriptionResponse, error) {
+	if err := s.authorizeWebhooks(ctx); err != nil {
+		return nil, err
+	}
+
+	if req.GetId() == "" {
+		return nil, status.Error(codes.InvalidArgument, "subscription id is required")
+	}
+
+	sub, err := s.webhooksService.GetSubscription(ctx, req.GetId())
+	if err != nil {
+		return nil, webhooksError(err)
+	}
+
+	return &adminv1.GetWebhookSubscriptionResponse{Subscription: subscriptionToProto(sub)}, nil
+}
+
+func (s *AdminServerAPI) UpdateWebhookSubscription(ctx context.Context, req *adminv1.UpdateWebhookSubscriptionRequest) (*adminv1.UpdateWebhookSubscriptionResponse, error) {
+	if err := s.authorizeWebhooks(ctx); err != nil {
+		return nil, err
+	}
+
+	if req.GetId() == "" {
+		return nil, status.Error(codes.InvalidArgument, "subscription id is required")
+	}
+
+	sub, err := s.webhooksService.UpdateSubscription(ctx, models.WebhookSubscription{
+		ID:          req.GetId(),
+		URL:         req.GetUrl(),
+		EventTypes:  req.GetEventTypes(),
+		Secret:      req.GetSecret(),
+		Description: req.GetDescription(),
+		Active:      req.GetActive(),
+	})
+	if err != nil {
+		return nil, webhooksError(err)
+	}
+
+	return &adminv1.UpdateWebhookSubscriptionResponse{Subscription: subscriptionToProto(sub)}, nil
+}
+
+func (s *AdminServerAPI) DeleteWebhookSubscription(ctx context.Context, req *adminv1.DeleteWebhookSubscriptionRequest) (*adminv1.DeleteWebhookSubscriptionResponse, error) {
+	if err := s.authorizeWebhooks(ctx); err != nil {
+		return nil, err
+	}
+
+	if req.GetId() == "" {
+		return nil, status.Error(codes.InvalidArgument, "subscription id is required")
+	}
+
+	if err := s.webhooksService.DeleteSubscription(ctx, req.GetId()); err != nil {
+		return nil, webhooksError(err)
+	}
+
+	return &adminv1.DeleteWebhookSubscriptionResponse{}, nil
+}
+
+func (s *AdminServerAPI) ListWebhookDeliveries(ctx context.Context, req *adminv1.ListWebhookDeliveriesRequest) (*adminv1.ListWebhookDeliveriesResponse, error) {
+	if err := s.authorizeWebhooks(ctx); err != nil {
+		return nil, err
+	}
+
+	if req.GetSubscriptionId() == "" {
+		return nil, status.Error(codes.InvalidArgument, "subscription id is required")
+	}
+
+	deliveries, err := s.webhooksService.ListDeliveries(ctx, req.GetSubscriptionId(), models.WebhookDeliveryStatus(req.GetStatus()), req.GetBeforeId(), int(req.GetLimit()))
+	if err != nil {
+		return nil, webhooksError(err)
+	}
+
+	resp := &adminv1.ListWebhookDeliveriesResponse{Deliveries: make([]*adminv1.WebhookDelivery, 0, len(deliveries))}
+	for _, delivery := range deliveries {
+		d := &adminv1.WebhookDelivery{
+			Id:             delivery.ID,
+			SubscriptionId: delivery.SubscriptionID,
+			EventId:        delivery.EventID,
+			EventType:      delivery.EventType,
+			Payload:        delivery.Payload,
+			Status:         string(delivery.Status),
+			Attempts:       int32(delivery.Attempts),
+			NextAttemptAt:  timestamppb.New(delivery.NextAttemptAt),
+			LastError:      delivery.LastError,
+			CreatedAt:      timestamppb.New(delivery.CreatedAt),
+		}
+		if !delivery.DeliveredAt.IsZero() {
+			d.DeliveredAt = timestamppb.New(delivery.DeliveredAt)
+		}
+		resp.Deliveries = append(resp.Deliveries, d)
+	}
+	if len(deliveries) > 0 {
+		resp.NextBeforeId = deliveries[len(deliveries)-1].ID
+	}
+
+	return resp, nil
+}
+
+func (s *AdminServerAPI) ListWebhookDeliveryAttempts(ctx context.Context, req *adminv1.ListWebhookDeliveryAttemptsRequest) (*adminv1.ListWebhookDeliveryAttemptsResponse, error) {
+	if err := s.authorizeWebhooks(ctx); err != nil {
+		return nil, err
+	}
+
+	attempts, err := s.webhooksService.ListDeliveryAttempts(ctx, req.GetDeliveryId())
+	if err != nil {
+		return nil, webhooksError(err)
+	}
+
+	resp := &adminv1.ListWebhookDeliveryAttemptsResponse{Attempts: make([]*adminv1.WebhookDeliveryAttempt, 0, len(attempts))}
+	for _, attempt := range attempts {
+		resp.Attempts = append(resp.Attempts, &adminv1.WebhookDeliveryAttempt{
+			Id:           attempt.ID,
+			DeliveryId:   attempt.DeliveryID,
+			Attempt:      int32(attempt.Attempt),
+			StatusCode:   int32(attempt.StatusCode),
+			Error:        attempt.Error,
+			ResponseBody: attempt.ResponseBody,
+			DurationMs:   attempt.Duration.Milliseconds(),
+			CreatedAt:    timestamppb.New(attempt.CreatedAt),
+		})
+	}
+
+	return resp, nil
+}
+
+func (s *AdminServerAPI) RedeliverWebhook(ctx context.Context, req *adminv1.RedeliverWebhookRequest) (*adminv1.RedeliverWebhookResponse, error) {
+	if err := s.authorizeWebhooks(ctx); err != nil {
+		return nil, err
+	}
+
+	if err := s.webhooksService.Redeliver(ctx, req.GetDeliveryId()); err != nil {
+		return nil, webhooksError(err)
+	}
+
+	return &adminv1.RedeliverWebhookResponse{}, nil
+}
+
+// authorizeWebhooks проверяет admin токен и то, что вебхуки доступны: в режиме --dev
+// хранилища подписок нет
+func (s *AdminServerAPI) authorizeWebhooks(ctx context.Context) error {
+	if err := s.authorize(ctx); err != nil {
+		return err
+	}
+
+	if s.webhooksService == nil {
+		return status.Error(codes.FailedPrecondition, "webhooks are not available")
+	}
+
+	return nil
+}
+
+func webhooksError(err error) error {
+	switch {
+	case errors.Is(err, webhooks.ErrInvalidURL), errors.Is(err, webhooks.ErrInvalidEventTypes),
+		errors.Is(err, webhooks.ErrInvalidSecret), errors.Is(err, webhooks.ErrInvalidStatus):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, storage.ErrSubscriptionNotFound), errors.Is(err, storage.ErrDeliveryNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	default:
+		return status.Error(codes.Internal, err.Error())
+	}
+}
+
+// subscriptionToProto - подписка без секрета
+func subscriptionToProto(sub models.WebhookSubscription) *adminv1.WebhookSubscription {
+	return &adminv1.WebhookSubscription{
+		Id:          sub.ID,
+		Url:         sub.URL,
+		EventTypes:  sub.EventTypes,
+		Description: sub.Description,
+		Active:      sub.Active,
+		CreatedAt:   timestamppb.New(sub.CreatedAt),
+		UpdatedAt:   timestamppb.New(sub.UpdatedAt),
+	}
+}
@@ -4,10 +4,13 @@ import (
 	"context"
 	"errors"
 
+	authv1 "github.com/DenisBochko/yandex_SSO/gen/go/auth/v1"
 	"github.com/DenisBochko/yandex_SSO/internal/services/auth"
 	"github.com/DenisBochko/yandex_SSO/internal/storage"
+	authinterceptor "github.com/DenisBochko/yandex_SSO/pkg/AuthInterceptor"
 
 	ssov1 "gitlab.crja72.ru/golang/2025/spring/course/projects/go6/contracts/gen/go/sso"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
@@ -15,21 +18,41 @@ import (
 )
 
 type Auth interface {
-	Login(ctx context.Context, email string, password string) (string, *timestamppb.Timestamp, string, *timestamppb.Timestamp, error)
+	Login(ctx context.Context, login string, password string) (string, *timestamppb.Timestamp, string, *timestamppb.Timestamp, error)
 	Register(ctx context.Context, name string, email string, password string) (string, error)
 	ResendVerificationToken(ctx context.Context, user_id string) (string, error)
 	RefreshToken(ctx context.Context, token string) (string, *timestamppb.Timestamp, string, *timestamppb.Timestamp, error)
 	Verify(ctx context.Context, token string) (bool, error)
+	VerifyCode(ctx context.Context, userID string, code string) (bool, error)
+	Reauthenticate(ctx context.Context, userID string, password string) (string, *timestamppb.Timestamp, error)
+	RevokeSessions(ctx context.Context, token string) (int64, error)
+	CompleteLoginChallenge(ctx context.Context, login string, code string) (string, *timestamppb.Timestamp, string, *timestamppb.Timestamp, error)
+	RegisterByPhone(ctx context.Context, name string, rawPhone string) (string, error)
+	RequestPhoneLogin(ctx context.Context, rawPhone string) error
+	LoginByPhone(ctx context.Context, rawPhone string, code string) (string, *timestamppb.Timestamp, string, *timestamppb.Timestamp, error)
+	AttachPhone(ctx context.Context, userID string, rawPhone string) error
+	VerifyPhone(ctx context.Context, userID string, code string) (bool, error)
 	Logut(ctx context.Context, refreshToken string) (bool, error)
 }
 
+// ReasonSecondFactorRequired - значение ErrorInfo.Reason в ошибке Login, когда вход рискованный
+// и его нужно подтвердить кодом из SMS через CompleteLoginChallenge
+const ReasonSecondFactorRequired = "SECOND_FACTOR_REQUIRED"
+
 type AuthServerAPI struct {
 	ssov1.UnimplementedAuthServer
 	auth Auth
 }
 
+// AuthV1ServerAPI реализует методы из proto/auth/v1, которых пока нет в contracts
+type AuthV1ServerAPI struct {
+	authv1.UnimplementedAuthServer
+	auth Auth
+}
+
 func Register(gRPC *grpc.Server, auth Auth) {
 	ssov1.RegisterAuthServer(gRPC, &AuthServerAPI{auth: auth})
+	authv1.RegisterAuthServer(gRPC, &AuthV1ServerAPI{auth: auth})
 }
 
 func (s *AuthServerAPI) Register(ctx context.Context, req *ssov1.RegisterRequest) (*ssov1.RegisterResponse, error) {
@@ -46,6 +69,9 @@ func (s *AuthServerAPI) Register(ctx context.Context, req *ssov1.RegisterRequest
 		if errors.Is(err, storage.ErrUserExists) {
 			return nil, status.Error(codes.AlreadyExists, err.Error())
 		}
+		if errors.Is(err, auth.ErrInvalidEmail) {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
 		return nil, status.Error(codes.Internal, err.Error())
 	}
 
@@ -61,6 +87,12 @@ func (s *AuthServerAPI) ResendVerificationToken(ctx context.Context, req *ssov1.
 
 	respStatus, err := s.auth.ResendVerificationToken(ctx, req.GetUserId())
 	if err != nil {
+		if errors.Is(err, auth.ErrEmailUndeliverable) {
+			return nil, status.Error(codes.FailedPrecondition, err.Error())
+		}
+		if errors.Is(err, storage.ErrTooManyCodes) {
+			return nil, status.Error(codes.ResourceExhausted, err.Error())
+		}
 		return nil, status.Error(codes.Internal, "resend verification tocken failed")
 	}
 
@@ -70,8 +102,9 @@ func (s *AuthServerAPI) ResendVerificationToken(ctx context.Context, req *ssov1.
 }
 
 func (s *AuthServerAPI) Login(ctx context.Context, req *ssov1.LoginRequest) (*ssov1.LoginResponse, error) {
+	// в поле email можно передать и хэндл пользователя
 	if req.GetEmail() == "" {
-		return nil, status.Error(codes.InvalidArgument, "email is required")
+		return nil, status.Error(codes.InvalidArgument, "email or username is required")
 	}
 
 	if req.GetPassword() == "" {
@@ -87,6 +120,15 @@ func (s *AuthServerAPI) Login(ctx context.Context, req *ssov1.LoginRequest) (*ss
 		if errors.Is(err, storage.ErrKeyDoesNotExist) {
 			return nil, status.Error(codes.Unauthenticated, err.Error())
 		}
+		if errors.Is(err, auth.ErrAccountBlocked) || errors.Is(err, auth.ErrLoginDenied) {
+			return nil, status.Error(codes.PermissionDenied, err.Error())
+		}
+		if errors.Is(err, auth.ErrSecondFactorRequired) {
+			return nil, secondFactorRequired()
+		}
+		if errors.Is(err, storage.ErrTooManyCodes) {
+			return nil, status.Error(codes.ResourceExhausted, err.Error())
+		}
 		return nil, status.Error(codes.Internal, err.Error())
 	}
 
@@ -108,6 +150,9 @@ func (s *AuthServerAPI) RefreshToken(ctx context.Context, req *ssov1.RefreshToke
 		if errors.Is(err, auth.ErrInvalidCredentials) {
 			return nil, status.Error(codes.Unauthenticated, err.Error())
 		}
+		if errors.Is(err, auth.ErrAccountBlocked) {
+			return nil, status.Error(codes.PermissionDenied, err.Error())
+		}
 		return nil, status.Error(codes.Internal, err.Error())
 	}
 
@@ -158,3 +203,300 @@ func (s *AuthServerAPI) Logout(ctx context.Context, req *ssov1.LogoutRequest) (*
 		Status: "OK",
 	}, nil
 }
+
+func (s *AuthV1ServerAPI) VerifyCode(ctx context.Context, req *authv1.VerifyCodeRequest) (*authv1.VerifyCodeResponse, error) {
+	if req.GetUserId() == "" {
+		return nil, status.Error(codes.InvalidArgument, "userId is required")
+	}
+
+	if req.GetCode() == "" {
+		return nil, status.Error(codes.InvalidArgument, "code is required")
+	}
+
+	isValid, err := s.auth.VerifyCode(ctx, req.GetUserId(), req.GetCode())
+	if err != nil {
+		if errors.Is(err, auth.ErrInvalidCode) {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		if errors.Is(err, storage.ErrTooManyAttempts) {
+			return nil, status.Error(codes.ResourceExhausted, err.Error())
+		}
+		if errors.Is(err, storage.ErrTokenNotFound) {
+			return nil, status.Error(codes.NotFound, err.Error())
+		}
+		if errors.Is(err, storage.ErrTokenExpired) {
+			return nil, status.Error(codes.Aborted, err.Error())
+		}
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	return &authv1.VerifyCodeResponse{
+		IsValid: isValid,
+	}, nil
+}
+
+func (s *AuthV1ServerAPI) Reauthenticate(ctx context.Context, req *authv1.ReauthenticateRequest) (*authv1.ReauthenticateResponse, error) {
+	// пользователь берётся из access токена: метод не публичный, без токена его не пропустит AuthInterceptor
+	userID, ok := ctx.Value(authinterceptor.ContextUserIDKey).(string)
+	if !ok || userID == "" {
+		return nil, status.Error(codes.Unauthenticated, "access token is required")
+	}
+
+	if req.GetPassword() == "" {
+		return nil, status.Error(codes.InvalidArgument, "password is required")
+	}
+
+	accessToken, accessTokenExpiresAt, err := s.auth.Reauthenticate(ctx, userID, req.GetPassword())
+	if err != nil {
+		if errors.Is(err, auth.ErrInvalidCredentials) {
+			return nil, status.Error(codes.Unauthenticated, err.Error())
+		}
+		if errors.Is(err, auth.ErrAccountBlocked) {
+			return nil, status.Error(codes.PermissionDenied, err.Error())
+		}
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	return &authv1.ReauthenticateResponse{
+		AccessToken:          accessToken,
+		AccessTokenExpiresAt: accessTokenExpiresAt,
+	}, nil
+}
+
+func (s *AuthV1ServerAPI) RevokeSessions(ctx context.Context, req *authv1.RevokeSessionsRequest) (*authv1.RevokeSessionsResponse, error) {
+	if req.GetToken() == "" {
+		return nil, status.Error(codes.InvalidArgument, "token is required")
+	}
+
+	revoked, err := s.auth.RevokeSessions(ctx, req.GetToken())
+	if err != nil {
+		if errors.Is(err, storage.ErrTokenNotFound) {
+			return nil, status.Error(codes.NotFound, err.Error())
+		}
+		if errors.Is(err, storage.ErrTokenExpired) {
+			return nil, status.Error(codes.Aborted, err.Error())
+		}
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	return &authv1.RevokeSessionsResponse{
+		RevokedSessions: revoked,
+	}, nil
+}
+
+func (s *AuthV1ServerAPI) CompleteLoginChallenge(ctx context.Context, req *authv1.CompleteLoginChallengeRequest) (*authv1.CompleteLoginChallengeResponse, error) {
+	if req.GetLogin() == "" {
+		return nil, status.Error(codes.InvalidArgument, "login is required")
+	}
+
+	if req.GetCode() == "" {
+		return nil, status.Error(codes.InvalidArgument, "code is required")
+	}
+
+	accessToken, accessTokenExpiresAt, refreshToken, refreshTokenExpiresAt, err := s.auth.CompleteLoginChallenge(ctx, req.GetLogin(), req.GetCode())
+	if err != nil {
+		if errors.Is(err, auth.ErrInvalidCredentials) {
+			return nil, status.Error(codes.Unauthenticated, err.Error())
+		}
+		if errors.Is(err, storage.ErrTooManyAttempts) {
+			return nil, status.Error(codes.ResourceExhausted, err.Error())
+		}
+		if errors.Is(err, storage.ErrTokenExpired) {
+			return nil, status.Error(codes.Aborted, err.Error())
+		}
+		if errors.Is(err, auth.ErrAccountBlocked) {
+			return nil, status.Error(codes.PermissionDenied, err.Error())
+		}
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	return &authv1.CompleteLoginChallengeResponse{
+		AccessToken:           accessToken,
+		AccessTokenExpiresAt:  accessTokenExpiresAt,
+		RefreshToken:          refreshToken,
+		RefreshTokenExpiresAt: refreshTokenExpiresAt,
+	}, nil
+}
+
+func (s *AuthV1ServerAPI) RegisterByPhone(ctx context.Context, req *authv1.RegisterByPhoneRequest) (*authv1.RegisterByPhoneResponse, error) {
+	if req.GetPhone() == "" {
+		return nil, status.Error(codes.InvalidArgument, "phone is required")
+	}
+
+	userID, err := s.auth.RegisterByPhone(ctx, req.GetName(), req.GetPhone())
+	if err != nil {
+		if errors.Is(err, auth.ErrInvalidPhone) {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		if errors.Is(err, storage.ErrUserExists) {
+			return nil, status.Error(codes.AlreadyExists, err.Error())
+		}
+		if errors.Is(err, storage.ErrTooManyCodes) {
+			return nil, status.Error(codes.ResourceExhausted, err.Error())
+		}
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	return &authv1.RegisterByPhoneResponse{
+		UserId: userID,
+	}, nil
+}
+
+func (s *AuthV1ServerAPI) RequestPhoneLogin(ctx context.Context, req *authv1.RequestPhoneLoginRequest) (*authv1.RequestPhoneLoginResponse, error) {
+	if req.GetPhone() == "" {
+		return nil, status.Error(codes.InvalidArgument, "phone is required")
+	}
+
+	if err := s.auth.RequestPhoneLogin(ctx, req.GetPhone()); err != nil {
+		if errors.Is(err, auth.ErrInvalidPhone) {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		if errors.Is(err, storage.ErrTooManyCodes) {
+			return nil, status.Error(codes.ResourceExhausted, err.Error())
+		}
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	return &authv1.RequestPhoneLoginResponse{}, nil
+}
+
+func (s *AuthV1ServerAPI) LoginByPhone(ctx context.Context, req *authv1.LoginByPhoneRequest) (*authv1.LoginByPhoneResponse, error) {
+	if req.GetPhone() == "" {
+		return nil, status.Error(codes.InvalidArgument, "phone is required")
+	}
+
+	if req.GetCode() == "" {
+		return nil, status.Error(codes.InvalidArgument, "code is required")
+	}
+
+	accessToken, accessTokenExpiresAt, refreshToken, refreshTokenExpiresAt, err := s.auth.LoginByPhone(ctx, req.GetPhone(), req.GetCode())
+	if err != nil {
+		if errors.Is(err, auth.ErrInvalidPhone) {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		// код не запрашивали - тот же ответ, что и для неизвестного номера: RequestPhoneLogin не раскрывает,
+		// зарегистрирован ли номер, и здесь это тоже не должно быть видно
+		if errors.Is(err, auth.ErrInvalidCredentials) || errors.Is(err, storage.ErrTokenNotFound) {
+			return nil, status.Error(codes.Unauthenticated, "invalid credentials")
+		}
+		if errors.Is(err, storage.ErrTooManyAttempts) {
+			return nil, status.Error(codes.ResourceExhausted, err.Error())
+		}
+		if errors.Is(err, storage.ErrTokenExpired) {
+			return nil, status.Error(codes.Aborted, err.Error())
+		}
+		if errors.Is(err, auth.ErrAccountBlocked) || errors.Is(err, auth.ErrLoginDenied) {
+			return nil, status.Error(codes.PermissionDenied, err.Error())
+		}
+		if errors.Is(err, auth.ErrSecondFactorRequired) {
+			return nil, secondFactorRequired()
+		}
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	return &authv1.LoginByPhoneResponse{
+		AccessToken:           accessToken,
+		AccessTokenExpiresAt:  accessTokenExpiresAt,
+		RefreshToken:          refreshToken,
+		RefreshTokenExpiresAt: refreshTokenExpiresAt,
+	}, nil
+}
+
+func (s *AuthV1ServerAPI) AttachPhone(ctx context.Context, req *authv1.AttachPhoneRequest) (*authv1.AttachPhoneResponse, error) {
+	if req.GetUserId() == "" {
+		return nil, status.Error(codes.InvalidArgument, "userId is required")
+	}
+
+	if req.GetPhone() == "" {
+		return nil, status.Error(codes.InvalidArgument, "phone is required")
+	}
+
+	if err := checkOwner(ctx, req.GetUserId()); err != nil {
+		return nil, err
+	}
+
+	if err := s.auth.AttachPhone(ctx, req.GetUserId(), req.GetPhone()); err != nil {
+		if errors.Is(err, auth.ErrInvalidPhone) {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		if errors.Is(err, storage.ErrPhoneExists) {
+			return nil, status.Error(codes.AlreadyExists, err.Error())
+		}
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return nil, status.Error(codes.NotFound, err.Error())
+		}
+		if errors.Is(err, storage.ErrTooManyCodes) {
+			return nil, status.Error(codes.ResourceExhausted, err.Error())
+		}
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	return &authv1.AttachPhoneResponse{}, nil
+}
+
+func (s *AuthV1ServerAPI) VerifyPhone(ctx context.Context, req *authv1.VerifyPhoneRequest) (*authv1.VerifyPhoneResponse, error) {
+	if req.GetUserId() == "" {
+		return nil, status.Error(codes.InvalidArgument, "userId is required")
+	}
+
+	if req.GetCode() == "" {
+		return nil, status.Error(codes.InvalidArgument, "code is required")
+	}
+
+	if err := checkOwner(ctx, req.GetUserId()); err != nil {
+		return nil, err
+	}
+
+	isValid, err := s.auth.VerifyPhone(ctx, req.GetUserId(), req.GetCode())
+	if err != nil {
+		if errors.Is(err, auth.ErrInvalidCode) {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		if errors.Is(err, storage.ErrTooManyAttempts) {
+			return nil, status.Error(codes.ResourceExhausted, err.Error())
+		}
+		if errors.Is(err, storage.ErrTokenNotFound) {
+			return nil, status.Error(codes.NotFound, err.Error())
+		}
+		if errors.Is(err, storage.ErrTokenExpired) {
+			return nil, status.Error(codes.Aborted, err.Error())
+		}
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	return &authv1.VerifyPhoneResponse{
+		IsValid: isValid,
+	}, nil
+}
+
+// checkOwner пропускает запрос только с access токеном пользователя userID. Токен обязателен
+// и при grpc.auth_interceptor: false: номер телефона - второй фактор входа, менять его без токена нельзя
+func checkOwner(ctx context.Context, userID string) error {
+	tokenUserID, ok := ctx.Value(authinterceptor.ContextUserIDKey).(string)
+	if !ok || tokenUserID == "" {
+		return status.Error(codes.Unauthenticated, "access token is required")
+	}
+
+	if tokenUserID != userID {
+		return status.Error(codes.PermissionDenied, "access token belongs to another user")
+	}
+
+	return nil
+}
+
+// secondFactorRequired - ошибка Unauthenticated с ErrorInfo, по которой клиент отличает
+// запрос второго фактора от неверного пароля
+func secondFactorRequired() error {
+	st := status.New(codes.Unauthenticated, "second factor required")
+
+	detailed, err := st.WithDetails(&errdetails.ErrorInfo{
+		Reason:   ReasonSecondFactorRequired,
+		Domain:   "sso",
+		Metadata: map[string]string{"channel": "sms"},
+	})
+	if err != nil {
+		return st.Err()
+	}
+
+	return detailed.Err()
+}
@@ -0,0 +1,163 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	authv1 "github.com/DenisBochko/yandex_SSO/gen/go/auth/v1"
+	"github.com/DenisBochko/yandex_SSO/internal/services/auth"
+	"github.com/DenisBochko/yandex_SSO/internal/storage"
+	authinterceptor "github.com/DenisBochko/yandex_SSO/pkg/AuthInterceptor"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// phoneAuth возвращает из методов телефона заданную ошибку. Остальные методы Auth не вызываются
+type phoneAuth struct {
+	Auth
+	err   error
+	calls int
+}
+
+func (a *phoneAuth) RegisterByPhone(ctx context.Context, name string, rawPhone string) (string, error) {
+	a.calls++
+	return "user-id", a.err
+}
+
+func (a *phoneAuth) RequestPhoneLogin(ctx context.Context, rawPhone string) error {
+	a.calls++
+	return a.err
+}
+
+func (a *phoneAuth) LoginByPhone(ctx context.Context, rawPhone string, code string) (string, *timestamppb.Timestamp, string, *timestamppb.Timestamp, error) {
+	a.calls++
+	return "access", timestamppb.Now(), "refresh", timestamppb.Now(), a.err
+}
+
+func (a *phoneAuth) AttachPhone(ctx context.Context, userID string, rawPhone string) error {
+	a.calls++
+	return a.err
+}
+
+func (a *phoneAuth) VerifyPhone(ctx context.Context, userID string, code string) (bool, error) {
+	a.calls++
+	return a.err == nil, a.err
+}
+
+func withUser(userID string) context.Context {
+	return context.WithValue(context.Background(), authinterceptor.ContextUserIDKey, userID)
+}
+
+func TestPhoneErrorCodes(t *testing.T) {
+	wrapped := func(err error) error { return fmt.Errorf("wrapped: %w", err) }
+
+	tests := []struct {
+		name string
+		call func(s *AuthV1ServerAPI) error
+		err  error
+		code codes.Code
+	}{
+		{"register ok", registerByPhone, nil, codes.OK},
+		{"register invalid phone", registerByPhone, auth.ErrInvalidPhone, codes.InvalidArgument},
+		{"register exists", registerByPhone, storage.ErrUserExists, codes.AlreadyExists},
+		{"register rate", registerByPhone, wrapped(storage.ErrTooManyCodes), codes.ResourceExhausted},
+		{"register internal", registerByPhone, fmt.Errorf("db is down"), codes.Internal},
+
+		{"request ok", requestPhoneLogin, nil, codes.OK},
+		{"request invalid phone", requestPhoneLogin, auth.ErrInvalidPhone, codes.InvalidArgument},
+		{"request rate", requestPhoneLogin, wrapped(storage.ErrTooManyCodes), codes.ResourceExhausted},
+
+		{"login ok", loginByPhone, nil, codes.OK},
+		{"login invalid phone", loginByPhone, auth.ErrInvalidPhone, codes.InvalidArgument},
+		{"login unknown phone", loginByPhone, wrapped(auth.ErrInvalidCredentials), codes.Unauthenticated},
+		{"login code not requested", loginByPhone, storage.ErrTokenNotFound, codes.Unauthenticated},
+		{"login attempts", loginByPhone, storage.ErrTooManyAttempts, codes.ResourceExhausted},
+		{"login expired", loginByPhone, storage.ErrTokenExpired, codes.Aborted},
+		{"login blocked", loginByPhone, auth.ErrAccountBlocked, codes.PermissionDenied},
+		{"login denied", loginByPhone, wrapped(auth.ErrLoginDenied), codes.PermissionDenied},
+		{"login second factor", loginByPhone, auth.ErrSecondFactorRequired, codes.Unauthenticated},
+
+		{"attach ok", attachPhone, nil, codes.OK},
+		{"attach invalid phone", attachPhone, auth.ErrInvalidPhone, codes.InvalidArgument},
+		{"attach phone in use", attachPhone, storage.ErrPhoneExists, codes.AlreadyExists},
+		{"attach no user", attachPhone, storage.ErrUserNotFound, codes.NotFound},
+		{"attach rate", attachPhone, wrapped(storage.ErrTooManyCodes), codes.ResourceExhausted},
+
+		{"verify ok", verifyPhone, nil, codes.OK},
+		{"verify invalid code", verifyPhone, wrapped(auth.ErrInvalidCode), codes.InvalidArgument},
+		{"verify attempts", verifyPhone, storage.ErrTooManyAttempts, codes.ResourceExhausted},
+		{"verify no code", verifyPhone, storage.ErrTokenNotFound, codes.NotFound},
+		{"verify expired", verifyPhone, storage.ErrTokenExpired, codes.Aborted},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.call(&AuthV1ServerAPI{auth: &phoneAuth{err: tt.err}})
+			require.Equal(t, tt.code, status.Code(err), err)
+		})
+	}
+}
+
+func TestLoginByPhoneSecondFactorDetails(t *testing.T) {
+	err := loginByPhone(&AuthV1ServerAPI{auth: &phoneAuth{err: auth.ErrSecondFactorRequired}})
+
+	st, _ := status.FromError(err)
+	require.Len(t, st.Details(), 1)
+}
+
+func TestPhoneOwner(t *testing.T) {
+	calls := map[string]func(ctx context.Context, s *AuthV1ServerAPI) error{
+		"attach": func(ctx context.Context, s *AuthV1ServerAPI) error {
+			_, err := s.AttachPhone(ctx, &authv1.AttachPhoneRequest{UserId: "user-id", Phone: "+79990000000"})
+			return err
+		},
+		"verify": func(ctx context.Context, s *AuthV1ServerAPI) error {
+			_, err := s.VerifyPhone(ctx, &authv1.VerifyPhoneRequest{UserId: "user-id", Code: "123456"})
+			return err
+		},
+	}
+
+	for name, call := range calls {
+		t.Run(name, func(t *testing.T) {
+			a := &phoneAuth{}
+			s := &AuthV1ServerAPI{auth: a}
+
+			// без токена, как при grpc.auth_interceptor: false
+			require.Equal(t, codes.Unauthenticated, status.Code(call(context.Background(), s)))
+			require.Equal(t, codes.PermissionDenied, status.Code(call(withUser("other-id"), s)))
+			require.Zero(t, a.calls)
+
+			require.NoError(t, call(withUser("user-id"), s))
+			require.Equal(t, 1, a.calls)
+		})
+	}
+}
+
+func registerByPhone(s *AuthV1ServerAPI) error {
+	_, err := s.RegisterByPhone(context.Background(), &authv1.RegisterByPhoneRequest{Name: "user", Phone: "+79990000000"})
+	return err
+}
+
+func requestPhoneLogin(s *AuthV1ServerAPI) error {
+	_, err := s.RequestPhoneLogin(context.Background(), &authv1.RequestPhoneLoginRequest{Phone: "+79990000000"})
+	return err
+}
+
+func loginByPhone(s *AuthV1ServerAPI) error {
+	_, err := s.LoginByPhone(context.Background(), &authv1.LoginByPhoneRequest{Phone: "+79990000000", Code: "123456"})
+	return err
+}
+
+func attachPhone(s *AuthV1ServerAPI) error {
+	_, err := s.AttachPhone(withUser("user-id"), &authv1.AttachPhoneRequest{UserId: "user-id", Phone: "+79990000000"})
+	return err
+}
+
+func verifyPhone(s *AuthV1ServerAPI) error {
+	_, err := s.VerifyPhone(withUser("user-id"), &authv1.VerifyPhoneRequest{UserId: "user-id", Code: "123456"})
+	return err
+}
@@ -3,35 +3,72 @@ package users
 import (
 	"context"
 	"errors"
+	"sort"
 
+	usersv1 "github.com/DenisBochko/yandex_SSO/gen/go/users/v1"
 	"github.com/DenisBochko/yandex_SSO/internal/domain/models"
+	"github.com/DenisBochko/yandex_SSO/internal/services/users"
 	"github.com/DenisBochko/yandex_SSO/internal/storage"
+	authinterceptor "github.com/DenisBochko/yandex_SSO/pkg/AuthInterceptor"
 
 	ssov1 "gitlab.crja72.ru/golang/2025/spring/course/projects/go6/contracts/gen/go/sso"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
 )
 
 type UsersService interface {
 	GetUsers(ctx context.Context, ids []string) ([]models.User, error)
 	GetUserById(ctx context.Context, id string) (models.User, error)
-	UpdateUser(ctx context.Context, user models.User) (bool, error)
+	UpdateUser(ctx context.Context, id string, name string, email string, confirmEmailChange func() error) (bool, error)
 	DeleteUser(ctx context.Context, id string) (bool, error)
 	UploadAvatar(ctx context.Context, id string, photo []byte, contentType string, fileName string) (string, error)
+	CheckUsername(ctx context.Context, userID string, raw string) (string, error)
+	ChangeUsername(ctx context.Context, userID string, raw string) (string, error)
+	UsernameHistory(ctx context.Context, userID string) ([]models.UsernameChange, error)
+	ListSecurityEvents(ctx context.Context, userID string, beforeID int64, limit int) ([]models.SecurityEvent, error)
 }
 
-const (
-	fileName = "avatar"
-)
+const fileName = "avatar"
 
 type UsersServerAPI struct {
 	ssov1.UnimplementedUsersServer
 	userService UsersService
+
+	// stepUpEmailChange - смена email в UpdateUser требует свежего входа (step_up.email_change)
+	stepUpEmailChange bool
+}
+
+// UsersV1ServerAPI реализует методы из proto/users/v1, которых пока нет в contracts
+type UsersV1ServerAPI struct {
+	usersv1.UnimplementedUsersServer
+	userService UsersService
 }
 
-func Register(gRPC *grpc.Server, userService UsersService) {
-	ssov1.RegisterUsersServer(gRPC, &UsersServerAPI{userService: userService})
+func Register(gRPC *grpc.Server, userService UsersService, stepUpEmailChange bool) {
+	ssov1.RegisterUsersServer(gRPC, &UsersServerAPI{userService: userService, stepUpEmailChange: stepUpEmailChange})
+	usersv1.RegisterUsersServer(gRPC, &UsersV1ServerAPI{userService: userService})
+}
+
+// checkOwner не даёт по своему access токену работать с чужим аккаунтом.
+// Запрос без токена (grpc.auth_interceptor: false) пропускается, как и в остальных методах Users
+func checkOwner(ctx context.Context, userID string) error {
+	if tokenUserID, ok := ctx.Value(authinterceptor.ContextUserIDKey).(string); ok && tokenUserID != userID {
+		return status.Error(codes.PermissionDenied, "access token belongs to another user")
+	}
+
+	return nil
+}
+
+// requireOwner - checkOwner, который не пропускает запрос без токена и при grpc.auth_interceptor: false.
+// Нужен методам, которые меняют аккаунт или отдают его историю
+func requireOwner(ctx context.Context, userID string) error {
+	if _, ok := ctx.Value(authinterceptor.ContextUserIDKey).(string); !ok {
+		return status.Error(codes.Unauthenticated, "access token is required")
+	}
+
+	return checkOwner(ctx, userID)
 }
 
 func (u *UsersServerAPI) GetUserById(ctx context.Context, req *ssov1.GetUserByIdRequest) (*ssov1.GetUserByIdResponse, error) {
@@ -98,22 +135,35 @@ func (s *UsersServerAPI) UpdateUser(ctx context.Context, req *ssov1.UpdateUserRe
 		return nil, status.Error(codes.InvalidArgument, "UserId is required")
 	}
 
-	user, err := s.userService.GetUserById(ctx, req.GetUserId())
-	if err != nil {
-		if errors.Is(err, storage.ErrUserNotFound) {
-			return nil, status.Error(codes.NotFound, err.Error())
-		}
-		return nil, status.Error(codes.Internal, err.Error())
+	if err := checkOwner(ctx, req.GetUserId()); err != nil {
+		return nil, err
 	}
 
-	user.Name = req.GetName()
-	user.Email = req.GetEmail()
+	// смена email - захват аккаунта, поэтому нужен недавний ввод пароля (Reauthenticate).
+	// Сервис сравнивает email с записью, прочитанной в транзакции обновления
+	var stepUpErr error
+	var confirmEmailChange func() error
+	if s.stepUpEmailChange {
+		confirmEmailChange = func() error {
+			stepUpErr = authinterceptor.RequireStepUp(ctx)
+			return stepUpErr
+		}
+	}
 
-	_, err = s.userService.UpdateUser(ctx, user)
+	_, err := s.userService.UpdateUser(ctx, req.GetUserId(), req.GetName(), req.GetEmail(), confirmEmailChange)
 	if err != nil {
+		if stepUpErr != nil {
+			return nil, stepUpErr
+		}
 		if errors.Is(err, storage.ErrUserNotFound) {
 			return nil, status.Error(codes.NotFound, err.Error())
 		}
+		if errors.Is(err, storage.ErrUserExists) {
+			return nil, status.Error(codes.AlreadyExists, err.Error())
+		}
+		if errors.Is(err, users.ErrInvalidEmail) {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
 		return nil, status.Error(codes.Internal, err.Error())
 	}
 
@@ -127,6 +177,10 @@ func (s *UsersServerAPI) DeleteUser(ctx context.Context, req *ssov1.DeleteUserRe
 		return nil, status.Error(codes.InvalidArgument, "id is required")
 	}
 
+	if err := checkOwner(ctx, req.GetUserId()); err != nil {
+		return nil, err
+	}
+
 	ok, err := s.userService.DeleteUser(ctx, req.GetUserId())
 	if err != nil {
 		if errors.Is(err, storage.ErrUserNotFound) {
@@ -173,3 +227,167 @@ func (s *UsersServerAPI) UploadAvatar(ctx context.Context, req *ssov1.UploadAvat
 		Url: url,
 	}, nil
 }
+
+func (s *UsersV1ServerAPI) CheckUsername(ctx context.Context, req *usersv1.CheckUsernameRequest) (*usersv1.CheckUsernameResponse, error) {
+	if req.GetUsername() == "" {
+		return nil, status.Error(codes.InvalidArgument, "username is required")
+	}
+
+	username, err := s.userService.CheckUsername(ctx, req.GetUserId(), req.GetUsername())
+	if err != nil {
+		if errors.Is(err, storage.ErrUsernameTaken) {
+			return &usersv1.CheckUsernameResponse{Username: username, Available: false}, nil
+		}
+		if errors.Is(err, users.ErrInvalidUsername) || errors.Is(err, users.ErrReservedUsername) {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	return &usersv1.CheckUsernameResponse{
+		Username:  username,
+		Available: true,
+	}, nil
+}
+
+func (s *UsersV1ServerAPI) ChangeUsername(ctx context.Context, req *usersv1.ChangeUsernameRequest) (*usersv1.ChangeUsernameResponse, error) {
+	if req.GetUserId() == "" {
+		return nil, status.Error(codes.InvalidArgument, "id is required")
+	}
+
+	if req.GetUsername() == "" {
+		return nil, status.Error(codes.InvalidArgument, "username is required")
+	}
+
+	if err := requireOwner(ctx, req.GetUserId()); err != nil {
+		return nil, err
+	}
+
+	username, err := s.userService.ChangeUsername(ctx, req.GetUserId(), req.GetUsername())
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return nil, status.Error(codes.NotFound, err.Error())
+		}
+		if errors.Is(err, storage.ErrUsernameTaken) {
+			return nil, status.Error(codes.AlreadyExists, err.Error())
+		}
+		if errors.Is(err, storage.ErrUsernameChangeTooSoon) {
+			return nil, status.Error(codes.FailedPrecondition, err.Error())
+		}
+		if errors.Is(err, users.ErrInvalidUsername) || errors.Is(err, users.ErrReservedUsername) {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	return &usersv1.ChangeUsernameResponse{
+		Username: username,
+	}, nil
+}
+
+// GetUser - GetUserById с полями, которых нет в ssov1.User: хэндлом и доставляемостью email
+func (s *UsersV1ServerAPI) GetUser(ctx context.Context, req *usersv1.GetUserRequest) (*usersv1.GetUserResponse, error) {
+	if req.GetUserId() == "" {
+		return nil, status.Error(codes.InvalidArgument, "id is required")
+	}
+
+	user, err := s.userService.GetUserById(ctx, req.GetUserId())
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return nil, status.Error(codes.NotFound, err.Error())
+		}
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	emailStatus := user.EmailStatus
+	if emailStatus == "" {
+		emailStatus = models.EmailStatusOK
+	}
+
+	return &usersv1.GetUserResponse{
+		User: &usersv1.User{
+			UserId:      user.ID,
+			Name:        user.Name,
+			Email:       user.Email,
+			AvatarUrl:   user.Avatar,
+			Username:    user.Username,
+			EmailStatus: string(emailStatus),
+		},
+	}, nil
+}
+
+func (s *UsersV1ServerAPI) UsernameHistory(ctx context.Context, req *usersv1.UsernameHistoryRequest) (*usersv1.UsernameHistoryResponse, error) {
+	if req.GetUserId() == "" {
+		return nil, status.Error(codes.InvalidArgument, "id is required")
+	}
+
+	if err := requireOwner(ctx, req.GetUserId()); err != nil {
+		return nil, err
+	}
+
+	history, err := s.userService.UsernameHistory(ctx, req.GetUserId())
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return nil, status.Error(codes.NotFound, err.Error())
+		}
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	changes := make([]*usersv1.UsernameChange, 0, len(history))
+	for _, change := range history {
+		changes = append(changes, &usersv1.UsernameChange{
+			Username:  change.Username,
+			ChangedAt: timestamppb.New(change.ChangedAt),
+			HeldUntil: timestamppb.New(change.HeldUntil),
+		})
+	}
+
+	return &usersv1.UsernameHistoryResponse{
+		Changes: changes,
+	}, nil
+}
+
+func (s *UsersV1ServerAPI) ListSecurityEvents(ctx context.Context, req *usersv1.ListSecurityEventsRequest) (*usersv1.ListSecurityEventsResponse, error) {
+	if req.GetUserId() == "" {
+		return nil, status.Error(codes.InvalidArgument, "id is required")
+	}
+
+	// в ленте адреса и устройства пользователя, поэтому без токена её не отдаём и при grpc.auth_interceptor: false
+	if err := requireOwner(ctx, req.GetUserId()); err != nil {
+		return nil, err
+	}
+
+	events, err := s.userService.ListSecurityEvents(ctx, req.GetUserId(), req.GetBeforeId(), int(req.GetLimit()))
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return nil, status.Error(codes.NotFound, err.Error())
+		}
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+
+	resp := &usersv1.ListSecurityEventsResponse{
+		Events: make([]*usersv1.SecurityEvent, 0, len(events)),
+	}
+	for _, event := range events {
+		details := make([]*usersv1.SecurityEventDetail, 0, len(event.Details))
+		for key, value := range event.Details {
+			details = append(details, &usersv1.SecurityEventDetail{Key: key, Value: value})
+		}
+		sort.Slice(details, func(i, j int) bool { return details[i].Key < details[j].Key })
+
+		resp.Events = append(resp.Events, &usersv1.SecurityEvent{
+			Id:        event.ID,
+			Type:      string(event.Type),
+			Login:     event.Login,
+			Ip:        event.IP,
+			UserAgent: event.UserAgent,
+			Details:   details,
+			CreatedAt: timestamppb.New(event.CreatedAt),
+		})
+	}
+	if len(events) > 0 {
+		resp.NextBeforeId = events[len(events)-1].ID
+	}
+
+	return resp, nil
+}
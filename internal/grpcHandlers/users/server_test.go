@@ -0,0 +1,70 @@
+package users
+
+import (
+	"context"
+	"testing"
+
+	usersv1 "github.com/DenisBochko/yandex_SSO/gen/go/users/v1"
+	"github.com/DenisBochko/yandex_SSO/internal/domain/models"
+	authinterceptor "github.com/DenisBochko/yandex_SSO/pkg/AuthInterceptor"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// usernames считает вызовы методов хэндлов. Остальные методы UsersService не вызываются
+type usernames struct {
+	UsersService
+	calls int
+}
+
+func (u *usernames) ChangeUsername(ctx context.Context, userID string, raw string) (string, error) {
+	u.calls++
+	return raw, nil
+}
+
+func (u *usernames) UsernameHistory(ctx context.Context, userID string) ([]models.UsernameChange, error) {
+	u.calls++
+	return nil, nil
+}
+
+func (u *usernames) ListSecurityEvents(ctx context.Context, userID string, beforeID int64, limit int) ([]models.SecurityEvent, error) {
+	u.calls++
+	return nil, nil
+}
+
+func TestRequireOwner(t *testing.T) {
+	calls := map[string]func(ctx context.Context, s *UsersV1ServerAPI) error{
+		"change username": func(ctx context.Context, s *UsersV1ServerAPI) error {
+			_, err := s.ChangeUsername(ctx, &usersv1.ChangeUsernameRequest{UserId: "user-id", Username: "user"})
+			return err
+		},
+		"username history": func(ctx context.Context, s *UsersV1ServerAPI) error {
+			_, err := s.UsernameHistory(ctx, &usersv1.UsernameHistoryRequest{UserId: "user-id"})
+			return err
+		},
+		"security events": func(ctx context.Context, s *UsersV1ServerAPI) error {
+			_, err := s.ListSecurityEvents(ctx, &usersv1.ListSecurityEventsRequest{UserId: "user-id"})
+			return err
+		},
+	}
+
+	for name, call := range calls {
+		t.Run(name, func(t *testing.T) {
+			service := &usernames{}
+			s := &UsersV1ServerAPI{userService: service}
+
+			// без токена, как при grpc.auth_interceptor: false
+			require.Equal(t, codes.Unauthenticated, status.Code(call(context.Background(), s)))
+
+			other := context.WithValue(context.Background(), authinterceptor.ContextUserIDKey, "other-id")
+			require.Equal(t, codes.PermissionDenied, status.Code(call(other, s)))
+			require.Zero(t, service.calls)
+
+			owner := context.WithValue(context.Background(), authinterceptor.ContextUserIDKey, "user-id")
+			require.NoError(t, call(owner, s))
+			require.Equal(t, 1, service.calls)
+		})
+	}
+}
@@ -0,0 +1,82 @@
+package migrations
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/DenisBochko/yandex_SSO/pkg/sqlite"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSqliteMigrator(t *testing.T) {
+	ctx := context.Background()
+
+	conn, err := sqlite.New(ctx, sqlite.SqliteConfig{Path: filepath.Join(t.TempDir(), "sso.db"), BusyTimeout: 5 * time.Second})
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	m, err := NewSqlite(conn)
+	require.NoError(t, err)
+
+	status, err := m.Status(ctx)
+	require.NoError(t, err)
+	require.Zero(t, status.Version)
+	require.NotEmpty(t, status.Migrations)
+	require.Len(t, status.Pending(), len(status.Migrations))
+	require.ErrorIs(t, status.Compatible(), ErrSchemaNotMigrated)
+
+	require.NoError(t, m.Up(ctx))
+	// повторный up ничего не делает
+	require.NoError(t, m.Up(ctx))
+
+	status, err = m.Status(ctx)
+	require.NoError(t, err)
+	require.Equal(t, status.Latest(), status.Version)
+	require.Empty(t, status.Pending())
+	require.NoError(t, status.Compatible())
+
+	require.NoError(t, m.Down(ctx, len(status.Migrations)))
+	status, err = m.Status(ctx)
+	require.NoError(t, err)
+	require.Zero(t, status.Version)
+
+	require.NoError(t, m.Force(ctx, int(status.Latest())))
+	status, err = m.Status(ctx)
+	require.NoError(t, err)
+	require.NoError(t, status.Compatible())
+
+	require.NoError(t, m.Close())
+	// Close не закрывает бд, принадлежащую вызывающему
+	require.NoError(t, conn.PingContext(ctx))
+}
+
+func TestStatusCompatible(t *testing.T) {
+	all := []Migration{{Version: 1, Name: "init"}, {Version: 2, Name: "users"}}
+
+	require.NoError(t, Status{Version: 2, Migrations: all}.Compatible())
+	// схема новее сборки: её применила более новая версия сервиса во время выкатки
+	require.NoError(t, Status{Version: 3, Migrations: all}.Compatible())
+	require.ErrorIs(t, Status{Version: 1, Migrations: all}.Compatible(), ErrSchemaOutdated)
+	require.ErrorIs(t, Status{Version: 2, Dirty: true, Migrations: all}.Compatible(), ErrSchemaDirty)
+}
+
+func TestCreate(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"1_init.up.sql", "1_init.down.sql", "12_users.up.sql", "12_users.down.sql"} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), nil, 0o644))
+	}
+
+	up, down, err := Create(dir, "addIndex")
+	require.NoError(t, err)
+	require.Equal(t, filepath.Join(dir, "13_addIndex.up.sql"), up)
+	require.Equal(t, filepath.Join(dir, "13_addIndex.down.sql"), down)
+	require.FileExists(t, up)
+	require.FileExists(t, down)
+
+	_, _, err = Create(dir, "../escape")
+	require.Error(t, err)
+}
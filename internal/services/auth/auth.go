@@ -4,12 +4,17 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/DenisBochko/yandex_SSO/internal/config"
 	"github.com/DenisBochko/yandex_SSO/internal/domain/models"
 	"github.com/DenisBochko/yandex_SSO/internal/storage"
+	"github.com/DenisBochko/yandex_SSO/lib/emailaddr"
+	"github.com/DenisBochko/yandex_SSO/lib/handle"
 	"github.com/DenisBochko/yandex_SSO/lib/jwt"
+	"github.com/DenisBochko/yandex_SSO/lib/otp"
+	"github.com/DenisBochko/yandex_SSO/lib/phone"
 
 	"github.com/google/uuid"
 	"go.uber.org/zap"
@@ -25,24 +30,48 @@ type Auth struct {
 	kafkaTransport KafkaTransport
 	redis          RedisStorage
 	cfg            *config.JwtConfig
+	verifyCfg      *config.VerificationConfig
+	phoneCfg       *config.PhoneConfig
+	devicesCfg     *config.DevicesConfig
+	risk           RiskEngine
+	phones         phone.Normalizer
+	emails         emailaddr.Normalizer
 }
 
 type KafkaTransport interface {
 	SendVerificationUserMessage(ctx context.Context, message models.VerificationUserMessage) error
+	SendSmsMessage(ctx context.Context, message models.SmsMessage) error
+	SendNewSignInMessage(ctx context.Context, message models.NewSignInMessage) error
+	SendUserEvent(ctx context.Context, event models.UserEvent) error
 }
 
 type RedisStorage interface {
-	Set(uuid string, userID string) error
-	Get(uuid string) (string, error)
-	Delete(uuid string) error
+	SaveSession(ctx context.Context, token string, session models.Session) error
+	Session(ctx context.Context, token string) (models.Session, error)
+	Delete(ctx context.Context, uuid string) error
+	DeleteUserSessions(ctx context.Context, userID string) (int64, error)
 }
 
 type Storage interface {
-	SaveUser(ctx context.Context, name string, email string, passHash []byte) (uid string, err error)
-	User(ctx context.Context, email string) (models.User, error)
+	SaveUser(ctx context.Context, name string, email string, emailCanonical string, passHash []byte) (uid string, err error)
+	User(ctx context.Context, email string, emailCanonical string) (models.User, error)
+	UserByUsername(ctx context.Context, username string) (models.User, error)
 	CreateVerificationToken(ctx context.Context, userID string, token string, expiresAt time.Time) (bool, error)
-	VerifyToken(ctx context.Context, token string) (bool, error)
+	VerifyToken(ctx context.Context, token string) (userID string, err error)
 	UserById(ctx context.Context, id string) (models.User, error)
+	SavePhoneUser(ctx context.Context, name string, phone string) (uid string, err error)
+	UserByPhone(ctx context.Context, phone string) (models.User, error)
+	SetUserPhone(ctx context.Context, id string, phone string) (bool, error)
+	CreateVerificationCode(ctx context.Context, userID string, channel models.CodeChannel, codeHash []byte, expiresAt time.Time, limits models.CodeLimits) (bool, error)
+	VerificationCode(ctx context.Context, userID string, channel models.CodeChannel) (models.VerificationCode, error)
+	AddVerificationCodeAttempt(ctx context.Context, userID string, channel models.CodeChannel, maxAttempts int) (int, error)
+	ConsumeVerificationCode(ctx context.Context, userID string, channel models.CodeChannel) (bool, error)
+	SaveSecurityEvent(ctx context.Context, event models.SecurityEvent) error
+	CountRecentSecurityEvents(ctx context.Context, userID string, ip string, eventType models.SecurityEventType, since time.Time) (int, error)
+	TouchKnownDevice(ctx context.Context, device models.KnownDevice) (isNew bool, knownBefore int, err error)
+	CreateSessionRevokeToken(ctx context.Context, userID string, fingerprint string, token string, expiresAt time.Time) error
+	ConsumeSessionRevokeToken(ctx context.Context, token string) (string, error)
+	InTx(ctx context.Context, fn func(ctx context.Context) error) error
 }
 
 func New(
@@ -51,6 +80,11 @@ func New(
 	transport KafkaTransport,
 	redis RedisStorage,
 	cfg *config.JwtConfig,
+	verifyCfg *config.VerificationConfig,
+	phoneCfg *config.PhoneConfig,
+	emailCfg *config.EmailConfig,
+	devicesCfg *config.DevicesConfig,
+	riskEngine RiskEngine,
 ) *Auth {
 	return &Auth{
 		log:            log,
@@ -58,6 +92,17 @@ func New(
 		kafkaTransport: transport,
 		redis:          redis,
 		cfg:            cfg,
+		verifyCfg:      verifyCfg,
+		phoneCfg:       phoneCfg,
+		devicesCfg:     devicesCfg,
+		risk:           riskEngine,
+		phones: phone.Normalizer{
+			DefaultCountryCode: phoneCfg.DefaultCountryCode,
+			TrunkPrefix:        phoneCfg.TrunkPrefix,
+		},
+		emails: emailaddr.Normalizer{
+			ProviderRules: emailCfg.ProviderCanonicalization,
+		},
 	}
 }
 
@@ -66,6 +111,14 @@ var (
 	ErrUserExists          = errors.New("user already exists")
 	ErrRegistrationFailed  = errors.New("registration failed")
 	ErrRefreshTokenExpired = errors.New("refresh token has expired")
+	ErrAccountBlocked      = errors.New("account is blocked")
+	ErrInvalidCode         = errors.New("invalid verification code")
+	ErrInvalidEmail        = errors.New("invalid email")
+	ErrLoginDenied         = errors.New("login denied by risk policy")
+	ErrEmailUndeliverable  = errors.New("email address is undeliverable")
+
+	// ErrSecondFactorRequired - вход рискованный, код для CompleteLoginChallenge отправлен по SMS
+	ErrSecondFactorRequired = errors.New("second factor required")
 )
 
 // apiGateway.com/api/sso/verify?token=edea549f-8843-492e-ad8e-c11a62e3bdc5
@@ -73,6 +126,11 @@ var (
 // RegisterNewUser registers new user in the system and returns user ID.
 // If user with given username already exists, returns error.
 func (a *Auth) Register(ctx context.Context, name string, email string, pass string) (string, error) {
+	email, emailCanonical, err := a.emails.Normalize(email)
+	if err != nil {
+		return "", ErrInvalidEmail
+	}
+
 	log := a.log.With(zap.String("email", email))
 	log.Info("Registering new user")
 
@@ -83,99 +141,135 @@ func (a *Auth) Register(ctx context.Context, name string, email string, pass str
 		return "", fmt.Errorf("failed to hash password: %w", err)
 	}
 
-	// Сохраняем пользователя в БД
-	id, err := a.storage.SaveUser(ctx, name, email, passHash)
-	if err != nil {
-		if errors.Is(err, storage.ErrUserExists) {
-			log.Info("user already exists", zap.Error(err))
-			return "", storage.ErrUserExists
+	// Пользователь и сообщение с верификацией сохраняются в одной транзакции:
+	// либо есть оба, либо ни одного
+	var id string
+	err = a.storage.InTx(ctx, func(ctx context.Context) error {
+		// Сохраняем пользователя в БД
+		id, err = a.storage.SaveUser(ctx, name, email, emailCanonical, passHash)
+		if err != nil {
+			if errors.Is(err, storage.ErrUserExists) {
+				log.Info("user already exists", zap.Error(err))
+				return storage.ErrUserExists
+			}
+
+			log.Info("failed to save user", zap.Error(err))
+			return fmt.Errorf("failed to save user: %w", err)
 		}
 
-		log.Info("failed to save user", zap.Error(err))
-		return "", fmt.Errorf("failed to save user: %w", err)
-	}
+		// Создаем верификационный токен и/или код и отправляем их пользователю
+		if err := a.sendVerification(ctx, id, name, email); err != nil {
+			log.Error("failed to send verification", zap.Error(err))
+			return err
+		}
 
-	// Создаем верификационный токен для пользователя
-	verificationToken := uuid.NewString()
-	expiresAt := time.Now().Add(10 * time.Minute).UTC()
+		event := models.UserEvent{
+			Type:    models.UserEventRegistered,
+			UserID:  id,
+			Profile: &models.UserProfile{Name: name, Email: email},
+		}
+		if err := a.kafkaTransport.SendUserEvent(ctx, event); err != nil {
+			log.Error("failed to send user event", zap.Error(err))
+			return fmt.Errorf("failed to send user event: %w", err)
+		}
 
-	ok, err := a.storage.CreateVerificationToken(ctx, id, verificationToken, expiresAt)
+		return nil
+	})
 	if err != nil {
-		log.Error("failed to create verification token", zap.Error(err))
-		return "", fmt.Errorf("failed to create verification token: %w", err)
+		return "", err
 	}
 
-	if !ok {
-		log.Error("failed to create verification token", zap.String("userID", id))
-		return "", fmt.Errorf("failed to create verification token: %w", err)
+	return id, nil
+}
+
+func (a *Auth) ResendVerificationToken(ctx context.Context, user_id string) (string, error) {
+	// пользователь читается в транзакции мимо кэша: ссылка не должна уйти на прежний адрес
+	err := a.storage.InTx(ctx, func(ctx context.Context) error {
+		user, err := a.storage.UserById(ctx, user_id)
+		if err != nil {
+			return err
+		}
+
+		// на адрес, с которого пришёл отказ или жалоба, не пишем: пользователь должен сменить email
+		if !user.EmailDeliverable() {
+			return ErrEmailUndeliverable
+		}
+
+		return a.sendVerification(ctx, user.ID, user.Name, user.Email)
+	})
+	if errors.Is(err, storage.ErrUserNotFound) || errors.Is(err, ErrEmailUndeliverable) {
+		return "failed", err
+	}
+	if err != nil {
+		a.log.Error("failed to send verification", zap.String("userID", user_id), zap.Error(err))
+		return "failed", err
 	}
 
-	// Отправляем сообщение в Kafka
+	return "OK", nil
+}
+
+// sendVerification выпускает ссылку-токен и/или числовой код в зависимости от verification.mode
+// и отправляет их в Kafka. Новый токен и новый код заменяют ранее выданные.
+func (a *Auth) sendVerification(ctx context.Context, userID string, name string, email string) error {
 	message := models.VerificationUserMessage{
-		UserID: id,
+		UserID: userID,
 		Name:   name,
 		Email:  email,
-		Token:  verificationToken,
 	}
 
-	if err := a.kafkaTransport.SendVerificationUserMessage(ctx, message); err != nil {
-		log.Error("failed to send verification message", zap.Error(err))
-		return "", fmt.Errorf("failed to send verification message: %w", err)
-	}
+	expiresAt := time.Now().Add(a.verifyCfg.TTL).UTC()
 
-	return id, nil
-}
+	if a.verifyCfg.Mode != config.VerificationModeCode {
+		verificationToken := uuid.NewString()
 
-func (a *Auth) ResendVerificationToken(ctx context.Context, user_id string) (string, error) {
-	user, err := a.storage.UserById(ctx, user_id)
-	if err != nil {
-		return "failed", err
-	}
+		ok, err := a.storage.CreateVerificationToken(ctx, userID, verificationToken, expiresAt)
+		if err != nil {
+			return fmt.Errorf("failed to create verification token: %w", err)
+		}
 
-	// Создаем верификационный токен для пользователя
-	verificationToken := uuid.NewString()
-	expiresAt := time.Now().Add(10 * time.Minute).UTC()
+		if !ok {
+			return fmt.Errorf("failed to create verification token for user %s", userID)
+		}
 
-	ok, err := a.storage.CreateVerificationToken(ctx, user.ID, verificationToken, expiresAt)
-	if err != nil {
-		a.log.Error("failed to create verification token", zap.Error(err))
-		return "failed", fmt.Errorf("failed to create verification token: %w", err)
+		message.Token = verificationToken
 	}
 
-	if !ok {
-		a.log.Error("failed to create verification token", zap.String("userID", user.ID))
-		return "failed", fmt.Errorf("failed to create verification token: %w", err)
-	}
+	if a.verifyCfg.Mode == config.VerificationModeCode || a.verifyCfg.Mode == config.VerificationModeBoth {
+		code, err := a.newCode(ctx, userID, models.CodeChannelEmail, expiresAt, models.CodeLimits{
+			ResendCooldown: a.verifyCfg.CodeResendCooldown,
+			Window:         a.verifyCfg.CodeIssueWindow,
+			MaxIssues:      a.verifyCfg.CodeMaxIssues,
+		})
+		if err != nil {
+			return err
+		}
 
-	// Отправляем сообщение в Kafka
-	message := models.VerificationUserMessage{
-		UserID: user.ID,
-		Name:   user.Name,
-		Email:  user.Email,
-		Token:  verificationToken,
+		message.Code = code
 	}
 
+	// Отправляем сообщение в Kafka
 	if err := a.kafkaTransport.SendVerificationUserMessage(ctx, message); err != nil {
-		a.log.Error("failed to send verification message", zap.Error(err))
-		return "failed", fmt.Errorf("failed to send verification message: %w", err)
+		return fmt.Errorf("failed to send verification message: %w", err)
 	}
 
-	return "OK", nil
+	return nil
 }
 
 // Login checks if user with given credentials exists in the system and returns access token.
+// login is either an email or a username (handle), with or without leading @.
 //
 // If user exists, but password is incorrect, returns error.
 // If user doesn't exist, returns error.
-func (a *Auth) Login(ctx context.Context, email string, password string) (string, *timestamppb.Timestamp, string, *timestamppb.Timestamp, error) {
-	log := a.log.With(zap.String("email", email))
+func (a *Auth) Login(ctx context.Context, login string, password string) (string, *timestamppb.Timestamp, string, *timestamppb.Timestamp, error) {
+	log := a.log.With(zap.String("login", login))
 	log.Info("Attempting to login user")
 
 	// Достаем пользователя из БД
-	user, err := a.storage.User(ctx, email)
+	user, err := a.userByLogin(ctx, login)
 	if err != nil {
 		if errors.Is(err, storage.ErrUserNotFound) {
 			log.Warn("user not found", zap.Error(err))
+			a.recordEvent(ctx, models.SecurityEventLoginFailure, "", login, reason("user_not_found"))
 			return "", nil, "", nil, fmt.Errorf("user not found: %w", ErrInvalidCredentials)
 		}
 		log.Error("failed to get user", zap.Error(err))
@@ -185,33 +279,50 @@ func (a *Auth) Login(ctx context.Context, email string, password string) (string
 	// Проверяем корректность полученного пароля
 	if err := bcrypt.CompareHashAndPassword(user.PassHash, []byte(password)); err != nil {
 		log.Warn("invalid credentials", zap.Error(err))
+		a.recordEvent(ctx, models.SecurityEventLoginFailure, user.ID, login, reason("invalid_password"))
 		return "", nil, "", nil, fmt.Errorf("invalid credentials: %w", ErrInvalidCredentials)
 	}
 
-	log.Info("user logged in successfully", zap.String("userID", user.ID))
+	// Заблокированным пользователям токены не выдаём
+	if err := checkAccountStatus(user); err != nil {
+		log.Warn("login attempt to blocked account", zap.String("userID", user.ID), zap.String("status", string(user.Status)))
+		a.recordEvent(ctx, models.SecurityEventLoginFailure, user.ID, login, reason("account_"+string(user.Status)))
+		return "", nil, "", nil, err
+	}
 
-	// Создаем access токен авторизации
-	accessToken, err := jwt.NewToken(user, a.cfg.AppSecretAccessToken, a.cfg.AccessTokenTTL)
-	if err != nil {
-		log.Error("failed to create access token", zap.Error(err))
-		return "", nil, "", nil, fmt.Errorf("failed to create access token: %w", err)
+	details := map[string]string{"method": models.AMRPassword}
+	if err := a.assessLogin(ctx, user, login, models.AMRPassword, details); err != nil {
+		log.Warn("login stopped by risk policy", zap.String("userID", user.ID), zap.String("score", details["risk_score"]), zap.Error(err))
+		return "", nil, "", nil, err
 	}
-	access_token_expires_at := durationToTimestamp(time.Now(), a.cfg.AccessTokenTTL)
+	session := newSession(user.ID, models.AMRPassword)
 
-	// Создаем refresh токен авторизации и сохраняем в Redis
-	refreshToken := uuid.New().String()
+	log.Info("user logged in successfully", zap.String("userID", user.ID), zap.String("risk", details["risk_decision"]))
+	a.recordEvent(ctx, models.SecurityEventLoginSuccess, user.ID, login, details)
+	a.checkDevice(ctx, user)
+	a.emitLoggedIn(ctx, user.ID, models.AMRPassword)
 
-	if err := a.redis.Set(refreshToken, user.ID); err != nil {
-		log.Error("failed to save user in redis", zap.Error(err))
-		return "", nil, "", nil, fmt.Errorf("failed to save user in redis: %w", err)
+	return a.issueTokens(ctx, user, session)
+}
+
+// userByLogin ищет пользователя по email или хэндлу. В хэндле не может быть @,
+// поэтому строка с @ в середине всегда считается email.
+func (a *Auth) userByLogin(ctx context.Context, login string) (models.User, error) {
+	if !strings.Contains(strings.TrimPrefix(strings.TrimSpace(login), "@"), "@") {
+		return a.storage.UserByUsername(ctx, handle.Fold(login))
 	}
-	refresh_token_expires_at := durationToTimestamp(time.Now(), a.cfg.RefreshTokenTTL)
 
-	return accessToken, access_token_expires_at, refreshToken, refresh_token_expires_at, nil
+	// Приводим email к каноническому виду: Bob@X.com и bob@x.com - один пользователь
+	email, emailCanonical, err := a.emails.Normalize(login)
+	if err != nil {
+		return models.User{}, storage.ErrUserNotFound
+	}
+
+	return a.storage.User(ctx, email, emailCanonical)
 }
 
 func (a *Auth) RefreshToken(ctx context.Context, token string) (string, *timestamppb.Timestamp, string, *timestamppb.Timestamp, error) {
-	userID, err := a.redis.Get(token)
+	session, err := a.redis.Session(ctx, token)
 	if err != nil {
 		if errors.Is(err, storage.ErrKeyDoesNotExist) {
 			return "", nil, "", nil, ErrRefreshTokenExpired
@@ -219,7 +330,7 @@ func (a *Auth) RefreshToken(ctx context.Context, token string) (string, *timesta
 		return "", nil, "", nil, fmt.Errorf("failed to get user from redis: %w", err)
 	}
 
-	user, err := a.storage.UserById(ctx, userID)
+	user, err := a.storage.UserById(ctx, session.UserID)
 	if err != nil {
 		if errors.Is(err, storage.ErrUserNotFound) {
 			a.log.Info("User not found")
@@ -230,53 +341,199 @@ func (a *Auth) RefreshToken(ctx context.Context, token string) (string, *timesta
 	}
 
 	// удаляем старый токен из редис
-	if err := a.redis.Delete(token); err != nil {
+	if err := a.redis.Delete(ctx, token); err != nil {
 		return "", nil, "", nil, fmt.Errorf("failed to delete user from redis: %w", err)
 	}
 
-	// Создаем новый access токен
-	newAccessToken, err := jwt.NewToken(user, a.cfg.AppSecretAccessToken, a.cfg.AccessTokenTTL)
+	// Заблокированный пользователь теряет сессию: старый токен уже удалён, новый не выдаём
+	if err := checkAccountStatus(user); err != nil {
+		a.log.Warn("refresh attempt for blocked account", zap.String("userID", user.ID), zap.String("status", string(user.Status)))
+		return "", nil, "", nil, err
+	}
+
+	a.recordEvent(ctx, models.SecurityEventTokenRefresh, user.ID, "", nil)
+
+	// время и способ входа остаются прежними: обновление токена - не повторная аутентификация
+	return a.issueTokens(ctx, user, session)
+}
+
+// newSession описывает только что прошедшую проверку учётных данных
+func newSession(userID string, methods ...string) models.Session {
+	return models.Session{
+		UserID:   userID,
+		AuthTime: time.Now().UTC().Truncate(time.Second),
+		AMR:      methods,
+		ACR:      models.ACRSingleFactor,
+	}
+}
+
+// issueTokens создаёт access токен и новый refresh токен, под которым сессия сохраняется в Redis
+func (a *Auth) issueTokens(ctx context.Context, user models.User, session models.Session) (string, *timestamppb.Timestamp, string, *timestamppb.Timestamp, error) {
+	// Создаем access токен авторизации
+	accessToken, err := jwt.NewToken(user, session, a.cfg.AppSecretAccessToken, a.cfg.AccessTokenTTL)
 	if err != nil {
-		return "", nil, "", nil, fmt.Errorf("failed to create new token: %w", err)
+		a.log.Error("failed to create access token", zap.Error(err))
+		return "", nil, "", nil, fmt.Errorf("failed to create access token: %w", err)
 	}
 	access_token_expires_at := durationToTimestamp(time.Now(), a.cfg.AccessTokenTTL)
 
 	// Создаем refresh токен авторизации и сохраняем в Redis
 	refreshToken := uuid.New().String()
 
-	if err := a.redis.Set(refreshToken, user.ID); err != nil {
+	if err := a.redis.SaveSession(ctx, refreshToken, session); err != nil {
 		a.log.Error("failed to save user in redis", zap.Error(err))
 		return "", nil, "", nil, fmt.Errorf("failed to save user in redis: %w", err)
 	}
 	refresh_token_expires_at := durationToTimestamp(time.Now(), a.cfg.RefreshTokenTTL)
 
-	return newAccessToken, access_token_expires_at, refreshToken, refresh_token_expires_at, nil
+	return accessToken, access_token_expires_at, refreshToken, refresh_token_expires_at, nil
 }
 
 func (a *Auth) Verify(ctx context.Context, token string) (bool, error) {
 	log := a.log.With(zap.String("token", token))
 	log.Info("Verifying token")
 
-	ok, err := a.storage.VerifyToken(ctx, token)
+	// подтверждение и событие user.verified фиксируются вместе: событие уходит через outbox
+	// только если адрес действительно подтверждён, и не теряется при сбое брокера
+	var expired bool
+	err := a.storage.InTx(ctx, func(ctx context.Context) error {
+		userID, err := a.storage.VerifyToken(ctx, token)
+		if err != nil {
+			if errors.Is(err, storage.ErrTokenNotFound) {
+				return fmt.Errorf("token not found: %w", err)
+			}
+			// хранилище уже удалило просроченный токен: транзакция фиксируется, иначе удаление откатится
+			if errors.Is(err, storage.ErrTokenExpired) {
+				expired = true
+				return nil
+			}
+			return fmt.Errorf("failed to verify token: %w", err)
+		}
+
+		if err := a.kafkaTransport.SendUserEvent(ctx, models.UserEvent{Type: models.UserEventVerified, UserID: userID}); err != nil {
+			return fmt.Errorf("failed to send user event: %w", err)
+		}
+
+		return nil
+	})
+	if err == nil && expired {
+		err = fmt.Errorf("token expired: %w", storage.ErrTokenExpired)
+	}
+	if err != nil {
+		log.Warn("failed to verify token", zap.Error(err))
+		return false, err
+	}
+
+	return true, nil
+}
+
+// VerifyCode подтверждает email пользователя числовым кодом.
+// Каждая проверка расходует попытку, после verification.code_max_attempts код перестаёт приниматься.
+func (a *Auth) VerifyCode(ctx context.Context, userID string, code string) (bool, error) {
+	log := a.log.With(zap.String("userID", userID))
+	log.Info("Verifying code")
+
+	// попытка расходуется вне транзакции: неверный код не должен откатывать счётчик
+	if err := a.matchCode(ctx, userID, models.CodeChannelEmail, code); err != nil {
+		log.Warn("verification code rejected", zap.Error(err))
+		return false, err
+	}
+
+	err := a.storage.InTx(ctx, func(ctx context.Context) error {
+		if err := a.consumeCode(ctx, userID, models.CodeChannelEmail); err != nil {
+			return err
+		}
+
+		if err := a.kafkaTransport.SendUserEvent(ctx, models.UserEvent{Type: models.UserEventVerified, UserID: userID}); err != nil {
+			return fmt.Errorf("failed to send user event: %w", err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		log.Warn("failed to verify code", zap.Error(err))
+		return false, err
+	}
+
+	return true, nil
+}
+
+// newCode выпускает новый числовой код для канала и сохраняет его хэш.
+// Если код запрошен слишком часто, возвращает storage.ErrTooManyCodes.
+func (a *Auth) newCode(ctx context.Context, userID string, channel models.CodeChannel, expiresAt time.Time, limits models.CodeLimits) (string, error) {
+	code, err := otp.Generate(a.verifyCfg.CodeLength)
+	if err != nil {
+		return "", fmt.Errorf("failed to generate verification code: %w", err)
+	}
+
+	codeHash, err := bcrypt.GenerateFromPassword([]byte(code), bcrypt.DefaultCost)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash verification code: %w", err)
+	}
+
+	if _, err := a.storage.CreateVerificationCode(ctx, userID, channel, codeHash, expiresAt, limits); err != nil {
+		if errors.Is(err, storage.ErrTooManyCodes) {
+			return "", err
+		}
+		return "", fmt.Errorf("failed to create verification code: %w", err)
+	}
+
+	return code, nil
+}
+
+// checkCode проверяет код канала и при совпадении погашает его
+func (a *Auth) checkCode(ctx context.Context, userID string, channel models.CodeChannel, code string) error {
+	if err := a.matchCode(ctx, userID, channel, code); err != nil {
+		return err
+	}
+
+	return a.consumeCode(ctx, userID, channel)
+}
+
+// matchCode расходует попытку и сравнивает код канала, не погашая его
+func (a *Auth) matchCode(ctx context.Context, userID string, channel models.CodeChannel, code string) error {
+	verificationCode, err := a.storage.VerificationCode(ctx, userID, channel)
 	if err != nil {
 		if errors.Is(err, storage.ErrTokenNotFound) {
-			return false, fmt.Errorf("token not found: %w", err)
+			return fmt.Errorf("code not found: %w", err)
 		}
+		return fmt.Errorf("failed to get verification code: %w", err)
+	}
 
-		if errors.Is(err, storage.ErrTokenExpired) {
-			return false, fmt.Errorf("token expired: %w", err)
+	if time.Now().UTC().After(verificationCode.ExpiresAt) {
+		return fmt.Errorf("code expired: %w", storage.ErrTokenExpired)
+	}
+
+	// Сначала расходуем попытку, потом сравниваем: так параллельные запросы не обойдут лимит
+	if _, err := a.storage.AddVerificationCodeAttempt(ctx, userID, channel, a.verifyCfg.MaxAttempts); err != nil {
+		if errors.Is(err, storage.ErrTooManyAttempts) {
+			a.recordEvent(ctx, models.SecurityEventLockout, userID, "", map[string]string{"channel": string(channel)})
+			return err
 		}
+		return fmt.Errorf("failed to count attempt: %w", err)
 	}
 
-	if !ok {
-		return false, fmt.Errorf("token not found: %w", err)
+	if err := bcrypt.CompareHashAndPassword(verificationCode.CodeHash, []byte(code)); err != nil {
+		return ErrInvalidCode
 	}
 
-	return true, nil
+	return nil
+}
+
+// consumeCode погашает код канала. Параллельный запрос с тем же кодом получит storage.ErrTokenNotFound.
+func (a *Auth) consumeCode(ctx context.Context, userID string, channel models.CodeChannel) error {
+	if _, err := a.storage.ConsumeVerificationCode(ctx, userID, channel); err != nil {
+		if errors.Is(err, storage.ErrTokenNotFound) {
+			return fmt.Errorf("code not found: %w", err)
+		}
+		return fmt.Errorf("failed to consume verification code: %w", err)
+	}
+
+	return nil
 }
 
 func (a *Auth) Logut(ctx context.Context, refreshToken string) (bool, error) {
-	_, err := a.redis.Get(refreshToken)
+	session, err := a.redis.Session(ctx, refreshToken)
 	if err != nil {
 		if errors.Is(err, storage.ErrKeyDoesNotExist) {
 			return false, ErrRefreshTokenExpired
@@ -284,14 +541,43 @@ func (a *Auth) Logut(ctx context.Context, refreshToken string) (bool, error) {
 		return false, fmt.Errorf("failed to get user from redis: %w", err)
 	}
 
-	if err := a.redis.Delete(refreshToken); err != nil {
+	if err := a.redis.Delete(ctx, refreshToken); err != nil {
 		a.log.Info("failed to delete user from redis")
 		return false, fmt.Errorf("failed to delete user from redis: %w", err)
 	}
 
+	a.recordEvent(ctx, models.SecurityEventLogout, session.UserID, "", nil)
+
 	return true, nil
 }
 
+// CheckAccountStatus проверяет, что пользователь существует и не заблокирован.
+// Используется AuthInterceptor'ом для запросов с уже выданным access токеном.
+func (a *Auth) CheckAccountStatus(ctx context.Context, userID string) error {
+	user, err := a.storage.UserById(ctx, userID)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return storage.ErrUserNotFound
+		}
+		return fmt.Errorf("failed to get user: %w", err)
+	}
+
+	return checkAccountStatus(user)
+}
+
+// checkAccountStatus возвращает ErrAccountBlocked с причиной, если вход пользователю запрещён
+func checkAccountStatus(user models.User) error {
+	if !user.IsBlocked(time.Now()) {
+		return nil
+	}
+
+	if user.Status == models.UserStatusSuspended && !user.SuspendedUntil.IsZero() {
+		return fmt.Errorf("%w: %s until %s: %s", ErrAccountBlocked, user.Status, user.SuspendedUntil.UTC().Format(time.RFC3339), user.StatusReason)
+	}
+
+	return fmt.Errorf("%w: %s: %s", ErrAccountBlocked, user.Status, user.StatusReason)
+}
+
 func durationToTimestamp(startTime time.Time, duration time.Duration) *timestamppb.Timestamp {
 	t := startTime.Add(duration)
 	return timestamppb.New(t)
@@ -0,0 +1,273 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/DenisBochko/yandex_SSO/internal/config"
+	"github.com/DenisBochko/yandex_SSO/internal/domain/models"
+	"github.com/DenisBochko/yandex_SSO/internal/storage"
+	"github.com/DenisBochko/yandex_SSO/internal/storage/memory"
+	"github.com/DenisBochko/yandex_SSO/lib/clientinfo"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+	"google.golang.org/grpc/peer"
+)
+
+// transport запоминает отправленные сообщения
+type transport struct {
+	mu            sync.Mutex
+	verifications []models.VerificationUserMessage
+	sms           []models.SmsMessage
+	events        []models.UserEvent
+	eventsErr     error // ошибка отправки событий, как при недоступном брокере
+}
+
+func (t *transport) SendVerificationUserMessage(ctx context.Context, message models.VerificationUserMessage) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.verifications = append(t.verifications, message)
+	return nil
+}
+
+func (t *transport) SendSmsMessage(ctx context.Context, message models.SmsMessage) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.sms = append(t.sms, message)
+	return nil
+}
+
+func (t *transport) SendNewSignInMessage(ctx context.Context, message models.NewSignInMessage) error {
+	return nil
+}
+
+func (t *transport) SendUserEvent(ctx context.Context, event models.UserEvent) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.eventsErr != nil {
+		return t.eventsErr
+	}
+	t.events = append(t.events, event)
+	return nil
+}
+
+type allowRisk struct{}
+
+func (allowRisk) Assess(ctx context.Context, userID string, client clientinfo.Info) models.RiskAssessment {
+	return models.RiskAssessment{Decision: models.RiskAllow}
+}
+
+// fixedRisk возвращает одно и то же решение для любого входа
+type fixedRisk models.RiskDecision
+
+func (r fixedRisk) Assess(ctx context.Context, userID string, client clientinfo.Info) models.RiskAssessment {
+	return models.RiskAssessment{Decision: models.RiskDecision(r)}
+}
+
+func newAuth(t *testing.T) (*Auth, *memory.Storage, *transport) {
+	return newAuthWithRisk(t, allowRisk{})
+}
+
+func newAuthWithRisk(t *testing.T, risk RiskEngine) (*Auth, *memory.Storage, *transport) {
+	t.Helper()
+
+	st := memory.New()
+	tr := &transport{}
+	a := New(zap.NewNop(), st, tr, memory.NewSessions(time.Hour),
+		&config.JwtConfig{AppSecretAccessToken: "a", AppSecretRefreshToken: "b", AccessTokenTTL: time.Minute, RefreshTokenTTL: time.Hour},
+		&config.VerificationConfig{Mode: config.VerificationModeBoth, TTL: time.Hour, CodeLength: 6, MaxAttempts: 3},
+		&config.PhoneConfig{DefaultCountryCode: "7", TrunkPrefix: "8", OTPTTL: time.Minute,
+			OTPResendCooldown: time.Minute, OTPIssueWindow: time.Hour, OTPMaxIssues: 3, OTPMaxPerIP: 3},
+		&config.EmailConfig{},
+		&config.DevicesConfig{},
+		risk,
+	)
+
+	return a, st, tr
+}
+
+func TestCheckAccountStatus(t *testing.T) {
+	now := time.Now()
+
+	tests := []struct {
+		name    string
+		user    models.User
+		blocked bool
+	}{
+		{"active", models.User{Status: models.UserStatusActive}, false},
+		{"no status", models.User{}, false},
+		{"suspended indefinitely", models.User{Status: models.UserStatusSuspended}, true},
+		{"suspended until later", models.User{Status: models.UserStatusSuspended, SuspendedUntil: now.Add(time.Hour)}, true},
+		{"suspension expired", models.User{Status: models.UserStatusSuspended, SuspendedUntil: now.Add(-time.Second)}, false},
+		{"banned", models.User{Status: models.UserStatusBanned, StatusReason: "spam"}, true},
+		{"pending deletion", models.User{Status: models.UserStatusPendingDeletion}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkAccountStatus(tt.user)
+			if tt.blocked {
+				require.ErrorIs(t, err, ErrAccountBlocked)
+			} else {
+				require.NoError(t, err)
+			}
+		})
+	}
+
+	require.ErrorContains(t, checkAccountStatus(models.User{Status: models.UserStatusBanned, StatusReason: "spam"}), "banned: spam")
+}
+
+func TestCheckAccountStatusByID(t *testing.T) {
+	a, st, _ := newAuth(t)
+	ctx := context.Background()
+
+	id, err := st.SaveUser(ctx, "user", "user@example.com", "user@example.com", []byte("hash"))
+	require.NoError(t, err)
+	require.NoError(t, a.CheckAccountStatus(ctx, id))
+
+	_, err = st.SetUserStatus(ctx, id, models.UserStatusSuspended, "abuse", time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	require.ErrorIs(t, a.CheckAccountStatus(ctx, id), ErrAccountBlocked)
+
+	require.ErrorIs(t, a.CheckAccountStatus(ctx, "missing"), storage.ErrUserNotFound)
+}
+
+func fromIP(ip string) context.Context {
+	return peer.NewContext(context.Background(), &peer.Peer{Addr: &net.TCPAddr{IP: net.ParseIP(ip), Port: 40000}})
+}
+
+func TestPhoneCodeLimits(t *testing.T) {
+	a, st, _ := newAuth(t)
+	ctx := fromIP("203.0.113.7")
+
+	_, err := a.RegisterByPhone(ctx, "Ann", "+79990000001")
+	require.NoError(t, err)
+
+	// повторная отправка раньше phone.otp_resend_cooldown
+	require.ErrorIs(t, a.RequestPhoneLogin(ctx, "+79990000001"), storage.ErrTooManyCodes)
+
+	for _, number := range []string{"+79990000002", "+79990000003"} {
+		_, err := a.RegisterByPhone(ctx, "Bob", number)
+		require.NoError(t, err)
+	}
+
+	// с одного IP не больше phone.otp_max_per_ip SMS, пользователь при этом не создаётся
+	_, err = a.RegisterByPhone(ctx, "Eve", "+79990000004")
+	require.ErrorIs(t, err, storage.ErrTooManyCodes)
+
+	_, err = st.UserByPhone(context.Background(), "+79990000004")
+	require.ErrorIs(t, err, storage.ErrUserNotFound)
+
+	_, err = a.RegisterByPhone(fromIP("198.51.100.1"), "Eve", "+79990000004")
+	require.NoError(t, err)
+}
+
+func TestRiskChallenge(t *testing.T) {
+	a, st, tr := newAuthWithRisk(t, fixedRisk(models.RiskChallenge))
+	ctx := fromIP("203.0.113.7")
+
+	hash, err := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.MinCost)
+	require.NoError(t, err)
+
+	// без подтверждённого номера второго фактора нет - вход запрещён
+	id, err := st.SaveUser(ctx, "user", "user@example.com", "user@example.com", hash)
+	require.NoError(t, err)
+
+	_, _, _, _, err = a.Login(ctx, "user@example.com", "password")
+	require.ErrorIs(t, err, ErrLoginDenied)
+
+	// с номером токены выдаются только после кода из SMS
+	_, err = st.SetUserPhone(ctx, id, "+79990000001")
+	require.NoError(t, err)
+	require.NoError(t, st.InTx(ctx, func(ctx context.Context) error {
+		if _, err := st.CreateVerificationCode(ctx, id, models.CodeChannelSMS, []byte("x"), time.Now().Add(time.Hour), models.CodeLimits{}); err != nil {
+			return err
+		}
+		_, err := st.ConsumeVerificationCode(ctx, id, models.CodeChannelSMS)
+		return err
+	}))
+
+	access, _, _, _, err := a.Login(ctx, "user@example.com", "password")
+	require.ErrorIs(t, err, ErrSecondFactorRequired)
+	require.Empty(t, access)
+	require.Len(t, tr.sms, 1)
+	require.Equal(t, models.SmsPurposeLoginChallenge, tr.sms[0].Purpose)
+
+	_, _, _, _, err = a.CompleteLoginChallenge(ctx, "user@example.com", "wrong")
+	require.ErrorIs(t, err, ErrInvalidCredentials)
+
+	access, _, refresh, _, err := a.CompleteLoginChallenge(ctx, "user@example.com", tr.sms[0].Code)
+	require.NoError(t, err)
+	require.NotEmpty(t, access)
+	require.NotEmpty(t, refresh)
+
+	// код одноразовый
+	_, _, _, _, err = a.CompleteLoginChallenge(ctx, "user@example.com", tr.sms[0].Code)
+	require.ErrorIs(t, err, ErrInvalidCredentials)
+
+	// отказы по риску не считаются неудачными входами
+	failures, err := st.CountRecentSecurityEvents(ctx, id, "", models.SecurityEventLoginFailure, time.Now().Add(-time.Hour))
+	require.NoError(t, err)
+	require.Equal(t, 2, failures) // неверный и повторно использованный код
+	denials, err := st.CountRecentSecurityEvents(ctx, id, "", models.SecurityEventRiskDenied, time.Now().Add(-time.Hour))
+	require.NoError(t, err)
+	require.Equal(t, 1, denials)
+}
+
+func TestVerifyCodeWithEvent(t *testing.T) {
+	a, st, tr := newAuth(t)
+	ctx := context.Background()
+
+	id, err := a.Register(ctx, "user", "user@example.com", "password")
+	require.NoError(t, err)
+	code := tr.verifications[0].Code
+
+	// без события подтверждение откатывается, код остаётся действующим
+	tr.eventsErr = errors.New("broker is down")
+	_, err = a.VerifyCode(ctx, id, code)
+	require.Error(t, err)
+
+	user, err := st.UserById(ctx, id)
+	require.NoError(t, err)
+	require.False(t, user.Verified)
+
+	tr.eventsErr = nil
+	ok, err := a.VerifyCode(ctx, id, code)
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	user, err = st.UserById(ctx, id)
+	require.NoError(t, err)
+	require.True(t, user.Verified)
+	require.Equal(t, models.UserEventVerified, tr.events[len(tr.events)-1].Type)
+}
+
+func TestVerifyExpiredToken(t *testing.T) {
+	a, st, _ := newAuth(t)
+	ctx := context.Background()
+
+	id, err := a.Register(ctx, "user", "user@example.com", "password")
+	require.NoError(t, err)
+
+	token := uuid.NewString()
+	_, err = st.CreateVerificationToken(ctx, id, token, time.Now().Add(-time.Minute))
+	require.NoError(t, err)
+
+	_, err = a.Verify(ctx, token)
+	require.ErrorIs(t, err, storage.ErrTokenExpired)
+
+	// просроченный токен удалён, а не остался после отката транзакции
+	_, err = st.VerifyToken(ctx, token)
+	require.ErrorIs(t, err, storage.ErrTokenNotFound)
+
+	user, err := st.UserById(ctx, id)
+	require.NoError(t, err)
+	require.False(t, user.Verified)
+}
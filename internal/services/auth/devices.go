@@ -0,0 +1,131 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/DenisBochko/yandex_SSO/internal/domain/models"
+	"github.com/DenisBochko/yandex_SSO/internal/storage"
+	"github.com/DenisBochko/yandex_SSO/lib/clientinfo"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// checkDevice запоминает устройство, с которого вошёл пользователь, и при входе с незнакомого
+// устройства отправляет уведомление со ссылкой "это был не я". Ошибки только логируются:
+// вход уже состоялся, и отказывать в нём из-за уведомления нельзя.
+func (a *Auth) checkDevice(ctx context.Context, user models.User) {
+	client := clientinfo.FromContext(ctx)
+	fingerprint := client.Fingerprint()
+	now := time.Now().UTC()
+
+	log := a.log.With(zap.String("userID", user.ID), zap.String("ip", client.IP))
+
+	isNew, knownBefore, err := a.storage.TouchKnownDevice(ctx, models.KnownDevice{
+		UserID:      user.ID,
+		Fingerprint: fingerprint,
+		UserAgent:   client.UserAgent,
+		IP:          client.IP,
+		LastSeenAt:  now,
+	})
+	if err != nil {
+		log.Warn("failed to save known device", zap.Error(err))
+		return
+	}
+
+	// первое устройство пользователя - это его регистрация, сообщать не о чем
+	if !isNew || knownBefore == 0 || !a.devicesCfg.NotifyNewDevice {
+		return
+	}
+
+	token := uuid.New().String()
+	err = a.storage.InTx(ctx, func(ctx context.Context) error {
+		if err := a.storage.CreateSessionRevokeToken(ctx, user.ID, fingerprint, token, now.Add(a.devicesCfg.RevokeTokenTTL)); err != nil {
+			return fmt.Errorf("failed to create session revoke token: %w", err)
+		}
+
+		message := models.NewSignInMessage{
+			UserID:      user.ID,
+			Name:        user.Name,
+			Email:       user.Email,
+			Phone:       user.Phone,
+			IP:          client.IP,
+			UserAgent:   client.UserAgent,
+			SignedInAt:  now,
+			RevokeToken: token,
+		}
+		// на недоставляемый адрес уведомление не отправляется, остаётся телефон
+		if !user.EmailDeliverable() {
+			message.Email = ""
+		}
+
+		if err := a.kafkaTransport.SendNewSignInMessage(ctx, message); err != nil {
+			return fmt.Errorf("failed to send new sign-in message: %w", err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		log.Warn("failed to notify about new device", zap.Error(err))
+		return
+	}
+
+	log.Info("new device sign-in notification sent")
+}
+
+// RevokeSessions обрабатывает ссылку "это был не я": завершает все сессии пользователя
+// и забывает устройство, с которого был вход. Возвращает количество удалённых refresh токенов.
+// Уже выданные access токены действуют до истечения своего срока.
+func (a *Auth) RevokeSessions(ctx context.Context, token string) (int64, error) {
+	userID, err := a.storage.ConsumeSessionRevokeToken(ctx, token)
+	if err != nil {
+		if errors.Is(err, storage.ErrTokenNotFound) || errors.Is(err, storage.ErrTokenExpired) {
+			return 0, err
+		}
+		return 0, fmt.Errorf("failed to consume session revoke token: %w", err)
+	}
+
+	log := a.log.With(zap.String("userID", userID))
+
+	deleted, err := a.redis.DeleteUserSessions(ctx, userID)
+	if err != nil {
+		log.Error("failed to revoke sessions", zap.Error(err))
+		return 0, fmt.Errorf("failed to revoke sessions: %w", err)
+	}
+
+	log.Info("sessions revoked by user", zap.Int64("sessions", deleted))
+	a.recordEvent(ctx, models.SecurityEventSessionsRevoked, userID, "", map[string]string{"sessions": strconv.FormatInt(deleted, 10)})
+
+	return deleted, nil
+}
+
+// ForceLogout завершает все сессии пользователя по команде другого сервиса
+// (модерация, биллинг). Возвращает количество удалённых refresh токенов.
+func (a *Auth) ForceLogout(ctx context.Context, userID string, reason string) (int64, error) {
+	if _, err := a.storage.UserById(ctx, userID); err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return 0, storage.ErrUserNotFound
+		}
+		return 0, fmt.Errorf("failed to get user: %w", err)
+	}
+
+	log := a.log.With(zap.String("userID", userID))
+
+	deleted, err := a.redis.DeleteUserSessions(ctx, userID)
+	if err != nil {
+		log.Error("failed to revoke sessions", zap.Error(err))
+		return 0, fmt.Errorf("failed to revoke sessions: %w", err)
+	}
+
+	log.Info("sessions revoked by command", zap.Int64("sessions", deleted), zap.String("reason", reason))
+	a.recordEvent(ctx, models.SecurityEventSessionsRevoked, userID, "", map[string]string{
+		"sessions": strconv.FormatInt(deleted, 10),
+		"reason":   reason,
+	})
+
+	return deleted, nil
+}
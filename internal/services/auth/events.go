@@ -0,0 +1,68 @@
+package auth
+
+import (
+	"context"
+	"unicode/utf8"
+
+	"github.com/DenisBochko/yandex_SSO/internal/domain/models"
+	"github.com/DenisBochko/yandex_SSO/lib/clientinfo"
+
+	"go.uber.org/zap"
+)
+
+// Размеры колонок security_events.login и security_events.ip в postgres
+const (
+	maxEventLoginLength = 255
+	maxEventIPLength    = 64
+)
+
+// recordEvent записывает событие в ленту безопасности пользователя.
+// IP и user agent берутся из метаданных gRPC запроса. Ошибка записи только логируется:
+// недоступность журнала не должна мешать пользователю войти.
+func (a *Auth) recordEvent(ctx context.Context, eventType models.SecurityEventType, userID string, login string, details map[string]string) {
+	client := clientinfo.FromContext(ctx)
+
+	// логин вводит клиент, и длинное значение не должно терять событие неудачного входа
+	event := models.SecurityEvent{
+		UserID:    userID,
+		Type:      eventType,
+		Login:     truncate(login, maxEventLoginLength),
+		IP:        truncate(client.IP, maxEventIPLength),
+		UserAgent: client.UserAgent,
+		Details:   details,
+	}
+
+	if err := a.storage.SaveSecurityEvent(ctx, event); err != nil {
+		a.log.Warn("failed to save security event", zap.String("type", string(eventType)), zap.String("userID", userID), zap.Error(err))
+	}
+}
+
+// emitUserEvent публикует событие жизненного цикла вне транзакции с изменением данных.
+// Используется там, где отдельного изменения данных нет (вход): ошибка только логируется.
+func (a *Auth) emitUserEvent(ctx context.Context, event models.UserEvent) {
+	if err := a.kafkaTransport.SendUserEvent(ctx, event); err != nil {
+		a.log.Warn("failed to send user event", zap.String("type", string(event.Type)), zap.String("userID", event.UserID), zap.Error(err))
+	}
+}
+
+func (a *Auth) emitLoggedIn(ctx context.Context, userID string, method string) {
+	a.emitUserEvent(ctx, models.UserEvent{
+		Type:   models.UserEventLoggedIn,
+		UserID: userID,
+		Method: method,
+		IP:     clientinfo.FromContext(ctx).IP,
+	})
+}
+
+// truncate обрезает строку до n символов
+func truncate(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n])
+}
+
+// reason - краткая форма details для событий с единственной причиной
+func reason(r string) map[string]string {
+	return map[string]string{"reason": r}
+}
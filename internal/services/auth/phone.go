@@ -0,0 +1,248 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/DenisBochko/yandex_SSO/internal/domain/models"
+	"github.com/DenisBochko/yandex_SSO/internal/storage"
+	"github.com/DenisBochko/yandex_SSO/lib/clientinfo"
+	"github.com/DenisBochko/yandex_SSO/lib/phone"
+
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+var (
+	ErrInvalidPhone = errors.New("invalid phone number")
+)
+
+// RegisterByPhone регистрирует пользователя без email и пароля и отправляет SMS с кодом.
+// Номер подтверждается первым успешным входом через LoginByPhone.
+func (a *Auth) RegisterByPhone(ctx context.Context, name string, rawPhone string) (string, error) {
+	number, err := a.normalizePhone(rawPhone)
+	if err != nil {
+		return "", err
+	}
+
+	log := a.log.With(zap.String("phone", number))
+	log.Info("Registering new user by phone")
+
+	var id string
+	err = a.storage.InTx(ctx, func(ctx context.Context) error {
+		id, err = a.storage.SavePhoneUser(ctx, name, number)
+		if err != nil {
+			if errors.Is(err, storage.ErrUserExists) {
+				log.Info("user already exists", zap.Error(err))
+				return storage.ErrUserExists
+			}
+
+			log.Info("failed to save user", zap.Error(err))
+			return fmt.Errorf("failed to save user: %w", err)
+		}
+
+		if err := a.sendPhoneCode(ctx, id, number, models.CodeChannelSMS, models.SmsPurposeRegister); err != nil {
+			log.Error("failed to send sms code", zap.Error(err))
+			return err
+		}
+
+		event := models.UserEvent{
+			Type:    models.UserEventRegistered,
+			UserID:  id,
+			Profile: &models.UserProfile{Name: name, Phone: number},
+		}
+		if err := a.kafkaTransport.SendUserEvent(ctx, event); err != nil {
+			log.Error("failed to send user event", zap.Error(err))
+			return fmt.Errorf("failed to send user event: %w", err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return id, nil
+}
+
+// RequestPhoneLogin отправляет одноразовый код для входа по номеру телефона.
+// Для незарегистрированного номера ошибка не возвращается, чтобы по ответу нельзя было
+// проверить, есть ли номер в системе.
+func (a *Auth) RequestPhoneLogin(ctx context.Context, rawPhone string) error {
+	number, err := a.normalizePhone(rawPhone)
+	if err != nil {
+		return err
+	}
+
+	log := a.log.With(zap.String("phone", number))
+
+	user, err := a.storage.UserByPhone(ctx, number)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			log.Info("login code requested for unknown phone")
+			return nil
+		}
+		return fmt.Errorf("failed to get user: %w", err)
+	}
+
+	if err := a.sendPhoneCode(ctx, user.ID, number, models.CodeChannelSMS, models.SmsPurposeLogin); err != nil {
+		log.Error("failed to send sms code", zap.Error(err))
+		return err
+	}
+
+	return nil
+}
+
+// LoginByPhone проверяет SMS-код и выдаёт пару токенов. Номер при этом считается подтверждённым.
+func (a *Auth) LoginByPhone(ctx context.Context, rawPhone string, code string) (string, *timestamppb.Timestamp, string, *timestamppb.Timestamp, error) {
+	number, err := a.normalizePhone(rawPhone)
+	if err != nil {
+		return "", nil, "", nil, err
+	}
+
+	log := a.log.With(zap.String("phone", number))
+	log.Info("Attempting to login user by phone")
+
+	user, err := a.storage.UserByPhone(ctx, number)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			log.Warn("user not found", zap.Error(err))
+			a.recordEvent(ctx, models.SecurityEventLoginFailure, "", number, reason("user_not_found"))
+			return "", nil, "", nil, fmt.Errorf("user not found: %w", ErrInvalidCredentials)
+		}
+		return "", nil, "", nil, fmt.Errorf("failed to get user: %w", err)
+	}
+
+	if err := a.checkCode(ctx, user.ID, models.CodeChannelSMS, code); err != nil {
+		log.Warn("sms code rejected", zap.Error(err))
+		a.recordEvent(ctx, models.SecurityEventLoginFailure, user.ID, number, reason("invalid_code"))
+		if errors.Is(err, ErrInvalidCode) {
+			return "", nil, "", nil, fmt.Errorf("invalid code: %w", ErrInvalidCredentials)
+		}
+		return "", nil, "", nil, err
+	}
+	user.PhoneVerified = true
+
+	if err := checkAccountStatus(user); err != nil {
+		log.Warn("login attempt to blocked account", zap.String("userID", user.ID), zap.String("status", string(user.Status)))
+		a.recordEvent(ctx, models.SecurityEventLoginFailure, user.ID, number, reason("account_"+string(user.Status)))
+		return "", nil, "", nil, err
+	}
+
+	details := map[string]string{"method": models.AMRSMS}
+	if err := a.assessLogin(ctx, user, number, models.AMRSMS, details); err != nil {
+		log.Warn("login stopped by risk policy", zap.String("userID", user.ID), zap.String("score", details["risk_score"]), zap.Error(err))
+		return "", nil, "", nil, err
+	}
+	session := newSession(user.ID, models.AMRSMS)
+
+	log.Info("user logged in successfully", zap.String("userID", user.ID), zap.String("risk", details["risk_decision"]))
+	a.recordEvent(ctx, models.SecurityEventLoginSuccess, user.ID, number, details)
+	a.checkDevice(ctx, user)
+	a.emitLoggedIn(ctx, user.ID, models.AMRSMS)
+
+	return a.issueTokens(ctx, user, session)
+}
+
+// AttachPhone привязывает номер к существующему пользователю и отправляет код для его подтверждения
+func (a *Auth) AttachPhone(ctx context.Context, userID string, rawPhone string) error {
+	number, err := a.normalizePhone(rawPhone)
+	if err != nil {
+		return err
+	}
+
+	if _, err := a.storage.SetUserPhone(ctx, userID, number); err != nil {
+		if errors.Is(err, storage.ErrPhoneExists) || errors.Is(err, storage.ErrUserNotFound) {
+			return err
+		}
+		return fmt.Errorf("failed to set user phone: %w", err)
+	}
+
+	a.recordEvent(ctx, models.SecurityEventMFAChange, userID, "", map[string]string{"action": "phone_attached", "phone": number})
+
+	return a.sendPhoneCode(ctx, userID, number, models.CodeChannelSMS, models.SmsPurposeVerifyPhone)
+}
+
+// VerifyPhone подтверждает привязанный номер кодом из SMS
+func (a *Auth) VerifyPhone(ctx context.Context, userID string, code string) (bool, error) {
+	if err := a.checkCode(ctx, userID, models.CodeChannelSMS, code); err != nil {
+		a.log.Warn("sms code rejected", zap.String("userID", userID), zap.Error(err))
+		return false, err
+	}
+
+	a.recordEvent(ctx, models.SecurityEventMFAChange, userID, "", map[string]string{"action": "phone_verified"})
+
+	return true, nil
+}
+
+// sendPhoneCode выпускает SMS-код канала channel и публикует его в топик SMS-шлюза.
+// Код сохраняется в одной транзакции с сообщением, чтобы не остался действующий код, который никто не получил.
+// Частоту отправки ограничивают phone.otp_resend_cooldown и phone.otp_max_issues для номера
+// и phone.otp_max_per_ip для адреса клиента: при превышении возвращается storage.ErrTooManyCodes.
+func (a *Auth) sendPhoneCode(ctx context.Context, userID string, number string, channel models.CodeChannel, purpose string) error {
+	if err := a.checkSmsRate(ctx); err != nil {
+		return err
+	}
+
+	return a.storage.InTx(ctx, func(ctx context.Context) error {
+		code, err := a.newCode(ctx, userID, channel, time.Now().Add(a.phoneCfg.OTPTTL).UTC(), models.CodeLimits{
+			ResendCooldown: a.phoneCfg.OTPResendCooldown,
+			Window:         a.phoneCfg.OTPIssueWindow,
+			MaxIssues:      a.phoneCfg.OTPMaxIssues,
+		})
+		if err != nil {
+			return err
+		}
+
+		message := models.SmsMessage{
+			UserID:  userID,
+			Phone:   number,
+			Code:    code,
+			Purpose: purpose,
+		}
+
+		if err := a.kafkaTransport.SendSmsMessage(ctx, message); err != nil {
+			return fmt.Errorf("failed to send sms message: %w", err)
+		}
+
+		// по этим событиям считается лимит отправок с одного IP
+		a.recordEvent(ctx, models.SecurityEventSmsSent, userID, number, map[string]string{"purpose": purpose})
+
+		return nil
+	})
+}
+
+// checkSmsRate не даёт с одного IP отправить больше phone.otp_max_per_ip SMS за phone.otp_issue_window:
+// так перебор номеров не превращается в рассылку платных SMS. Запросы без IP не ограничиваются.
+func (a *Auth) checkSmsRate(ctx context.Context) error {
+	ip := clientinfo.FromContext(ctx).IP
+	if a.phoneCfg.OTPMaxPerIP <= 0 || ip == "" {
+		return nil
+	}
+
+	sent, err := a.storage.CountRecentSecurityEvents(ctx, "", ip, models.SecurityEventSmsSent, time.Now().Add(-a.phoneCfg.OTPIssueWindow).UTC())
+	if err != nil {
+		return fmt.Errorf("failed to count sent sms: %w", err)
+	}
+
+	if sent >= a.phoneCfg.OTPMaxPerIP {
+		a.log.Warn("sms rate limit exceeded", zap.String("ip", ip), zap.Int("sent", sent))
+		return fmt.Errorf("too many sms from %s: %w", ip, storage.ErrTooManyCodes)
+	}
+
+	return nil
+}
+
+func (a *Auth) normalizePhone(rawPhone string) (string, error) {
+	number, err := a.phones.Normalize(rawPhone)
+	if err != nil {
+		if errors.Is(err, phone.ErrInvalidPhone) {
+			return "", ErrInvalidPhone
+		}
+		return "", err
+	}
+
+	return number, nil
+}
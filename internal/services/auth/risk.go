@@ -0,0 +1,106 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/DenisBochko/yandex_SSO/internal/domain/models"
+	"github.com/DenisBochko/yandex_SSO/internal/storage"
+	"github.com/DenisBochko/yandex_SSO/lib/clientinfo"
+
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// RiskEngine оценивает риск входа, учётные данные к этому моменту уже проверены
+type RiskEngine interface {
+	Assess(ctx context.Context, userID string, client clientinfo.Info) models.RiskAssessment
+}
+
+// assessLogin оценивает вход и применяет решение. Итог оценки дописывается в details события входа.
+//
+// При RiskDeny записывается отказ (SecurityEventRiskDenied) и возвращается ErrLoginDenied.
+// При RiskChallenge токены не выдаются, пока пользователь не подтвердит вход вторым фактором:
+// после пароля - кодом по SMS на подтверждённый номер (CompleteLoginChallenge), и возвращается
+// ErrSecondFactorRequired. Если второго фактора нет (нет номера или вход уже был по SMS), вход запрещается.
+func (a *Auth) assessLogin(ctx context.Context, user models.User, login string, method string, details map[string]string) error {
+	assessment := a.risk.Assess(ctx, user.ID, clientinfo.FromContext(ctx))
+
+	details["risk_score"] = strconv.Itoa(assessment.Score)
+	details["risk_decision"] = string(assessment.Decision)
+	if len(assessment.Signals) > 0 {
+		signals := make([]string, 0, len(assessment.Signals))
+		for name := range assessment.Signals {
+			signals = append(signals, name)
+		}
+		sort.Strings(signals)
+		details["risk_signals"] = strings.Join(signals, ",")
+	}
+
+	switch assessment.Decision {
+	case models.RiskDeny:
+		details["reason"] = "risk_denied"
+		a.recordEvent(ctx, models.SecurityEventRiskDenied, user.ID, login, details)
+		return ErrLoginDenied
+	case models.RiskChallenge:
+		if method != models.AMRPassword || user.Phone == "" || !user.PhoneVerified {
+			details["reason"] = "second_factor_unavailable"
+			a.recordEvent(ctx, models.SecurityEventRiskDenied, user.ID, login, details)
+			return ErrLoginDenied
+		}
+
+		if err := a.sendPhoneCode(ctx, user.ID, user.Phone, models.CodeChannelLoginChallenge, models.SmsPurposeLoginChallenge); err != nil {
+			return err
+		}
+
+		details["reason"] = "second_factor_required"
+		a.recordEvent(ctx, models.SecurityEventRiskChallenge, user.ID, login, details)
+		return ErrSecondFactorRequired
+	}
+
+	return nil
+}
+
+// CompleteLoginChallenge завершает вход, который оценка риска отправила на проверку вторым фактором:
+// проверяет код из SMS и выдаёт пару токенов с amr [pwd, sms]. login - тот же, что и в Login.
+// Повторно риск не оценивается: пароль и владение номером уже подтверждены.
+func (a *Auth) CompleteLoginChallenge(ctx context.Context, login string, code string) (string, *timestamppb.Timestamp, string, *timestamppb.Timestamp, error) {
+	log := a.log.With(zap.String("login", login))
+	log.Info("Completing login challenge")
+
+	user, err := a.userByLogin(ctx, login)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return "", nil, "", nil, fmt.Errorf("user not found: %w", ErrInvalidCredentials)
+		}
+		return "", nil, "", nil, fmt.Errorf("failed to get user: %w", err)
+	}
+
+	if err := a.checkCode(ctx, user.ID, models.CodeChannelLoginChallenge, code); err != nil {
+		log.Warn("login challenge code rejected", zap.String("userID", user.ID), zap.Error(err))
+		a.recordEvent(ctx, models.SecurityEventLoginFailure, user.ID, login, reason("invalid_challenge_code"))
+		if errors.Is(err, ErrInvalidCode) || errors.Is(err, storage.ErrTokenNotFound) {
+			return "", nil, "", nil, fmt.Errorf("invalid code: %w", ErrInvalidCredentials)
+		}
+		return "", nil, "", nil, err
+	}
+
+	if err := checkAccountStatus(user); err != nil {
+		a.recordEvent(ctx, models.SecurityEventLoginFailure, user.ID, login, reason("account_"+string(user.Status)))
+		return "", nil, "", nil, err
+	}
+
+	session := newSession(user.ID, models.AMRPassword, models.AMRSMS)
+	session.ACR = models.ACRMultiFactor
+
+	log.Info("user logged in with second factor", zap.String("userID", user.ID))
+	a.recordEvent(ctx, models.SecurityEventLoginSuccess, user.ID, login, map[string]string{"method": models.AMRPassword, "second_factor": models.AMRSMS})
+	a.checkDevice(ctx, user)
+	a.emitLoggedIn(ctx, user.ID, models.AMRPassword)
+
+	return a.issueTokens(ctx, user, session)
+}
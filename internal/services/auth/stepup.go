@@ -0,0 +1,52 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/DenisBochko/yandex_SSO/internal/domain/models"
+	"github.com/DenisBochko/yandex_SSO/internal/storage"
+	"github.com/DenisBochko/yandex_SSO/lib/jwt"
+
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// Reauthenticate повторно проверяет пароль уже вошедшего пользователя и выпускает access токен
+// со свежим auth_time. Пока токен моложе StepUpConfig.MaxAge, AuthInterceptor пропускает
+// чувствительные методы (удаление аккаунта, смена email). Refresh токен сессии не меняется.
+func (a *Auth) Reauthenticate(ctx context.Context, userID string, password string) (string, *timestamppb.Timestamp, error) {
+	log := a.log.With(zap.String("userID", userID))
+	log.Info("Reauthenticating user")
+
+	user, err := a.storage.UserById(ctx, userID)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return "", nil, fmt.Errorf("user not found: %w", ErrInvalidCredentials)
+		}
+		return "", nil, fmt.Errorf("failed to get user: %w", err)
+	}
+
+	if err := bcrypt.CompareHashAndPassword(user.PassHash, []byte(password)); err != nil {
+		log.Warn("reauthentication failed", zap.Error(err))
+		a.recordEvent(ctx, models.SecurityEventLoginFailure, user.ID, "", reason("reauthentication_failed"))
+		return "", nil, fmt.Errorf("invalid credentials: %w", ErrInvalidCredentials)
+	}
+
+	if err := checkAccountStatus(user); err != nil {
+		return "", nil, err
+	}
+
+	a.recordEvent(ctx, models.SecurityEventReauthentication, user.ID, "", nil)
+
+	accessToken, err := jwt.NewToken(user, newSession(user.ID, models.AMRPassword), a.cfg.AppSecretAccessToken, a.cfg.AccessTokenTTL)
+	if err != nil {
+		log.Error("failed to create access token", zap.Error(err))
+		return "", nil, fmt.Errorf("failed to create access token: %w", err)
+	}
+
+	return accessToken, durationToTimestamp(time.Now(), a.cfg.AccessTokenTTL), nil
+}
@@ -0,0 +1,219 @@
+package commands
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+	"unicode/utf8"
+
+	"github.com/DenisBochko/yandex_SSO/internal/domain/models"
+	"github.com/DenisBochko/yandex_SSO/internal/storage"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+type Storage interface {
+	UserById(ctx context.Context, id string) (models.User, error)
+	AccountCommandProcessed(ctx context.Context, id string) (bool, error)
+	SaveAccountCommandResult(ctx context.Context, result models.AccountCommandResult) (bool, error)
+	InTx(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
+type Users interface {
+	SetUserStatus(ctx context.Context, id string, status models.UserStatus, reason string, until time.Time) (bool, error)
+	DeleteUser(ctx context.Context, id string) (bool, error)
+}
+
+type Sessions interface {
+	ForceLogout(ctx context.Context, userID string, reason string) (int64, error)
+}
+
+type KafkaTransport interface {
+	SendAccountCommandResult(ctx context.Context, result models.AccountCommandResult) error
+}
+
+const (
+	maxCommandIDLength = 128
+	maxReasonLength    = 512
+)
+
+// ErrInvalidCommand - команда без ключа идемпотентности или неизвестного типа.
+// На такую команду нельзя ответить результатом, её место - в dead letter топике.
+var ErrInvalidCommand = errors.New("invalid account command")
+
+// errDuplicate откатывает транзакцию, если ту же команду параллельно выполнила другая реплика
+var errDuplicate = errors.New("duplicate account command")
+
+// CommandsService выполняет команды над учётными записями, пришедшие от других сервисов.
+// Команда выполняется не больше одного раза на ключ идемпотентности: изменение, запись итога
+// и событие с результатом фиксируются в одной транзакции. Отказ (пользователь не найден,
+// некорректные параметры) - тоже результат: он записывается и публикуется, команда не повторяется.
+type CommandsService struct {
+	log       *zap.Logger
+	storage   Storage
+	users     Users
+	sessions  Sessions
+	transport KafkaTransport
+}
+
+func New(log *zap.Logger, storage Storage, users Users, sessions Sessions, transport KafkaTransport) *CommandsService {
+	return &CommandsService{
+		log:       log,
+		storage:   storage,
+		users:     users,
+		sessions:  sessions,
+		transport: transport,
+	}
+}
+
+// Execute выполняет команду. Возвращает ErrInvalidCommand для команды, которую нельзя выполнить
+// ни при каком повторе, и ошибку хранилища или транспорта при временном сбое.
+// Повтор уже выполненной команды ничего не делает.
+func (c *CommandsService) Execute(ctx context.Context, cmd models.AccountCommand) error {
+	if cmd.ID == "" || len(cmd.ID) > maxCommandIDLength {
+		return fmt.Errorf("%w: command id must be 1-%d bytes", ErrInvalidCommand, maxCommandIDLength)
+	}
+	if !cmd.Type.Valid() {
+		return fmt.Errorf("%w: unknown command type %q", ErrInvalidCommand, cmd.Type)
+	}
+
+	log := c.log.With(zap.String("commandID", cmd.ID), zap.String("command", string(cmd.Type)),
+		zap.String("userID", cmd.UserID), zap.String("requestedBy", cmd.RequestedBy))
+
+	err := c.storage.InTx(ctx, func(ctx context.Context) error {
+		processed, err := c.storage.AccountCommandProcessed(ctx, cmd.ID)
+		if err != nil {
+			return err
+		}
+		if processed {
+			return errDuplicate
+		}
+
+		result := models.AccountCommandResult{
+			CommandID:   cmd.ID,
+			Command:     cmd.Type,
+			UserID:      cmd.UserID,
+			RequestedBy: cmd.RequestedBy,
+			Status:      models.AccountCommandOK,
+			CreatedAt:   time.Now().UTC(),
+		}
+
+		result.Changed, err = c.apply(ctx, cmd)
+		if err != nil {
+			var rejected rejection
+			if !errors.As(err, &rejected) {
+				return err
+			}
+			result.Status = models.AccountCommandRejected
+			result.Error = rejected.reason
+		}
+
+		saved, err := c.storage.SaveAccountCommandResult(ctx, result)
+		if err != nil {
+			return err
+		}
+		if !saved {
+			return errDuplicate
+		}
+
+		if err := c.transport.SendAccountCommandResult(ctx, result); err != nil {
+			return fmt.Errorf("failed to send account command result: %w", err)
+		}
+
+		log.Info("account command processed", zap.String("status", string(result.Status)),
+			zap.Bool("changed", result.Changed), zap.String("error", result.Error))
+
+		return nil
+	})
+	if errors.Is(err, errDuplicate) {
+		log.Info("skipping duplicate account command")
+		return nil
+	}
+	if err != nil {
+		log.Warn("failed to process account command", zap.Error(err))
+		return err
+	}
+
+	return nil
+}
+
+// rejection - отказ выполнить команду; повтор его не исправит
+type rejection struct {
+	reason string
+}
+
+func (r rejection) Error() string { return r.reason }
+
+// apply выполняет команду и возвращает, изменилось ли что-нибудь
+func (c *CommandsService) apply(ctx context.Context, cmd models.AccountCommand) (bool, error) {
+	// невалидный uuid оборвал бы транзакцию ошибкой postgres, поэтому проверяем его заранее
+	if _, err := uuid.Parse(cmd.UserID); err != nil {
+		return false, rejection{"invalid user id"}
+	}
+	if utf8.RuneCountInString(cmd.Reason) > maxReasonLength {
+		return false, rejection{fmt.Sprintf("reason is longer than %d characters", maxReasonLength)}
+	}
+
+	user, err := c.storage.UserById(ctx, cmd.UserID)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return false, rejection{"user not found"}
+		}
+		return false, fmt.Errorf("failed to get user: %w", err)
+	}
+
+	switch cmd.Type {
+	case models.AccountCommandSuspend:
+		if !cmd.Until.IsZero() && !cmd.Until.After(time.Now()) {
+			return false, rejection{"suspension end is in the past"}
+		}
+		if user.Status == models.UserStatusSuspended && user.SuspendedUntil.Equal(cmd.Until) && user.StatusReason == cmd.Reason {
+			return false, nil
+		}
+		return c.setStatus(ctx, cmd.UserID, models.UserStatusSuspended, cmd.Reason, cmd.Until)
+
+	case models.AccountCommandUnsuspend:
+		// бан и удаление по расписанию снимаются только администратором
+		if user.Status != models.UserStatusSuspended {
+			if user.Status == models.UserStatusActive {
+				return false, nil
+			}
+			return false, rejection{fmt.Sprintf("account is %s, not suspended", user.Status)}
+		}
+		return c.setStatus(ctx, cmd.UserID, models.UserStatusActive, cmd.Reason, time.Time{})
+
+	case models.AccountCommandDelete:
+		if _, err := c.users.DeleteUser(ctx, cmd.UserID); err != nil {
+			if errors.Is(err, storage.ErrUserNotFound) {
+				return false, rejection{"user not found"}
+			}
+			return false, err
+		}
+		return true, nil
+
+	case models.AccountCommandForceLogout:
+		deleted, err := c.sessions.ForceLogout(ctx, cmd.UserID, cmd.Reason)
+		if err != nil {
+			if errors.Is(err, storage.ErrUserNotFound) {
+				return false, rejection{"user not found"}
+			}
+			return false, err
+		}
+		return deleted > 0, nil
+	}
+
+	return false, fmt.Errorf("%w: unknown command type %q", ErrInvalidCommand, cmd.Type)
+}
+
+func (c *CommandsService) setStatus(ctx context.Context, userID string, status models.UserStatus, reason string, until time.Time) (bool, error) {
+	if _, err := c.users.SetUserStatus(ctx, userID, status, reason, until); err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return false, rejection{"user not found"}
+		}
+		return false, err
+	}
+
+	return true, nil
+}
@@ -0,0 +1,136 @@
+package risk
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/DenisBochko/yandex_SSO/internal/config"
+	"github.com/DenisBochko/yandex_SSO/internal/domain/models"
+	"github.com/DenisBochko/yandex_SSO/lib/clientinfo"
+	"github.com/DenisBochko/yandex_SSO/lib/geoip"
+	"github.com/DenisBochko/yandex_SSO/lib/iplist"
+
+	"go.uber.org/zap"
+)
+
+// Сервис оценки риска входа
+
+type Storage interface {
+	CountRecentSecurityEvents(ctx context.Context, userID string, ip string, eventType models.SecurityEventType, since time.Time) (int, error)
+	LastSecurityEvent(ctx context.Context, userID string, eventType models.SecurityEventType) (models.SecurityEvent, error)
+	IsKnownDevice(ctx context.Context, userID string, fingerprint string) (bool, error)
+}
+
+// Attempt - вход, который оценивается. Пароль или код к этому моменту уже проверен.
+type Attempt struct {
+	UserID string
+	Client clientinfo.Info
+	Time   time.Time
+}
+
+// Signal - один признак риска.
+// Score возвращает долю от 0 (признака нет) до 1 (выражен полностью), итоговый вклад - доля, умноженная на вес.
+type Signal interface {
+	Name() string
+	Score(ctx context.Context, attempt Attempt) (float64, error)
+}
+
+type weightedSignal struct {
+	signal Signal
+	weight int
+}
+
+// Engine складывает взвешенные признаки в балл от 0 до 100 и по порогам принимает решение
+type Engine struct {
+	log     *zap.Logger
+	cfg     *config.RiskConfig
+	signals []weightedSignal
+}
+
+// New создаёт движок со встроенными признаками, вес которых в конфигурации больше нуля.
+// Признаки, которым нужны файлы (IPBlocklistPath, GeoIPPaths), подключаются только если пути заданы.
+func New(log *zap.Logger, cfg *config.RiskConfig, storage Storage) (*Engine, error) {
+	e := &Engine{
+		log: log.With(zap.String("component", "risk")),
+		cfg: cfg,
+	}
+
+	if !cfg.Enabled {
+		return e, nil
+	}
+
+	e.Register(&FailedAttempts{storage: storage, window: cfg.FailedAttemptsWindow, limit: cfg.FailedAttemptsLimit}, cfg.Weights.FailedAttempts)
+	e.Register(&NewDevice{storage: storage}, cfg.Weights.NewDevice)
+	e.Register(&Dormancy{storage: storage, after: cfg.DormantAfter}, cfg.Weights.Dormancy)
+
+	if cfg.IPBlocklistPath != "" {
+		list, err := iplist.Load(cfg.IPBlocklistPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load ip blocklist: %w", err)
+		}
+		e.log.Info("ip blocklist loaded", zap.Int("entries", list.Len()))
+		e.Register(&IPReputation{list: list}, cfg.Weights.IPReputation)
+	}
+
+	if len(cfg.GeoIPPaths) > 0 {
+		db, err := geoip.Load(cfg.GeoIPPaths...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load geoip database: %w", err)
+		}
+		e.log.Info("geoip database loaded", zap.Int("networks", db.Len()))
+		e.Register(&ImpossibleTravel{storage: storage, geo: db, maxSpeedKmh: cfg.MaxTravelSpeedKmh}, cfg.Weights.ImpossibleTravel)
+	}
+
+	return e, nil
+}
+
+// Register подключает дополнительный признак. Признаки с нулевым весом не подключаются.
+func (e *Engine) Register(signal Signal, weight int) {
+	if weight <= 0 {
+		return
+	}
+	e.signals = append(e.signals, weightedSignal{signal: signal, weight: weight})
+}
+
+// Assess оценивает вход пользователя userID с клиента client.
+// Ошибка отдельного признака не мешает оценке: признак считается отсутствующим.
+func (e *Engine) Assess(ctx context.Context, userID string, client clientinfo.Info) models.RiskAssessment {
+	assessment := models.RiskAssessment{
+		Decision: models.RiskAllow,
+		Signals:  make(map[string]float64, len(e.signals)),
+	}
+
+	if !e.cfg.Enabled {
+		return assessment
+	}
+
+	attempt := Attempt{UserID: userID, Client: client, Time: time.Now().UTC()}
+
+	var total float64
+	for _, ws := range e.signals {
+		score, err := ws.signal.Score(ctx, attempt)
+		if err != nil {
+			e.log.Warn("risk signal failed", zap.String("signal", ws.signal.Name()), zap.Error(err))
+			continue
+		}
+
+		score = math.Max(0, math.Min(1, score))
+		if score > 0 {
+			assessment.Signals[ws.signal.Name()] = score
+		}
+		total += score * float64(ws.weight)
+	}
+
+	assessment.Score = int(math.Min(100, math.Round(total)))
+
+	switch {
+	case assessment.Score >= e.cfg.DenyThreshold:
+		assessment.Decision = models.RiskDeny
+	case assessment.Score >= e.cfg.ChallengeThreshold:
+		assessment.Decision = models.RiskChallenge
+	}
+
+	return assessment
+}
@@ -0,0 +1,102 @@
+package risk
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DenisBochko/yandex_SSO/internal/config"
+	"github.com/DenisBochko/yandex_SSO/internal/domain/models"
+	"github.com/DenisBochko/yandex_SSO/internal/storage/memory"
+	"github.com/DenisBochko/yandex_SSO/lib/clientinfo"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// fixed - признак с заданной долей
+type fixed struct {
+	name  string
+	score float64
+	err   error
+}
+
+func (s fixed) Name() string { return s.name }
+
+func (s fixed) Score(ctx context.Context, attempt Attempt) (float64, error) {
+	return s.score, s.err
+}
+
+func newEngine(t *testing.T, signals map[Signal]int) *Engine {
+	t.Helper()
+
+	// нулевые веса встроенных признаков: в оценке участвуют только переданные
+	e, err := New(zap.NewNop(), &config.RiskConfig{Enabled: true, ChallengeThreshold: 40, DenyThreshold: 80}, memory.New())
+	require.NoError(t, err)
+
+	for signal, weight := range signals {
+		e.Register(signal, weight)
+	}
+
+	return e
+}
+
+func TestAssessThresholds(t *testing.T) {
+	tests := []struct {
+		name     string
+		signals  map[Signal]int
+		score    int
+		decision models.RiskDecision
+	}{
+		{"no signals", nil, 0, models.RiskAllow},
+		{"below challenge", map[Signal]int{fixed{name: "a", score: 1}: 39}, 39, models.RiskAllow},
+		{"challenge", map[Signal]int{fixed{name: "a", score: 1}: 20, fixed{name: "b", score: 1}: 20}, 40, models.RiskChallenge},
+		{"partial score", map[Signal]int{fixed{name: "a", score: 0.5}: 100}, 50, models.RiskChallenge},
+		{"deny", map[Signal]int{fixed{name: "a", score: 1}: 80}, 80, models.RiskDeny},
+		{"clamped signal", map[Signal]int{fixed{name: "a", score: 3}: 30, fixed{name: "b", score: -1}: 50}, 30, models.RiskAllow},
+		{"capped total", map[Signal]int{fixed{name: "a", score: 1}: 70, fixed{name: "b", score: 1}: 70}, 100, models.RiskDeny},
+		{"failed signal", map[Signal]int{fixed{name: "a", score: 1, err: errors.New("boom")}: 90}, 0, models.RiskAllow},
+		{"zero weight", map[Signal]int{fixed{name: "a", score: 1}: 0}, 0, models.RiskAllow},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assessment := newEngine(t, tt.signals).Assess(context.Background(), "user", clientinfo.Info{})
+			require.Equal(t, tt.score, assessment.Score)
+			require.Equal(t, tt.decision, assessment.Decision)
+		})
+	}
+}
+
+func TestAssessSignals(t *testing.T) {
+	e := newEngine(t, map[Signal]int{fixed{name: "on", score: 0.5}: 40, fixed{name: "off"}: 40})
+
+	assessment := e.Assess(context.Background(), "user", clientinfo.Info{})
+	require.Equal(t, map[string]float64{"on": 0.5}, assessment.Signals)
+}
+
+func TestAssessDisabled(t *testing.T) {
+	e, err := New(zap.NewNop(), &config.RiskConfig{ChallengeThreshold: 40, DenyThreshold: 80, Weights: config.RiskWeights{NewDevice: 100}}, memory.New())
+	require.NoError(t, err)
+
+	require.Equal(t, models.RiskAllow, e.Assess(context.Background(), "user", clientinfo.Info{}).Decision)
+}
+
+func TestFailedAttemptsIgnoresRiskDenials(t *testing.T) {
+	st := memory.New()
+	ctx := context.Background()
+	client := clientinfo.Info{IP: "203.0.113.7"}
+
+	id, err := st.SaveUser(ctx, "user", "user@example.com", "user@example.com", []byte("hash"))
+	require.NoError(t, err)
+
+	for _, eventType := range []models.SecurityEventType{models.SecurityEventLoginFailure, models.SecurityEventRiskDenied, models.SecurityEventRiskDenied} {
+		require.NoError(t, st.SaveSecurityEvent(ctx, models.SecurityEvent{UserID: id, Type: eventType, IP: client.IP}))
+	}
+
+	signal := &FailedAttempts{storage: st, window: time.Hour, limit: 4}
+	score, err := signal.Score(ctx, Attempt{UserID: id, Client: client, Time: time.Now().UTC()})
+	require.NoError(t, err)
+	require.Equal(t, 0.25, score)
+}
@@ -0,0 +1,139 @@
+package risk
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/DenisBochko/yandex_SSO/internal/domain/models"
+	"github.com/DenisBochko/yandex_SSO/internal/storage"
+	"github.com/DenisBochko/yandex_SSO/lib/geoip"
+	"github.com/DenisBochko/yandex_SSO/lib/iplist"
+)
+
+// FailedAttempts - частота неудачных входов в аккаунт или с того же адреса за последние window.
+// limit неудачных попыток и больше дают полный балл.
+type FailedAttempts struct {
+	storage Storage
+	window  time.Duration
+	limit   int
+}
+
+func (s *FailedAttempts) Name() string { return "failed_attempts" }
+
+func (s *FailedAttempts) Score(ctx context.Context, attempt Attempt) (float64, error) {
+	if s.limit <= 0 {
+		return 0, nil
+	}
+
+	count, err := s.storage.CountRecentSecurityEvents(ctx, attempt.UserID, attempt.Client.IP, models.SecurityEventLoginFailure, attempt.Time.Add(-s.window))
+	if err != nil {
+		return 0, err
+	}
+
+	return float64(count) / float64(s.limit), nil
+}
+
+// NewDevice - вход с устройства, с которого пользователь раньше не входил
+type NewDevice struct {
+	storage Storage
+}
+
+func (s *NewDevice) Name() string { return "new_device" }
+
+func (s *NewDevice) Score(ctx context.Context, attempt Attempt) (float64, error) {
+	known, err := s.storage.IsKnownDevice(ctx, attempt.UserID, attempt.Client.Fingerprint())
+	if err != nil {
+		return 0, err
+	}
+
+	if known {
+		return 0, nil
+	}
+	return 1, nil
+}
+
+// IPReputation - адрес из локального списка (прокси, Tor, замеченные в переборе паролей)
+type IPReputation struct {
+	list *iplist.List
+}
+
+func (s *IPReputation) Name() string { return "ip_reputation" }
+
+func (s *IPReputation) Score(ctx context.Context, attempt Attempt) (float64, error) {
+	if s.list.Contains(attempt.Client.IP) {
+		return 1, nil
+	}
+	return 0, nil
+}
+
+// Dormancy - в аккаунт давно не входили: такие аккаунты чаще всего угоняют по старым утечкам паролей
+type Dormancy struct {
+	storage Storage
+	after   time.Duration
+}
+
+func (s *Dormancy) Name() string { return "dormant_account" }
+
+func (s *Dormancy) Score(ctx context.Context, attempt Attempt) (float64, error) {
+	last, err := s.storage.LastSecurityEvent(ctx, attempt.UserID, models.SecurityEventLoginSuccess)
+	if err != nil {
+		// первый вход после регистрации - не повод для подозрений
+		if errors.Is(err, storage.ErrEventNotFound) {
+			return 0, nil
+		}
+		return 0, err
+	}
+
+	if attempt.Time.Sub(last.CreatedAt) >= s.after {
+		return 1, nil
+	}
+	return 0, nil
+}
+
+// minTravelDistanceKm - расстояния меньше этого не учитываются: точность геолокации по IP - десятки километров
+const minTravelDistanceKm = 100
+
+// ImpossibleTravel - от места предыдущего входа до текущего нельзя добраться быстрее maxSpeedKmh
+type ImpossibleTravel struct {
+	storage     Storage
+	geo         *geoip.DB
+	maxSpeedKmh float64
+}
+
+func (s *ImpossibleTravel) Name() string { return "impossible_travel" }
+
+func (s *ImpossibleTravel) Score(ctx context.Context, attempt Attempt) (float64, error) {
+	last, err := s.storage.LastSecurityEvent(ctx, attempt.UserID, models.SecurityEventLoginSuccess)
+	if err != nil {
+		if errors.Is(err, storage.ErrEventNotFound) {
+			return 0, nil
+		}
+		return 0, err
+	}
+
+	from, err := s.geo.Lookup(last.IP)
+	if err != nil {
+		return 0, nil
+	}
+	to, err := s.geo.Lookup(attempt.Client.IP)
+	if err != nil {
+		return 0, nil
+	}
+
+	distance := geoip.DistanceKm(from, to)
+	if distance < minTravelDistanceKm {
+		return 0, nil
+	}
+
+	// не меньше минуты, чтобы не делить на ноль при входах подряд
+	hours := attempt.Time.Sub(last.CreatedAt).Hours()
+	if hours < 1.0/60 {
+		hours = 1.0 / 60
+	}
+
+	if distance/hours > s.maxSpeedKmh {
+		return 1, nil
+	}
+	return 0, nil
+}
@@ -0,0 +1,77 @@
+package users
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/DenisBochko/yandex_SSO/internal/domain/models"
+	"github.com/DenisBochko/yandex_SSO/internal/storage"
+
+	"go.uber.org/zap"
+)
+
+// ApplyEmailFeedback применяет отчёт почтового сервиса о доставке письма.
+// Постоянный отказ помечает адрес как bounced, жалоба на спам - как complained; после этого
+// письма на адрес не отправляются, пока пользователь не сменит email или статус не сбросят.
+// Временные отказы и успешные доставки статус не меняют. Повторный отчёт безопасен.
+// Некорректный отчёт пропускается с записью в лог, ошибка возвращается только при сбое хранилища.
+func (u *UsersService) ApplyEmailFeedback(ctx context.Context, feedback models.EmailFeedback) error {
+	var status models.EmailStatus
+
+	switch feedback.Type {
+	case models.EmailFeedbackDelivered:
+		return nil
+	case models.EmailFeedbackBounce:
+		if !feedback.Permanent {
+			u.log.Debug("transient email bounce", zap.String("userID", feedback.UserID), zap.String("reason", feedback.Reason))
+			return nil
+		}
+		status = models.EmailStatusBounced
+	case models.EmailFeedbackComplaint:
+		status = models.EmailStatusComplained
+	default:
+		u.log.Warn("skipping email feedback of unknown type", zap.String("type", feedback.Type), zap.String("eventID", feedback.EventID))
+		return nil
+	}
+
+	canonical, err := u.emails.Canonical(feedback.Email)
+	if err != nil {
+		u.log.Warn("skipping email feedback with invalid address", zap.String("eventID", feedback.EventID), zap.Error(err))
+		return nil
+	}
+
+	at := feedback.OccurredAt
+	if at.IsZero() {
+		at = time.Now().UTC()
+	}
+
+	updated, err := u.storage.SetEmailStatus(ctx, feedback.UserID, canonical, status, feedback.Reason, at)
+	if err != nil {
+		return fmt.Errorf("failed to apply email feedback: %w", err)
+	}
+
+	log := u.log.With(zap.String("userID", feedback.UserID), zap.String("status", string(status)), zap.String("eventID", feedback.EventID))
+	if updated == 0 {
+		// адрес уже сменили, пользователя удалили или отчёт устарел
+		log.Info("email feedback matched no user")
+		return nil
+	}
+
+	log.Info("email marked undeliverable", zap.String("reason", feedback.Reason))
+
+	return nil
+}
+
+// ResetEmailStatus снова разрешает отправку писем, например после того как пользователь освободил ящик
+func (u *UsersService) ResetEmailStatus(ctx context.Context, userID string) error {
+	if err := u.storage.ResetEmailStatus(ctx, userID); err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return storage.ErrUserNotFound
+		}
+		return fmt.Errorf("failed to reset email status: %w", err)
+	}
+
+	return nil
+}
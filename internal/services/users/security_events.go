@@ -0,0 +1,36 @@
+package users
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/DenisBochko/yandex_SSO/internal/domain/models"
+	"github.com/DenisBochko/yandex_SSO/internal/storage"
+)
+
+const (
+	defaultSecurityEventsPage = 50
+	maxSecurityEventsPage     = 200
+)
+
+// ListSecurityEvents возвращает ленту событий безопасности пользователя от новых к старым.
+// beforeID - id последнего события предыдущей страницы, 0 - первая страница.
+func (u *UsersService) ListSecurityEvents(ctx context.Context, userID string, beforeID int64, limit int) ([]models.SecurityEvent, error) {
+	if limit <= 0 {
+		limit = defaultSecurityEventsPage
+	}
+	if limit > maxSecurityEventsPage {
+		limit = maxSecurityEventsPage
+	}
+
+	events, err := u.storage.SecurityEvents(ctx, userID, beforeID, limit)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return nil, storage.ErrUserNotFound
+		}
+		return nil, fmt.Errorf("failed to get security events: %w", err)
+	}
+
+	return events, nil
+}
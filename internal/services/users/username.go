@@ -0,0 +1,97 @@
+package users
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/DenisBochko/yandex_SSO/internal/domain/models"
+	"github.com/DenisBochko/yandex_SSO/internal/storage"
+	"github.com/DenisBochko/yandex_SSO/lib/handle"
+
+	"go.uber.org/zap"
+)
+
+// CheckUsername проверяет, может ли пользователь userID занять хэндл, и возвращает его в каноническом виде.
+// userID может быть пустым - например, при проверке до регистрации.
+func (u *UsersService) CheckUsername(ctx context.Context, userID string, raw string) (string, error) {
+	username, skeleton, err := u.normalizeUsername(raw)
+	if err != nil {
+		return "", err
+	}
+
+	available, err := u.storage.UsernameAvailable(ctx, userID, skeleton, time.Now().UTC())
+	if err != nil {
+		return "", fmt.Errorf("failed to check username: %w", err)
+	}
+
+	if !available {
+		return username, storage.ErrUsernameTaken
+	}
+
+	return username, nil
+}
+
+// ChangeUsername устанавливает хэндл пользователю. Частота смены ограничена ChangeCooldown,
+// а прежний хэндл ещё HoldPeriod не может занять никто другой - так его не перехватят сразу после смены.
+func (u *UsersService) ChangeUsername(ctx context.Context, userID string, raw string) (string, error) {
+	log := u.log.With(zap.String("id", userID))
+	log.Info("Changing username")
+
+	username, skeleton, err := u.normalizeUsername(raw)
+	if err != nil {
+		return "", err
+	}
+
+	err = u.storage.InTx(ctx, func(ctx context.Context) error {
+		err := u.storage.ChangeUsername(ctx, userID, username, skeleton, time.Now().UTC(), u.usernameCfg.ChangeCooldown, u.usernameCfg.HoldPeriod)
+		if err != nil {
+			if errors.Is(err, storage.ErrUserNotFound) || errors.Is(err, storage.ErrUsernameTaken) || errors.Is(err, storage.ErrUsernameChangeTooSoon) {
+				log.Info("username change rejected", zap.String("username", username), zap.Error(err))
+				return err
+			}
+			log.Info("failed to change username", zap.Error(err))
+			return fmt.Errorf("failed to change username: %w", err)
+		}
+
+		user, err := u.storage.UserById(ctx, userID)
+		if err != nil {
+			return fmt.Errorf("failed to get user: %w", err)
+		}
+
+		return u.sendUserEvent(ctx, models.UserEvent{Type: models.UserEventUpdated, UserID: userID, Profile: user.Profile()})
+	})
+	if err != nil {
+		return "", err
+	}
+
+	log.Info("username changed", zap.String("username", username))
+
+	return username, nil
+}
+
+// UsernameHistory возвращает прежние хэндлы пользователя
+func (u *UsersService) UsernameHistory(ctx context.Context, userID string) ([]models.UsernameChange, error) {
+	history, err := u.storage.UsernameHistory(ctx, userID)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return nil, storage.ErrUserNotFound
+		}
+		return nil, fmt.Errorf("failed to get username history: %w", err)
+	}
+
+	return history, nil
+}
+
+func (u *UsersService) normalizeUsername(raw string) (string, string, error) {
+	username, skeleton, err := u.handles.Normalize(raw)
+	if err != nil {
+		if errors.Is(err, handle.ErrReservedHandle) {
+			return "", "", ErrReservedUsername
+		}
+		return "", "", ErrInvalidUsername
+	}
+
+	return username, skeleton, nil
+}
@@ -4,52 +4,92 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"strings"
+	"time"
+
 	"github.com/DenisBochko/yandex_SSO/internal/config"
 	"github.com/DenisBochko/yandex_SSO/internal/domain/models"
 	"github.com/DenisBochko/yandex_SSO/internal/storage"
+	"github.com/DenisBochko/yandex_SSO/lib/emailaddr"
+	"github.com/DenisBochko/yandex_SSO/lib/handle"
 
 	"go.uber.org/zap"
 )
 
 type Storage interface {
-	SaveUser(ctx context.Context, name string, email string, passHash []byte) (uid string, err error)
-	User(ctx context.Context, email string) (models.User, error)
+	SaveUser(ctx context.Context, name string, email string, emailCanonical string, passHash []byte) (uid string, err error)
+	User(ctx context.Context, email string, emailCanonical string) (models.User, error)
 	Users(ctx context.Context, ids []string) ([]models.User, error)
 	UserById(ctx context.Context, id string) (models.User, error)
-	UpdateUser(ctx context.Context, user models.User) (bool, error) // обновление по id
+	UpdateUser(ctx context.Context, user models.User) (bool, error) // имя, email и аватар по id, подтверждение email не меняется
 	DeleteUser(ctx context.Context, id string) (bool, error)
+	SetUserStatus(ctx context.Context, id string, status models.UserStatus, reason string, until time.Time) (bool, error)
+	UsernameAvailable(ctx context.Context, userID string, skeleton string, now time.Time) (bool, error)
+	ChangeUsername(ctx context.Context, userID string, username string, skeleton string, now time.Time, cooldown time.Duration, hold time.Duration) error
+	UsernameHistory(ctx context.Context, userID string) ([]models.UsernameChange, error)
+	SecurityEvents(ctx context.Context, userID string, beforeID int64, limit int) ([]models.SecurityEvent, error)
+	SetEmailStatus(ctx context.Context, userID string, emailCanonical string, status models.EmailStatus, reason string, at time.Time) (int64, error)
+	ResetEmailStatus(ctx context.Context, userID string) error
+	InTx(ctx context.Context, fn func(ctx context.Context) error) error
 }
 
 type MinIoStorage interface {
 	UploadPhoto(ctx context.Context, id string, photo []byte, contentType string, fileName string) (string, error)
 }
 
+type KafkaTransport interface {
+	SendAccountStatusMessage(ctx context.Context, message models.AccountStatusMessage) error
+	SendUserEvent(ctx context.Context, event models.UserEvent) error
+}
+
 type UsersService struct {
-	log          *zap.Logger
-	storage      Storage
-	minIoStorage MinIoStorage
-	cfg          *config.JwtConfig
+	log            *zap.Logger
+	storage        Storage
+	minIoStorage   MinIoStorage
+	kafkaTransport KafkaTransport
+	cfg            *config.JwtConfig
+	emails         emailaddr.Normalizer
+	usernameCfg    *config.UsernameConfig
+	handles        *handle.Validator
 }
 
 func New(
 	log *zap.Logger,
 	storage Storage,
 	minioStorage MinIoStorage,
+	transport KafkaTransport,
 	cfg *config.JwtConfig,
+	emailCfg *config.EmailConfig,
+	usernameCfg *config.UsernameConfig,
 ) *UsersService {
 	return &UsersService{
-		log:          log,
-		storage:      storage,
-		minIoStorage: minioStorage,
-		cfg:          cfg,
+		log:            log,
+		storage:        storage,
+		minIoStorage:   minioStorage,
+		kafkaTransport: transport,
+		cfg:            cfg,
+		emails: emailaddr.Normalizer{
+			ProviderRules: emailCfg.ProviderCanonicalization,
+		},
+		usernameCfg: usernameCfg,
+		handles:     handle.New(usernameCfg.Reserved...),
 	}
 }
 
+var (
+	ErrInvalidStatus = errors.New("invalid account status")
+	ErrInvalidEmail  = errors.New("invalid email")
+
+	ErrInvalidUsername  = errors.New("invalid username")
+	ErrReservedUsername = errors.New("username is reserved")
+)
+
 func (u *UsersService) GetUserById(ctx context.Context, id string) (models.User, error) {
 	log := u.log.With(zap.String("id", id))
 	log.Info("Getting user")
 
-	user, err := u.storage.UserById(ctx, id)
+	// только чтение: допустима реплика, свои изменения пользователь всё равно увидит
+	user, err := u.storage.UserById(storage.WithReplicaReads(ctx), id)
 	if err != nil {
 		if errors.Is(err, storage.ErrUserNotFound) {
 			log.Info("User not found")
@@ -66,7 +106,7 @@ func (u *UsersService) GetUsers(ctx context.Context, ids []string) ([]models.Use
 	log := u.log.With(zap.String("ids", fmt.Sprintf("%v", ids)))
 	log.Info("Getting users")
 
-	users, err := u.storage.Users(ctx, ids)
+	users, err := u.storage.Users(storage.WithReplicaReads(ctx), ids)
 	if err != nil {
 		log.Info("failed to get users")
 
@@ -80,18 +120,62 @@ func (u *UsersService) GetUsers(ctx context.Context, ids []string) ([]models.Use
 	return users, nil
 }
 
-func (u *UsersService) UpdateUser(ctx context.Context, user models.User) (bool, error) {
-	log := u.log.With(zap.String("id", user.ID))
+// UpdateUser меняет имя и email пользователя. Текущая запись читается с primary в той же транзакции,
+// что и запись: копия из реплики или кэша могла устареть и вернуть бы чужие изменения.
+// Если email меняется, перед записью вызывается confirmEmailChange (nil - без проверки), её ошибка возвращается как есть.
+func (u *UsersService) UpdateUser(ctx context.Context, id string, name string, email string, confirmEmailChange func() error) (bool, error) {
+	log := u.log.With(zap.String("id", id))
 	log.Info("Updating user")
 
-	ok, err := u.storage.UpdateUser(ctx, user)
-	if err != nil {
-		if errors.Is(err, storage.ErrUserNotFound) {
-			log.Info("User not found")
-			return false, storage.ErrUserNotFound
+	// Каноническая форма пересчитывается при каждом обновлении, чтобы не разойтись с email
+	var emailCanonical string
+	if email != "" {
+		var err error
+		email, emailCanonical, err = u.emails.Normalize(email)
+		if err != nil {
+			return false, ErrInvalidEmail
+		}
+	}
+
+	var ok bool
+	err := u.storage.InTx(ctx, func(ctx context.Context) error {
+		user, err := u.storage.UserById(ctx, id)
+		if err != nil {
+			if errors.Is(err, storage.ErrUserNotFound) {
+				log.Info("User not found")
+				return storage.ErrUserNotFound
+			}
+			log.Info("failed to get user", zap.Error(err))
+			return fmt.Errorf("failed to get user: %w", err)
+		}
+
+		if confirmEmailChange != nil && !strings.EqualFold(email, user.Email) {
+			if err := confirmEmailChange(); err != nil {
+				return err
+			}
+		}
+
+		user.Name = name
+		user.Email, user.EmailCanonical = email, emailCanonical
+
+		ok, err = u.storage.UpdateUser(ctx, user)
+		if err != nil {
+			if errors.Is(err, storage.ErrUserNotFound) {
+				log.Info("User not found")
+				return storage.ErrUserNotFound
+			}
+			if errors.Is(err, storage.ErrUserExists) {
+				log.Info("email already taken")
+				return storage.ErrUserExists
+			}
+			log.Info("failed to update user", zap.Error(err))
+			return fmt.Errorf("failed to update user: %w", err)
 		}
-		log.Info("failed to update user", zap.Error(err))
-		return false, fmt.Errorf("failed to update user: %w", err)
+
+		return u.sendUserEvent(ctx, models.UserEvent{Type: models.UserEventUpdated, UserID: user.ID, Profile: user.Profile()})
+	})
+	if err != nil {
+		return false, err
 	}
 
 	return ok, nil
@@ -101,14 +185,23 @@ func (u *UsersService) DeleteUser(ctx context.Context, id string) (bool, error)
 	log := u.log.With(zap.String("id", id))
 	log.Info("Deleting user")
 
-	ok, err := u.storage.DeleteUser(ctx, id)
-	if err != nil {
-		if errors.Is(err, storage.ErrUserNotFound) {
-			log.Info("User not found")
-			return false, storage.ErrUserNotFound
+	var ok bool
+	err := u.storage.InTx(ctx, func(ctx context.Context) error {
+		var err error
+		ok, err = u.storage.DeleteUser(ctx, id)
+		if err != nil {
+			if errors.Is(err, storage.ErrUserNotFound) {
+				log.Info("User not found")
+				return storage.ErrUserNotFound
+			}
+			log.Info("failed to delete user", zap.Error(err))
+			return fmt.Errorf("failed to delete user: %w", err)
 		}
-		log.Info("failed to delete user", zap.Error(err))
-		return false, fmt.Errorf("failed to delete user: %w", err)
+
+		return u.sendUserEvent(ctx, models.UserEvent{Type: models.UserEventDeleted, UserID: id})
+	})
+	if err != nil {
+		return false, err
 	}
 
 	return ok, nil
@@ -119,8 +212,7 @@ func (u *UsersService) UploadAvatar(ctx context.Context, id string, photo []byte
 	log.Info("Uploading photo")
 
 	// Проверяем, что пользователь существует
-	user, err := u.storage.UserById(ctx, id)
-	if err != nil {
+	if _, err := u.storage.UserById(ctx, id); err != nil {
 		if errors.Is(err, storage.ErrUserNotFound) {
 			log.Info("User not found")
 			return "", storage.ErrUserNotFound
@@ -136,19 +228,100 @@ func (u *UsersService) UploadAvatar(ctx context.Context, id string, photo []byte
 		return "", storage.ErrInternalStorage
 	}
 
-	// Обновляем URL фото в базе данных
-	user.Avatar = url
+	// Обновляем URL фото в базе данных. UpdateUser записывает пользователя целиком, поэтому он
+	// перечитывается в транзакции мимо кэша: копия из кэша могла устареть и затёрла бы чужие правки
+	err = u.storage.InTx(ctx, func(ctx context.Context) error {
+		user, err := u.storage.UserById(ctx, id)
+		if err != nil {
+			if errors.Is(err, storage.ErrUserNotFound) {
+				log.Info("User not found")
+				return storage.ErrUserNotFound
+			}
+			log.Info("failed to get user", zap.Error(err))
+			return fmt.Errorf("failed to get user: %w", err)
+		}
+
+		user.Avatar = url
 
-	ok, err := u.storage.UpdateUser(ctx, user)
+		ok, err := u.storage.UpdateUser(ctx, user)
+		if err != nil {
+			log.Info("failed to update user in database", zap.Error(err))
+			return fmt.Errorf("failed to update user: %w", err)
+		}
+
+		if !ok {
+			log.Info("failed to update user in database")
+			return storage.ErrInternalStorage
+		}
+
+		return u.sendUserEvent(ctx, models.UserEvent{Type: models.UserEventAvatarChanged, UserID: id, AvatarURL: url})
+	})
 	if err != nil {
-		log.Info("failed to update user in database", zap.Error(err))
-		return "", fmt.Errorf("failed to update user: %w", err)
+		return "", err
 	}
 
-	if !ok {
-		log.Info("failed to update user in database")
-		return "", storage.ErrInternalStorage
+	return url, nil
+}
+
+// sendUserEvent публикует событие жизненного цикла. Вызывается внутри InTx вместе с изменением,
+// которое событие описывает: при ошибке откатываются оба.
+func (u *UsersService) sendUserEvent(ctx context.Context, event models.UserEvent) error {
+	if err := u.kafkaTransport.SendUserEvent(ctx, event); err != nil {
+		u.log.Error("failed to send user event", zap.String("type", string(event.Type)), zap.String("id", event.UserID), zap.Error(err))
+		return fmt.Errorf("failed to send user event: %w", err)
 	}
 
-	return url, nil
+	return nil
+}
+
+// SetUserStatus блокирует или разблокирует учётную запись и сообщает об этом другим сервисам через Kafka.
+// until имеет смысл только для UserStatusSuspended; нулевое значение - блокировка бессрочная.
+func (u *UsersService) SetUserStatus(ctx context.Context, id string, status models.UserStatus, reason string, until time.Time) (bool, error) {
+	log := u.log.With(zap.String("id", id), zap.String("status", string(status)))
+	log.Info("Changing user status")
+
+	if !status.Valid() {
+		return false, ErrInvalidStatus
+	}
+
+	if status != models.UserStatusSuspended {
+		until = time.Time{}
+	}
+
+	// Статус и сообщение о нём фиксируются вместе: другие сервисы не должны
+	// узнать о блокировке, которой нет, и пропустить ту, что есть
+	var ok bool
+	err := u.storage.InTx(ctx, func(ctx context.Context) error {
+		var err error
+		ok, err = u.storage.SetUserStatus(ctx, id, status, reason, until)
+		if err != nil {
+			if errors.Is(err, storage.ErrUserNotFound) {
+				log.Info("User not found")
+				return storage.ErrUserNotFound
+			}
+			log.Info("failed to set user status", zap.Error(err))
+			return fmt.Errorf("failed to set user status: %w", err)
+		}
+
+		message := models.AccountStatusMessage{
+			UserID: id,
+			Status: status,
+			Reason: reason,
+		}
+		if !until.IsZero() {
+			message.SuspendedUntil = &until
+		}
+
+		if err := u.kafkaTransport.SendAccountStatusMessage(ctx, message); err != nil {
+			log.Error("failed to send account status message", zap.Error(err))
+			return fmt.Errorf("failed to send account status message: %w", err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return ok, nil
 }
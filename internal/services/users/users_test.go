@@ -0,0 +1,151 @@
+package users
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DenisBochko/yandex_SSO/internal/config"
+	"github.com/DenisBochko/yandex_SSO/internal/domain/models"
+	"github.com/DenisBochko/yandex_SSO/internal/storage"
+	"github.com/DenisBochko/yandex_SSO/internal/storage/memory"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+type transport struct {
+	events []models.UserEvent
+}
+
+func (t *transport) SendAccountStatusMessage(ctx context.Context, message models.AccountStatusMessage) error {
+	return nil
+}
+
+func (t *transport) SendUserEvent(ctx context.Context, event models.UserEvent) error {
+	t.events = append(t.events, event)
+	return nil
+}
+
+func newUsers(t *testing.T) (*UsersService, *memory.Storage) {
+	t.Helper()
+
+	st := memory.New()
+	u := New(zap.NewNop(), st, nil, &transport{}, &config.JwtConfig{}, &config.EmailConfig{}, &config.UsernameConfig{})
+
+	return u, st
+}
+
+// verifiedUser - пользователь с подтверждённым email
+func verifiedUser(t *testing.T, st *memory.Storage, email string) string {
+	t.Helper()
+	ctx := context.Background()
+
+	id, err := st.SaveUser(ctx, "user", email, email, []byte("hash"))
+	require.NoError(t, err)
+
+	_, err = st.CreateVerificationToken(ctx, id, "token-"+id, time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	_, err = st.VerifyToken(ctx, "token-"+id)
+	require.NoError(t, err)
+
+	return id
+}
+
+func TestUpdateUserKeepsVerification(t *testing.T) {
+	u, st := newUsers(t)
+	ctx := context.Background()
+
+	id := verifiedUser(t, st, "user@example.com")
+
+	_, err := u.UpdateUser(ctx, id, "New name", "user@example.com", nil)
+	require.NoError(t, err)
+
+	user, err := st.UserById(ctx, id)
+	require.NoError(t, err)
+	require.Equal(t, "New name", user.Name)
+	require.True(t, user.Verified)
+
+	_, err = u.UpdateUser(ctx, "00000000-0000-0000-0000-000000000000", "ghost", "ghost@example.com", nil)
+	require.ErrorIs(t, err, storage.ErrUserNotFound)
+}
+
+func TestUpdateUserConfirmEmailChange(t *testing.T) {
+	u, st := newUsers(t)
+	ctx := context.Background()
+
+	id := verifiedUser(t, st, "user@example.com")
+
+	var calls int
+	stepUp := errors.New("step-up required")
+	confirm := func() error {
+		calls++
+		return stepUp
+	}
+
+	// email тот же с точностью до регистра - проверка не нужна
+	_, err := u.UpdateUser(ctx, id, "New name", " USER@example.com", confirm)
+	require.NoError(t, err)
+	require.Zero(t, calls)
+
+	_, err = u.UpdateUser(ctx, id, "Other name", "other@example.com", confirm)
+	require.ErrorIs(t, err, stepUp)
+	require.Equal(t, 1, calls)
+
+	user, err := st.UserById(ctx, id)
+	require.NoError(t, err)
+	require.Equal(t, "New name", user.Name)
+	require.Equal(t, "USER@example.com", user.Email)
+}
+
+type txKey struct{}
+
+// staleCache отдаёт вне транзакции сохранённую заранее копию пользователя, как LRU реплики,
+// до которой ещё не дошёл сброс. Внутри InTx чтения идут в хранилище
+type staleCache struct {
+	*memory.Storage
+	stale models.User
+}
+
+func (s *staleCache) UserById(ctx context.Context, id string) (models.User, error) {
+	if ctx.Value(txKey{}) == nil && id == s.stale.ID {
+		return s.stale, nil
+	}
+	return s.Storage.UserById(ctx, id)
+}
+
+func (s *staleCache) InTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	return s.Storage.InTx(context.WithValue(ctx, txKey{}, true), fn)
+}
+
+type photos struct{}
+
+func (photos) UploadPhoto(ctx context.Context, id string, photo []byte, contentType string, fileName string) (string, error) {
+	return "https://cdn.example.com/" + id + "/" + fileName, nil
+}
+
+func TestUploadAvatarIgnoresStaleCache(t *testing.T) {
+	st := memory.New()
+	ctx := context.Background()
+
+	id := verifiedUser(t, st, "user@example.com")
+	stale, err := st.UserById(ctx, id)
+	require.NoError(t, err)
+
+	cached := &staleCache{Storage: st, stale: stale}
+	u := New(zap.NewNop(), cached, photos{}, &transport{}, &config.JwtConfig{}, &config.EmailConfig{}, &config.UsernameConfig{})
+
+	// профиль изменён на другой реплике, кэш этой реплики ещё не сброшен
+	_, err = u.UpdateUser(ctx, id, "New name", "new@example.com", nil)
+	require.NoError(t, err)
+
+	url, err := u.UploadAvatar(ctx, id, []byte("photo"), "image/png", "avatar.png")
+	require.NoError(t, err)
+
+	user, err := st.UserById(ctx, id)
+	require.NoError(t, err)
+	require.Equal(t, url, user.Avatar)
+	require.Equal(t, "New name", user.Name)
+	require.Equal(t, "new@example.com", user.Email)
+}
@@ -0,0 +1,289 @@
+package webhooks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"time"
+
+	"github.com/DenisBochko/yandex_SSO/internal/config"
+	"github.com/DenisBochko/yandex_SSO/internal/domain/models"
+	"github.com/DenisBochko/yandex_SSO/internal/storage"
+	"github.com/DenisBochko/yandex_SSO/lib/netguard"
+	"github.com/DenisBochko/yandex_SSO/lib/webhooksig"
+
+	"go.uber.org/zap"
+)
+
+type Storage interface {
+	SaveWebhookSubscription(ctx context.Context, sub models.WebhookSubscription) (string, error)
+	WebhookSubscriptions(ctx context.Context) ([]models.WebhookSubscription, error)
+	WebhookSubscription(ctx context.Context, id string) (models.WebhookSubscription, error)
+	UpdateWebhookSubscription(ctx context.Context, sub models.WebhookSubscription) error
+	DeleteWebhookSubscription(ctx context.Context, id string) error
+	WebhookDeliveries(ctx context.Context, subscriptionID string, status models.WebhookDeliveryStatus, beforeID int64, limit int) ([]models.WebhookDelivery, error)
+	WebhookDeliveryAttempts(ctx context.Context, deliveryID int64) ([]models.WebhookDeliveryAttempt, error)
+	RedeliverWebhook(ctx context.Context, id int64, now time.Time) error
+}
+
+// EventTypes - события, на которые можно подписаться. Служебные сообщения (ссылки подтверждения,
+// SMS-коды, токены отзыва сессий) содержат секреты и партнёрам не отправляются.
+var EventTypes = []string{
+	string(models.UserEventRegistered),
+	string(models.UserEventVerified),
+	string(models.UserEventUpdated),
+	string(models.UserEventAvatarChanged),
+	string(models.UserEventDeleted),
+	string(models.UserEventLoggedIn),
+	"account.status_changed",
+}
+
+const (
+	defaultDeliveriesPage = 50
+	maxDeliveriesPage     = 200
+
+	minSecretLength = 16
+)
+
+var (
+	ErrInvalidURL        = errors.New("invalid webhook url")
+	ErrInvalidEventTypes = errors.New("invalid webhook event types")
+	ErrInvalidSecret     = errors.New("webhook secret is too short")
+	ErrInvalidStatus     = errors.New("invalid webhook delivery status")
+)
+
+// WebhooksService управляет подписками на вебхуки и журналом доставок.
+// Сами доставки создаёт адаптер при публикации события, а отправляет internal/app/webhooks.
+type WebhooksService struct {
+	log     *zap.Logger
+	storage Storage
+	cfg     *config.WebhooksConfig
+}
+
+func New(log *zap.Logger, storage Storage, cfg *config.WebhooksConfig) *WebhooksService {
+	return &WebhooksService{
+		log:     log,
+		storage: storage,
+		cfg:     cfg,
+	}
+}
+
+// CreateSubscription создаёт подписку. Если secret пуст, он генерируется.
+// Секрет есть только в ответе этого метода - получатель должен его сохранить.
+func (w *WebhooksService) CreateSubscription(ctx context.Context, rawURL string, eventTypes []string, secret string, description string) (models.WebhookSubscription, error) {
+	endpoint, err := w.validateURL(ctx, rawURL)
+	if err != nil {
+		return models.WebhookSubscription{}, err
+	}
+
+	types, err := normalizeEventTypes(eventTypes)
+	if err != nil {
+		return models.WebhookSubscription{}, err
+	}
+
+	if secret == "" {
+		if secret, err = webhooksig.GenerateSecret(); err != nil {
+			return models.WebhookSubscription{}, err
+		}
+	} else if len(secret) < minSecretLength {
+		return models.WebhookSubscription{}, ErrInvalidSecret
+	}
+
+	sub := models.WebhookSubscription{
+		URL:         endpoint,
+		EventTypes:  types,
+		Secret:      secret,
+		Description: description,
+		Active:      true,
+	}
+
+	sub.ID, err = w.storage.SaveWebhookSubscription(ctx, sub)
+	if err != nil {
+		return models.WebhookSubscription{}, fmt.Errorf("failed to create webhook subscription: %w", err)
+	}
+
+	w.log.Info("webhook subscription created", zap.String("id", sub.ID), zap.String("url", sub.URL), zap.Strings("eventTypes", sub.EventTypes))
+
+	return sub, nil
+}
+
+func (w *WebhooksService) ListSubscriptions(ctx context.Context) ([]models.WebhookSubscription, error) {
+	subs, err := w.storage.WebhookSubscriptions(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list webhook subscriptions: %w", err)
+	}
+
+	return subs, nil
+}
+
+func (w *WebhooksService) GetSubscription(ctx context.Context, id string) (models.WebhookSubscription, error) {
+	sub, err := w.storage.WebhookSubscription(ctx, id)
+	if err != nil {
+		if errors.Is(err, storage.ErrSubscriptionNotFound) {
+			return models.WebhookSubscription{}, storage.ErrSubscriptionNotFound
+		}
+		return models.WebhookSubscription{}, fmt.Errorf("failed to get webhook subscription: %w", err)
+	}
+
+	return sub, nil
+}
+
+// UpdateSubscription меняет адрес, типы событий, описание и активность подписки.
+// Пустой secret оставляет прежний, иначе заменяет его - так секрет ротируется.
+// Выключенная подписка не получает новых событий, уже созданные доставки ждут её включения.
+func (w *WebhooksService) UpdateSubscription(ctx context.Context, sub models.WebhookSubscription) (models.WebhookSubscription, error) {
+	endpoint, err := w.validateURL(ctx, sub.URL)
+	if err != nil {
+		return models.WebhookSubscription{}, err
+	}
+
+	types, err := normalizeEventTypes(sub.EventTypes)
+	if err != nil {
+		return models.WebhookSubscription{}, err
+	}
+
+	if sub.Secret != "" && len(sub.Secret) < minSecretLength {
+		return models.WebhookSubscription{}, ErrInvalidSecret
+	}
+
+	sub.URL = endpoint
+	sub.EventTypes = types
+
+	if err := w.storage.UpdateWebhookSubscription(ctx, sub); err != nil {
+		if errors.Is(err, storage.ErrSubscriptionNotFound) {
+			return models.WebhookSubscription{}, storage.ErrSubscriptionNotFound
+		}
+		return models.WebhookSubscription{}, fmt.Errorf("failed to update webhook subscription: %w", err)
+	}
+
+	return w.GetSubscription(ctx, sub.ID)
+}
+
+func (w *WebhooksService) DeleteSubscription(ctx context.Context, id string) error {
+	if err := w.storage.DeleteWebhookSubscription(ctx, id); err != nil {
+		if errors.Is(err, storage.ErrSubscriptionNotFound) {
+			return storage.ErrSubscriptionNotFound
+		}
+		return fmt.Errorf("failed to delete webhook subscription: %w", err)
+	}
+
+	w.log.Info("webhook subscription deleted", zap.String("id", id))
+
+	return nil
+}
+
+// ListDeliveries возвращает журнал доставок подписки от новых к старым.
+// status фильтрует по состоянию, пустой - все. beforeID - id последней доставки предыдущей страницы.
+func (w *WebhooksService) ListDeliveries(ctx context.Context, subscriptionID string, status models.WebhookDeliveryStatus, beforeID int64, limit int) ([]models.WebhookDelivery, error) {
+	switch status {
+	case "", models.WebhookDeliveryPending, models.WebhookDeliveryDelivered, models.WebhookDeliveryDead:
+	default:
+		return nil, ErrInvalidStatus
+	}
+
+	if limit <= 0 {
+		limit = defaultDeliveriesPage
+	}
+	if limit > maxDeliveriesPage {
+		limit = maxDeliveriesPage
+	}
+
+	// несуществующая подписка - ошибка, а не пустой список
+	if _, err := w.GetSubscription(ctx, subscriptionID); err != nil {
+		return nil, err
+	}
+
+	deliveries, err := w.storage.WebhookDeliveries(ctx, subscriptionID, status, beforeID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list webhook deliveries: %w", err)
+	}
+
+	return deliveries, nil
+}
+
+// ListDeliveryAttempts возвращает попытки доставки: код ответа, ошибку, начало тела ответа и длительность
+func (w *WebhooksService) ListDeliveryAttempts(ctx context.Context, deliveryID int64) ([]models.WebhookDeliveryAttempt, error) {
+	attempts, err := w.storage.WebhookDeliveryAttempts(ctx, deliveryID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list webhook delivery attempts: %w", err)
+	}
+
+	return attempts, nil
+}
+
+// Redeliver ставит доставку в очередь заново с полным набором попыток.
+// Подходит и для dead, и для уже доставленных событий, которые получатель потерял.
+func (w *WebhooksService) Redeliver(ctx context.Context, deliveryID int64) error {
+	if err := w.storage.RedeliverWebhook(ctx, deliveryID, time.Now().UTC()); err != nil {
+		if errors.Is(err, storage.ErrDeliveryNotFound) {
+			return storage.ErrDeliveryNotFound
+		}
+		return fmt.Errorf("failed to redeliver webhook: %w", err)
+	}
+
+	w.log.Info("webhook delivery requeued", zap.Int64("deliveryId", deliveryID))
+
+	return nil
+}
+
+// validateURL допускает только абсолютные https адреса (http - если разрешено в конфиге) без учётных данных.
+// Адрес не должен вести во внутреннюю сеть (см. lib/netguard), если это не разрешено webhooks.allow_private.
+// Worker проверяет адрес ещё раз при подключении: DNS мог измениться после создания подписки.
+func (w *WebhooksService) validateURL(ctx context.Context, raw string) (string, error) {
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" || u.User != nil || u.Fragment != "" {
+		return "", ErrInvalidURL
+	}
+
+	switch u.Scheme {
+	case "https":
+	case "http":
+		if !w.cfg.AllowHTTP {
+			return "", ErrInvalidURL
+		}
+	default:
+		return "", ErrInvalidURL
+	}
+
+	if !w.cfg.AllowPrivate {
+		if err := netguard.CheckHost(ctx, u.Hostname()); err != nil {
+			return "", fmt.Errorf("%w: %v", ErrInvalidURL, err)
+		}
+	}
+
+	return u.String(), nil
+}
+
+// normalizeEventTypes проверяет типы событий и убирает повторы
+func normalizeEventTypes(eventTypes []string) ([]string, error) {
+	if len(eventTypes) == 0 {
+		return nil, ErrInvalidEventTypes
+	}
+
+	seen := make(map[string]bool, len(eventTypes))
+	types := make([]string, 0, len(eventTypes))
+	for _, t := range eventTypes {
+		if !isKnownEventType(t) {
+			return nil, fmt.Errorf("%w: %q", ErrInvalidEventTypes, t)
+		}
+		if !seen[t] {
+			seen[t] = true
+			types = append(types, t)
+		}
+	}
+
+	sort.Strings(types)
+
+	return types, nil
+}
+
+func isKnownEventType(eventType string) bool {
+	for _, t := range EventTypes {
+		if t == eventType {
+			return true
+		}
+	}
+	return false
+}
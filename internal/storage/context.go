@@ -0,0 +1,18 @@
+package storage
+
+import "context"
+
+type replicaReadsKey struct{}
+
+// WithReplicaReads разрешает хранилищу читать по ctx с реплики, которая может немного отставать
+// (postgres с POSTGRES_REPLICAS). Только для запросов, результат которых не используется для записи:
+// изменения самого пользователя хранилище всё равно читает из primary в течение короткого окна.
+func WithReplicaReads(ctx context.Context) context.Context {
+	return context.WithValue(ctx, replicaReadsKey{}, true)
+}
+
+// ReplicaReadsAllowed сообщает, помечен ли ctx через WithReplicaReads
+func ReplicaReadsAllowed(ctx context.Context) bool {
+	allowed, _ := ctx.Value(replicaReadsKey{}).(bool)
+	return allowed
+}
@@ -0,0 +1,107 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/DenisBochko/yandex_SSO/internal/domain/models"
+	"github.com/DenisBochko/yandex_SSO/internal/storage"
+)
+
+// TouchKnownDevice отмечает вход с устройства и сообщает, было ли устройство незнакомым.
+// knownBefore - сколько других устройств пользователя уже было известно.
+func (s *Storage) TouchKnownDevice(ctx context.Context, device models.KnownDevice) (isNew bool, knownBefore int, err error) {
+	defer s.lock(ctx)()
+
+	if _, ok := s.state.users[device.UserID]; !ok {
+		return false, 0, fmt.Errorf("failed to save known device: %w", storage.ErrUserNotFound)
+	}
+
+	key := deviceKey{userID: device.UserID, fingerprint: device.Fingerprint}
+
+	if known, ok := s.state.devices[key]; ok {
+		known.UserAgent = device.UserAgent
+		known.IP = device.IP
+		known.LastSeenAt = device.LastSeenAt
+		s.state.devices[key] = known
+		return false, 0, nil
+	}
+
+	for k := range s.state.devices {
+		if k.userID == device.UserID {
+			knownBefore++
+		}
+	}
+
+	device.FirstSeenAt = device.LastSeenAt
+	s.state.devices[key] = device
+
+	return true, knownBefore, nil
+}
+
+// IsKnownDevice сообщает, входил ли пользователь раньше с устройства fingerprint
+func (s *Storage) IsKnownDevice(ctx context.Context, userID string, fingerprint string) (bool, error) {
+	defer s.lock(ctx)()
+
+	_, ok := s.state.devices[deviceKey{userID: userID, fingerprint: fingerprint}]
+	return ok, nil
+}
+
+// CreateSessionRevokeToken сохраняет токен ссылки "это был не я" для входа с устройства fingerprint
+func (s *Storage) CreateSessionRevokeToken(ctx context.Context, userID string, fingerprint string, token string, expiresAt time.Time) error {
+	defer s.lock(ctx)()
+
+	if _, ok := s.state.users[userID]; !ok {
+		return fmt.Errorf("failed to create session revoke token: %w", storage.ErrUserNotFound)
+	}
+
+	if _, ok := s.state.revokeTokens[token]; ok {
+		return fmt.Errorf("failed to create session revoke token: %w", storage.ErrTokenExists)
+	}
+
+	s.state.revokeTokens[token] = revokeRecord{userID: userID, fingerprint: fingerprint, expiresAt: expiresAt}
+
+	return nil
+}
+
+// ConsumeSessionRevokeToken удаляет токен "это был не я" и устройство, с которого был вход,
+// и возвращает id пользователя. Остальные такие токены пользователя тоже удаляются.
+func (s *Storage) ConsumeSessionRevokeToken(ctx context.Context, token string) (string, error) {
+	defer s.lock(ctx)()
+
+	t, ok := s.state.revokeTokens[token]
+	if !ok {
+		return "", storage.ErrTokenNotFound
+	}
+
+	delete(s.state.revokeTokens, token)
+	if time.Now().UTC().After(t.expiresAt) {
+		return "", storage.ErrTokenExpired
+	}
+
+	for other, r := range s.state.revokeTokens {
+		if r.userID == t.userID {
+			delete(s.state.revokeTokens, other)
+		}
+	}
+
+	delete(s.state.devices, deviceKey{userID: t.userID, fingerprint: t.fingerprint})
+
+	return t.userID, nil
+}
+
+// PurgeExpiredSessionRevokeTokens удаляет токены "это был не я", истёкшие до before
+func (s *Storage) PurgeExpiredSessionRevokeTokens(ctx context.Context, before time.Time) (int64, error) {
+	defer s.lock(ctx)()
+
+	var n int64
+	for token, t := range s.state.revokeTokens {
+		if t.expiresAt.Before(before) {
+			delete(s.state.revokeTokens, token)
+			n++
+		}
+	}
+
+	return n, nil
+}
@@ -0,0 +1,14 @@
+package memory
+
+import "context"
+
+// Leader - выбор лидера для единственного процесса: лидером он является всегда
+type Leader struct{}
+
+func (Leader) TryAcquire(ctx context.Context) (bool, error) {
+	return true, nil
+}
+
+func (Leader) Release(ctx context.Context) error {
+	return nil
+}
@@ -0,0 +1,138 @@
+// Package memory - хранилища в памяти процесса с той же семантикой ошибок, что у postgres, redis и minIO.
+// Используются в тестах и в режиме разработки (--dev), когда внешних сервисов нет.
+// Соответствие реализациям проверяет общий набор тестов internal/storage/storagetest.
+package memory
+
+import (
+	"context"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/DenisBochko/yandex_SSO/internal/domain/models"
+)
+
+// Storage заменяет postgres: пользователи, токены и коды подтверждения, хэндлы, события безопасности,
+// устройства, outbox и результаты команд. Все данные защищены одним мьютексом.
+type Storage struct {
+	mu    sync.Mutex
+	state state
+}
+
+// state - содержимое хранилища. Значения в картах и срезах не изменяются на месте,
+// а заменяются целиком, поэтому для снимка в InTx достаточно скопировать сами карты и срезы.
+type state struct {
+	users        map[string]userRecord
+	tokens       map[string]tokenRecord
+	codes        map[codeKey]models.VerificationCode
+	history      []historyRecord
+	events       []models.SecurityEvent
+	devices      map[deviceKey]models.KnownDevice
+	revokeTokens map[string]revokeRecord
+	outbox       []outboxRecord
+	commands     map[string]models.AccountCommandResult
+
+	eventSeq  int64
+	outboxSeq int64
+}
+
+// userRecord - пользователь и служебные колонки, которых нет в models.User
+type userRecord struct {
+	models.User
+	usernameSkeleton string
+	emailStatusAt    time.Time
+	createdAt        time.Time
+}
+
+type tokenRecord struct {
+	userID    string
+	expiresAt time.Time
+}
+
+type codeKey struct {
+	userID  string
+	channel models.CodeChannel
+}
+
+type historyRecord struct {
+	models.UsernameChange
+	skeleton string
+}
+
+type deviceKey struct {
+	userID      string
+	fingerprint string
+}
+
+type revokeRecord struct {
+	userID      string
+	fingerprint string
+	expiresAt   time.Time
+}
+
+type outboxRecord struct {
+	models.OutboxMessage
+	lastError   string
+	publishedAt time.Time
+}
+
+// Конструктор Storage
+func New() *Storage {
+	return &Storage{
+		state: state{
+			users:        make(map[string]userRecord),
+			tokens:       make(map[string]tokenRecord),
+			codes:        make(map[codeKey]models.VerificationCode),
+			devices:      make(map[deviceKey]models.KnownDevice),
+			revokeTokens: make(map[string]revokeRecord),
+			commands:     make(map[string]models.AccountCommandResult),
+		},
+	}
+}
+
+func (st state) clone() state {
+	st.users = maps.Clone(st.users)
+	st.tokens = maps.Clone(st.tokens)
+	st.codes = maps.Clone(st.codes)
+	st.history = slices.Clone(st.history)
+	st.events = slices.Clone(st.events)
+	st.devices = maps.Clone(st.devices)
+	st.revokeTokens = maps.Clone(st.revokeTokens)
+	st.outbox = slices.Clone(st.outbox)
+	st.commands = maps.Clone(st.commands)
+	return st
+}
+
+type txKey struct{}
+
+// lock захватывает мьютекс, если его ещё не держит InTx выше по стеку
+func (s *Storage) lock(ctx context.Context) func() {
+	if tx, ok := ctx.Value(txKey{}).(*Storage); ok && tx == s {
+		return func() {}
+	}
+
+	s.mu.Lock()
+	return s.mu.Unlock
+}
+
+// InTx выполняет fn под мьютексом хранилища: методы, вызванные с переданным в fn контекстом,
+// видят и меняют данные без вмешательства других запросов. Если fn вернула ошибку,
+// хранилище возвращается к состоянию до вызова. Вложенный InTx использует внешнюю транзакцию.
+func (s *Storage) InTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	if tx, ok := ctx.Value(txKey{}).(*Storage); ok && tx == s {
+		return fn(ctx)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	snapshot := s.state.clone()
+
+	if err := fn(context.WithValue(ctx, txKey{}, s)); err != nil {
+		s.state = snapshot
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,90 @@
+package memory
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/DenisBochko/yandex_SSO/internal/domain/models"
+	"github.com/DenisBochko/yandex_SSO/internal/services/auth"
+	"github.com/DenisBochko/yandex_SSO/internal/services/users"
+	"github.com/DenisBochko/yandex_SSO/internal/storage"
+	"github.com/DenisBochko/yandex_SSO/internal/storage/storagetest"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStorage(t *testing.T) {
+	storagetest.RunStorage(t, func(t *testing.T) storagetest.Storage {
+		return New()
+	})
+}
+
+func TestSessions(t *testing.T) {
+	storagetest.RunSessions(t, func(t *testing.T) auth.RedisStorage {
+		return NewSessions(time.Hour)
+	})
+}
+
+func TestObjects(t *testing.T) {
+	storagetest.RunObjects(t, func(t *testing.T) users.MinIoStorage {
+		return NewObjects("avatars")
+	})
+}
+
+func TestSessionsExpire(t *testing.T) {
+	s := NewSessions(time.Minute)
+	current := time.Now()
+	s.now = func() time.Time { return current }
+	ctx := context.Background()
+
+	require.NoError(t, s.SaveSession(ctx, "token", models.Session{UserID: "user"}))
+
+	current = current.Add(time.Minute)
+
+	_, err := s.Session(ctx, "token")
+	require.ErrorIs(t, err, storage.ErrKeyDoesNotExist)
+
+	deleted, err := s.DeleteUserSessions(ctx, "user")
+	require.NoError(t, err)
+	require.Zero(t, deleted)
+}
+
+func TestConcurrentTransactions(t *testing.T) {
+	s := New()
+	ctx := context.Background()
+
+	id, err := s.SaveUser(ctx, "user", "user@example.com", "user@example.com", []byte("hash"))
+	require.NoError(t, err)
+	_, err = s.CreateVerificationCode(ctx, id, models.CodeChannelEmail, []byte("code"), time.Now().Add(time.Hour), models.CodeLimits{})
+	require.NoError(t, err)
+
+	// из параллельных попыток погасить код успешна ровно одна
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	consumed := 0
+
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			err := s.InTx(ctx, func(ctx context.Context) error {
+				if _, err := s.VerificationCode(ctx, id, models.CodeChannelEmail); err != nil {
+					return err
+				}
+				_, err := s.ConsumeVerificationCode(ctx, id, models.CodeChannelEmail)
+				return err
+			})
+			if err == nil {
+				mu.Lock()
+				consumed++
+				mu.Unlock()
+			}
+		}()
+	}
+
+	wg.Wait()
+	require.Equal(t, 1, consumed)
+}
@@ -0,0 +1,53 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/DenisBochko/yandex_SSO/lib/avatar"
+)
+
+// Objects заменяет minIO: фото профиля хранятся в памяти, ссылки на них имеют вид memory://<bucket>/<объект>
+type Objects struct {
+	mu      sync.Mutex
+	bucket  string
+	objects map[string]object
+}
+
+type object struct {
+	data        []byte
+	contentType string
+}
+
+func NewObjects(bucket string) *Objects {
+	return &Objects{
+		bucket:  bucket,
+		objects: make(map[string]object),
+	}
+}
+
+// UploadPhoto сжимает фото так же, как хранилище minIO, и сохраняет его под именем <id>_<fileName>
+func (o *Objects) UploadPhoto(ctx context.Context, id string, photo []byte, contentType string, fileName string) (string, error) {
+	objectName := fmt.Sprintf("%s_%s", id, fileName)
+
+	resized, contentType, err := avatar.Prepare(photo, contentType)
+	if err != nil {
+		return "", err
+	}
+
+	o.mu.Lock()
+	o.objects[objectName] = object{data: resized, contentType: contentType}
+	o.mu.Unlock()
+
+	return fmt.Sprintf("memory://%s/%s", o.bucket, objectName), nil
+}
+
+// Object возвращает сохранённый объект и его content type
+func (o *Objects) Object(name string) ([]byte, string, bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	obj, ok := o.objects[name]
+	return obj.data, obj.contentType, ok
+}
@@ -0,0 +1,165 @@
+package memory
+
+import (
+	"context"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/DenisBochko/yandex_SSO/internal/domain/models"
+)
+
+// SaveOutboxMessage добавляет сообщение в outbox. Внутри InTx запись откатывается вместе с изменением данных.
+func (s *Storage) SaveOutboxMessage(ctx context.Context, message models.OutboxMessage) error {
+	defer s.lock(ctx)()
+
+	now := time.Now().UTC()
+
+	s.state.outboxSeq++
+	message.ID = s.state.outboxSeq
+	message.CreatedAt = now
+	message.NextAttemptAt = now
+	message.Attempts = 0
+
+	message.Headers = maps.Clone(message.Headers)
+	if message.Headers == nil {
+		message.Headers = map[string]string{}
+	}
+
+	s.state.outbox = append(s.state.outbox, outboxRecord{OutboxMessage: message})
+
+	return nil
+}
+
+// PendingOutboxMessages возвращает до limit неопубликованных сообщений в порядке id, которые можно отправить сейчас.
+// Сообщение пропускается, если более раннее сообщение того же aggregate_id ждёт повторной попытки.
+func (s *Storage) PendingOutboxMessages(ctx context.Context, now time.Time, limit int) ([]models.OutboxMessage, error) {
+	defer s.lock(ctx)()
+
+	waiting := make(map[string]bool)
+
+	var messages []models.OutboxMessage
+	for _, m := range s.state.outbox {
+		if len(messages) >= limit {
+			break
+		}
+		if !m.publishedAt.IsZero() {
+			continue
+		}
+		if m.NextAttemptAt.After(now) {
+			waiting[m.AggregateID] = true
+			continue
+		}
+		if waiting[m.AggregateID] {
+			continue
+		}
+		messages = append(messages, m.OutboxMessage)
+	}
+
+	return messages, nil
+}
+
+// MarkOutboxPublished отмечает сообщения опубликованными
+func (s *Storage) MarkOutboxPublished(ctx context.Context, ids []int64, publishedAt time.Time) error {
+	defer s.lock(ctx)()
+
+	for i, m := range s.state.outbox {
+		if slices.Contains(ids, m.ID) {
+			m.Attempts++
+			m.lastError = ""
+			m.publishedAt = publishedAt
+			s.state.outbox[i] = m
+		}
+	}
+
+	return nil
+}
+
+// MarkOutboxFailed записывает неудачную попытку и время следующей
+func (s *Storage) MarkOutboxFailed(ctx context.Context, id int64, lastError string, nextAttemptAt time.Time) error {
+	defer s.lock(ctx)()
+
+	for i, m := range s.state.outbox {
+		if m.ID == id {
+			m.Attempts++
+			m.lastError = lastError
+			m.NextAttemptAt = nextAttemptAt
+			s.state.outbox[i] = m
+		}
+	}
+
+	return nil
+}
+
+// OutboxBacklog возвращает количество неопубликованных сообщений и время создания самого старого из них
+func (s *Storage) OutboxBacklog(ctx context.Context) (int64, time.Time, error) {
+	defer s.lock(ctx)()
+
+	var count int64
+	var oldest time.Time
+	for _, m := range s.state.outbox {
+		if !m.publishedAt.IsZero() {
+			continue
+		}
+		count++
+		if oldest.IsZero() || m.CreatedAt.Before(oldest) {
+			oldest = m.CreatedAt
+		}
+	}
+
+	return count, oldest, nil
+}
+
+// PurgePublishedOutbox удаляет сообщения, опубликованные до before
+func (s *Storage) PurgePublishedOutbox(ctx context.Context, before time.Time) (int64, error) {
+	defer s.lock(ctx)()
+
+	outbox := s.state.outbox[:0:0]
+	for _, m := range s.state.outbox {
+		if m.publishedAt.IsZero() || !m.publishedAt.Before(before) {
+			outbox = append(outbox, m)
+		}
+	}
+
+	n := int64(len(s.state.outbox) - len(outbox))
+	s.state.outbox = outbox
+
+	return n, nil
+}
+
+// SaveAccountCommandResult записывает итог команды. Возвращает false, если команда
+// с таким id уже записана: тогда её повтор выполнять не нужно.
+func (s *Storage) SaveAccountCommandResult(ctx context.Context, result models.AccountCommandResult) (bool, error) {
+	defer s.lock(ctx)()
+
+	if _, ok := s.state.commands[result.CommandID]; ok {
+		return false, nil
+	}
+
+	s.state.commands[result.CommandID] = result
+
+	return true, nil
+}
+
+// AccountCommandProcessed проверяет, выполнялась ли уже команда с этим id
+func (s *Storage) AccountCommandProcessed(ctx context.Context, id string) (bool, error) {
+	defer s.lock(ctx)()
+
+	_, ok := s.state.commands[id]
+	return ok, nil
+}
+
+// PurgeAccountCommands удаляет записи о командах старше before
+func (s *Storage) PurgeAccountCommands(ctx context.Context, before time.Time) (int64, error) {
+	defer s.lock(ctx)()
+
+	var n int64
+	for id, result := range s.state.commands {
+		if result.CreatedAt.Before(before) {
+			delete(s.state.commands, id)
+			n++
+		}
+	}
+
+	return n, nil
+}
@@ -0,0 +1,101 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"time"
+
+	"github.com/DenisBochko/yandex_SSO/internal/domain/models"
+	"github.com/DenisBochko/yandex_SSO/internal/storage"
+)
+
+// SaveSecurityEvent записывает событие безопасности
+func (s *Storage) SaveSecurityEvent(ctx context.Context, event models.SecurityEvent) error {
+	defer s.lock(ctx)()
+
+	// событие без пользователя - попытка входа с несуществующим логином
+	if _, ok := s.state.users[event.UserID]; event.UserID != "" && !ok {
+		return fmt.Errorf("failed to save security event: %w", storage.ErrUserNotFound)
+	}
+
+	s.state.eventSeq++
+	event.ID = s.state.eventSeq
+	event.CreatedAt = time.Now().UTC()
+
+	event.Details = maps.Clone(event.Details)
+	if event.Details == nil {
+		event.Details = map[string]string{}
+	}
+
+	s.state.events = append(s.state.events, event)
+
+	return nil
+}
+
+// SecurityEvents возвращает до limit событий пользователя, начиная с самых новых.
+// beforeID - курсор для следующей страницы: id последнего полученного события, 0 - с начала.
+func (s *Storage) SecurityEvents(ctx context.Context, userID string, beforeID int64, limit int) ([]models.SecurityEvent, error) {
+	defer s.lock(ctx)()
+
+	var events []models.SecurityEvent
+	// события добавляются в порядке id, поэтому идём с конца
+	for i := len(s.state.events) - 1; i >= 0 && len(events) < limit; i-- {
+		event := s.state.events[i]
+		if event.UserID != userID || (beforeID != 0 && event.ID >= beforeID) {
+			continue
+		}
+		events = append(events, event)
+	}
+
+	return events, nil
+}
+
+// PurgeSecurityEvents удаляет события старше before
+func (s *Storage) PurgeSecurityEvents(ctx context.Context, before time.Time) (int64, error) {
+	defer s.lock(ctx)()
+
+	events := s.state.events[:0:0]
+	for _, event := range s.state.events {
+		if !event.CreatedAt.Before(before) {
+			events = append(events, event)
+		}
+	}
+
+	n := int64(len(s.state.events) - len(events))
+	s.state.events = events
+
+	return n, nil
+}
+
+// CountRecentSecurityEvents считает события типа eventType не старше since,
+// относящиеся к пользователю userID или пришедшие с адреса ip
+func (s *Storage) CountRecentSecurityEvents(ctx context.Context, userID string, ip string, eventType models.SecurityEventType, since time.Time) (int, error) {
+	defer s.lock(ctx)()
+
+	var count int
+	for _, event := range s.state.events {
+		if event.Type != eventType || event.CreatedAt.Before(since) {
+			continue
+		}
+		if (userID != "" && event.UserID == userID) || (ip != "" && event.IP == ip) {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+// LastSecurityEvent возвращает последнее событие пользователя типа eventType
+func (s *Storage) LastSecurityEvent(ctx context.Context, userID string, eventType models.SecurityEventType) (models.SecurityEvent, error) {
+	defer s.lock(ctx)()
+
+	for i := len(s.state.events) - 1; i >= 0; i-- {
+		event := s.state.events[i]
+		if event.UserID == userID && event.Type == eventType {
+			return event, nil
+		}
+	}
+
+	return models.SecurityEvent{}, storage.ErrEventNotFound
+}
@@ -0,0 +1,111 @@
+package memory
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/DenisBochko/yandex_SSO/internal/domain/models"
+	"github.com/DenisBochko/yandex_SSO/internal/storage"
+)
+
+// Sessions заменяет redis: сессии под refresh токенами с временем жизни ttl
+// и индекс токенов пользователя для завершения всех его сессий.
+type Sessions struct {
+	mu    sync.Mutex
+	ttl   time.Duration
+	now   func() time.Time
+	items map[string]sessionRecord
+	users map[string]map[string]struct{}
+}
+
+type sessionRecord struct {
+	session   models.Session
+	expiresAt time.Time
+}
+
+func NewSessions(ttl time.Duration) *Sessions {
+	return &Sessions{
+		ttl:   ttl,
+		now:   time.Now,
+		items: make(map[string]sessionRecord),
+		users: make(map[string]map[string]struct{}),
+	}
+}
+
+// SaveSession сохраняет сессию под refresh токеном и добавляет токен в индекс сессий пользователя
+func (s *Sessions) SaveSession(ctx context.Context, token string, session models.Session) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.items[token] = sessionRecord{session: session, expiresAt: s.now().Add(s.ttl)}
+
+	tokens, ok := s.users[session.UserID]
+	if !ok {
+		tokens = make(map[string]struct{})
+		s.users[session.UserID] = tokens
+	}
+	tokens[token] = struct{}{}
+
+	return nil
+}
+
+// Session возвращает сессию по refresh токену
+func (s *Sessions) Session(ctx context.Context, token string) (models.Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	item, ok := s.items[token]
+	if !ok {
+		return models.Session{}, storage.ErrKeyDoesNotExist
+	}
+
+	if !s.now().Before(item.expiresAt) {
+		s.remove(token, item.session.UserID)
+		return models.Session{}, storage.ErrKeyDoesNotExist
+	}
+
+	return item.session, nil
+}
+
+func (s *Sessions) Delete(ctx context.Context, uuid string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if item, ok := s.items[uuid]; ok {
+		s.remove(uuid, item.session.UserID)
+	}
+
+	return nil
+}
+
+// DeleteUserSessions удаляет все refresh токены пользователя и возвращает количество удалённых
+func (s *Sessions) DeleteUserSessions(ctx context.Context, userID string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+
+	var deleted int64
+	for token := range s.users[userID] {
+		// истёкшие токены в redis уже исчезли бы сами и в количество не вошли бы
+		if item, ok := s.items[token]; ok && now.Before(item.expiresAt) {
+			deleted++
+		}
+		delete(s.items, token)
+	}
+	delete(s.users, userID)
+
+	return deleted, nil
+}
+
+func (s *Sessions) remove(token string, userID string) {
+	delete(s.items, token)
+
+	if tokens, ok := s.users[userID]; ok {
+		delete(tokens, token)
+		if len(tokens) == 0 {
+			delete(s.users, userID)
+		}
+	}
+}
@@ -0,0 +1,622 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/DenisBochko/yandex_SSO/internal/domain/models"
+	"github.com/DenisBochko/yandex_SSO/internal/storage"
+
+	"github.com/google/uuid"
+)
+
+// newUser заполняет значения по умолчанию, которые в postgres задаёт схема таблицы users
+func newUser(name string) userRecord {
+	return userRecord{
+		User: models.User{
+			ID:          uuid.NewString(),
+			Name:        name,
+			Status:      models.UserStatusActive,
+			EmailStatus: models.EmailStatusOK,
+		},
+		createdAt: time.Now().UTC(),
+	}
+}
+
+// emailTaken проверяет уникальность email и email_canonical среди пользователей, кроме exceptID
+func (s *Storage) emailTaken(email string, emailCanonical string, exceptID string) bool {
+	for id, u := range s.state.users {
+		if id == exceptID {
+			continue
+		}
+		if email != "" && u.Email == email {
+			return true
+		}
+		if emailCanonical != "" && u.EmailCanonical == emailCanonical {
+			return true
+		}
+	}
+	return false
+}
+
+// SaveUser сохраняет пользователя. Уникальность проверяется по email и каноническому email.
+func (s *Storage) SaveUser(ctx context.Context, name string, email string, emailCanonical string, passHash []byte) (string, error) {
+	defer s.lock(ctx)()
+
+	if s.emailTaken(email, emailCanonical, "") {
+		return "", storage.ErrUserExists
+	}
+
+	user := newUser(name)
+	user.Email = email
+	user.EmailCanonical = emailCanonical
+	user.PassHash = passHash
+
+	s.state.users[user.ID] = user
+
+	return user.ID, nil
+}
+
+// SavePhoneUser сохраняет пользователя, зарегистрированного по номеру телефона, без email и пароля
+func (s *Storage) SavePhoneUser(ctx context.Context, name string, phone string) (string, error) {
+	defer s.lock(ctx)()
+
+	if _, ok := s.userByPhone(phone); ok {
+		return "", storage.ErrUserExists
+	}
+
+	user := newUser(name)
+	user.Phone = phone
+
+	s.state.users[user.ID] = user
+
+	return user.ID, nil
+}
+
+func (s *Storage) userByPhone(phone string) (userRecord, bool) {
+	for _, u := range s.state.users {
+		if u.Phone != "" && u.Phone == phone {
+			return u, true
+		}
+	}
+	return userRecord{}, false
+}
+
+// UserByPhone возвращает пользователя по номеру телефона в формате E.164
+func (s *Storage) UserByPhone(ctx context.Context, phone string) (models.User, error) {
+	defer s.lock(ctx)()
+
+	u, ok := s.userByPhone(phone)
+	if !ok {
+		return models.User{}, storage.ErrUserNotFound
+	}
+
+	return u.User, nil
+}
+
+// SetUserPhone привязывает номер к пользователю. Новый номер считается неподтверждённым.
+func (s *Storage) SetUserPhone(ctx context.Context, id string, phone string) (bool, error) {
+	defer s.lock(ctx)()
+
+	u, ok := s.state.users[id]
+	if !ok {
+		return false, storage.ErrUserNotFound
+	}
+
+	if other, ok := s.userByPhone(phone); ok && other.ID != id {
+		return false, storage.ErrPhoneExists
+	}
+
+	u.Phone = phone
+	u.PhoneVerified = false
+	s.state.users[id] = u
+
+	return true, nil
+}
+
+// User возвращает пользователя по каноническому email или по самому адресу без учёта регистра.
+// Если подходят несколько пользователей, выбирается точное совпадение адреса, затем канонического адреса.
+func (s *Storage) User(ctx context.Context, email string, emailCanonical string) (models.User, error) {
+	defer s.lock(ctx)()
+
+	var found *userRecord
+	rank := 0
+	for _, u := range s.state.users {
+		var r int
+		switch {
+		case u.Email != "" && u.Email == email:
+			r = 3
+		case u.EmailCanonical != "" && u.EmailCanonical == emailCanonical:
+			r = 2
+		case u.Email != "" && strings.EqualFold(u.Email, email):
+			r = 1
+		}
+		if r > rank {
+			found, rank = &u, r
+		}
+	}
+
+	if found == nil {
+		return models.User{}, storage.ErrUserNotFound
+	}
+
+	return found.User, nil
+}
+
+// Users возвращает список пользователей по списку id. Неизвестные id пропускаются.
+func (s *Storage) Users(ctx context.Context, ids []string) ([]models.User, error) {
+	defer s.lock(ctx)()
+
+	var users []models.User
+	seen := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		u, ok := s.state.users[id]
+		if !ok || seen[id] {
+			continue
+		}
+		seen[id] = true
+		users = append(users, u.User)
+	}
+
+	return users, nil
+}
+
+func (s *Storage) UserById(ctx context.Context, id string) (models.User, error) {
+	defer s.lock(ctx)()
+
+	u, ok := s.state.users[id]
+	if !ok {
+		return models.User{}, storage.ErrUserNotFound
+	}
+
+	return u.User, nil
+}
+
+// UserByUsername возвращает пользователя по хэндлу в нижнем регистре
+func (s *Storage) UserByUsername(ctx context.Context, username string) (models.User, error) {
+	defer s.lock(ctx)()
+
+	for _, u := range s.state.users {
+		if u.Username != "" && u.Username == username {
+			return u.User, nil
+		}
+	}
+
+	return models.User{}, storage.ErrUserNotFound
+}
+
+// UserEmails возвращает id, email и email_canonical всех пользователей с email в порядке регистрации
+func (s *Storage) UserEmails(ctx context.Context) ([]models.User, error) {
+	defer s.lock(ctx)()
+
+	var records []userRecord
+	for _, u := range s.state.users {
+		if u.Email != "" {
+			records = append(records, u)
+		}
+	}
+
+	sort.Slice(records, func(i, j int) bool { return records[i].createdAt.Before(records[j].createdAt) })
+
+	users := make([]models.User, 0, len(records))
+	for _, u := range records {
+		users = append(users, models.User{ID: u.ID, Email: u.Email, EmailCanonical: u.EmailCanonical})
+	}
+
+	return users, nil
+}
+
+// Обновляет имя, email и аватар пользователя по id. Подтверждение email не меняется.
+// Как и в postgres, отсутствие пользователя ошибкой не считается.
+func (s *Storage) UpdateUser(ctx context.Context, user models.User) (bool, error) {
+	defer s.lock(ctx)()
+
+	u, ok := s.state.users[user.ID]
+	if !ok {
+		return true, nil
+	}
+
+	if s.emailTaken(user.Email, user.EmailCanonical, user.ID) {
+		return false, storage.ErrUserExists
+	}
+
+	// отчёты о доставке относятся к прежнему адресу
+	if u.Email != user.Email {
+		u.EmailStatus = models.EmailStatusOK
+		u.EmailStatusReason = ""
+		u.emailStatusAt = time.Time{}
+	}
+
+	u.Name = user.Name
+	u.Email = user.Email
+	u.EmailCanonical = user.EmailCanonical
+	u.Avatar = user.Avatar
+	s.state.users[user.ID] = u
+
+	return true, nil
+}
+
+// SetUserStatus меняет статус учётной записи. Нулевой until означает бессрочную блокировку.
+func (s *Storage) SetUserStatus(ctx context.Context, id string, status models.UserStatus, reason string, until time.Time) (bool, error) {
+	defer s.lock(ctx)()
+
+	u, ok := s.state.users[id]
+	if !ok {
+		return false, storage.ErrUserNotFound
+	}
+
+	u.Status = status
+	u.StatusReason = reason
+	u.SuspendedUntil = until
+	s.state.users[id] = u
+
+	return true, nil
+}
+
+// DeleteUser удаляет пользователя вместе со всеми его данными, как ON DELETE CASCADE в postgres
+func (s *Storage) DeleteUser(ctx context.Context, id string) (bool, error) {
+	defer s.lock(ctx)()
+
+	if _, ok := s.state.users[id]; !ok {
+		return true, nil
+	}
+
+	delete(s.state.users, id)
+
+	for token, t := range s.state.tokens {
+		if t.userID == id {
+			delete(s.state.tokens, token)
+		}
+	}
+
+	for key := range s.state.codes {
+		if key.userID == id {
+			delete(s.state.codes, key)
+		}
+	}
+
+	for key := range s.state.devices {
+		if key.userID == id {
+			delete(s.state.devices, key)
+		}
+	}
+
+	for token, t := range s.state.revokeTokens {
+		if t.userID == id {
+			delete(s.state.revokeTokens, token)
+		}
+	}
+
+	history := s.state.history[:0:0]
+	for _, h := range s.state.history {
+		if h.UserID != id {
+			history = append(history, h)
+		}
+	}
+	s.state.history = history
+
+	events := s.state.events[:0:0]
+	for _, e := range s.state.events {
+		if e.UserID != id {
+			events = append(events, e)
+		}
+	}
+	s.state.events = events
+
+	return true, nil
+}
+
+// CreateVerificationToken сохраняет новый верификационный токен пользователя.
+// Все ранее выданные токены пользователя удаляются, работает только последняя ссылка.
+func (s *Storage) CreateVerificationToken(ctx context.Context, userID string, token string, expiresAt time.Time) (bool, error) {
+	defer s.lock(ctx)()
+
+	if _, ok := s.state.users[userID]; !ok {
+		return false, fmt.Errorf("failed to create verification token: %w", storage.ErrUserNotFound)
+	}
+
+	if t, ok := s.state.tokens[token]; ok && t.userID != userID {
+		return false, storage.ErrTokenExists
+	}
+
+	s.deleteUserTokens(userID)
+	s.state.tokens[token] = tokenRecord{userID: userID, expiresAt: expiresAt}
+
+	return true, nil
+}
+
+func (s *Storage) deleteUserTokens(userID string) {
+	for token, t := range s.state.tokens {
+		if t.userID == userID {
+			delete(s.state.tokens, token)
+		}
+	}
+}
+
+// VerifyToken погашает токен и подтверждает пользователя. Возвращает id подтверждённого пользователя.
+// Токен удаляется при первом использовании, повторный запрос вернёт ErrTokenNotFound.
+func (s *Storage) VerifyToken(ctx context.Context, token string) (string, error) {
+	defer s.lock(ctx)()
+
+	t, ok := s.state.tokens[token]
+	if !ok {
+		return "", storage.ErrTokenNotFound
+	}
+
+	// просроченный токен тоже удаляем, он больше никогда не пригодится
+	delete(s.state.tokens, token)
+	if time.Now().UTC().After(t.expiresAt) {
+		return "", storage.ErrTokenExpired
+	}
+
+	// числовой код для этого email тоже больше не нужен
+	delete(s.state.codes, codeKey{userID: t.userID, channel: models.CodeChannelEmail})
+
+	if u, ok := s.state.users[t.userID]; ok {
+		u.Verified = true
+		s.state.users[t.userID] = u
+	}
+
+	return t.userID, nil
+}
+
+// PurgeExpiredVerificationTokens удаляет токены, истёкшие до before, и возвращает их количество
+func (s *Storage) PurgeExpiredVerificationTokens(ctx context.Context, before time.Time) (int64, error) {
+	defer s.lock(ctx)()
+
+	var n int64
+	for token, t := range s.state.tokens {
+		if t.expiresAt.Before(before) {
+			delete(s.state.tokens, token)
+			n++
+		}
+	}
+
+	return n, nil
+}
+
+// CreateVerificationCode сохраняет хэш нового кода пользователя для канала channel.
+// Предыдущий код этого канала перезаписывается. Счётчики попыток и выпусков сбрасываются
+// только с началом нового окна limits.Window; если код запрошен раньше limits.ResendCooldown
+// или в окне уже выпущено limits.MaxIssues кодов, возвращает ErrTooManyCodes.
+func (s *Storage) CreateVerificationCode(ctx context.Context, userID string, channel models.CodeChannel, codeHash []byte, expiresAt time.Time, limits models.CodeLimits) (bool, error) {
+	defer s.lock(ctx)()
+
+	if _, ok := s.state.users[userID]; !ok {
+		return false, storage.ErrUserNotFound
+	}
+
+	now := time.Now().UTC()
+	key := codeKey{userID: userID, channel: channel}
+
+	code, ok := s.state.codes[key]
+	if !ok || !code.WindowStartedAt.After(now.Add(-limits.Window)) {
+		code = models.VerificationCode{WindowStartedAt: now}
+	} else if code.IssuedAt.After(now.Add(-limits.ResendCooldown)) || (limits.MaxIssues > 0 && code.Issues >= limits.MaxIssues) {
+		return false, storage.ErrTooManyCodes
+	}
+
+	code.UserID = userID
+	code.Channel = channel
+	code.CodeHash = codeHash
+	code.ExpiresAt = expiresAt
+	code.IssuedAt = now
+	code.Issues++
+	s.state.codes[key] = code
+
+	return true, nil
+}
+
+// VerificationCode возвращает действующий код пользователя для канала channel
+func (s *Storage) VerificationCode(ctx context.Context, userID string, channel models.CodeChannel) (models.VerificationCode, error) {
+	defer s.lock(ctx)()
+
+	code, ok := s.state.codes[codeKey{userID: userID, channel: channel}]
+	if !ok {
+		return models.VerificationCode{}, storage.ErrTokenNotFound
+	}
+
+	return code, nil
+}
+
+// AddVerificationCodeAttempt расходует одну попытку ввода кода.
+// Если попытки закончились или кода нет, возвращает ErrTooManyAttempts.
+func (s *Storage) AddVerificationCodeAttempt(ctx context.Context, userID string, channel models.CodeChannel, maxAttempts int) (int, error) {
+	defer s.lock(ctx)()
+
+	key := codeKey{userID: userID, channel: channel}
+
+	code, ok := s.state.codes[key]
+	if !ok || code.Attempts >= maxAttempts {
+		return 0, storage.ErrTooManyAttempts
+	}
+
+	code.Attempts++
+	s.state.codes[key] = code
+
+	return code.Attempts, nil
+}
+
+// ConsumeVerificationCode погашает код и подтверждает канал:
+// для email - адрес пользователя (неиспользованные ссылки-токены тоже удаляются),
+// для sms - номер телефона. Код второго фактора (login_challenge) ничего не подтверждает.
+func (s *Storage) ConsumeVerificationCode(ctx context.Context, userID string, channel models.CodeChannel) (bool, error) {
+	defer s.lock(ctx)()
+
+	key := codeKey{userID: userID, channel: channel}
+	if _, ok := s.state.codes[key]; !ok {
+		return false, storage.ErrTokenNotFound
+	}
+	delete(s.state.codes, key)
+
+	u, ok := s.state.users[userID]
+
+	switch channel {
+	case models.CodeChannelSMS:
+		u.PhoneVerified = true
+	case models.CodeChannelEmail:
+		s.deleteUserTokens(userID)
+		u.Verified = true
+	}
+
+	if ok {
+		s.state.users[userID] = u
+	}
+
+	return true, nil
+}
+
+// PurgeExpiredVerificationCodes удаляет коды, истёкшие до before, и возвращает их количество
+func (s *Storage) PurgeExpiredVerificationCodes(ctx context.Context, before time.Time) (int64, error) {
+	defer s.lock(ctx)()
+
+	var n int64
+	for key, code := range s.state.codes {
+		if code.ExpiresAt.Before(before) {
+			delete(s.state.codes, key)
+			n++
+		}
+	}
+
+	return n, nil
+}
+
+// usernameHeld сообщает, удерживается ли хэндл со скелетом skeleton историей другого пользователя
+func (s *Storage) usernameHeld(userID string, skeleton string, now time.Time) bool {
+	for _, h := range s.state.history {
+		if h.skeleton == skeleton && h.HeldUntil.After(now) && h.UserID != userID {
+			return true
+		}
+	}
+	return false
+}
+
+// UsernameAvailable проверяет, что хэндл со скелетом skeleton не занят и не удерживается
+// историей другого пользователя. Собственные хэндлы userID считаются свободными.
+func (s *Storage) UsernameAvailable(ctx context.Context, userID string, skeleton string, now time.Time) (bool, error) {
+	defer s.lock(ctx)()
+
+	for id, u := range s.state.users {
+		if u.usernameSkeleton == skeleton && id != userID {
+			return false, nil
+		}
+	}
+
+	return !s.usernameHeld(userID, skeleton, now), nil
+}
+
+// ChangeUsername устанавливает хэндл пользователю. Сменить хэндл можно не чаще раза в cooldown;
+// прежний хэндл записывается в историю и удерживается за пользователем в течение hold.
+func (s *Storage) ChangeUsername(ctx context.Context, userID string, username string, skeleton string, now time.Time, cooldown time.Duration, hold time.Duration) error {
+	defer s.lock(ctx)()
+
+	u, ok := s.state.users[userID]
+	if !ok {
+		return storage.ErrUserNotFound
+	}
+
+	if u.Username == username {
+		return nil
+	}
+
+	// первый выбор хэндла не ограничен
+	if !u.UsernameChangedAt.IsZero() && now.Before(u.UsernameChangedAt.Add(cooldown)) {
+		return storage.ErrUsernameChangeTooSoon
+	}
+
+	if s.usernameHeld(userID, skeleton, now) {
+		return storage.ErrUsernameTaken
+	}
+
+	for id, other := range s.state.users {
+		if id != userID && (other.Username == username || other.usernameSkeleton == skeleton) {
+			return storage.ErrUsernameTaken
+		}
+	}
+
+	if u.Username != "" {
+		s.state.history = append(s.state.history, historyRecord{
+			UsernameChange: models.UsernameChange{
+				UserID:    userID,
+				Username:  u.Username,
+				ChangedAt: now,
+				HeldUntil: now.Add(hold),
+			},
+			skeleton: u.usernameSkeleton,
+		})
+	}
+
+	u.Username = username
+	u.usernameSkeleton = skeleton
+	u.UsernameChangedAt = now
+	s.state.users[userID] = u
+
+	return nil
+}
+
+// UsernameHistory возвращает прежние хэндлы пользователя, последние - первыми
+func (s *Storage) UsernameHistory(ctx context.Context, userID string) ([]models.UsernameChange, error) {
+	defer s.lock(ctx)()
+
+	var history []models.UsernameChange
+	for _, h := range s.state.history {
+		if h.UserID == userID {
+			history = append(history, h.UsernameChange)
+		}
+	}
+
+	sort.SliceStable(history, func(i, j int) bool { return history[i].ChangedAt.After(history[j].ChangedAt) })
+
+	return history, nil
+}
+
+// SetEmailStatus записывает доставляемость адреса emailCanonical и возвращает число изменённых пользователей.
+// Если userID не пуст, меняется только этот пользователь и только пока адрес у него прежний.
+// Отчёт старше уже записанного не применяется, а complained не понижается до bounced.
+func (s *Storage) SetEmailStatus(ctx context.Context, userID string, emailCanonical string, status models.EmailStatus, reason string, at time.Time) (int64, error) {
+	defer s.lock(ctx)()
+
+	var n int64
+	for id, u := range s.state.users {
+		if u.EmailCanonical == "" || u.EmailCanonical != emailCanonical {
+			continue
+		}
+		if userID != "" && id != userID {
+			continue
+		}
+		if !u.emailStatusAt.IsZero() && u.emailStatusAt.After(at) {
+			continue
+		}
+		if u.EmailStatus == models.EmailStatusComplained && status == models.EmailStatusBounced {
+			continue
+		}
+
+		u.EmailStatus = status
+		u.EmailStatusReason = reason
+		u.emailStatusAt = at
+		s.state.users[id] = u
+		n++
+	}
+
+	return n, nil
+}
+
+// ResetEmailStatus снова разрешает отправку писем пользователю
+func (s *Storage) ResetEmailStatus(ctx context.Context, userID string) error {
+	defer s.lock(ctx)()
+
+	u, ok := s.state.users[userID]
+	if !ok {
+		return storage.ErrUserNotFound
+	}
+
+	u.EmailStatus = models.EmailStatusOK
+	u.EmailStatusReason = ""
+	u.emailStatusAt = time.Time{}
+	s.state.users[userID] = u
+
+	return nil
+}
@@ -4,11 +4,9 @@ import (
 	"bytes"
 	"context"
 	"fmt"
-	"image"
-	_ "image/jpeg"
-	_ "image/png"
 
-	"github.com/disintegration/imaging"
+	"github.com/DenisBochko/yandex_SSO/lib/avatar"
+
 	"github.com/minio/minio-go/v7"
 )
 
@@ -27,32 +25,14 @@ func New(minioClient *minio.Client, bucketName string) *MinIoStorage {
 func (m *MinIoStorage) UploadPhoto(ctx context.Context, id string, photo []byte, contentType string, fileName string) (string, error) {
 	objectName := fmt.Sprintf("%s_%s", id, fileName)
 
-	// Декодируем изображение из []byte
-	img, _, err := image.Decode(bytes.NewReader(photo))
-	if err != nil {
-		return "", fmt.Errorf("failed to decode image: %w", err)
-	}
-
 	// Сжимаем изображение до 512x512
-	resizedImg := imaging.Fill(img, 512, 512, imaging.Center, imaging.Lanczos)
-
-	// Кодируем обратно в JPEG (можно PNG — зависит от contentType)
-	var buf bytes.Buffer
-	switch contentType {
-	case "image/png":
-		err = imaging.Encode(&buf, resizedImg, imaging.PNG)
-	default:
-		// по умолчанию JPEG
-		contentType = "image/jpeg"
-		err = imaging.Encode(&buf, resizedImg, imaging.JPEG)
-	}
-
+	resized, contentType, err := avatar.Prepare(photo, contentType)
 	if err != nil {
-		return "", fmt.Errorf("failed to encode resized image: %w", err)
+		return "", err
 	}
 
 	// Загружаем сжатое изображение в MinIO
-	_, err = m.minioClient.PutObject(ctx, m.bucketName, objectName, &buf, int64(buf.Len()),
+	_, err = m.minioClient.PutObject(ctx, m.bucketName, objectName, bytes.NewReader(resized), int64(len(resized)),
 		minio.PutObjectOptions{ContentType: contentType},
 	)
 
@@ -0,0 +1,41 @@
+package miniostorage
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/DenisBochko/yandex_SSO/internal/services/users"
+	"github.com/DenisBochko/yandex_SSO/internal/storage/storagetest"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/stretchr/testify/require"
+)
+
+// Набор тестов storagetest запускается на настоящем minIO, только если задан SSO_TEST_MINIO_ENDPOINT
+// (host:port) и ключи SSO_TEST_MINIO_USER и SSO_TEST_MINIO_PASS. Фото загружаются в бакет sso-test.
+func TestObjects(t *testing.T) {
+	endpoint := os.Getenv("SSO_TEST_MINIO_ENDPOINT")
+	if endpoint == "" {
+		t.Skip("SSO_TEST_MINIO_ENDPOINT is not set")
+	}
+
+	client, err := minio.New(endpoint, &minio.Options{
+		Creds: credentials.NewStaticV4(os.Getenv("SSO_TEST_MINIO_USER"), os.Getenv("SSO_TEST_MINIO_PASS"), ""),
+	})
+	require.NoError(t, err)
+
+	const bucket = "sso-test"
+
+	ctx := context.Background()
+	exists, err := client.BucketExists(ctx, bucket)
+	require.NoError(t, err)
+	if !exists {
+		require.NoError(t, client.MakeBucket(ctx, bucket, minio.MakeBucketOptions{}))
+	}
+
+	storagetest.RunObjects(t, func(t *testing.T) users.MinIoStorage {
+		return New(client, bucket)
+	})
+}
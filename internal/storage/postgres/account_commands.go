@@ -0,0 +1,47 @@
+package postgresql
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/DenisBochko/yandex_SSO/internal/domain/models"
+)
+
+// SaveAccountCommandResult записывает итог команды. Возвращает false, если команда
+// с таким id уже записана: тогда её повтор выполнять не нужно. Внутри InTx
+// конкурентная вставка того же id ждёт завершения первой транзакции.
+func (s *Storage) SaveAccountCommandResult(ctx context.Context, result models.AccountCommandResult) (bool, error) {
+	tag, err := s.conn(ctx).Exec(ctx, `
+        INSERT INTO account_commands (id, command, user_id, requested_by, status, error, changed, created_at)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+        ON CONFLICT (id) DO NOTHING
+    `, result.CommandID, result.Command, result.UserID, result.RequestedBy, result.Status, result.Error, result.Changed, result.CreatedAt)
+	if err != nil {
+		return false, fmt.Errorf("failed to save account command result: %w", err)
+	}
+
+	return tag.RowsAffected() == 1, nil
+}
+
+// AccountCommandProcessed проверяет, выполнялась ли уже команда с этим id
+func (s *Storage) AccountCommandProcessed(ctx context.Context, id string) (bool, error) {
+	var exists bool
+	err := s.conn(ctx).QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM account_commands WHERE id = $1)", id).Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("failed to check account command: %w", err)
+	}
+
+	return exists, nil
+}
+
+// PurgeAccountCommands удаляет записи о командах старше before. После этого
+// повтор команды с тем же id будет выполнен заново.
+func (s *Storage) PurgeAccountCommands(ctx context.Context, before time.Time) (int64, error) {
+	tag, err := s.conn(ctx).Exec(ctx, "DELETE FROM account_commands WHERE created_at < $1", before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge account commands: %w", err)
+	}
+
+	return tag.RowsAffected(), nil
+}
@@ -0,0 +1,118 @@
+package postgresql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/DenisBochko/yandex_SSO/internal/domain/models"
+	"github.com/DenisBochko/yandex_SSO/internal/storage"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// TouchKnownDevice отмечает вход с устройства и сообщает, было ли устройство незнакомым.
+// knownBefore - сколько других устройств пользователя уже было известно.
+func (s *Storage) TouchKnownDevice(ctx context.Context, device models.KnownDevice) (isNew bool, knownBefore int, err error) {
+	err = s.conn(ctx).QueryRow(ctx, `
+        INSERT INTO known_devices(user_id, fingerprint, user_agent, ip, first_seen_at, last_seen_at)
+        VALUES($1, $2, $3, $4, $5, $5)
+        ON CONFLICT (user_id, fingerprint) DO UPDATE
+            SET user_agent = EXCLUDED.user_agent, ip = EXCLUDED.ip, last_seen_at = EXCLUDED.last_seen_at
+        RETURNING (xmax = 0)
+    `, device.UserID, device.Fingerprint, device.UserAgent, device.IP, device.LastSeenAt).Scan(&isNew)
+	if err != nil {
+		return false, 0, fmt.Errorf("failed to save known device: %w", err)
+	}
+
+	if !isNew {
+		return false, 0, nil
+	}
+
+	err = s.conn(ctx).QueryRow(ctx, "SELECT count(*) FROM known_devices WHERE user_id = $1 AND fingerprint <> $2",
+		device.UserID, device.Fingerprint).Scan(&knownBefore)
+	if err != nil {
+		return true, 0, fmt.Errorf("failed to count known devices: %w", err)
+	}
+
+	return true, knownBefore, nil
+}
+
+// CreateSessionRevokeToken сохраняет токен ссылки "это был не я" для входа с устройства fingerprint
+func (s *Storage) CreateSessionRevokeToken(ctx context.Context, userID string, fingerprint string, token string, expiresAt time.Time) error {
+	_, err := s.conn(ctx).Exec(ctx, "INSERT INTO session_revoke_tokens(token, user_id, fingerprint, expires_at) VALUES($1, $2, $3, $4)",
+		token, userID, fingerprint, expiresAt)
+	if err != nil {
+		return fmt.Errorf("failed to create session revoke token: %w", err)
+	}
+
+	return nil
+}
+
+// ConsumeSessionRevokeToken удаляет токен "это был не я" и устройство, с которого был вход,
+// и возвращает id пользователя. Остальные такие токены пользователя тоже удаляются:
+// сессии завершаются все сразу, повторные нажатия не нужны.
+func (s *Storage) ConsumeSessionRevokeToken(ctx context.Context, token string) (string, error) {
+	var userID, fingerprint string
+	var expiresAt time.Time
+
+	tx, err := s.conn(ctx).Begin(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	err = tx.QueryRow(ctx, "DELETE FROM session_revoke_tokens WHERE token = $1 RETURNING user_id, fingerprint, expires_at", token).
+		Scan(&userID, &fingerprint, &expiresAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", storage.ErrTokenNotFound
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to get session revoke token: %w", err)
+	}
+
+	if time.Now().UTC().After(expiresAt) {
+		if err := tx.Commit(ctx); err != nil {
+			return "", fmt.Errorf("failed to commit transaction: %w", err)
+		}
+		return "", storage.ErrTokenExpired
+	}
+
+	if _, err := tx.Exec(ctx, "DELETE FROM session_revoke_tokens WHERE user_id = $1", userID); err != nil {
+		return "", fmt.Errorf("failed to delete session revoke tokens: %w", err)
+	}
+
+	if _, err := tx.Exec(ctx, "DELETE FROM known_devices WHERE user_id = $1 AND fingerprint = $2", userID, fingerprint); err != nil {
+		return "", fmt.Errorf("failed to forget device: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return "", fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return userID, nil
+}
+
+// PurgeExpiredSessionRevokeTokens удаляет токены "это был не я", истёкшие до before
+func (s *Storage) PurgeExpiredSessionRevokeTokens(ctx context.Context, before time.Time) (int64, error) {
+	tag, err := s.conn(ctx).Exec(ctx, "DELETE FROM session_revoke_tokens WHERE expires_at < $1", before.UTC())
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge session revoke tokens: %w", err)
+	}
+
+	return tag.RowsAffected(), nil
+}
+
+// IsKnownDevice сообщает, входил ли пользователь раньше с устройства fingerprint
+func (s *Storage) IsKnownDevice(ctx context.Context, userID string, fingerprint string) (bool, error) {
+	var known bool
+
+	err := s.conn(ctx).QueryRow(ctx, "SELECT EXISTS (SELECT 1 FROM known_devices WHERE user_id = $1 AND fingerprint = $2)",
+		userID, fingerprint).Scan(&known)
+	if err != nil {
+		return false, fmt.Errorf("failed to check known device: %w", err)
+	}
+
+	return known, nil
+}
@@ -0,0 +1,52 @@
+package postgresql
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/DenisBochko/yandex_SSO/internal/domain/models"
+	"github.com/DenisBochko/yandex_SSO/internal/storage"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// SetEmailStatus записывает доставляемость адреса emailCanonical и возвращает число изменённых пользователей.
+// Если userID не пуст, меняется только этот пользователь и только пока адрес у него прежний.
+// Отчёт старше уже записанного не применяется, а complained не понижается до bounced.
+func (s *Storage) SetEmailStatus(ctx context.Context, userID string, emailCanonical string, status models.EmailStatus, reason string, at time.Time) (int64, error) {
+	tag, err := s.conn(ctx).Exec(ctx, `
+        UPDATE users SET email_status = $3, email_status_reason = $4, email_status_at = $5
+        WHERE email_canonical = $2
+          AND ($1 = '' OR id::text = $1)
+          AND (email_status_at IS NULL OR email_status_at <= $5)
+          AND NOT (email_status = 'complained' AND $3 = 'bounced')
+    `, userID, emailCanonical, status, reason, at)
+	if err != nil {
+		return 0, fmt.Errorf("failed to set email status: %w", err)
+	}
+
+	return tag.RowsAffected(), nil
+}
+
+// ResetEmailStatus снова разрешает отправку писем пользователю
+func (s *Storage) ResetEmailStatus(ctx context.Context, userID string) error {
+	tag, err := s.conn(ctx).Exec(ctx, `
+        UPDATE users SET email_status = 'ok', email_status_reason = '', email_status_at = NULL
+        WHERE id = $1
+    `, userID)
+
+	if pgErr, ok := err.(*pgconn.PgError); ok && pgErr.Code == "22P02" {
+		return storage.ErrUserNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to reset email status: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return storage.ErrUserNotFound
+	}
+
+	s.markWritten(ctx, userID)
+
+	return nil
+}
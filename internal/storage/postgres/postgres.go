@@ -2,7 +2,6 @@ package postgresql
 
 import (
 	"context"
-	"database/sql"
 	"errors"
 	"fmt"
 	"time"
@@ -16,6 +15,56 @@ import (
 
 type Storage struct {
 	db *pgxpool.Pool
+
+	// replicas, marks и written заданы только в NewWithReplicas
+	replicas Replicas
+	marks    WriteMarks
+	written  *recentWrites
+}
+
+// userColumns - список колонок, который читает scanUser.
+// email и pass_hash пусты у пользователей, зарегистрированных по телефону.
+const userColumns = `id, name, COALESCE(email, ''), COALESCE(pass_hash, ''::bytea), verify, avatar,
+	COALESCE(email_canonical, ''), COALESCE(username, ''), username_changed_at,
+	COALESCE(phone, ''), phone_verified, status, status_reason, suspended_until,
+	email_status, email_status_reason`
+
+// scanUser читает пользователя из строки, выбранной по userColumns
+func scanUser(row pgx.Row) (models.User, error) {
+	var user models.User
+	var suspendedUntil, usernameChangedAt *time.Time
+
+	err := row.Scan(
+		&user.ID,
+		&user.Name,
+		&user.Email,
+		&user.PassHash,
+		&user.Verified,
+		&user.Avatar,
+		&user.EmailCanonical,
+		&user.Username,
+		&usernameChangedAt,
+		&user.Phone,
+		&user.PhoneVerified,
+		&user.Status,
+		&user.StatusReason,
+		&suspendedUntil,
+		&user.EmailStatus,
+		&user.EmailStatusReason,
+	)
+	if err != nil {
+		return models.User{}, err
+	}
+
+	if suspendedUntil != nil {
+		user.SuspendedUntil = *suspendedUntil
+	}
+
+	if usernameChangedAt != nil {
+		user.UsernameChangedAt = *usernameChangedAt
+	}
+
+	return user, nil
 }
 
 // Конструктор Storage
@@ -23,11 +72,12 @@ func New(db *pgxpool.Pool) *Storage {
 	return &Storage{db: db}
 }
 
-// SaveUser сохраняет пользователя в БД
-func (s *Storage) SaveUser(ctx context.Context, name string, email string, passHash []byte) (string, error) {
+// SaveUser сохраняет пользователя в БД. Уникальность проверяется по каноническому email.
+func (s *Storage) SaveUser(ctx context.Context, name string, email string, emailCanonical string, passHash []byte) (string, error) {
 	var id string
 
-	err := s.db.QueryRow(ctx, "INSERT INTO users(name, email, pass_hash) VALUES($1, $2, $3) RETURNING id", name, email, passHash).Scan(&id)
+	err := s.conn(ctx).QueryRow(ctx, "INSERT INTO users(name, email, email_canonical, pass_hash) VALUES($1, $2, $3, $4) RETURNING id",
+		name, email, emailCanonical, passHash).Scan(&id)
 	if pgErr, ok := err.(*pgconn.PgError); ok {
 		switch pgErr.Code {
 		case "23505": // Нарушение уникальности
@@ -37,22 +87,93 @@ func (s *Storage) SaveUser(ctx context.Context, name string, email string, passH
 		}
 	}
 
+	s.markWritten(ctx, id)
+
 	return id, nil
 }
 
-// User возвращает пользователя по email
-func (s *Storage) User(ctx context.Context, email string) (models.User, error) {
-	var user models.User
+// SavePhoneUser сохраняет пользователя, зарегистрированного по номеру телефона, без email и пароля
+func (s *Storage) SavePhoneUser(ctx context.Context, name string, phone string) (string, error) {
+	var id string
 
-	err := s.db.QueryRow(ctx, "SELECT id, name, email, pass_hash, verify, avatar FROM users WHERE email = $1",
-		email).Scan(
-		&user.ID,
-		&user.Name,
-		&user.Email,
-		&user.PassHash,
-		&user.Verified,
-		&user.Avatar,
-	)
+	err := s.conn(ctx).QueryRow(ctx, "INSERT INTO users(name, phone) VALUES($1, $2) RETURNING id", name, phone).Scan(&id)
+	if pgErr, ok := err.(*pgconn.PgError); ok {
+		switch pgErr.Code {
+		case "23505": // Нарушение уникальности
+			return "", storage.ErrUserExists
+		default:
+			return "", fmt.Errorf("failed to save user: %w", err)
+		}
+	}
+
+	if err != nil {
+		return "", fmt.Errorf("failed to save user: %w", err)
+	}
+
+	s.markWritten(ctx, id)
+
+	return id, nil
+}
+
+// UserByPhone возвращает пользователя по номеру телефона в формате E.164
+func (s *Storage) UserByPhone(ctx context.Context, phone string) (models.User, error) {
+	user, err := scanUser(s.conn(ctx).QueryRow(ctx, "SELECT "+userColumns+" FROM users WHERE phone = $1", phone))
+
+	if errors.Is(err, pgx.ErrNoRows) {
+		return models.User{}, storage.ErrUserNotFound
+	}
+
+	if err != nil {
+		return models.User{}, fmt.Errorf("failed to get user: %w", err)
+	}
+
+	return user, nil
+}
+
+// SetUserPhone привязывает номер к пользователю. Новый номер считается неподтверждённым.
+func (s *Storage) SetUserPhone(ctx context.Context, id string, phone string) (bool, error) {
+	tag, err := s.conn(ctx).Exec(ctx, "UPDATE users SET phone = $1, phone_verified = false WHERE id = $2", phone, id)
+
+	if pgErr, ok := err.(*pgconn.PgError); ok {
+		switch pgErr.Code {
+		case "23505": // номер уже привязан к другому пользователю
+			return false, storage.ErrPhoneExists
+		case "22P02": // некорректный uuid
+			return false, storage.ErrUserNotFound
+		default:
+			return false, fmt.Errorf("failed to set user phone: %w", err)
+		}
+	}
+
+	if err != nil {
+		return false, fmt.Errorf("failed to set user phone: %w", err)
+	}
+
+	if tag.RowsAffected() == 0 {
+		return false, storage.ErrUserNotFound
+	}
+
+	s.markWritten(ctx, id)
+
+	return true, nil
+}
+
+// User возвращает пользователя по каноническому email или по самому адресу без учёта регистра.
+// Второе нужно пользователям, чьи адреса пересеклись при миграции на email_canonical (колонка пуста),
+// и тем, чей email_canonical посчитан по прежним правилам (см. cmd/emailreport -fix).
+// Если подходят несколько пользователей, выбирается точное совпадение адреса, затем канонического адреса.
+func (s *Storage) User(ctx context.Context, email string, emailCanonical string) (models.User, error) {
+	user, err := scanUser(s.conn(ctx).QueryRow(ctx, `
+        SELECT `+userColumns+` FROM users
+        WHERE email_canonical = $1 OR lower(email) = lower($2)
+        ORDER BY COALESCE(email = $2, false) DESC, COALESCE(email_canonical = $1, false) DESC
+        LIMIT 1
+    `, emailCanonical, email))
+
+	// пользователь не найден
+	if errors.Is(err, pgx.ErrNoRows) {
+		return models.User{}, storage.ErrUserNotFound
+	}
 
 	if pgErr, ok := err.(*pgconn.PgError); ok {
 		switch pgErr.Code {
@@ -70,7 +191,7 @@ func (s *Storage) User(ctx context.Context, email string) (models.User, error) {
 func (s *Storage) Users(ctx context.Context, ids []string) ([]models.User, error) {
 	var users []models.User
 
-	rows, err := s.db.Query(ctx, "SELECT id, name, email, pass_hash, verify, avatar FROM users WHERE id = ANY($1)", ids)
+	rows, err := s.reader(ctx, ids...).Query(ctx, "SELECT "+userColumns+" FROM users WHERE id = ANY($1)", ids)
 	if pgErr, ok := err.(*pgconn.PgError); ok {
 		switch pgErr.Code {
 		case "22P02": // такого id не существует
@@ -83,8 +204,8 @@ func (s *Storage) Users(ctx context.Context, ids []string) ([]models.User, error
 	defer rows.Close()
 
 	for rows.Next() {
-		var user models.User
-		if err := rows.Scan(&user.ID, &user.Name, &user.Email, &user.PassHash, &user.Verified, &user.Avatar); err != nil {
+		user, err := scanUser(rows)
+		if err != nil {
 			return nil, fmt.Errorf("failed to scan user: %w", err)
 		}
 		users = append(users, user)
@@ -103,19 +224,7 @@ func (s *Storage) Users(ctx context.Context, ids []string) ([]models.User, error
 }
 
 func (s *Storage) UserById(ctx context.Context, id string) (models.User, error) {
-	var user models.User
-
-	err := s.db.QueryRow(ctx, `
-        SELECT id, name, email, pass_hash, verify, avatar
-        FROM users WHERE id = $1
-    `, id).Scan(
-		&user.ID,
-		&user.Name,
-		&user.Email,
-		&user.PassHash,
-		&user.Verified,
-		&user.Avatar,
-	)
+	user, err := scanUser(s.reader(ctx, id).QueryRow(ctx, "SELECT "+userColumns+" FROM users WHERE id = $1", id))
 
 	// пользователь не найден
 	if errors.Is(err, pgx.ErrNoRows) {
@@ -139,18 +248,27 @@ func (s *Storage) UserById(ctx context.Context, id string) (models.User, error)
 	return user, nil
 }
 
-// Обновляет данные пользователя по id
+// Обновляет имя, email и аватар пользователя по id. Подтверждение email не меняется
 func (s *Storage) UpdateUser(ctx context.Context, user models.User) (bool, error) {
-	_, err := s.db.Exec(ctx, "UPDATE users SET name = $1, email = $2, verify = $3, avatar = $4 WHERE id = $5",
+	_, err := s.conn(ctx).Exec(ctx, `
+        UPDATE users SET name = $1, email = NULLIF($2, ''), email_canonical = NULLIF($3, ''), avatar = $4,
+            -- отчёты о доставке относятся к прежнему адресу
+            email_status = CASE WHEN email IS DISTINCT FROM NULLIF($2, '') THEN 'ok' ELSE email_status END,
+            email_status_reason = CASE WHEN email IS DISTINCT FROM NULLIF($2, '') THEN '' ELSE email_status_reason END,
+            email_status_at = CASE WHEN email IS DISTINCT FROM NULLIF($2, '') THEN NULL ELSE email_status_at END
+        WHERE id = $5
+    `,
 		user.Name,
 		user.Email,
-		user.Verified,
+		user.EmailCanonical,
 		user.Avatar,
 		user.ID,
 	)
 
 	if pgErr, ok := err.(*pgconn.PgError); ok {
 		switch pgErr.Code {
+		case "23505": // такой email уже занят
+			return false, storage.ErrUserExists
 		case "22P02": // такого id не существует
 			return false, storage.ErrUserNotFound
 		default:
@@ -158,11 +276,49 @@ func (s *Storage) UpdateUser(ctx context.Context, user models.User) (bool, error
 		}
 	}
 
+	s.markWritten(ctx, user.ID)
+
+	return true, nil
+}
+
+// SetUserStatus меняет статус учётной записи. Нулевой until означает бессрочную блокировку.
+func (s *Storage) SetUserStatus(ctx context.Context, id string, status models.UserStatus, reason string, until time.Time) (bool, error) {
+	var suspendedUntil *time.Time
+	if !until.IsZero() {
+		suspendedUntil = &until
+	}
+
+	tag, err := s.conn(ctx).Exec(ctx, "UPDATE users SET status = $1, status_reason = $2, suspended_until = $3 WHERE id = $4",
+		status,
+		reason,
+		suspendedUntil,
+		id,
+	)
+
+	if pgErr, ok := err.(*pgconn.PgError); ok {
+		switch pgErr.Code {
+		case "22P02": // такого id не существует
+			return false, storage.ErrUserNotFound
+		default:
+			return false, fmt.Errorf("failed to set user status: %w", err)
+		}
+	}
+
+	if err != nil {
+		return false, fmt.Errorf("failed to set user status: %w", err)
+	}
+
+	if tag.RowsAffected() == 0 {
+		return false, storage.ErrUserNotFound
+	}
+
+	s.markWritten(ctx, id)
+
 	return true, nil
 }
 
 func (s *Storage) DeleteUser(ctx context.Context, id string) (bool, error) {
-	_, err := s.db.Exec(ctx, "DELETE FROM users WHERE id = $1", id)
+	_, err := s.conn(ctx).Exec(ctx, "DELETE FROM users WHERE id = $1", id)
 
 	if pgErr, ok := err.(*pgconn.PgError); ok {
 		switch pgErr.Code {
@@ -173,11 +329,26 @@ func (s *Storage) DeleteUser(ctx context.Context, id string) (bool, error) {
 		}
 	}
 
+	s.markWritten(ctx, id)
+
 	return true, nil
 }
 
+// CreateVerificationToken сохраняет новый верификационный токен пользователя.
+// Все ранее выданные токены пользователя удаляются в той же транзакции,
+// поэтому после повторной отправки письма работает только последняя ссылка.
 func (s *Storage) CreateVerificationToken(ctx context.Context, userID string, token string, expiresAt time.Time) (bool, error) {
-	_, err := s.db.Exec(ctx, "INSERT INTO verification_tokens(user_id, token, expires_at) VALUES($1, $2, $3)", userID, token, expiresAt)
+	tx, err := s.conn(ctx).Begin(ctx)
+	if err != nil {
+		return false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, "DELETE FROM verification_tokens WHERE user_id = $1", userID); err != nil {
+		return false, fmt.Errorf("failed to invalidate verification tokens: %w", err)
+	}
+
+	_, err = tx.Exec(ctx, "INSERT INTO verification_tokens(user_id, token, expires_at) VALUES($1, $2, $3)", userID, token, expiresAt)
 	if pgErr, ok := err.(*pgconn.PgError); ok {
 		switch pgErr.Code {
 		case "23505": // Нарушение уникальности
@@ -187,38 +358,434 @@ func (s *Storage) CreateVerificationToken(ctx context.Context, userID string, to
 		}
 	}
 
+	if err != nil {
+		return false, fmt.Errorf("failed to create verification token: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return false, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
 	return true, nil
 }
 
-func (s *Storage) VerifyToken(ctx context.Context, token string) (bool, error) {
+// VerifyToken погашает токен и подтверждает пользователя в одной транзакции.
+// Возвращает id подтверждённого пользователя.
+// Токен удаляется при первом использовании, повторный запрос вернёт ErrTokenNotFound.
+func (s *Storage) VerifyToken(ctx context.Context, token string) (string, error) {
 	var userID string
 	var expiresAt time.Time
 
-	err := s.db.QueryRow(ctx, "SELECT user_id, expires_at FROM verification_tokens WHERE token = $1", token).Scan(&userID, &expiresAt)
+	tx, err := s.conn(ctx).Begin(ctx)
+	if err != nil {
+		return "", fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	err = tx.QueryRow(ctx, "DELETE FROM verification_tokens WHERE token = $1 RETURNING user_id, expires_at", token).Scan(&userID, &expiresAt)
 	if err != nil {
-		if err == sql.ErrNoRows {
-			return false, storage.ErrTokenNotFound
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", storage.ErrTokenNotFound
 		}
 		if pgErr, ok := err.(*pgconn.PgError); ok {
-			return false, fmt.Errorf("postgres error on token lookup: %s (%s)", pgErr.Message, pgErr.Code)
+			return "", fmt.Errorf("postgres error on token lookup: %s (%s)", pgErr.Message, pgErr.Code)
 		}
-		return false, fmt.Errorf("failed to get verification token: %w", err)
+		return "", fmt.Errorf("failed to get verification token: %w", err)
 	}
 
+	// просроченный токен тоже удаляем, он больше никогда не пригодится
 	if time.Now().UTC().After(expiresAt) {
-		return false, storage.ErrTokenExpired
+		if err := tx.Commit(ctx); err != nil {
+			return "", fmt.Errorf("failed to commit transaction: %w", err)
+		}
+		return "", storage.ErrTokenExpired
+	}
+
+	// числовой код для этого email тоже больше не нужен
+	if _, err := tx.Exec(ctx, "DELETE FROM verification_codes WHERE user_id = $1 AND channel = $2", userID, models.CodeChannelEmail); err != nil {
+		return "", fmt.Errorf("failed to delete verification code: %w", err)
 	}
 
-	_, err = s.db.Exec(ctx, "UPDATE users SET verify = true WHERE id = $1", userID)
+	_, err = tx.Exec(ctx, "UPDATE users SET verify = true WHERE id = $1", userID)
 	if err != nil {
 		if pgErr, ok := err.(*pgconn.PgError); ok {
 			if pgErr.Code == "22P02" {
-				return false, storage.ErrUserNotFound
+				return "", storage.ErrUserNotFound
 			}
-			return false, fmt.Errorf("postgres error on user update: %s (%s)", pgErr.Message, pgErr.Code)
+			return "", fmt.Errorf("postgres error on user update: %s (%s)", pgErr.Message, pgErr.Code)
+		}
+		return "", fmt.Errorf("failed to update user: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return "", fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	s.markWritten(ctx, userID)
+
+	return userID, nil
+}
+
+// PurgeExpiredVerificationTokens удаляет токены, истёкшие до before, и возвращает их количество
+func (s *Storage) PurgeExpiredVerificationTokens(ctx context.Context, before time.Time) (int64, error) {
+	tag, err := s.conn(ctx).Exec(ctx, "DELETE FROM verification_tokens WHERE expires_at < $1", before.UTC())
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge verification tokens: %w", err)
+	}
+
+	return tag.RowsAffected(), nil
+}
+
+// CreateVerificationCode сохраняет хэш нового кода пользователя для канала channel.
+// Предыдущий код этого канала перезаписывается. Счётчики попыток и выпусков сбрасываются
+// только с началом нового окна limits.Window; если код запрошен раньше limits.ResendCooldown
+// или в окне уже выпущено limits.MaxIssues кодов, возвращает ErrTooManyCodes.
+func (s *Storage) CreateVerificationCode(ctx context.Context, userID string, channel models.CodeChannel, codeHash []byte, expiresAt time.Time, limits models.CodeLimits) (bool, error) {
+	now := time.Now().UTC()
+
+	var issues int
+	err := s.conn(ctx).QueryRow(ctx, `
+        INSERT INTO verification_codes AS c (user_id, channel, code_hash, attempts, expires_at, issued_at, window_started_at, issues)
+        VALUES($1, $2, $3, 0, $4, $5, $5, 1)
+        ON CONFLICT (user_id, channel) DO UPDATE SET
+            code_hash = EXCLUDED.code_hash,
+            expires_at = EXCLUDED.expires_at,
+            issued_at = EXCLUDED.issued_at,
+            attempts = CASE WHEN c.window_started_at <= $6 THEN 0 ELSE c.attempts END,
+            issues = CASE WHEN c.window_started_at <= $6 THEN 1 ELSE c.issues + 1 END,
+            window_started_at = CASE WHEN c.window_started_at <= $6 THEN EXCLUDED.window_started_at ELSE c.window_started_at END
+        WHERE c.issued_at <= $7 AND (c.window_started_at <= $6 OR $8 = 0 OR c.issues < $8)
+        RETURNING issues
+    `, userID, channel, codeHash, expiresAt, now, now.Add(-limits.Window), now.Add(-limits.ResendCooldown), limits.MaxIssues).Scan(&issues)
+
+	if errors.Is(err, pgx.ErrNoRows) { // код есть, а условие WHERE не выполнено
+		return false, storage.ErrTooManyCodes
+	}
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		switch pgErr.Code {
+		case "23503", "22P02": // пользователя нет или некорректный uuid
+			return false, storage.ErrUserNotFound
+		default:
+			return false, fmt.Errorf("failed to create verification code: %w", err)
+		}
+	}
+
+	if err != nil {
+		return false, fmt.Errorf("failed to create verification code: %w", err)
+	}
+
+	return true, nil
+}
+
+// VerificationCode возвращает действующий код пользователя для канала channel
+func (s *Storage) VerificationCode(ctx context.Context, userID string, channel models.CodeChannel) (models.VerificationCode, error) {
+	var code models.VerificationCode
+
+	err := s.conn(ctx).QueryRow(ctx, `
+        SELECT user_id, channel, code_hash, attempts, expires_at, issued_at, window_started_at, issues
+        FROM verification_codes WHERE user_id = $1 AND channel = $2
+    `, userID, channel).Scan(
+		&code.UserID,
+		&code.Channel,
+		&code.CodeHash,
+		&code.Attempts,
+		&code.ExpiresAt,
+		&code.IssuedAt,
+		&code.WindowStartedAt,
+		&code.Issues,
+	)
+
+	if errors.Is(err, pgx.ErrNoRows) {
+		return models.VerificationCode{}, storage.ErrTokenNotFound
+	}
+
+	if pgErr, ok := err.(*pgconn.PgError); ok {
+		switch pgErr.Code {
+		case "22P02": // некорректный uuid
+			return models.VerificationCode{}, storage.ErrTokenNotFound
+		default:
+			return models.VerificationCode{}, fmt.Errorf("failed to get verification code: %w", err)
+		}
+	}
+
+	if err != nil {
+		return models.VerificationCode{}, fmt.Errorf("failed to get verification code: %w", err)
+	}
+
+	return code, nil
+}
+
+// AddVerificationCodeAttempt атомарно расходует одну попытку ввода кода.
+// Если попытки закончились, возвращает ErrTooManyAttempts.
+func (s *Storage) AddVerificationCodeAttempt(ctx context.Context, userID string, channel models.CodeChannel, maxAttempts int) (int, error) {
+	var attempts int
+
+	err := s.conn(ctx).QueryRow(ctx, `
+        UPDATE verification_codes SET attempts = attempts + 1
+        WHERE user_id = $1 AND channel = $2 AND attempts < $3
+        RETURNING attempts
+    `, userID, channel, maxAttempts).Scan(&attempts)
+
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, storage.ErrTooManyAttempts
+	}
+
+	if err != nil {
+		return 0, fmt.Errorf("failed to count verification code attempt: %w", err)
+	}
+
+	return attempts, nil
+}
+
+// ConsumeVerificationCode погашает код и подтверждает канал в одной транзакции:
+// для email - адрес пользователя (неиспользованные ссылки-токены тоже удаляются),
+// для sms - номер телефона. Код второго фактора (login_challenge) ничего не подтверждает.
+func (s *Storage) ConsumeVerificationCode(ctx context.Context, userID string, channel models.CodeChannel) (bool, error) {
+	tx, err := s.conn(ctx).Begin(ctx)
+	if err != nil {
+		return false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	tag, err := tx.Exec(ctx, "DELETE FROM verification_codes WHERE user_id = $1 AND channel = $2", userID, channel)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete verification code: %w", err)
+	}
+
+	// код уже погашен параллельным запросом
+	if tag.RowsAffected() == 0 {
+		return false, storage.ErrTokenNotFound
+	}
+
+	switch channel {
+	case models.CodeChannelSMS:
+		if _, err := tx.Exec(ctx, "UPDATE users SET phone_verified = true WHERE id = $1", userID); err != nil {
+			return false, fmt.Errorf("failed to update user: %w", err)
+		}
+	case models.CodeChannelEmail:
+		if _, err := tx.Exec(ctx, "DELETE FROM verification_tokens WHERE user_id = $1", userID); err != nil {
+			return false, fmt.Errorf("failed to delete verification tokens: %w", err)
+		}
+
+		if _, err := tx.Exec(ctx, "UPDATE users SET verify = true WHERE id = $1", userID); err != nil {
+			return false, fmt.Errorf("failed to update user: %w", err)
 		}
-		return false, fmt.Errorf("failed to update user: %w", err)
 	}
 
+	if err := tx.Commit(ctx); err != nil {
+		return false, fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	s.markWritten(ctx, userID)
+
 	return true, nil
 }
+
+// PurgeExpiredVerificationCodes удаляет коды, истёкшие до before, и возвращает их количество
+func (s *Storage) PurgeExpiredVerificationCodes(ctx context.Context, before time.Time) (int64, error) {
+	tag, err := s.conn(ctx).Exec(ctx, "DELETE FROM verification_codes WHERE expires_at < $1", before.UTC())
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge verification codes: %w", err)
+	}
+
+	return tag.RowsAffected(), nil
+}
+
+// UserEmails возвращает id, email и email_canonical всех пользователей с email.
+// Используется отчётом о коллизиях адресов (cmd/emailreport).
+func (s *Storage) UserEmails(ctx context.Context) ([]models.User, error) {
+	rows, err := s.conn(ctx).Query(ctx, "SELECT id, email, COALESCE(email_canonical, '') FROM users WHERE email IS NOT NULL ORDER BY created_at")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user emails: %w", err)
+	}
+	defer rows.Close()
+
+	var users []models.User
+	for rows.Next() {
+		var user models.User
+		if err := rows.Scan(&user.ID, &user.Email, &user.EmailCanonical); err != nil {
+			return nil, fmt.Errorf("failed to scan user email: %w", err)
+		}
+		users = append(users, user)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate over user emails: %w", err)
+	}
+
+	return users, nil
+}
+
+// SetEmailCanonicals переписывает email_canonical пользователей: ключ - id, пустое значение - NULL.
+// Все изменения выполняются в одной транзакции; чтобы обмен значениями между пользователями
+// не нарушал уникальность, изменяемые строки сначала очищаются. Используется cmd/emailreport -fix.
+func (s *Storage) SetEmailCanonicals(ctx context.Context, canonicals map[string]string) (int64, error) {
+	if len(canonicals) == 0 {
+		return 0, nil
+	}
+
+	ids := make([]string, 0, len(canonicals))
+	for id := range canonicals {
+		ids = append(ids, id)
+	}
+
+	var updated int64
+	err := s.InTx(ctx, func(ctx context.Context) error {
+		if _, err := s.conn(ctx).Exec(ctx, "UPDATE users SET email_canonical = NULL WHERE id = ANY($1)", ids); err != nil {
+			return fmt.Errorf("failed to clear email_canonical: %w", err)
+		}
+
+		for id, canonical := range canonicals {
+			tag, err := s.conn(ctx).Exec(ctx, "UPDATE users SET email_canonical = NULLIF($2, '') WHERE id = $1", id, canonical)
+			if err != nil {
+				return fmt.Errorf("failed to set email_canonical of user %s: %w", id, err)
+			}
+			updated += tag.RowsAffected()
+		}
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return updated, nil
+}
+
+// UserByUsername возвращает пользователя по хэндлу в нижнем регистре
+func (s *Storage) UserByUsername(ctx context.Context, username string) (models.User, error) {
+	user, err := scanUser(s.conn(ctx).QueryRow(ctx, "SELECT "+userColumns+" FROM users WHERE username = $1", username))
+
+	if errors.Is(err, pgx.ErrNoRows) {
+		return models.User{}, storage.ErrUserNotFound
+	}
+
+	if err != nil {
+		return models.User{}, fmt.Errorf("failed to get user: %w", err)
+	}
+
+	return user, nil
+}
+
+// UsernameAvailable проверяет, что хэндл со скелетом skeleton не занят и не удерживается
+// историей другого пользователя. Собственные хэндлы userID считаются свободными.
+func (s *Storage) UsernameAvailable(ctx context.Context, userID string, skeleton string, now time.Time) (bool, error) {
+	var taken bool
+
+	err := s.conn(ctx).QueryRow(ctx, `
+        SELECT EXISTS (SELECT 1 FROM users WHERE username_skeleton = $1 AND id::text <> $2)
+            OR EXISTS (SELECT 1 FROM username_history WHERE username_skeleton = $1 AND held_until > $3 AND user_id::text <> $2)
+    `, skeleton, userID, now).Scan(&taken)
+	if err != nil {
+		return false, fmt.Errorf("failed to check username: %w", err)
+	}
+
+	return !taken, nil
+}
+
+// ChangeUsername устанавливает хэндл пользователю. Сменить хэндл можно не чаще раза в cooldown;
+// прежний хэндл записывается в историю и удерживается за пользователем в течение hold.
+func (s *Storage) ChangeUsername(ctx context.Context, userID string, username string, skeleton string, now time.Time, cooldown time.Duration, hold time.Duration) error {
+	tx, err := s.conn(ctx).Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var oldUsername, oldSkeleton string
+	var changedAt *time.Time
+
+	err = tx.QueryRow(ctx, `
+        SELECT COALESCE(username, ''), COALESCE(username_skeleton, ''), username_changed_at
+        FROM users WHERE id = $1 FOR UPDATE
+    `, userID).Scan(&oldUsername, &oldSkeleton, &changedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return storage.ErrUserNotFound
+	}
+	if pgErr, ok := err.(*pgconn.PgError); ok && pgErr.Code == "22P02" {
+		return storage.ErrUserNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get user: %w", err)
+	}
+
+	if oldUsername == username {
+		return nil
+	}
+
+	// первый выбор хэндла не ограничен
+	if changedAt != nil && now.Before(changedAt.Add(cooldown)) {
+		return storage.ErrUsernameChangeTooSoon
+	}
+
+	var held bool
+	err = tx.QueryRow(ctx, `
+        SELECT EXISTS (SELECT 1 FROM username_history WHERE username_skeleton = $1 AND held_until > $2 AND user_id <> $3)
+    `, skeleton, now, userID).Scan(&held)
+	if err != nil {
+		return fmt.Errorf("failed to check username history: %w", err)
+	}
+	if held {
+		return storage.ErrUsernameTaken
+	}
+
+	_, err = tx.Exec(ctx, `
+        UPDATE users SET username = $1, username_skeleton = $2, username_changed_at = $3 WHERE id = $4
+    `, username, skeleton, now, userID)
+	if pgErr, ok := err.(*pgconn.PgError); ok && pgErr.Code == "23505" {
+		return storage.ErrUsernameTaken
+	}
+	if err != nil {
+		return fmt.Errorf("failed to change username: %w", err)
+	}
+
+	if oldUsername != "" {
+		_, err = tx.Exec(ctx, `
+            INSERT INTO username_history(user_id, username, username_skeleton, changed_at, held_until)
+            VALUES($1, $2, $3, $4, $5)
+        `, userID, oldUsername, oldSkeleton, now, now.Add(hold))
+		if err != nil {
+			return fmt.Errorf("failed to save username history: %w", err)
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	s.markWritten(ctx, userID)
+
+	return nil
+}
+
+// UsernameHistory возвращает прежние хэндлы пользователя, последние - первыми
+func (s *Storage) UsernameHistory(ctx context.Context, userID string) ([]models.UsernameChange, error) {
+	rows, err := s.conn(ctx).Query(ctx, `
+        SELECT user_id, username, changed_at, held_until FROM username_history
+        WHERE user_id = $1 ORDER BY changed_at DESC
+    `, userID)
+	if pgErr, ok := err.(*pgconn.PgError); ok && pgErr.Code == "22P02" {
+		return nil, storage.ErrUserNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get username history: %w", err)
+	}
+	defer rows.Close()
+
+	var history []models.UsernameChange
+	for rows.Next() {
+		var change models.UsernameChange
+		if err := rows.Scan(&change.UserID, &change.Username, &change.ChangedAt, &change.HeldUntil); err != nil {
+			return nil, fmt.Errorf("failed to scan username change: %w", err)
+		}
+		history = append(history, change)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate over username history: %w", err)
+	}
+
+	return history, nil
+}
@@ -0,0 +1,156 @@
+package postgresql
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/DenisBochko/yandex_SSO/internal/storage"
+	"github.com/DenisBochko/yandex_SSO/pkg/metrics"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// writeMarkErrorsTotal - сбои при записи и чтении отметок в WriteMarks
+var writeMarkErrorsTotal = metrics.NewCounter("postgres_write_mark_errors_total")
+
+// Replicas выбирает пул для запросов только на чтение (pkg/postgres.Replicas)
+type Replicas interface {
+	Reader() *pgxpool.Pool
+}
+
+// WriteMarks - отметки о недавно изменённых пользователях, общие для всех экземпляров сервиса
+// (redisstorage.WriteMarks). Без них запрос, попавший на другой экземпляр, читал бы с реплики,
+// ещё не получившей изменение.
+type WriteMarks interface {
+	Mark(ctx context.Context, ids ...string) error
+	Marked(ctx context.Context, ids ...string) (bool, error)
+}
+
+// markTimeout ограничивает запись отметки после коммита: изменение уже сохранено,
+// поэтому отметка не должна прерываться вместе с запросом клиента
+const markTimeout = time.Second
+
+// NewWithReplicas создаёт Storage, который читает пользователей по контексту с storage.WithReplicaReads
+// из replicas. Пользователь, изменённый любым экземпляром сервиса, window читается из primary: реплика могла
+// ещё не получить изменение, а сам пользователь должен сразу видеть свои правки.
+// Отметки ставятся после коммита, а хранятся в marks и, чтобы не ходить в marks за своими же изменениями,
+// в памяти процесса.
+func NewWithReplicas(db *pgxpool.Pool, replicas Replicas, marks WriteMarks, window time.Duration) *Storage {
+	return &Storage{
+		db:       db,
+		replicas: replicas,
+		marks:    marks,
+		written:  &recentWrites{window: window, until: make(map[string]time.Time)},
+	}
+}
+
+// reader возвращает соединение для чтения пользователей ids: реплику, если ctx это разрешает
+// и никто из них не менялся недавно, иначе то же, что conn
+func (s *Storage) reader(ctx context.Context, ids ...string) conn {
+	if s.replicas == nil || !storage.ReplicaReadsAllowed(ctx) || s.written.has(ids...) {
+		return s.conn(ctx)
+	}
+	if _, ok := ctx.Value(txKey{}).(pgx.Tx); ok {
+		return s.conn(ctx)
+	}
+
+	// если отметки недоступны, безопаснее прочитать из primary
+	if marked, err := s.marks.Marked(ctx, ids...); err != nil || marked {
+		if err != nil {
+			writeMarkErrorsTotal.Add(1)
+		}
+		return s.conn(ctx)
+	}
+
+	return s.replicas.Reader()
+}
+
+// pendingWrites - пользователи, изменённые в незавершённой транзакции InTx
+type pendingWrites struct {
+	mu  sync.Mutex
+	ids []string
+}
+
+type pendingWritesKey struct{}
+
+// markWritten отмечает изменённых пользователей. Внутри InTx отметка откладывается до коммита:
+// иначе другой запрос мог бы успеть прочитать с реплики после истечения окна, а до коммита
+// отметка не нужна - изменения ещё никому не видны.
+func (s *Storage) markWritten(ctx context.Context, ids ...string) {
+	if s.written == nil {
+		return
+	}
+
+	if pending, ok := ctx.Value(pendingWritesKey{}).(*pendingWrites); ok {
+		pending.mu.Lock()
+		pending.ids = append(pending.ids, ids...)
+		pending.mu.Unlock()
+		return
+	}
+
+	s.written.add(ids...)
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), markTimeout)
+	defer cancel()
+
+	if err := s.marks.Mark(ctx, ids...); err != nil {
+		// запрос на другой экземпляр увидит изменение не позже чем через POSTGRES_REPLICA_MAX_LAG
+		writeMarkErrorsTotal.Add(1)
+	}
+}
+
+// recentWrites помнит пользователей, изменённых этим процессом за последние window, - локальная копия
+// отметок из WriteMarks. nil - реплик нет, запоминать нечего.
+type recentWrites struct {
+	window time.Duration
+
+	mu        sync.Mutex
+	until     map[string]time.Time
+	lastSweep time.Time
+}
+
+func (w *recentWrites) add(ids ...string) {
+	if w == nil {
+		return
+	}
+
+	now := time.Now()
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for _, id := range ids {
+		w.until[id] = now.Add(w.window)
+	}
+
+	// истёкшие записи удаляются не чаще раза в окно, чтобы карта не росла
+	if now.Sub(w.lastSweep) > w.window {
+		for id, until := range w.until {
+			if now.After(until) {
+				delete(w.until, id)
+			}
+		}
+		w.lastSweep = now
+	}
+}
+
+func (w *recentWrites) has(ids ...string) bool {
+	if w == nil {
+		return false
+	}
+
+	now := time.Now()
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for _, id := range ids {
+		if until, ok := w.until[id]; ok && now.Before(until) {
+			return true
+		}
+	}
+
+	return false
+}
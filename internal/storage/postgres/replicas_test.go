@@ -0,0 +1,112 @@
+package postgresql
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DenisBochko/yandex_SSO/internal/storage"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/stretchr/testify/require"
+)
+
+// marks - WriteMarks в памяти, err имитирует недоступный redis
+type marks struct {
+	ids map[string]bool
+	err error
+}
+
+func (m *marks) Mark(ctx context.Context, ids ...string) error {
+	for _, id := range ids {
+		m.ids[id] = true
+	}
+	return m.err
+}
+
+func (m *marks) Marked(ctx context.Context, ids ...string) (bool, error) {
+	for _, id := range ids {
+		if m.ids[id] {
+			return true, m.err
+		}
+	}
+	return false, m.err
+}
+
+type replicaPool struct {
+	pool *pgxpool.Pool
+}
+
+func (r replicaPool) Reader() *pgxpool.Pool {
+	return r.pool
+}
+
+// Пулы подключаются лениво, поэтому база для проверки маршрутизации не нужна
+func TestReaderRouting(t *testing.T) {
+	primary, err := pgxpool.New(context.Background(), "postgres://localhost:1/primary")
+	require.NoError(t, err)
+	t.Cleanup(primary.Close)
+	replica, err := pgxpool.New(context.Background(), "postgres://localhost:1/replica")
+	require.NoError(t, err)
+	t.Cleanup(replica.Close)
+
+	shared := &marks{ids: make(map[string]bool)}
+	s := NewWithReplicas(primary, replicaPool{replica}, shared, time.Minute)
+	ctx := storage.WithReplicaReads(context.Background())
+
+	// без явного разрешения чтение идёт в primary: результат может использоваться для записи
+	require.Equal(t, conn(primary), s.reader(context.Background(), "alice"))
+	require.Equal(t, conn(replica), s.reader(ctx, "alice"))
+
+	s.written.add("alice")
+	require.Equal(t, conn(primary), s.reader(ctx, "alice"))
+	require.Equal(t, conn(primary), s.reader(ctx, "bob", "alice"))
+	require.Equal(t, conn(replica), s.reader(ctx, "bob"))
+
+	// изменение, сделанное другим экземпляром сервиса, видно по общей отметке
+	shared.ids["carol"] = true
+	require.Equal(t, conn(primary), s.reader(ctx, "carol"))
+
+	// без отметок из redis безопаснее читать из primary
+	shared.err = errors.New("redis is down")
+	require.Equal(t, conn(primary), s.reader(ctx, "bob"))
+
+	// хранилище без реплик всегда читает из primary
+	require.Equal(t, conn(primary), New(primary).reader(ctx, "bob"))
+}
+
+func TestMarkWrittenAfterCommit(t *testing.T) {
+	primary, err := pgxpool.New(context.Background(), "postgres://localhost:1/primary")
+	require.NoError(t, err)
+	t.Cleanup(primary.Close)
+
+	shared := &marks{ids: make(map[string]bool)}
+	s := NewWithReplicas(primary, replicaPool{primary}, shared, time.Minute)
+
+	// внутри транзакции отметка копится до коммита
+	pending := &pendingWrites{}
+	s.markWritten(context.WithValue(context.Background(), pendingWritesKey{}, pending), "alice")
+	require.Equal(t, []string{"alice"}, pending.ids)
+	require.False(t, s.written.has("alice"))
+	require.Empty(t, shared.ids)
+
+	// вне транзакции - сразу, и в памяти процесса, и в общих отметках
+	s.markWritten(context.Background(), "alice")
+	require.True(t, s.written.has("alice"))
+	require.True(t, shared.ids["alice"])
+}
+
+func TestRecentWritesExpire(t *testing.T) {
+	w := &recentWrites{window: 10 * time.Millisecond, until: make(map[string]time.Time)}
+
+	w.add("alice")
+	require.True(t, w.has("alice"))
+
+	time.Sleep(20 * time.Millisecond)
+	require.False(t, w.has("alice"))
+
+	// следующая запись вычищает истёкшие
+	w.add("bob")
+	require.NotContains(t, w.until, "alice")
+}
@@ -0,0 +1,63 @@
+package postgresql
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// conn - общее подмножество pgxpool.Pool и pgx.Tx, через которое работают все методы Storage
+type conn interface {
+	Begin(ctx context.Context) (pgx.Tx, error)
+	Exec(ctx context.Context, sql string, arguments ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+type txKey struct{}
+
+// conn возвращает транзакцию, открытую InTx выше по стеку, или пул соединений.
+// Методы, которые сами открывают транзакцию через conn(ctx).Begin, внутри InTx получают savepoint.
+func (s *Storage) conn(ctx context.Context) conn {
+	if tx, ok := ctx.Value(txKey{}).(pgx.Tx); ok {
+		return tx
+	}
+	return s.db
+}
+
+// InTx выполняет fn в одной транзакции: все методы Storage, вызванные с переданным в fn контекстом,
+// работают в ней. Если fn вернула ошибку, транзакция откатывается. Вложенный InTx использует внешнюю транзакцию.
+func (s *Storage) InTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	if _, ok := ctx.Value(txKey{}).(pgx.Tx); ok {
+		return fn(ctx)
+	}
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	txCtx := context.WithValue(ctx, txKey{}, tx)
+	pending := &pendingWrites{}
+	if s.written != nil {
+		txCtx = context.WithValue(txCtx, pendingWritesKey{}, pending)
+	}
+
+	if err := fn(txCtx); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	// изменённые пользователи отмечаются только после коммита (см. markWritten)
+	if len(pending.ids) > 0 {
+		s.markWritten(ctx, pending.ids...)
+	}
+
+	return nil
+}
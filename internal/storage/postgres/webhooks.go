@@ -0,0 +1,310 @@
+package postgresql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/DenisBochko/yandex_SSO/internal/domain/models"
+	"github.com/DenisBochko/yandex_SSO/internal/storage"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// SaveWebhookSubscription создаёт подписку и возвращает её id
+func (s *Storage) SaveWebhookSubscription(ctx context.Context, sub models.WebhookSubscription) (string, error) {
+	var id string
+	err := s.conn(ctx).QueryRow(ctx, `
+        INSERT INTO webhook_subscriptions(url, event_types, secret, description, active)
+        VALUES($1, $2, $3, $4, $5)
+        RETURNING id
+    `, sub.URL, sub.EventTypes, sub.Secret, sub.Description, sub.Active).Scan(&id)
+	if err != nil {
+		return "", fmt.Errorf("failed to save webhook subscription: %w", err)
+	}
+
+	return id, nil
+}
+
+// WebhookSubscriptions возвращает все подписки без секретов
+func (s *Storage) WebhookSubscriptions(ctx context.Context) ([]models.WebhookSubscription, error) {
+	rows, err := s.conn(ctx).Query(ctx, `
+        SELECT id, url, event_types, description, active, created_at, updated_at
+        FROM webhook_subscriptions
+        ORDER BY created_at
+    `)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get webhook subscriptions: %w", err)
+	}
+	defer rows.Close()
+
+	var subs []models.WebhookSubscription
+	for rows.Next() {
+		var sub models.WebhookSubscription
+		if err := rows.Scan(&sub.ID, &sub.URL, &sub.EventTypes, &sub.Description, &sub.Active, &sub.CreatedAt, &sub.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan webhook subscription: %w", err)
+		}
+		subs = append(subs, sub)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate over webhook subscriptions: %w", err)
+	}
+
+	return subs, nil
+}
+
+// WebhookSubscription возвращает подписку без секрета
+func (s *Storage) WebhookSubscription(ctx context.Context, id string) (models.WebhookSubscription, error) {
+	var sub models.WebhookSubscription
+	err := s.conn(ctx).QueryRow(ctx, `
+        SELECT id, url, event_types, description, active, created_at, updated_at
+        FROM webhook_subscriptions
+        WHERE id = $1
+    `, id).Scan(&sub.ID, &sub.URL, &sub.EventTypes, &sub.Description, &sub.Active, &sub.CreatedAt, &sub.UpdatedAt)
+
+	if errors.Is(err, pgx.ErrNoRows) {
+		return models.WebhookSubscription{}, storage.ErrSubscriptionNotFound
+	}
+	if pgErr, ok := err.(*pgconn.PgError); ok && pgErr.Code == "22P02" { // id - не uuid
+		return models.WebhookSubscription{}, storage.ErrSubscriptionNotFound
+	}
+	if err != nil {
+		return models.WebhookSubscription{}, fmt.Errorf("failed to get webhook subscription: %w", err)
+	}
+
+	return sub, nil
+}
+
+// UpdateWebhookSubscription меняет адрес, типы событий, описание и активность подписки.
+// Пустой Secret оставляет прежний.
+func (s *Storage) UpdateWebhookSubscription(ctx context.Context, sub models.WebhookSubscription) error {
+	tag, err := s.conn(ctx).Exec(ctx, `
+        UPDATE webhook_subscriptions
+        SET url = $1, event_types = $2, description = $3, active = $4, secret = COALESCE(NULLIF($5, ''), secret), updated_at = NOW()
+        WHERE id = $6
+    `, sub.URL, sub.EventTypes, sub.Description, sub.Active, sub.Secret, sub.ID)
+
+	if pgErr, ok := err.(*pgconn.PgError); ok && pgErr.Code == "22P02" {
+		return storage.ErrSubscriptionNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update webhook subscription: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return storage.ErrSubscriptionNotFound
+	}
+
+	return nil
+}
+
+// DeleteWebhookSubscription удаляет подписку вместе с её доставками
+func (s *Storage) DeleteWebhookSubscription(ctx context.Context, id string) error {
+	tag, err := s.conn(ctx).Exec(ctx, "DELETE FROM webhook_subscriptions WHERE id = $1", id)
+
+	if pgErr, ok := err.(*pgconn.PgError); ok && pgErr.Code == "22P02" {
+		return storage.ErrSubscriptionNotFound
+	}
+	if err != nil {
+		return fmt.Errorf("failed to delete webhook subscription: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return storage.ErrSubscriptionNotFound
+	}
+
+	return nil
+}
+
+// EnqueueWebhookDeliveries создаёт доставку события для каждой активной подписки на его тип.
+// Внутри InTx доставки фиксируются вместе с событием. Повторная постановка того же события не дублирует доставки.
+func (s *Storage) EnqueueWebhookDeliveries(ctx context.Context, eventID string, eventType string, payload []byte) (int64, error) {
+	tag, err := s.conn(ctx).Exec(ctx, `
+        INSERT INTO webhook_deliveries(subscription_id, event_id, event_type, payload)
+        SELECT id, $1, $2, $3 FROM webhook_subscriptions
+        WHERE active AND $2 = ANY(event_types)
+        ON CONFLICT (subscription_id, event_id) DO NOTHING
+    `, eventID, eventType, string(payload))
+	if err != nil {
+		return 0, fmt.Errorf("failed to enqueue webhook deliveries: %w", err)
+	}
+
+	return tag.RowsAffected(), nil
+}
+
+// PendingWebhookDeliveries возвращает до limit доставок, которые пора отправить, вместе с адресом и секретом подписки.
+// Доставки выключенных подписок ждут, пока подписку не включат.
+func (s *Storage) PendingWebhookDeliveries(ctx context.Context, now time.Time, limit int) ([]models.WebhookDelivery, error) {
+	rows, err := s.conn(ctx).Query(ctx, `
+        SELECT d.id, d.subscription_id::text, d.event_id, d.event_type, d.payload, d.status, d.attempts,
+               d.next_attempt_at, d.last_error, d.created_at, s.url, s.secret
+        FROM webhook_deliveries d
+        JOIN webhook_subscriptions s ON s.id = d.subscription_id
+        WHERE d.status = 'pending' AND d.next_attempt_at <= $1 AND s.active
+        ORDER BY d.next_attempt_at, d.id
+        LIMIT $2
+    `, now, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get pending webhook deliveries: %w", err)
+	}
+	defer rows.Close()
+
+	var deliveries []models.WebhookDelivery
+	for rows.Next() {
+		var d models.WebhookDelivery
+		err := rows.Scan(&d.ID, &d.SubscriptionID, &d.EventID, &d.EventType, &d.Payload, &d.Status, &d.Attempts,
+			&d.NextAttemptAt, &d.LastError, &d.CreatedAt, &d.URL, &d.Secret)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan webhook delivery: %w", err)
+		}
+		deliveries = append(deliveries, d)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate over webhook deliveries: %w", err)
+	}
+
+	return deliveries, nil
+}
+
+// MarkWebhookDelivered отмечает доставку успешной и записывает попытку в журнал
+func (s *Storage) MarkWebhookDelivered(ctx context.Context, id int64, attempt models.WebhookDeliveryAttempt, deliveredAt time.Time) error {
+	_, err := s.conn(ctx).Exec(ctx, `
+        WITH d AS (
+            UPDATE webhook_deliveries SET status = 'delivered', attempts = attempts + 1, last_error = '', delivered_at = $2
+            WHERE id = $1
+            RETURNING id
+        )
+        INSERT INTO webhook_delivery_attempts(delivery_id, attempt, status_code, error, response_body, duration_ms)
+        SELECT d.id, (SELECT COUNT(*) FROM webhook_delivery_attempts a WHERE a.delivery_id = d.id) + 1, $3, $4, $5, $6
+        FROM d
+    `, id, deliveredAt, attempt.StatusCode, attempt.Error, attempt.ResponseBody, attempt.Duration.Milliseconds())
+	if err != nil {
+		return fmt.Errorf("failed to mark webhook delivered: %w", err)
+	}
+
+	return nil
+}
+
+// MarkWebhookFailed записывает неудачную попытку. При dead доставка больше не повторяется автоматически.
+func (s *Storage) MarkWebhookFailed(ctx context.Context, id int64, attempt models.WebhookDeliveryAttempt, nextAttemptAt time.Time, dead bool) error {
+	status := models.WebhookDeliveryPending
+	if dead {
+		status = models.WebhookDeliveryDead
+	}
+
+	_, err := s.conn(ctx).Exec(ctx, `
+        WITH d AS (
+            UPDATE webhook_deliveries SET status = $2, attempts = attempts + 1, last_error = $4, next_attempt_at = $3
+            WHERE id = $1
+            RETURNING id
+        )
+        INSERT INTO webhook_delivery_attempts(delivery_id, attempt, status_code, error, response_body, duration_ms)
+        SELECT d.id, (SELECT COUNT(*) FROM webhook_delivery_attempts a WHERE a.delivery_id = d.id) + 1, $5, $4, $6, $7
+        FROM d
+    `, id, status, nextAttemptAt, attempt.Error, attempt.StatusCode, attempt.ResponseBody, attempt.Duration.Milliseconds())
+	if err != nil {
+		return fmt.Errorf("failed to mark webhook failed: %w", err)
+	}
+
+	return nil
+}
+
+// WebhookDeliveries возвращает до limit доставок подписки от новых к старым.
+// Пустой status - любые. beforeID - курсор следующей страницы, 0 - с начала.
+func (s *Storage) WebhookDeliveries(ctx context.Context, subscriptionID string, status models.WebhookDeliveryStatus, beforeID int64, limit int) ([]models.WebhookDelivery, error) {
+	rows, err := s.conn(ctx).Query(ctx, `
+        SELECT id, subscription_id::text, event_id, event_type, payload, status, attempts, next_attempt_at, last_error, created_at, delivered_at
+        FROM webhook_deliveries
+        WHERE subscription_id = $1 AND ($2 = '' OR status = $2) AND ($3 = 0 OR id < $3)
+        ORDER BY id DESC
+        LIMIT $4
+    `, subscriptionID, string(status), beforeID, limit)
+	if pgErr, ok := err.(*pgconn.PgError); ok && pgErr.Code == "22P02" {
+		return nil, storage.ErrSubscriptionNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get webhook deliveries: %w", err)
+	}
+	defer rows.Close()
+
+	var deliveries []models.WebhookDelivery
+	for rows.Next() {
+		var d models.WebhookDelivery
+		var deliveredAt *time.Time
+		err := rows.Scan(&d.ID, &d.SubscriptionID, &d.EventID, &d.EventType, &d.Payload, &d.Status, &d.Attempts,
+			&d.NextAttemptAt, &d.LastError, &d.CreatedAt, &deliveredAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan webhook delivery: %w", err)
+		}
+		if deliveredAt != nil {
+			d.DeliveredAt = *deliveredAt
+		}
+		deliveries = append(deliveries, d)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate over webhook deliveries: %w", err)
+	}
+
+	return deliveries, nil
+}
+
+// WebhookDeliveryAttempts возвращает журнал попыток доставки по порядку
+func (s *Storage) WebhookDeliveryAttempts(ctx context.Context, deliveryID int64) ([]models.WebhookDeliveryAttempt, error) {
+	rows, err := s.conn(ctx).Query(ctx, `
+        SELECT id, delivery_id, attempt, status_code, error, response_body, duration_ms, created_at
+        FROM webhook_delivery_attempts
+        WHERE delivery_id = $1
+        ORDER BY attempt
+    `, deliveryID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get webhook delivery attempts: %w", err)
+	}
+	defer rows.Close()
+
+	var attempts []models.WebhookDeliveryAttempt
+	for rows.Next() {
+		var a models.WebhookDeliveryAttempt
+		var durationMs int64
+		if err := rows.Scan(&a.ID, &a.DeliveryID, &a.Attempt, &a.StatusCode, &a.Error, &a.ResponseBody, &durationMs, &a.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan webhook delivery attempt: %w", err)
+		}
+		a.Duration = time.Duration(durationMs) * time.Millisecond
+		attempts = append(attempts, a)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate over webhook delivery attempts: %w", err)
+	}
+
+	return attempts, nil
+}
+
+// RedeliverWebhook ставит доставку в очередь заново с полным набором попыток, в каком бы состоянии она ни была.
+// Журнал прежних попыток сохраняется.
+func (s *Storage) RedeliverWebhook(ctx context.Context, id int64, now time.Time) error {
+	tag, err := s.conn(ctx).Exec(ctx, `
+        UPDATE webhook_deliveries SET status = 'pending', attempts = 0, next_attempt_at = $2, delivered_at = NULL
+        WHERE id = $1
+    `, id, now)
+	if err != nil {
+		return fmt.Errorf("failed to redeliver webhook: %w", err)
+	}
+	if tag.RowsAffected() == 0 {
+		return storage.ErrDeliveryNotFound
+	}
+
+	return nil
+}
+
+// PurgeWebhookDeliveries удаляет завершённые (доставленные и dead) доставки старше before
+func (s *Storage) PurgeWebhookDeliveries(ctx context.Context, before time.Time) (int64, error) {
+	tag, err := s.conn(ctx).Exec(ctx, "DELETE FROM webhook_deliveries WHERE status <> 'pending' AND created_at < $1", before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge webhook deliveries: %w", err)
+	}
+
+	return tag.RowsAffected(), nil
+}
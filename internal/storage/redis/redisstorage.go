@@ -2,28 +2,34 @@ package redisstorage
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"strings"
 	"time"
 
+	"github.com/DenisBochko/yandex_SSO/internal/domain/models"
 	"github.com/DenisBochko/yandex_SSO/internal/storage"
 
 	"github.com/redis/go-redis/v9"
 )
 
+// RedisStorage хранит refresh токены. Работает с одним узлом, sentinel и cluster (см. pkg/redis):
+// команды, затрагивающие несколько ключей, отправляются по одному ключу, потому что в cluster
+// токены и индекс сессий пользователя лежат в разных слотах.
 type RedisStorage struct {
-	client *redis.Client
+	client redis.UniversalClient
 	ttl    time.Duration
 }
 
-func New(client *redis.Client, ttl time.Duration) *RedisStorage {
+func New(client redis.UniversalClient, ttl time.Duration) *RedisStorage {
 	return &RedisStorage{
 		client: client,
 		ttl:    ttl,
 	}
 }
 
-func (r *RedisStorage) Set(uuid string, userID string) error {
-	err := r.client.Set(context.Background(), uuid, userID, r.ttl).Err()
+func (r *RedisStorage) Set(ctx context.Context, uuid string, userID string) error {
+	err := r.client.Set(ctx, uuid, userID, r.ttl).Err()
 	if err != nil {
 		return fmt.Errorf("failed to set value in redis: %w", err)
 	}
@@ -31,8 +37,8 @@ func (r *RedisStorage) Set(uuid string, userID string) error {
 	return nil
 }
 
-func (r *RedisStorage) Get(uuid string) (string, error) {
-	userID, err := r.client.Get(context.Background(), uuid).Result()
+func (r *RedisStorage) Get(ctx context.Context, uuid string) (string, error) {
+	userID, err := r.client.Get(ctx, uuid).Result()
 	if err == redis.Nil {
 		return "", storage.ErrKeyDoesNotExist
 	} else if err != nil {
@@ -42,10 +48,99 @@ func (r *RedisStorage) Get(uuid string) (string, error) {
 	return userID, nil
 }
 
-func (r *RedisStorage) Delete(uuid string) error {
-	err := r.client.Del(context.Background(), uuid).Err()
+func (r *RedisStorage) Delete(ctx context.Context, uuid string) error {
+	err := r.client.Del(ctx, uuid).Err()
 	if err != nil {
 		return fmt.Errorf("failed to delete value from redis: %w", err)
 	}
 	return nil
 }
+
+// userSessionsKey - множество refresh токенов пользователя, нужно для завершения всех его сессий
+func userSessionsKey(userID string) string {
+	return "user_sessions:" + userID
+}
+
+// SaveSession сохраняет сессию под refresh токеном в виде JSON и добавляет токен в индекс сессий пользователя.
+// Индекс живёт столько же, сколько самый новый токен; удалённые токены из него не вычищаются,
+// DeleteUserSessions просто пропускает уже несуществующие ключи.
+// Ключи в разных слотах cluster, поэтому это не транзакция: индекс пишется первым, и при сбое
+// в нём остаётся лишний токен, а не сессия, которую DeleteUserSessions не найдёт.
+func (r *RedisStorage) SaveSession(ctx context.Context, token string, session models.Session) error {
+	value, err := json.Marshal(session)
+	if err != nil {
+		return fmt.Errorf("failed to marshal session: %w", err)
+	}
+
+	key := userSessionsKey(session.UserID)
+
+	if err := r.client.SAdd(ctx, key, token).Err(); err != nil {
+		return fmt.Errorf("failed to set value in redis: %w", err)
+	}
+
+	_, err = r.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Expire(ctx, key, r.ttl)
+		pipe.Set(ctx, token, value, r.ttl)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to set value in redis: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteUserSessions удаляет все refresh токены пользователя и возвращает количество удалённых
+func (r *RedisStorage) DeleteUserSessions(ctx context.Context, userID string) (int64, error) {
+	key := userSessionsKey(userID)
+
+	tokens, err := r.client.SMembers(ctx, key).Result()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get user sessions from redis: %w", err)
+	}
+
+	// по DEL на ключ: cluster отклоняет DEL с ключами из разных слотов
+	cmds := make([]*redis.IntCmd, len(tokens))
+	_, err = r.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, token := range tokens {
+			cmds[i] = pipe.Del(ctx, token)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete user sessions from redis: %w", err)
+	}
+
+	// индекс удаляется последним, чтобы после сбоя повторный вызов нашёл оставшиеся токены
+	if err := r.client.Del(ctx, key).Err(); err != nil {
+		return 0, fmt.Errorf("failed to delete user sessions from redis: %w", err)
+	}
+
+	var deleted int64
+	for _, cmd := range cmds {
+		deleted += cmd.Val()
+	}
+
+	return deleted, nil
+}
+
+// Session возвращает сессию по refresh токену.
+// Токены, выданные до появления сессий, хранят только id пользователя - для них AuthTime нулевой,
+// и любая операция, требующая свежего входа, попросит пройти аутентификацию заново.
+func (r *RedisStorage) Session(ctx context.Context, token string) (models.Session, error) {
+	value, err := r.Get(ctx, token)
+	if err != nil {
+		return models.Session{}, err
+	}
+
+	if !strings.HasPrefix(value, "{") {
+		return models.Session{UserID: value}, nil
+	}
+
+	var session models.Session
+	if err := json.Unmarshal([]byte(value), &session); err != nil {
+		return models.Session{}, fmt.Errorf("failed to unmarshal session: %w", err)
+	}
+
+	return session, nil
+}
@@ -0,0 +1,31 @@
+package redisstorage
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/DenisBochko/yandex_SSO/internal/services/auth"
+	"github.com/DenisBochko/yandex_SSO/internal/storage/storagetest"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/require"
+)
+
+// Набор тестов storagetest запускается на настоящем redis, только если задан SSO_TEST_REDIS_ADDR,
+// например localhost:6379. Используется база 15, она очищается перед каждым подтестом.
+func TestSessions(t *testing.T) {
+	addr := os.Getenv("SSO_TEST_REDIS_ADDR")
+	if addr == "" {
+		t.Skip("SSO_TEST_REDIS_ADDR is not set")
+	}
+
+	client := redis.NewClient(&redis.Options{Addr: addr, Password: os.Getenv("SSO_TEST_REDIS_PASS"), DB: 15})
+	t.Cleanup(func() { client.Close() })
+
+	storagetest.RunSessions(t, func(t *testing.T) auth.RedisStorage {
+		require.NoError(t, client.FlushDB(context.Background()).Err())
+		return New(client, time.Hour)
+	})
+}
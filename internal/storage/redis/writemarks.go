@@ -0,0 +1,70 @@
+package redisstorage
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// WriteMarks хранит отметки о недавно изменённых пользователях (postgresql.WriteMarks) ключами
+// с TTL window. Ключи общие для всех экземпляров сервиса, поэтому пользователь видит свои правки,
+// даже если следующий запрос попал на другой экземпляр.
+type WriteMarks struct {
+	client redis.UniversalClient
+	window time.Duration
+}
+
+func NewWriteMarks(client redis.UniversalClient, window time.Duration) *WriteMarks {
+	return &WriteMarks{
+		client: client,
+		window: window,
+	}
+}
+
+// Ключ содержит id в фигурных скобках, как и ключи кэша пользователей (internal/storage/usercache)
+func writeMarkKey(id string) string {
+	return "recent_write:{" + id + "}"
+}
+
+// Mark отмечает пользователей на window. Команды идут конвейером по одной на ключ:
+// в redis cluster ключи разных пользователей лежат в разных слотах.
+func (w *WriteMarks) Mark(ctx context.Context, ids ...string) error {
+	_, err := w.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, id := range ids {
+			pipe.Set(ctx, writeMarkKey(id), 1, w.window)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to set write marks in redis: %w", err)
+	}
+
+	return nil
+}
+
+// Marked сообщает, менялся ли кто-то из пользователей за последние window
+func (w *WriteMarks) Marked(ctx context.Context, ids ...string) (bool, error) {
+	if len(ids) == 0 {
+		return false, nil
+	}
+
+	cmds, err := w.client.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, id := range ids {
+			pipe.Exists(ctx, writeMarkKey(id))
+		}
+		return nil
+	})
+	if err != nil {
+		return false, fmt.Errorf("failed to get write marks from redis: %w", err)
+	}
+
+	for _, cmd := range cmds {
+		if cmd.(*redis.IntCmd).Val() > 0 {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
@@ -0,0 +1,51 @@
+package sqlitestorage
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/DenisBochko/yandex_SSO/internal/domain/models"
+)
+
+// SaveAccountCommandResult записывает итог команды. Возвращает false, если команда
+// с таким id уже записана: тогда её повтор выполнять не нужно.
+func (s *Storage) SaveAccountCommandResult(ctx context.Context, result models.AccountCommandResult) (bool, error) {
+	res, err := s.conn(ctx).ExecContext(ctx, `
+        INSERT INTO account_commands (id, command, user_id, requested_by, status, error, changed, created_at)
+        VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+        ON CONFLICT (id) DO NOTHING
+    `, result.CommandID, result.Command, result.UserID, result.RequestedBy, result.Status, result.Error, result.Changed, timeValue(result.CreatedAt))
+	if err != nil {
+		return false, fmt.Errorf("failed to save account command result: %w", err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to save account command result: %w", err)
+	}
+
+	return n == 1, nil
+}
+
+// AccountCommandProcessed проверяет, выполнялась ли уже команда с этим id
+func (s *Storage) AccountCommandProcessed(ctx context.Context, id string) (bool, error) {
+	var exists bool
+	err := s.conn(ctx).QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM account_commands WHERE id = ?)", id).Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("failed to check account command: %w", err)
+	}
+
+	return exists, nil
+}
+
+// PurgeAccountCommands удаляет записи о командах старше before. После этого
+// повтор команды с тем же id будет выполнен заново.
+func (s *Storage) PurgeAccountCommands(ctx context.Context, before time.Time) (int64, error) {
+	res, err := s.conn(ctx).ExecContext(ctx, "DELETE FROM account_commands WHERE created_at < ?", timeValue(before))
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge account commands: %w", err)
+	}
+
+	return res.RowsAffected()
+}
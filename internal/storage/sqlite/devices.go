@@ -0,0 +1,132 @@
+package sqlitestorage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/DenisBochko/yandex_SSO/internal/domain/models"
+	"github.com/DenisBochko/yandex_SSO/internal/storage"
+)
+
+// TouchKnownDevice отмечает вход с устройства и сообщает, было ли устройство незнакомым.
+// knownBefore - сколько других устройств пользователя уже было известно.
+func (s *Storage) TouchKnownDevice(ctx context.Context, device models.KnownDevice) (isNew bool, knownBefore int, err error) {
+	err = s.atomic(ctx, func(ctx context.Context) error {
+		// в SQLite нет xmax, поэтому новое устройство определяется по числу вставленных строк
+		res, err := s.conn(ctx).ExecContext(ctx, `
+            INSERT INTO known_devices(user_id, fingerprint, user_agent, ip, first_seen_at, last_seen_at)
+            VALUES(?1, ?2, ?3, ?4, ?5, ?5)
+            ON CONFLICT (user_id, fingerprint) DO NOTHING
+        `, device.UserID, device.Fingerprint, device.UserAgent, device.IP, timeValue(device.LastSeenAt))
+		if err != nil {
+			return fmt.Errorf("failed to save known device: %w", err)
+		}
+
+		if n, _ := res.RowsAffected(); n == 0 {
+			_, err := s.conn(ctx).ExecContext(ctx, `
+                UPDATE known_devices SET user_agent = ?, ip = ?, last_seen_at = ? WHERE user_id = ? AND fingerprint = ?
+            `, device.UserAgent, device.IP, timeValue(device.LastSeenAt), device.UserID, device.Fingerprint)
+			if err != nil {
+				return fmt.Errorf("failed to save known device: %w", err)
+			}
+			return nil
+		}
+
+		isNew = true
+
+		err = s.conn(ctx).QueryRowContext(ctx, "SELECT count(*) FROM known_devices WHERE user_id = ? AND fingerprint <> ?",
+			device.UserID, device.Fingerprint).Scan(&knownBefore)
+		if err != nil {
+			return fmt.Errorf("failed to count known devices: %w", err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return false, 0, err
+	}
+
+	return isNew, knownBefore, nil
+}
+
+// CreateSessionRevokeToken сохраняет токен ссылки "это был не я" для входа с устройства fingerprint
+func (s *Storage) CreateSessionRevokeToken(ctx context.Context, userID string, fingerprint string, token string, expiresAt time.Time) error {
+	_, err := s.conn(ctx).ExecContext(ctx, "INSERT INTO session_revoke_tokens(token, user_id, fingerprint, expires_at) VALUES(?, ?, ?, ?)",
+		token, userID, fingerprint, timeValue(expiresAt))
+	if err != nil {
+		return fmt.Errorf("failed to create session revoke token: %w", err)
+	}
+
+	return nil
+}
+
+// ConsumeSessionRevokeToken удаляет токен "это был не я" и устройство, с которого был вход,
+// и возвращает id пользователя. Остальные такие токены пользователя тоже удаляются:
+// сессии завершаются все сразу, повторные нажатия не нужны.
+func (s *Storage) ConsumeSessionRevokeToken(ctx context.Context, token string) (string, error) {
+	var userID, fingerprint string
+	var expiresAt time.Time
+	var expired bool
+
+	err := s.atomic(ctx, func(ctx context.Context) error {
+		err := s.conn(ctx).QueryRowContext(ctx, "DELETE FROM session_revoke_tokens WHERE token = ? RETURNING user_id, fingerprint, expires_at", token).
+			Scan(&userID, &fingerprint, scanTime{&expiresAt})
+		if errors.Is(err, sql.ErrNoRows) {
+			return storage.ErrTokenNotFound
+		}
+		if err != nil {
+			return fmt.Errorf("failed to get session revoke token: %w", err)
+		}
+
+		// просроченный токен удаляется, остальное не трогаем
+		if time.Now().UTC().After(expiresAt) {
+			expired = true
+			return nil
+		}
+
+		if _, err := s.conn(ctx).ExecContext(ctx, "DELETE FROM session_revoke_tokens WHERE user_id = ?", userID); err != nil {
+			return fmt.Errorf("failed to delete session revoke tokens: %w", err)
+		}
+
+		if _, err := s.conn(ctx).ExecContext(ctx, "DELETE FROM known_devices WHERE user_id = ? AND fingerprint = ?", userID, fingerprint); err != nil {
+			return fmt.Errorf("failed to forget device: %w", err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if expired {
+		return "", storage.ErrTokenExpired
+	}
+
+	return userID, nil
+}
+
+// PurgeExpiredSessionRevokeTokens удаляет токены "это был не я", истёкшие до before
+func (s *Storage) PurgeExpiredSessionRevokeTokens(ctx context.Context, before time.Time) (int64, error) {
+	res, err := s.conn(ctx).ExecContext(ctx, "DELETE FROM session_revoke_tokens WHERE expires_at < ?", timeValue(before))
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge session revoke tokens: %w", err)
+	}
+
+	return res.RowsAffected()
+}
+
+// IsKnownDevice сообщает, входил ли пользователь раньше с устройства fingerprint
+func (s *Storage) IsKnownDevice(ctx context.Context, userID string, fingerprint string) (bool, error) {
+	var known bool
+
+	err := s.conn(ctx).QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM known_devices WHERE user_id = ? AND fingerprint = ?)",
+		userID, fingerprint).Scan(&known)
+	if err != nil {
+		return false, fmt.Errorf("failed to check known device: %w", err)
+	}
+
+	return known, nil
+}
@@ -0,0 +1,44 @@
+package sqlitestorage
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/DenisBochko/yandex_SSO/internal/domain/models"
+	"github.com/DenisBochko/yandex_SSO/internal/storage"
+)
+
+// SetEmailStatus записывает доставляемость адреса emailCanonical и возвращает число изменённых пользователей.
+// Если userID не пуст, меняется только этот пользователь и только пока адрес у него прежний.
+// Отчёт старше уже записанного не применяется, а complained не понижается до bounced.
+func (s *Storage) SetEmailStatus(ctx context.Context, userID string, emailCanonical string, status models.EmailStatus, reason string, at time.Time) (int64, error) {
+	res, err := s.conn(ctx).ExecContext(ctx, `
+        UPDATE users SET email_status = ?3, email_status_reason = ?4, email_status_at = ?5
+        WHERE email_canonical = ?2
+          AND (?1 = '' OR id = ?1)
+          AND (email_status_at IS NULL OR email_status_at <= ?5)
+          AND NOT (email_status = 'complained' AND ?3 = 'bounced')
+    `, userID, emailCanonical, status, reason, timeValue(at))
+	if err != nil {
+		return 0, fmt.Errorf("failed to set email status: %w", err)
+	}
+
+	return res.RowsAffected()
+}
+
+// ResetEmailStatus снова разрешает отправку писем пользователю
+func (s *Storage) ResetEmailStatus(ctx context.Context, userID string) error {
+	res, err := s.conn(ctx).ExecContext(ctx, `
+        UPDATE users SET email_status = 'ok', email_status_reason = '', email_status_at = NULL
+        WHERE id = ?
+    `, userID)
+	if err != nil {
+		return fmt.Errorf("failed to reset email status: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return storage.ErrUserNotFound
+	}
+
+	return nil
+}
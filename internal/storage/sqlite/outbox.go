@@ -0,0 +1,124 @@
+package sqlitestorage
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/DenisBochko/yandex_SSO/internal/domain/models"
+)
+
+// SaveOutboxMessage добавляет сообщение в outbox. Внутри InTx запись попадает в ту же транзакцию,
+// что и изменение данных, поэтому сообщение не потеряется и не уйдёт без изменения.
+func (s *Storage) SaveOutboxMessage(ctx context.Context, message models.OutboxMessage) error {
+	headers := message.Headers
+	if headers == nil {
+		headers = map[string]string{}
+	}
+
+	headersJSON, err := jsonValue(headers)
+	if err != nil {
+		return fmt.Errorf("failed to encode outbox headers: %w", err)
+	}
+
+	now := timeValue(time.Now())
+
+	_, err = s.conn(ctx).ExecContext(ctx, `
+        INSERT INTO outbox(aggregate_id, topic, kind, headers, payload, created_at, next_attempt_at) VALUES(?, ?, ?, ?, ?, ?, ?)
+    `, message.AggregateID, message.Topic, message.Kind, headersJSON, message.Payload, now, now)
+	if err != nil {
+		return fmt.Errorf("failed to save outbox message: %w", err)
+	}
+
+	return nil
+}
+
+// PendingOutboxMessages возвращает до limit неопубликованных сообщений в порядке id, которые можно отправить сейчас.
+// Сообщение пропускается, если более раннее сообщение того же aggregate_id ждёт повторной попытки:
+// иначе порядок внутри ключа нарушится.
+func (s *Storage) PendingOutboxMessages(ctx context.Context, now time.Time, limit int) ([]models.OutboxMessage, error) {
+	rows, err := s.conn(ctx).QueryContext(ctx, `
+        SELECT o.id, o.aggregate_id, o.topic, o.kind, o.headers, o.payload, o.created_at, o.attempts, o.next_attempt_at
+        FROM outbox o
+        WHERE o.published_at IS NULL
+          AND o.next_attempt_at <= ?1
+          AND NOT EXISTS (
+              SELECT 1 FROM outbox p
+              WHERE p.aggregate_id = o.aggregate_id AND p.published_at IS NULL AND p.id < o.id AND p.next_attempt_at > ?1
+          )
+        ORDER BY o.id
+        LIMIT ?2
+    `, timeValue(now), limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get outbox messages: %w", err)
+	}
+	defer rows.Close()
+
+	var messages []models.OutboxMessage
+	for rows.Next() {
+		var m models.OutboxMessage
+		err := rows.Scan(&m.ID, &m.AggregateID, &m.Topic, &m.Kind, scanJSON{&m.Headers}, &m.Payload,
+			scanTime{&m.CreatedAt}, &m.Attempts, scanTime{&m.NextAttemptAt})
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan outbox message: %w", err)
+		}
+		messages = append(messages, m)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate over outbox messages: %w", err)
+	}
+
+	return messages, nil
+}
+
+// MarkOutboxPublished отмечает сообщения опубликованными
+func (s *Storage) MarkOutboxPublished(ctx context.Context, ids []int64, publishedAt time.Time) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	in, args := placeholders(ids)
+
+	_, err := s.conn(ctx).ExecContext(ctx, "UPDATE outbox SET published_at = ?, attempts = attempts + 1, last_error = '' WHERE id IN ("+in+")",
+		append([]any{timeValue(publishedAt)}, args...)...)
+	if err != nil {
+		return fmt.Errorf("failed to mark outbox messages published: %w", err)
+	}
+
+	return nil
+}
+
+// MarkOutboxFailed записывает неудачную попытку и время следующей
+func (s *Storage) MarkOutboxFailed(ctx context.Context, id int64, lastError string, nextAttemptAt time.Time) error {
+	_, err := s.conn(ctx).ExecContext(ctx, "UPDATE outbox SET attempts = attempts + 1, last_error = ?, next_attempt_at = ? WHERE id = ?",
+		lastError, timeValue(nextAttemptAt), id)
+	if err != nil {
+		return fmt.Errorf("failed to mark outbox message failed: %w", err)
+	}
+
+	return nil
+}
+
+// OutboxBacklog возвращает количество неопубликованных сообщений и время создания самого старого из них
+func (s *Storage) OutboxBacklog(ctx context.Context) (int64, time.Time, error) {
+	var count int64
+	var oldest time.Time
+
+	err := s.conn(ctx).QueryRowContext(ctx, "SELECT count(*), min(created_at) FROM outbox WHERE published_at IS NULL").Scan(&count, scanTime{&oldest})
+	if err != nil {
+		return 0, time.Time{}, fmt.Errorf("failed to get outbox backlog: %w", err)
+	}
+
+	return count, oldest, nil
+}
+
+// PurgePublishedOutbox удаляет сообщения, опубликованные до before
+func (s *Storage) PurgePublishedOutbox(ctx context.Context, before time.Time) (int64, error) {
+	res, err := s.conn(ctx).ExecContext(ctx, "DELETE FROM outbox WHERE published_at < ?", timeValue(before))
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge outbox: %w", err)
+	}
+
+	return res.RowsAffected()
+}
@@ -0,0 +1,123 @@
+package sqlitestorage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/DenisBochko/yandex_SSO/internal/domain/models"
+	"github.com/DenisBochko/yandex_SSO/internal/storage"
+)
+
+const securityEventColumns = "id, user_id, type, login, ip, user_agent, details, created_at"
+
+// scanSecurityEvent читает событие из строки, выбранной по securityEventColumns
+func scanSecurityEvent(row interface{ Scan(dest ...any) error }) (models.SecurityEvent, error) {
+	var event models.SecurityEvent
+
+	err := row.Scan(&event.ID, &event.UserID, &event.Type, &event.Login, &event.IP, &event.UserAgent,
+		scanJSON{&event.Details}, scanTime{&event.CreatedAt})
+
+	return event, err
+}
+
+// SaveSecurityEvent записывает событие безопасности
+func (s *Storage) SaveSecurityEvent(ctx context.Context, event models.SecurityEvent) error {
+	details := event.Details
+	if details == nil {
+		details = map[string]string{}
+	}
+
+	detailsJSON, err := jsonValue(details)
+	if err != nil {
+		return fmt.Errorf("failed to encode security event details: %w", err)
+	}
+
+	_, err = s.conn(ctx).ExecContext(ctx, `
+        INSERT INTO security_events(user_id, type, login, ip, user_agent, details, created_at)
+        VALUES(NULLIF(?, ''), ?, ?, ?, ?, ?, ?)
+    `, event.UserID, event.Type, event.Login, event.IP, event.UserAgent, detailsJSON, timeValue(time.Now()))
+	if err != nil {
+		return fmt.Errorf("failed to save security event: %w", err)
+	}
+
+	return nil
+}
+
+// SecurityEvents возвращает до limit событий пользователя, начиная с самых новых.
+// beforeID - курсор для следующей страницы: id последнего полученного события, 0 - с начала.
+func (s *Storage) SecurityEvents(ctx context.Context, userID string, beforeID int64, limit int) ([]models.SecurityEvent, error) {
+	rows, err := s.conn(ctx).QueryContext(ctx, `
+        SELECT `+securityEventColumns+`
+        FROM security_events
+        WHERE user_id = ?1 AND (?2 = 0 OR id < ?2)
+        ORDER BY id DESC
+        LIMIT ?3
+    `, userID, beforeID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get security events: %w", err)
+	}
+	defer rows.Close()
+
+	var events []models.SecurityEvent
+	for rows.Next() {
+		event, err := scanSecurityEvent(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan security event: %w", err)
+		}
+		events = append(events, event)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate over security events: %w", err)
+	}
+
+	return events, nil
+}
+
+// PurgeSecurityEvents удаляет события старше before
+func (s *Storage) PurgeSecurityEvents(ctx context.Context, before time.Time) (int64, error) {
+	res, err := s.conn(ctx).ExecContext(ctx, "DELETE FROM security_events WHERE created_at < ?", timeValue(before))
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge security events: %w", err)
+	}
+
+	return res.RowsAffected()
+}
+
+// CountRecentSecurityEvents считает события типа eventType не старше since,
+// относящиеся к пользователю userID или пришедшие с адреса ip
+func (s *Storage) CountRecentSecurityEvents(ctx context.Context, userID string, ip string, eventType models.SecurityEventType, since time.Time) (int, error) {
+	var count int
+
+	err := s.conn(ctx).QueryRowContext(ctx, `
+        SELECT count(*) FROM security_events
+        WHERE type = ?1 AND created_at >= ?2 AND (user_id = NULLIF(?3, '') OR (ip <> '' AND ip = ?4))
+    `, eventType, timeValue(since), userID, ip).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count security events: %w", err)
+	}
+
+	return count, nil
+}
+
+// LastSecurityEvent возвращает последнее событие пользователя типа eventType
+func (s *Storage) LastSecurityEvent(ctx context.Context, userID string, eventType models.SecurityEventType) (models.SecurityEvent, error) {
+	event, err := scanSecurityEvent(s.conn(ctx).QueryRowContext(ctx, `
+        SELECT `+securityEventColumns+`
+        FROM security_events
+        WHERE user_id = ? AND type = ?
+        ORDER BY id DESC
+        LIMIT 1
+    `, userID, eventType))
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.SecurityEvent{}, storage.ErrEventNotFound
+	}
+	if err != nil {
+		return models.SecurityEvent{}, fmt.Errorf("failed to get security event: %w", err)
+	}
+
+	return event, nil
+}
@@ -0,0 +1,582 @@
+// Package sqlitestorage - основное хранилище на SQLite для встроенных и edge-развёртываний без postgres.
+// Методы повторяют internal/storage/postgres и проходят тот же набор тестов storagetest.
+// Схема - db/sqlite_migrations, подключение и миграции - pkg/sqlite.
+package sqlitestorage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/DenisBochko/yandex_SSO/internal/domain/models"
+	"github.com/DenisBochko/yandex_SSO/internal/storage"
+
+	"github.com/google/uuid"
+)
+
+type Storage struct {
+	db *sql.DB
+}
+
+// userColumns - список колонок, который читает scanUser.
+// email и pass_hash пусты у пользователей, зарегистрированных по телефону.
+const userColumns = `id, name, COALESCE(email, ''), COALESCE(pass_hash, x''), verify, avatar,
+	COALESCE(email_canonical, ''), COALESCE(username, ''), username_changed_at,
+	COALESCE(phone, ''), phone_verified, status, status_reason, suspended_until,
+	email_status, email_status_reason`
+
+// scanUser читает пользователя из строки, выбранной по userColumns
+func scanUser(row interface{ Scan(dest ...any) error }) (models.User, error) {
+	var user models.User
+
+	err := row.Scan(
+		&user.ID,
+		&user.Name,
+		&user.Email,
+		&user.PassHash,
+		&user.Verified,
+		&user.Avatar,
+		&user.EmailCanonical,
+		&user.Username,
+		scanTime{&user.UsernameChangedAt},
+		&user.Phone,
+		&user.PhoneVerified,
+		&user.Status,
+		&user.StatusReason,
+		scanTime{&user.SuspendedUntil},
+		&user.EmailStatus,
+		&user.EmailStatusReason,
+	)
+	if err != nil {
+		return models.User{}, err
+	}
+
+	return user, nil
+}
+
+// Конструктор Storage. db открывается через pkg/sqlite: там включаются внешние ключи и WAL.
+func New(db *sql.DB) *Storage {
+	return &Storage{db: db}
+}
+
+// SaveUser сохраняет пользователя в БД. Уникальность проверяется по каноническому email.
+func (s *Storage) SaveUser(ctx context.Context, name string, email string, emailCanonical string, passHash []byte) (string, error) {
+	id := uuid.NewString()
+
+	_, err := s.conn(ctx).ExecContext(ctx, "INSERT INTO users(id, name, email, email_canonical, pass_hash, created_at) VALUES(?, ?, ?, ?, ?, ?)",
+		id, name, email, emailCanonical, passHash, timeValue(time.Now()))
+	if isUniqueViolation(err) {
+		return "", storage.ErrUserExists
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to save user: %w", err)
+	}
+
+	return id, nil
+}
+
+// SavePhoneUser сохраняет пользователя, зарегистрированного по номеру телефона, без email и пароля
+func (s *Storage) SavePhoneUser(ctx context.Context, name string, phone string) (string, error) {
+	id := uuid.NewString()
+
+	_, err := s.conn(ctx).ExecContext(ctx, "INSERT INTO users(id, name, phone, created_at) VALUES(?, ?, ?, ?)",
+		id, name, phone, timeValue(time.Now()))
+	if isUniqueViolation(err) {
+		return "", storage.ErrUserExists
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to save user: %w", err)
+	}
+
+	return id, nil
+}
+
+// UserByPhone возвращает пользователя по номеру телефона в формате E.164
+func (s *Storage) UserByPhone(ctx context.Context, phone string) (models.User, error) {
+	return s.userBy(ctx, "phone = ?", phone)
+}
+
+// SetUserPhone привязывает номер к пользователю. Новый номер считается неподтверждённым.
+func (s *Storage) SetUserPhone(ctx context.Context, id string, phone string) (bool, error) {
+	res, err := s.conn(ctx).ExecContext(ctx, "UPDATE users SET phone = ?, phone_verified = 0 WHERE id = ?", phone, id)
+	if isUniqueViolation(err) { // номер уже привязан к другому пользователю
+		return false, storage.ErrPhoneExists
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to set user phone: %w", err)
+	}
+
+	if n, _ := res.RowsAffected(); n == 0 {
+		return false, storage.ErrUserNotFound
+	}
+
+	return true, nil
+}
+
+// User возвращает пользователя по каноническому email или по самому адресу без учёта регистра.
+// Если подходят несколько пользователей, выбирается точное совпадение адреса, затем канонического адреса.
+func (s *Storage) User(ctx context.Context, email string, emailCanonical string) (models.User, error) {
+	return s.userBy(ctx, `email_canonical = ?1 OR lower(email) = lower(?2)
+        ORDER BY COALESCE(email = ?2, 0) DESC, COALESCE(email_canonical = ?1, 0) DESC LIMIT 1`, emailCanonical, email)
+}
+
+// Users возвращает список пользователей по списку id
+func (s *Storage) Users(ctx context.Context, ids []string) ([]models.User, error) {
+	if len(ids) == 0 {
+		return nil, nil
+	}
+
+	in, args := placeholders(ids)
+
+	rows, err := s.conn(ctx).QueryContext(ctx, "SELECT "+userColumns+" FROM users WHERE id IN ("+in+")", args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+	defer rows.Close()
+
+	var users []models.User
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan user: %w", err)
+		}
+		users = append(users, user)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate over users: %w", err)
+	}
+
+	return users, nil
+}
+
+func (s *Storage) UserById(ctx context.Context, id string) (models.User, error) {
+	return s.userBy(ctx, "id = ?", id)
+}
+
+// UserByUsername возвращает пользователя по хэндлу в нижнем регистре
+func (s *Storage) UserByUsername(ctx context.Context, username string) (models.User, error) {
+	return s.userBy(ctx, "username = ?", username)
+}
+
+// userBy возвращает пользователя по условию where
+func (s *Storage) userBy(ctx context.Context, where string, args ...any) (models.User, error) {
+	user, err := scanUser(s.conn(ctx).QueryRowContext(ctx, "SELECT "+userColumns+" FROM users WHERE "+where, args...))
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.User{}, storage.ErrUserNotFound
+	}
+
+	if err != nil {
+		return models.User{}, fmt.Errorf("failed to get user: %w", err)
+	}
+
+	return user, nil
+}
+
+// Обновляет имя, email и аватар пользователя по id. Подтверждение email не меняется
+func (s *Storage) UpdateUser(ctx context.Context, user models.User) (bool, error) {
+	_, err := s.conn(ctx).ExecContext(ctx, `
+        UPDATE users SET name = ?1, email = NULLIF(?2, ''), email_canonical = NULLIF(?3, ''), avatar = ?4,
+            -- отчёты о доставке относятся к прежнему адресу
+            email_status = CASE WHEN email IS NOT NULLIF(?2, '') THEN 'ok' ELSE email_status END,
+            email_status_reason = CASE WHEN email IS NOT NULLIF(?2, '') THEN '' ELSE email_status_reason END,
+            email_status_at = CASE WHEN email IS NOT NULLIF(?2, '') THEN NULL ELSE email_status_at END
+        WHERE id = ?5
+    `,
+		user.Name,
+		user.Email,
+		user.EmailCanonical,
+		user.Avatar,
+		user.ID,
+	)
+
+	if isUniqueViolation(err) { // такой email уже занят
+		return false, storage.ErrUserExists
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to update user: %w", err)
+	}
+
+	return true, nil
+}
+
+// SetUserStatus меняет статус учётной записи. Нулевой until означает бессрочную блокировку.
+func (s *Storage) SetUserStatus(ctx context.Context, id string, status models.UserStatus, reason string, until time.Time) (bool, error) {
+	res, err := s.conn(ctx).ExecContext(ctx, "UPDATE users SET status = ?, status_reason = ?, suspended_until = ? WHERE id = ?",
+		status,
+		reason,
+		timeValue(until),
+		id,
+	)
+	if err != nil {
+		return false, fmt.Errorf("failed to set user status: %w", err)
+	}
+
+	if n, _ := res.RowsAffected(); n == 0 {
+		return false, storage.ErrUserNotFound
+	}
+
+	return true, nil
+}
+
+func (s *Storage) DeleteUser(ctx context.Context, id string) (bool, error) {
+	if _, err := s.conn(ctx).ExecContext(ctx, "DELETE FROM users WHERE id = ?", id); err != nil {
+		return false, fmt.Errorf("failed to delete user: %w", err)
+	}
+
+	return true, nil
+}
+
+// CreateVerificationToken сохраняет новый верификационный токен пользователя.
+// Все ранее выданные токены пользователя удаляются в той же транзакции,
+// поэтому после повторной отправки письма работает только последняя ссылка.
+func (s *Storage) CreateVerificationToken(ctx context.Context, userID string, token string, expiresAt time.Time) (bool, error) {
+	err := s.atomic(ctx, func(ctx context.Context) error {
+		if _, err := s.conn(ctx).ExecContext(ctx, "DELETE FROM verification_tokens WHERE user_id = ?", userID); err != nil {
+			return fmt.Errorf("failed to invalidate verification tokens: %w", err)
+		}
+
+		_, err := s.conn(ctx).ExecContext(ctx, "INSERT INTO verification_tokens(user_id, token, expires_at) VALUES(?, ?, ?)",
+			userID, token, timeValue(expiresAt))
+		switch {
+		case isUniqueViolation(err):
+			return storage.ErrTokenExists
+		case isForeignKeyViolation(err):
+			return fmt.Errorf("failed to create verification token: %w", storage.ErrUserNotFound)
+		case err != nil:
+			return fmt.Errorf("failed to create verification token: %w", err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// VerifyToken погашает токен и подтверждает пользователя в одной транзакции.
+// Возвращает id подтверждённого пользователя.
+// Токен удаляется при первом использовании, повторный запрос вернёт ErrTokenNotFound.
+func (s *Storage) VerifyToken(ctx context.Context, token string) (string, error) {
+	var userID string
+	var expiresAt time.Time
+	var expired bool
+
+	err := s.atomic(ctx, func(ctx context.Context) error {
+		err := s.conn(ctx).QueryRowContext(ctx, "DELETE FROM verification_tokens WHERE token = ? RETURNING user_id, expires_at", token).
+			Scan(&userID, scanTime{&expiresAt})
+		if errors.Is(err, sql.ErrNoRows) {
+			return storage.ErrTokenNotFound
+		}
+		if err != nil {
+			return fmt.Errorf("failed to get verification token: %w", err)
+		}
+
+		// просроченный токен тоже удаляем, он больше никогда не пригодится
+		if time.Now().UTC().After(expiresAt) {
+			expired = true
+			return nil
+		}
+
+		// числовой код для этого email тоже больше не нужен
+		if _, err := s.conn(ctx).ExecContext(ctx, "DELETE FROM verification_codes WHERE user_id = ? AND channel = ?", userID, models.CodeChannelEmail); err != nil {
+			return fmt.Errorf("failed to delete verification code: %w", err)
+		}
+
+		if _, err := s.conn(ctx).ExecContext(ctx, "UPDATE users SET verify = 1 WHERE id = ?", userID); err != nil {
+			return fmt.Errorf("failed to update user: %w", err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if expired {
+		return "", storage.ErrTokenExpired
+	}
+
+	return userID, nil
+}
+
+// PurgeExpiredVerificationTokens удаляет токены, истёкшие до before, и возвращает их количество
+func (s *Storage) PurgeExpiredVerificationTokens(ctx context.Context, before time.Time) (int64, error) {
+	res, err := s.conn(ctx).ExecContext(ctx, "DELETE FROM verification_tokens WHERE expires_at < ?", timeValue(before))
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge verification tokens: %w", err)
+	}
+
+	return res.RowsAffected()
+}
+
+// CreateVerificationCode сохраняет хэш нового кода пользователя для канала channel.
+// Предыдущий код этого канала перезаписывается. Счётчики попыток и выпусков сбрасываются
+// только с началом нового окна limits.Window; если код запрошен раньше limits.ResendCooldown
+// или в окне уже выпущено limits.MaxIssues кодов, возвращает ErrTooManyCodes.
+func (s *Storage) CreateVerificationCode(ctx context.Context, userID string, channel models.CodeChannel, codeHash []byte, expiresAt time.Time, limits models.CodeLimits) (bool, error) {
+	now := time.Now().UTC()
+
+	var issues int
+	err := s.conn(ctx).QueryRowContext(ctx, `
+        INSERT INTO verification_codes(user_id, channel, code_hash, attempts, expires_at, issued_at, window_started_at, issues)
+        VALUES(?1, ?2, ?3, 0, ?4, ?5, ?5, 1)
+        ON CONFLICT (user_id, channel) DO UPDATE SET
+            code_hash = excluded.code_hash,
+            expires_at = excluded.expires_at,
+            issued_at = excluded.issued_at,
+            attempts = CASE WHEN verification_codes.window_started_at <= ?6 THEN 0 ELSE verification_codes.attempts END,
+            issues = CASE WHEN verification_codes.window_started_at <= ?6 THEN 1 ELSE verification_codes.issues + 1 END,
+            window_started_at = CASE WHEN verification_codes.window_started_at <= ?6 THEN excluded.window_started_at ELSE verification_codes.window_started_at END
+        WHERE verification_codes.issued_at <= ?7
+            AND (verification_codes.window_started_at <= ?6 OR ?8 = 0 OR verification_codes.issues < ?8)
+        RETURNING issues
+    `, userID, channel, codeHash, timeValue(expiresAt), timeValue(now), timeValue(now.Add(-limits.Window)), timeValue(now.Add(-limits.ResendCooldown)), limits.MaxIssues).Scan(&issues)
+
+	if errors.Is(err, sql.ErrNoRows) { // код есть, а условие WHERE не выполнено
+		return false, storage.ErrTooManyCodes
+	}
+	if isForeignKeyViolation(err) { // пользователя нет
+		return false, storage.ErrUserNotFound
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to create verification code: %w", err)
+	}
+
+	return true, nil
+}
+
+// VerificationCode возвращает действующий код пользователя для канала channel
+func (s *Storage) VerificationCode(ctx context.Context, userID string, channel models.CodeChannel) (models.VerificationCode, error) {
+	var code models.VerificationCode
+
+	err := s.conn(ctx).QueryRowContext(ctx, `
+        SELECT user_id, channel, code_hash, attempts, expires_at, issued_at, window_started_at, issues
+        FROM verification_codes WHERE user_id = ? AND channel = ?
+    `, userID, channel).Scan(
+		&code.UserID,
+		&code.Channel,
+		&code.CodeHash,
+		&code.Attempts,
+		scanTime{&code.ExpiresAt},
+		scanTime{&code.IssuedAt},
+		scanTime{&code.WindowStartedAt},
+		&code.Issues,
+	)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.VerificationCode{}, storage.ErrTokenNotFound
+	}
+
+	if err != nil {
+		return models.VerificationCode{}, fmt.Errorf("failed to get verification code: %w", err)
+	}
+
+	return code, nil
+}
+
+// AddVerificationCodeAttempt атомарно расходует одну попытку ввода кода.
+// Если попытки закончились, возвращает ErrTooManyAttempts.
+func (s *Storage) AddVerificationCodeAttempt(ctx context.Context, userID string, channel models.CodeChannel, maxAttempts int) (int, error) {
+	var attempts int
+
+	err := s.conn(ctx).QueryRowContext(ctx, `
+        UPDATE verification_codes SET attempts = attempts + 1
+        WHERE user_id = ? AND channel = ? AND attempts < ?
+        RETURNING attempts
+    `, userID, channel, maxAttempts).Scan(&attempts)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, storage.ErrTooManyAttempts
+	}
+
+	if err != nil {
+		return 0, fmt.Errorf("failed to count verification code attempt: %w", err)
+	}
+
+	return attempts, nil
+}
+
+// ConsumeVerificationCode погашает код и подтверждает канал в одной транзакции:
+// для email - адрес пользователя (неиспользованные ссылки-токены тоже удаляются),
+// для sms - номер телефона. Код второго фактора (login_challenge) ничего не подтверждает.
+func (s *Storage) ConsumeVerificationCode(ctx context.Context, userID string, channel models.CodeChannel) (bool, error) {
+	err := s.atomic(ctx, func(ctx context.Context) error {
+		res, err := s.conn(ctx).ExecContext(ctx, "DELETE FROM verification_codes WHERE user_id = ? AND channel = ?", userID, channel)
+		if err != nil {
+			return fmt.Errorf("failed to delete verification code: %w", err)
+		}
+
+		// код уже погашен параллельным запросом
+		if n, _ := res.RowsAffected(); n == 0 {
+			return storage.ErrTokenNotFound
+		}
+
+		switch channel {
+		case models.CodeChannelSMS:
+			if _, err := s.conn(ctx).ExecContext(ctx, "UPDATE users SET phone_verified = 1 WHERE id = ?", userID); err != nil {
+				return fmt.Errorf("failed to update user: %w", err)
+			}
+		case models.CodeChannelEmail:
+			if _, err := s.conn(ctx).ExecContext(ctx, "DELETE FROM verification_tokens WHERE user_id = ?", userID); err != nil {
+				return fmt.Errorf("failed to delete verification tokens: %w", err)
+			}
+
+			if _, err := s.conn(ctx).ExecContext(ctx, "UPDATE users SET verify = 1 WHERE id = ?", userID); err != nil {
+				return fmt.Errorf("failed to update user: %w", err)
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// PurgeExpiredVerificationCodes удаляет коды, истёкшие до before, и возвращает их количество
+func (s *Storage) PurgeExpiredVerificationCodes(ctx context.Context, before time.Time) (int64, error) {
+	res, err := s.conn(ctx).ExecContext(ctx, "DELETE FROM verification_codes WHERE expires_at < ?", timeValue(before))
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge verification codes: %w", err)
+	}
+
+	return res.RowsAffected()
+}
+
+// UserEmails возвращает id, email и email_canonical всех пользователей с email.
+// Используется отчётом о коллизиях адресов (cmd/emailreport).
+func (s *Storage) UserEmails(ctx context.Context) ([]models.User, error) {
+	rows, err := s.conn(ctx).QueryContext(ctx, "SELECT id, email, COALESCE(email_canonical, '') FROM users WHERE email IS NOT NULL ORDER BY created_at, rowid")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user emails: %w", err)
+	}
+	defer rows.Close()
+
+	var users []models.User
+	for rows.Next() {
+		var user models.User
+		if err := rows.Scan(&user.ID, &user.Email, &user.EmailCanonical); err != nil {
+			return nil, fmt.Errorf("failed to scan user email: %w", err)
+		}
+		users = append(users, user)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate over user emails: %w", err)
+	}
+
+	return users, nil
+}
+
+// UsernameAvailable проверяет, что хэндл со скелетом skeleton не занят и не удерживается
+// историей другого пользователя. Собственные хэндлы userID считаются свободными.
+func (s *Storage) UsernameAvailable(ctx context.Context, userID string, skeleton string, now time.Time) (bool, error) {
+	var taken bool
+
+	err := s.conn(ctx).QueryRowContext(ctx, `
+        SELECT EXISTS (SELECT 1 FROM users WHERE username_skeleton = ?1 AND id <> ?2)
+            OR EXISTS (SELECT 1 FROM username_history WHERE username_skeleton = ?1 AND held_until > ?3 AND user_id <> ?2)
+    `, skeleton, userID, timeValue(now)).Scan(&taken)
+	if err != nil {
+		return false, fmt.Errorf("failed to check username: %w", err)
+	}
+
+	return !taken, nil
+}
+
+// ChangeUsername устанавливает хэндл пользователю. Сменить хэндл можно не чаще раза в cooldown;
+// прежний хэндл записывается в историю и удерживается за пользователем в течение hold.
+func (s *Storage) ChangeUsername(ctx context.Context, userID string, username string, skeleton string, now time.Time, cooldown time.Duration, hold time.Duration) error {
+	return s.atomic(ctx, func(ctx context.Context) error {
+		var oldUsername, oldSkeleton string
+		var changedAt time.Time
+
+		// транзакции открываются с BEGIN IMMEDIATE (см. pkg/sqlite), поэтому строку никто не изменит до конца транзакции
+		err := s.conn(ctx).QueryRowContext(ctx, `
+            SELECT COALESCE(username, ''), COALESCE(username_skeleton, ''), username_changed_at
+            FROM users WHERE id = ?
+        `, userID).Scan(&oldUsername, &oldSkeleton, scanTime{&changedAt})
+		if errors.Is(err, sql.ErrNoRows) {
+			return storage.ErrUserNotFound
+		}
+		if err != nil {
+			return fmt.Errorf("failed to get user: %w", err)
+		}
+
+		if oldUsername == username {
+			return nil
+		}
+
+		// первый выбор хэндла не ограничен
+		if !changedAt.IsZero() && now.Before(changedAt.Add(cooldown)) {
+			return storage.ErrUsernameChangeTooSoon
+		}
+
+		var held bool
+		err = s.conn(ctx).QueryRowContext(ctx, `
+            SELECT EXISTS (SELECT 1 FROM username_history WHERE username_skeleton = ? AND held_until > ? AND user_id <> ?)
+        `, skeleton, timeValue(now), userID).Scan(&held)
+		if err != nil {
+			return fmt.Errorf("failed to check username history: %w", err)
+		}
+		if held {
+			return storage.ErrUsernameTaken
+		}
+
+		_, err = s.conn(ctx).ExecContext(ctx, "UPDATE users SET username = ?, username_skeleton = ?, username_changed_at = ? WHERE id = ?",
+			username, skeleton, timeValue(now), userID)
+		if isUniqueViolation(err) {
+			return storage.ErrUsernameTaken
+		}
+		if err != nil {
+			return fmt.Errorf("failed to change username: %w", err)
+		}
+
+		if oldUsername != "" {
+			_, err = s.conn(ctx).ExecContext(ctx, `
+                INSERT INTO username_history(user_id, username, username_skeleton, changed_at, held_until)
+                VALUES(?, ?, ?, ?, ?)
+            `, userID, oldUsername, oldSkeleton, timeValue(now), timeValue(now.Add(hold)))
+			if err != nil {
+				return fmt.Errorf("failed to save username history: %w", err)
+			}
+		}
+
+		return nil
+	})
+}
+
+// UsernameHistory возвращает прежние хэндлы пользователя, последние - первыми
+func (s *Storage) UsernameHistory(ctx context.Context, userID string) ([]models.UsernameChange, error) {
+	rows, err := s.conn(ctx).QueryContext(ctx, `
+        SELECT user_id, username, changed_at, held_until FROM username_history
+        WHERE user_id = ? ORDER BY changed_at DESC, id DESC
+    `, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get username history: %w", err)
+	}
+	defer rows.Close()
+
+	var history []models.UsernameChange
+	for rows.Next() {
+		var change models.UsernameChange
+		if err := rows.Scan(&change.UserID, &change.Username, scanTime{&change.ChangedAt}, scanTime{&change.HeldUntil}); err != nil {
+			return nil, fmt.Errorf("failed to scan username change: %w", err)
+		}
+		history = append(history, change)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate over username history: %w", err)
+	}
+
+	return history, nil
+}
@@ -0,0 +1,113 @@
+package sqlitestorage
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/DenisBochko/yandex_SSO/internal/domain/models"
+	"github.com/DenisBochko/yandex_SSO/internal/migrations"
+	"github.com/DenisBochko/yandex_SSO/internal/storage"
+	"github.com/DenisBochko/yandex_SSO/internal/storage/storagetest"
+	"github.com/DenisBochko/yandex_SSO/pkg/sqlite"
+
+	"github.com/stretchr/testify/require"
+)
+
+// newStorage создаёт хранилище на пустой базе во временном каталоге теста
+func newStorage(t *testing.T) *Storage {
+	db, err := sqlite.New(context.Background(), sqlite.SqliteConfig{
+		Path:        filepath.Join(t.TempDir(), "sso.db"),
+		BusyTimeout: 5 * time.Second,
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { db.Close() })
+
+	m, err := migrations.NewSqlite(db)
+	require.NoError(t, err)
+	require.NoError(t, m.Up(context.Background()))
+
+	return New(db)
+}
+
+func TestStorage(t *testing.T) {
+	storagetest.RunStorage(t, func(t *testing.T) storagetest.Storage {
+		return newStorage(t)
+	})
+}
+
+func TestWebhooks(t *testing.T) {
+	storagetest.RunWebhooks(t, func(t *testing.T) storagetest.WebhookStorage {
+		return newStorage(t)
+	})
+}
+
+// Ошибка метода внутри InTx откатывает только его изменения, остальная транзакция фиксируется
+func TestAtomicInsideTx(t *testing.T) {
+	s := newStorage(t)
+	ctx := context.Background()
+
+	id, err := s.SaveUser(ctx, "user", "alice@example.com", "alice@example.com", []byte("hash"))
+	require.NoError(t, err)
+	other, err := s.SaveUser(ctx, "other", "bob@example.com", "bob@example.com", []byte("hash"))
+	require.NoError(t, err)
+
+	_, err = s.CreateVerificationToken(ctx, id, "alice-token", time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	_, err = s.CreateVerificationToken(ctx, other, "bob-token", time.Now().Add(time.Hour))
+	require.NoError(t, err)
+
+	err = s.InTx(ctx, func(ctx context.Context) error {
+		// удаление прежних токенов bob откатывается вместе с неудачной вставкой
+		_, err := s.CreateVerificationToken(ctx, other, "alice-token", time.Now().Add(time.Hour))
+		require.ErrorIs(t, err, storage.ErrTokenExists)
+
+		_, err = s.SetUserStatus(ctx, id, models.UserStatusBanned, "test", time.Time{})
+		return err
+	})
+	require.NoError(t, err)
+
+	userID, err := s.VerifyToken(ctx, "bob-token")
+	require.NoError(t, err)
+	require.Equal(t, other, userID)
+
+	user, err := s.UserById(ctx, id)
+	require.NoError(t, err)
+	require.Equal(t, models.UserStatusBanned, user.Status)
+}
+
+// Запись из нескольких горутин ждёт блокировки, а не падает с SQLITE_BUSY
+func TestConcurrentWrites(t *testing.T) {
+	s := newStorage(t)
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 20)
+	for i := range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			email := fmt.Sprintf("user%d@example.com", i)
+			errs <- s.InTx(ctx, func(ctx context.Context) error {
+				id, err := s.SaveUser(ctx, "user", email, email, []byte("hash"))
+				if err != nil {
+					return err
+				}
+				return s.SaveOutboxMessage(ctx, models.OutboxMessage{AggregateID: id, Topic: "users", Kind: "registered", Payload: []byte("{}")})
+			})
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		require.NoError(t, err)
+	}
+
+	count, _, err := s.OutboxBacklog(ctx)
+	require.NoError(t, err)
+	require.EqualValues(t, 20, count)
+}
@@ -0,0 +1,78 @@
+package sqlitestorage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// conn - общее подмножество sql.DB и sql.Tx, через которое работают все методы Storage
+type conn interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+type txKey struct{}
+
+// conn возвращает транзакцию, открытую InTx выше по стеку, или пул соединений
+func (s *Storage) conn(ctx context.Context) conn {
+	if tx, ok := ctx.Value(txKey{}).(*sql.Tx); ok {
+		return tx
+	}
+	return s.db
+}
+
+// InTx выполняет fn в одной транзакции: все методы Storage, вызванные с переданным в fn контекстом,
+// работают в ней. Если fn вернула ошибку, транзакция откатывается. Вложенный InTx использует внешнюю транзакцию.
+func (s *Storage) InTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	if _, ok := ctx.Value(txKey{}).(*sql.Tx); ok {
+		return fn(ctx)
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := fn(context.WithValue(ctx, txKey{}, tx)); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// atomic выполняет fn, состоящую из нескольких запросов, атомарно. Внутри InTx вместо новой
+// транзакции открывается savepoint: ошибка fn откатывает только её изменения, как вложенный Begin в pgx.
+func (s *Storage) atomic(ctx context.Context, fn func(ctx context.Context) error) error {
+	tx, ok := ctx.Value(txKey{}).(*sql.Tx)
+	if !ok {
+		return s.InTx(ctx, fn)
+	}
+
+	if _, err := tx.ExecContext(ctx, "SAVEPOINT atomic"); err != nil {
+		return fmt.Errorf("failed to create savepoint: %w", err)
+	}
+
+	if err := fn(ctx); err != nil {
+		// savepoint откатывается, но не снимается: RELEASE нужен в обоих случаях
+		if _, rbErr := tx.ExecContext(ctx, "ROLLBACK TO atomic"); rbErr != nil {
+			return fmt.Errorf("failed to roll back to savepoint: %w", rbErr)
+		}
+		if _, relErr := tx.ExecContext(ctx, "RELEASE atomic"); relErr != nil {
+			return fmt.Errorf("failed to release savepoint: %w", relErr)
+		}
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, "RELEASE atomic"); err != nil {
+		return fmt.Errorf("failed to release savepoint: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,88 @@
+package sqlitestorage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// isUniqueViolation сообщает, что запрос нарушил ограничение уникальности или первичный ключ
+func isUniqueViolation(err error) bool {
+	var sqliteErr sqlite3.Error
+	if !errors.As(err, &sqliteErr) {
+		return false
+	}
+
+	return sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique || sqliteErr.ExtendedCode == sqlite3.ErrConstraintPrimaryKey
+}
+
+// isForeignKeyViolation сообщает, что запрос сослался на несуществующую строку, обычно пользователя
+func isForeignKeyViolation(err error) bool {
+	var sqliteErr sqlite3.Error
+	return errors.As(err, &sqliteErr) && sqliteErr.ExtendedCode == sqlite3.ErrConstraintForeignKey
+}
+
+// timeValue переводит время в микросекунды unix - так время хранится во всех колонках.
+// Нулевое время записывается как NULL.
+func timeValue(t time.Time) any {
+	if t.IsZero() {
+		return nil
+	}
+	return t.UnixMicro()
+}
+
+// scanTime читает колонку времени. NULL оставляет нулевое время.
+type scanTime struct {
+	t *time.Time
+}
+
+func (s scanTime) Scan(src any) error {
+	switch v := src.(type) {
+	case nil:
+		*s.t = time.Time{}
+	case int64:
+		*s.t = time.UnixMicro(v).UTC()
+	default:
+		return fmt.Errorf("unexpected time value %T", src)
+	}
+	return nil
+}
+
+// jsonValue сериализует map или срез в текст колонки
+func jsonValue(v any) (string, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// scanJSON читает колонку с JSON в значение, на которое указывает v
+type scanJSON struct {
+	v any
+}
+
+func (s scanJSON) Scan(src any) error {
+	switch v := src.(type) {
+	case string:
+		return json.Unmarshal([]byte(v), s.v)
+	case []byte:
+		return json.Unmarshal(v, s.v)
+	default:
+		return fmt.Errorf("unexpected json value %T", src)
+	}
+}
+
+// placeholders возвращает список "?, ?, ?" для условия IN и аргументы к нему
+func placeholders[T any](values []T) (string, []any) {
+	args := make([]any, len(values))
+	for i, v := range values {
+		args[i] = v
+	}
+
+	return strings.TrimSuffix(strings.Repeat("?, ", len(values)), ", "), args
+}
@@ -0,0 +1,325 @@
+package sqlitestorage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/DenisBochko/yandex_SSO/internal/domain/models"
+	"github.com/DenisBochko/yandex_SSO/internal/storage"
+
+	"github.com/google/uuid"
+)
+
+const webhookSubscriptionColumns = "id, url, event_types, description, active, created_at, updated_at"
+
+// scanWebhookSubscription читает подписку из строки, выбранной по webhookSubscriptionColumns
+func scanWebhookSubscription(row interface{ Scan(dest ...any) error }) (models.WebhookSubscription, error) {
+	var sub models.WebhookSubscription
+
+	err := row.Scan(&sub.ID, &sub.URL, scanJSON{&sub.EventTypes}, &sub.Description, &sub.Active,
+		scanTime{&sub.CreatedAt}, scanTime{&sub.UpdatedAt})
+
+	return sub, err
+}
+
+// SaveWebhookSubscription создаёт подписку и возвращает её id
+func (s *Storage) SaveWebhookSubscription(ctx context.Context, sub models.WebhookSubscription) (string, error) {
+	eventTypes, err := jsonValue(sub.EventTypes)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode webhook event types: %w", err)
+	}
+
+	id := uuid.NewString()
+	now := timeValue(time.Now())
+
+	_, err = s.conn(ctx).ExecContext(ctx, `
+        INSERT INTO webhook_subscriptions(id, url, event_types, secret, description, active, created_at, updated_at)
+        VALUES(?, ?, ?, ?, ?, ?, ?, ?)
+    `, id, sub.URL, eventTypes, sub.Secret, sub.Description, sub.Active, now, now)
+	if err != nil {
+		return "", fmt.Errorf("failed to save webhook subscription: %w", err)
+	}
+
+	return id, nil
+}
+
+// WebhookSubscriptions возвращает все подписки без секретов
+func (s *Storage) WebhookSubscriptions(ctx context.Context) ([]models.WebhookSubscription, error) {
+	rows, err := s.conn(ctx).QueryContext(ctx, "SELECT "+webhookSubscriptionColumns+" FROM webhook_subscriptions ORDER BY created_at, rowid")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get webhook subscriptions: %w", err)
+	}
+	defer rows.Close()
+
+	var subs []models.WebhookSubscription
+	for rows.Next() {
+		sub, err := scanWebhookSubscription(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan webhook subscription: %w", err)
+		}
+		subs = append(subs, sub)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate over webhook subscriptions: %w", err)
+	}
+
+	return subs, nil
+}
+
+// WebhookSubscription возвращает подписку без секрета
+func (s *Storage) WebhookSubscription(ctx context.Context, id string) (models.WebhookSubscription, error) {
+	sub, err := scanWebhookSubscription(s.conn(ctx).QueryRowContext(ctx, "SELECT "+webhookSubscriptionColumns+" FROM webhook_subscriptions WHERE id = ?", id))
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return models.WebhookSubscription{}, storage.ErrSubscriptionNotFound
+	}
+	if err != nil {
+		return models.WebhookSubscription{}, fmt.Errorf("failed to get webhook subscription: %w", err)
+	}
+
+	return sub, nil
+}
+
+// UpdateWebhookSubscription меняет адрес, типы событий, описание и активность подписки.
+// Пустой Secret оставляет прежний.
+func (s *Storage) UpdateWebhookSubscription(ctx context.Context, sub models.WebhookSubscription) error {
+	eventTypes, err := jsonValue(sub.EventTypes)
+	if err != nil {
+		return fmt.Errorf("failed to encode webhook event types: %w", err)
+	}
+
+	res, err := s.conn(ctx).ExecContext(ctx, `
+        UPDATE webhook_subscriptions
+        SET url = ?, event_types = ?, description = ?, active = ?, secret = COALESCE(NULLIF(?, ''), secret), updated_at = ?
+        WHERE id = ?
+    `, sub.URL, eventTypes, sub.Description, sub.Active, sub.Secret, timeValue(time.Now()), sub.ID)
+	if err != nil {
+		return fmt.Errorf("failed to update webhook subscription: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return storage.ErrSubscriptionNotFound
+	}
+
+	return nil
+}
+
+// DeleteWebhookSubscription удаляет подписку вместе с её доставками
+func (s *Storage) DeleteWebhookSubscription(ctx context.Context, id string) error {
+	res, err := s.conn(ctx).ExecContext(ctx, "DELETE FROM webhook_subscriptions WHERE id = ?", id)
+	if err != nil {
+		return fmt.Errorf("failed to delete webhook subscription: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return storage.ErrSubscriptionNotFound
+	}
+
+	return nil
+}
+
+// EnqueueWebhookDeliveries создаёт доставку события для каждой активной подписки на его тип.
+// Внутри InTx доставки фиксируются вместе с событием. Повторная постановка того же события не дублирует доставки.
+func (s *Storage) EnqueueWebhookDeliveries(ctx context.Context, eventID string, eventType string, payload []byte) (int64, error) {
+	now := timeValue(time.Now())
+
+	res, err := s.conn(ctx).ExecContext(ctx, `
+        INSERT INTO webhook_deliveries(subscription_id, event_id, event_type, payload, next_attempt_at, created_at)
+        SELECT id, ?1, ?2, ?3, ?4, ?4 FROM webhook_subscriptions
+        WHERE active AND EXISTS (SELECT 1 FROM json_each(event_types) WHERE value = ?2)
+        ON CONFLICT (subscription_id, event_id) DO NOTHING
+    `, eventID, eventType, string(payload), now)
+	if err != nil {
+		return 0, fmt.Errorf("failed to enqueue webhook deliveries: %w", err)
+	}
+
+	return res.RowsAffected()
+}
+
+// PendingWebhookDeliveries возвращает до limit доставок, которые пора отправить, вместе с адресом и секретом подписки.
+// Доставки выключенных подписок ждут, пока подписку не включат.
+func (s *Storage) PendingWebhookDeliveries(ctx context.Context, now time.Time, limit int) ([]models.WebhookDelivery, error) {
+	rows, err := s.conn(ctx).QueryContext(ctx, `
+        SELECT d.id, d.subscription_id, d.event_id, d.event_type, d.payload, d.status, d.attempts,
+               d.next_attempt_at, d.last_error, d.created_at, s.url, s.secret
+        FROM webhook_deliveries d
+        JOIN webhook_subscriptions s ON s.id = d.subscription_id
+        WHERE d.status = 'pending' AND d.next_attempt_at <= ? AND s.active
+        ORDER BY d.next_attempt_at, d.id
+        LIMIT ?
+    `, timeValue(now), limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get pending webhook deliveries: %w", err)
+	}
+	defer rows.Close()
+
+	var deliveries []models.WebhookDelivery
+	for rows.Next() {
+		var d models.WebhookDelivery
+		var payload string
+		err := rows.Scan(&d.ID, &d.SubscriptionID, &d.EventID, &d.EventType, &payload, &d.Status, &d.Attempts,
+			scanTime{&d.NextAttemptAt}, &d.LastError, scanTime{&d.CreatedAt}, &d.URL, &d.Secret)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan webhook delivery: %w", err)
+		}
+		d.Payload = []byte(payload)
+		deliveries = append(deliveries, d)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate over webhook deliveries: %w", err)
+	}
+
+	return deliveries, nil
+}
+
+// MarkWebhookDelivered отмечает доставку успешной и записывает попытку в журнал
+func (s *Storage) MarkWebhookDelivered(ctx context.Context, id int64, attempt models.WebhookDeliveryAttempt, deliveredAt time.Time) error {
+	return s.atomic(ctx, func(ctx context.Context) error {
+		_, err := s.conn(ctx).ExecContext(ctx, `
+            UPDATE webhook_deliveries SET status = 'delivered', attempts = attempts + 1, last_error = '', delivered_at = ?
+            WHERE id = ?
+        `, timeValue(deliveredAt), id)
+		if err != nil {
+			return fmt.Errorf("failed to mark webhook delivered: %w", err)
+		}
+
+		if err := s.saveWebhookAttempt(ctx, id, attempt); err != nil {
+			return fmt.Errorf("failed to mark webhook delivered: %w", err)
+		}
+
+		return nil
+	})
+}
+
+// MarkWebhookFailed записывает неудачную попытку. При dead доставка больше не повторяется автоматически.
+func (s *Storage) MarkWebhookFailed(ctx context.Context, id int64, attempt models.WebhookDeliveryAttempt, nextAttemptAt time.Time, dead bool) error {
+	status := models.WebhookDeliveryPending
+	if dead {
+		status = models.WebhookDeliveryDead
+	}
+
+	return s.atomic(ctx, func(ctx context.Context) error {
+		_, err := s.conn(ctx).ExecContext(ctx, `
+            UPDATE webhook_deliveries SET status = ?, attempts = attempts + 1, last_error = ?, next_attempt_at = ?
+            WHERE id = ?
+        `, status, attempt.Error, timeValue(nextAttemptAt), id)
+		if err != nil {
+			return fmt.Errorf("failed to mark webhook failed: %w", err)
+		}
+
+		if err := s.saveWebhookAttempt(ctx, id, attempt); err != nil {
+			return fmt.Errorf("failed to mark webhook failed: %w", err)
+		}
+
+		return nil
+	})
+}
+
+// saveWebhookAttempt добавляет попытку в журнал доставки, если доставка ещё существует
+func (s *Storage) saveWebhookAttempt(ctx context.Context, deliveryID int64, attempt models.WebhookDeliveryAttempt) error {
+	_, err := s.conn(ctx).ExecContext(ctx, `
+        INSERT INTO webhook_delivery_attempts(delivery_id, attempt, status_code, error, response_body, duration_ms, created_at)
+        SELECT d.id, (SELECT COUNT(*) FROM webhook_delivery_attempts a WHERE a.delivery_id = d.id) + 1, ?, ?, ?, ?, ?
+        FROM webhook_deliveries d
+        WHERE d.id = ?
+    `, attempt.StatusCode, attempt.Error, attempt.ResponseBody, attempt.Duration.Milliseconds(), timeValue(time.Now()), deliveryID)
+
+	return err
+}
+
+// WebhookDeliveries возвращает до limit доставок подписки от новых к старым.
+// Пустой status - любые. beforeID - курсор следующей страницы, 0 - с начала.
+func (s *Storage) WebhookDeliveries(ctx context.Context, subscriptionID string, status models.WebhookDeliveryStatus, beforeID int64, limit int) ([]models.WebhookDelivery, error) {
+	rows, err := s.conn(ctx).QueryContext(ctx, `
+        SELECT id, subscription_id, event_id, event_type, payload, status, attempts, next_attempt_at, last_error, created_at, delivered_at
+        FROM webhook_deliveries
+        WHERE subscription_id = ?1 AND (?2 = '' OR status = ?2) AND (?3 = 0 OR id < ?3)
+        ORDER BY id DESC
+        LIMIT ?4
+    `, subscriptionID, string(status), beforeID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get webhook deliveries: %w", err)
+	}
+	defer rows.Close()
+
+	var deliveries []models.WebhookDelivery
+	for rows.Next() {
+		var d models.WebhookDelivery
+		var payload string
+		err := rows.Scan(&d.ID, &d.SubscriptionID, &d.EventID, &d.EventType, &payload, &d.Status, &d.Attempts,
+			scanTime{&d.NextAttemptAt}, &d.LastError, scanTime{&d.CreatedAt}, scanTime{&d.DeliveredAt})
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan webhook delivery: %w", err)
+		}
+		d.Payload = []byte(payload)
+		deliveries = append(deliveries, d)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate over webhook deliveries: %w", err)
+	}
+
+	return deliveries, nil
+}
+
+// WebhookDeliveryAttempts возвращает журнал попыток доставки по порядку
+func (s *Storage) WebhookDeliveryAttempts(ctx context.Context, deliveryID int64) ([]models.WebhookDeliveryAttempt, error) {
+	rows, err := s.conn(ctx).QueryContext(ctx, `
+        SELECT id, delivery_id, attempt, status_code, error, response_body, duration_ms, created_at
+        FROM webhook_delivery_attempts
+        WHERE delivery_id = ?
+        ORDER BY attempt
+    `, deliveryID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get webhook delivery attempts: %w", err)
+	}
+	defer rows.Close()
+
+	var attempts []models.WebhookDeliveryAttempt
+	for rows.Next() {
+		var a models.WebhookDeliveryAttempt
+		var durationMs int64
+		err := rows.Scan(&a.ID, &a.DeliveryID, &a.Attempt, &a.StatusCode, &a.Error, &a.ResponseBody, &durationMs, scanTime{&a.CreatedAt})
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan webhook delivery attempt: %w", err)
+		}
+		a.Duration = time.Duration(durationMs) * time.Millisecond
+		attempts = append(attempts, a)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to iterate over webhook delivery attempts: %w", err)
+	}
+
+	return attempts, nil
+}
+
+// RedeliverWebhook ставит доставку в очередь заново с полным набором попыток, в каком бы состоянии она ни была.
+// Журнал прежних попыток сохраняется.
+func (s *Storage) RedeliverWebhook(ctx context.Context, id int64, now time.Time) error {
+	res, err := s.conn(ctx).ExecContext(ctx, `
+        UPDATE webhook_deliveries SET status = 'pending', attempts = 0, next_attempt_at = ?, delivered_at = NULL
+        WHERE id = ?
+    `, timeValue(now), id)
+	if err != nil {
+		return fmt.Errorf("failed to redeliver webhook: %w", err)
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return storage.ErrDeliveryNotFound
+	}
+
+	return nil
+}
+
+// PurgeWebhookDeliveries удаляет завершённые (доставленные и dead) доставки старше before
+func (s *Storage) PurgeWebhookDeliveries(ctx context.Context, before time.Time) (int64, error) {
+	res, err := s.conn(ctx).ExecContext(ctx, "DELETE FROM webhook_deliveries WHERE status <> 'pending' AND created_at < ?", timeValue(before))
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge webhook deliveries: %w", err)
+	}
+
+	return res.RowsAffected()
+}
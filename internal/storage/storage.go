@@ -11,5 +11,13 @@ var (
     ErrTokenNotFound = errors.New("token not found")
     ErrTokenExpired = errors.New("token expired")
     ErrKeyDoesNotExist = errors.New("key does not exist")
+    ErrTooManyAttempts = errors.New("too many attempts")
+    ErrTooManyCodes = errors.New("verification code requested too often")
+    ErrPhoneExists = errors.New("phone already in use")
+    ErrUsernameTaken = errors.New("username already taken")
+    ErrUsernameChangeTooSoon = errors.New("username changed too recently")
+    ErrEventNotFound = errors.New("security event not found")
+    ErrSubscriptionNotFound = errors.New("webhook subscription not found")
+    ErrDeliveryNotFound = errors.New("webhook delivery not found")
 )
 
@@ -0,0 +1,37 @@
+package storagetest
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/color"
+	"image/png"
+	"strings"
+	"testing"
+
+	"github.com/DenisBochko/yandex_SSO/internal/services/users"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+// RunObjects прогоняет набор тестов хранилища фото профиля
+func RunObjects(t *testing.T, newObjects func(t *testing.T) users.MinIoStorage) {
+	t.Run("UploadPhoto", func(t *testing.T) {
+		s := newObjects(t)
+		id := uuid.NewString()
+
+		img := image.NewRGBA(image.Rect(0, 0, 64, 32))
+		img.Set(1, 1, color.RGBA{R: 255, A: 255})
+
+		var buf bytes.Buffer
+		require.NoError(t, png.Encode(&buf, img))
+
+		url, err := s.UploadPhoto(context.Background(), id, buf.Bytes(), "image/png", "avatar.png")
+		require.NoError(t, err)
+		require.True(t, strings.HasSuffix(url, "/"+id+"_avatar.png"), url)
+
+		_, err = s.UploadPhoto(context.Background(), id, []byte("not an image"), "image/png", "avatar.png")
+		require.ErrorContains(t, err, "failed to decode image")
+	})
+}
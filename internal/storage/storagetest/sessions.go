@@ -0,0 +1,86 @@
+package storagetest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DenisBochko/yandex_SSO/internal/domain/models"
+	"github.com/DenisBochko/yandex_SSO/internal/services/auth"
+	"github.com/DenisBochko/yandex_SSO/internal/storage"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+// RunSessions прогоняет набор тестов хранилища сессий. newSessions вызывается в каждом подтесте
+// и должна возвращать пустое хранилище с временем жизни сессий не меньше минуты.
+func RunSessions(t *testing.T, newSessions func(t *testing.T) auth.RedisStorage) {
+	t.Run("Session", func(t *testing.T) {
+		s := newSessions(t)
+		ctx := context.Background()
+
+		token := uuid.NewString()
+		session := models.Session{
+			UserID:   uuid.NewString(),
+			AuthTime: time.Now().UTC().Truncate(time.Second),
+			AMR:      []string{"pwd", "otp"},
+			ACR:      "urn:sso:acr:mfa",
+		}
+
+		_, err := s.Session(ctx, token)
+		require.ErrorIs(t, err, storage.ErrKeyDoesNotExist)
+
+		require.NoError(t, s.SaveSession(ctx, token, session))
+
+		got, err := s.Session(ctx, token)
+		require.NoError(t, err)
+		require.Equal(t, session.UserID, got.UserID)
+		require.True(t, session.AuthTime.Equal(got.AuthTime))
+		require.Equal(t, session.AMR, got.AMR)
+		require.Equal(t, session.ACR, got.ACR)
+
+		require.NoError(t, s.Delete(ctx, token))
+
+		_, err = s.Session(ctx, token)
+		require.ErrorIs(t, err, storage.ErrKeyDoesNotExist)
+
+		// удаление отсутствующего токена ошибкой не считается
+		require.NoError(t, s.Delete(ctx, token))
+	})
+
+	t.Run("DeleteUserSessions", func(t *testing.T) {
+		s := newSessions(t)
+		ctx := context.Background()
+
+		userID := uuid.NewString()
+		otherID := uuid.NewString()
+
+		tokens := []string{uuid.NewString(), uuid.NewString(), uuid.NewString()}
+		for _, token := range tokens {
+			require.NoError(t, s.SaveSession(ctx, token, models.Session{UserID: userID}))
+		}
+
+		otherToken := uuid.NewString()
+		require.NoError(t, s.SaveSession(ctx, otherToken, models.Session{UserID: otherID}))
+
+		// уже удалённый токен в количество не входит
+		require.NoError(t, s.Delete(ctx, tokens[0]))
+
+		deleted, err := s.DeleteUserSessions(ctx, userID)
+		require.NoError(t, err)
+		require.EqualValues(t, 2, deleted)
+
+		for _, token := range tokens {
+			_, err := s.Session(ctx, token)
+			require.ErrorIs(t, err, storage.ErrKeyDoesNotExist)
+		}
+
+		_, err = s.Session(ctx, otherToken)
+		require.NoError(t, err)
+
+		deleted, err = s.DeleteUserSessions(ctx, userID)
+		require.NoError(t, err)
+		require.Zero(t, deleted)
+	})
+}
@@ -0,0 +1,864 @@
+// Package storagetest - общий набор тестов для реализаций хранилищ. Каждая реализация
+// (postgres, sqlite, redis, minIO и memory) прогоняет его в своих тестах, так семантика ошибок
+// (storage.ErrUserExists, ErrUserNotFound, ErrTokenExpired...) остаётся одинаковой у всех бэкендов.
+package storagetest
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	outboxapp "github.com/DenisBochko/yandex_SSO/internal/app/outbox"
+	"github.com/DenisBochko/yandex_SSO/internal/domain/models"
+	"github.com/DenisBochko/yandex_SSO/internal/services/auth"
+	"github.com/DenisBochko/yandex_SSO/internal/services/risk"
+	"github.com/DenisBochko/yandex_SSO/internal/services/users"
+	"github.com/DenisBochko/yandex_SSO/internal/storage"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+// Storage - всё, что сервисы и фоновые процессы ждут от основного хранилища
+type Storage interface {
+	auth.Storage
+	users.Storage
+	risk.Storage
+	outboxapp.Storage
+
+	SaveOutboxMessage(ctx context.Context, message models.OutboxMessage) error
+	PurgeExpiredVerificationTokens(ctx context.Context, before time.Time) (int64, error)
+	PurgeExpiredVerificationCodes(ctx context.Context, before time.Time) (int64, error)
+	PurgeExpiredSessionRevokeTokens(ctx context.Context, before time.Time) (int64, error)
+	PurgeSecurityEvents(ctx context.Context, before time.Time) (int64, error)
+	PurgePublishedOutbox(ctx context.Context, before time.Time) (int64, error)
+}
+
+// RunStorage прогоняет набор тестов основного хранилища. newStorage вызывается в каждом подтесте
+// и должна возвращать пустое хранилище.
+func RunStorage(t *testing.T, newStorage func(t *testing.T) Storage) {
+	tests := []struct {
+		name string
+		run  func(t *testing.T, s Storage)
+	}{
+		{"Users", testUsers},
+		{"PhoneUsers", testPhoneUsers},
+		{"UserByEmailFallback", testUserByEmailFallback},
+		{"UpdateUser", testUpdateUser},
+		{"UserStatus", testUserStatus},
+		{"DeleteUser", testDeleteUser},
+		{"VerificationTokens", testVerificationTokens},
+		{"VerificationTokenSingleUse", testVerificationTokenSingleUse},
+		{"VerificationCodes", testVerificationCodes},
+		{"VerificationCodeLimits", testVerificationCodeLimits},
+		{"Usernames", testUsernames},
+		{"EmailStatus", testEmailStatus},
+		{"SecurityEvents", testSecurityEvents},
+		{"KnownDevices", testKnownDevices},
+		{"SessionRevokeTokens", testSessionRevokeTokens},
+		{"Outbox", testOutbox},
+		{"InTx", testInTx},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.run(t, newStorage(t))
+		})
+	}
+}
+
+// now - текущее время с точностью postgres
+func now() time.Time {
+	return time.Now().UTC().Truncate(time.Microsecond)
+}
+
+func saveUser(t *testing.T, s Storage, email string) string {
+	t.Helper()
+
+	id, err := s.SaveUser(context.Background(), "user", email, email, []byte("hash"))
+	require.NoError(t, err)
+	require.NotEmpty(t, id)
+	return id
+}
+
+func testUsers(t *testing.T, s Storage) {
+	ctx := context.Background()
+
+	id := saveUser(t, s, "alice@example.com")
+
+	_, err := s.SaveUser(ctx, "other", "alice@example.com", "alice@example.com", []byte("hash"))
+	require.ErrorIs(t, err, storage.ErrUserExists)
+
+	// разный исходный адрес, но одинаковый канонический
+	_, err = s.SaveUser(ctx, "other", "Alice@Example.com", "alice@example.com", []byte("hash"))
+	require.ErrorIs(t, err, storage.ErrUserExists)
+
+	user, err := s.User(ctx, "ALICE@example.com", "alice@example.com")
+	require.NoError(t, err)
+	require.Equal(t, id, user.ID)
+	require.Equal(t, "user", user.Name)
+	require.Equal(t, []byte("hash"), user.PassHash)
+	require.False(t, user.Verified)
+	require.Equal(t, models.UserStatusActive, user.Status)
+	require.Equal(t, models.EmailStatusOK, user.EmailStatus)
+
+	_, err = s.User(ctx, "bob@example.com", "bob@example.com")
+	require.ErrorIs(t, err, storage.ErrUserNotFound)
+
+	byID, err := s.UserById(ctx, id)
+	require.NoError(t, err)
+	require.Equal(t, user, byID)
+
+	_, err = s.UserById(ctx, uuid.NewString())
+	require.ErrorIs(t, err, storage.ErrUserNotFound)
+
+	_, err = s.UserById(ctx, "not-a-uuid")
+	require.ErrorIs(t, err, storage.ErrUserNotFound)
+
+	other := saveUser(t, s, "bob@example.com")
+
+	list, err := s.Users(ctx, []string{id, other, uuid.NewString()})
+	require.NoError(t, err)
+	require.Len(t, list, 2)
+	require.ElementsMatch(t, []string{id, other}, []string{list[0].ID, list[1].ID})
+}
+
+func testPhoneUsers(t *testing.T, s Storage) {
+	ctx := context.Background()
+
+	id, err := s.SavePhoneUser(ctx, "phone user", "+79990000001")
+	require.NoError(t, err)
+
+	_, err = s.SavePhoneUser(ctx, "other", "+79990000001")
+	require.ErrorIs(t, err, storage.ErrUserExists)
+
+	user, err := s.UserByPhone(ctx, "+79990000001")
+	require.NoError(t, err)
+	require.Equal(t, id, user.ID)
+	require.Empty(t, user.Email)
+	require.Empty(t, user.PassHash)
+
+	_, err = s.UserByPhone(ctx, "+79990000002")
+	require.ErrorIs(t, err, storage.ErrUserNotFound)
+
+	emailUser := saveUser(t, s, "carol@example.com")
+
+	_, err = s.SetUserPhone(ctx, emailUser, "+79990000001")
+	require.ErrorIs(t, err, storage.ErrPhoneExists)
+
+	_, err = s.SetUserPhone(ctx, uuid.NewString(), "+79990000003")
+	require.ErrorIs(t, err, storage.ErrUserNotFound)
+
+	ok, err := s.SetUserPhone(ctx, emailUser, "+79990000003")
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	user, err = s.UserById(ctx, emailUser)
+	require.NoError(t, err)
+	require.Equal(t, "+79990000003", user.Phone)
+	require.False(t, user.PhoneVerified)
+}
+
+func testUserByEmailFallback(t *testing.T, s Storage) {
+	ctx := context.Background()
+
+	// email_canonical посчитан без правил провайдера, а вход ищет по каноническому адресу с ними
+	stale, err := s.SaveUser(ctx, "user", "Bob.Smith@Gmail.COM", "bob.smith@gmail.com", []byte("hash"))
+	require.NoError(t, err)
+
+	user, err := s.User(ctx, "bob.smith@gmail.com", "bobsmith@gmail.com")
+	require.NoError(t, err)
+	require.Equal(t, stale, user.ID)
+
+	// из подходящих пользователей выбирается точное совпадение адреса, затем канонического
+	lower, err := s.SaveUser(ctx, "user", "carol@example.com", "carol@example.com", []byte("hash"))
+	require.NoError(t, err)
+	upper, err := s.SaveUser(ctx, "user", "Carol@example.com", "carol+old@example.com", []byte("hash"))
+	require.NoError(t, err)
+
+	user, err = s.User(ctx, "Carol@example.com", "carol@example.com")
+	require.NoError(t, err)
+	require.Equal(t, upper, user.ID)
+
+	user, err = s.User(ctx, "CAROL@example.com", "carol@example.com")
+	require.NoError(t, err)
+	require.Equal(t, lower, user.ID)
+}
+
+func testUpdateUser(t *testing.T, s Storage) {
+	ctx := context.Background()
+
+	id := saveUser(t, s, "dave@example.com")
+	saveUser(t, s, "erin@example.com")
+
+	_, err := s.SetEmailStatus(ctx, id, "dave@example.com", models.EmailStatusBounced, "mailbox full", now())
+	require.NoError(t, err)
+
+	user, err := s.UserById(ctx, id)
+	require.NoError(t, err)
+
+	user.Email = "erin@example.com"
+	user.EmailCanonical = "erin@example.com"
+	_, err = s.UpdateUser(ctx, user)
+	require.ErrorIs(t, err, storage.ErrUserExists)
+
+	user.Name = "David"
+	user.Email = "david@example.com"
+	user.EmailCanonical = "david@example.com"
+	user.Verified = true
+	user.Avatar = "https://example.com/avatar.png"
+	ok, err := s.UpdateUser(ctx, user)
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	updated, err := s.UserById(ctx, id)
+	require.NoError(t, err)
+	require.Equal(t, "David", updated.Name)
+	require.Equal(t, "david@example.com", updated.Email)
+	// подтверждение меняют только VerifyToken и VerifyCode: устаревшая копия пользователя его не сбросит
+	require.False(t, updated.Verified)
+	require.Equal(t, "https://example.com/avatar.png", updated.Avatar)
+	// отчёты о доставке относились к прежнему адресу
+	require.Equal(t, models.EmailStatusOK, updated.EmailStatus)
+	require.Empty(t, updated.EmailStatusReason)
+
+	// отсутствие пользователя ошибкой не считается
+	ok, err = s.UpdateUser(ctx, models.User{ID: uuid.NewString(), Name: "ghost"})
+	require.NoError(t, err)
+	require.True(t, ok)
+}
+
+func testUserStatus(t *testing.T, s Storage) {
+	ctx := context.Background()
+
+	id := saveUser(t, s, "frank@example.com")
+	until := now().Add(time.Hour)
+
+	ok, err := s.SetUserStatus(ctx, id, models.UserStatusSuspended, "spam", until)
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	user, err := s.UserById(ctx, id)
+	require.NoError(t, err)
+	require.Equal(t, models.UserStatusSuspended, user.Status)
+	require.Equal(t, "spam", user.StatusReason)
+	require.True(t, until.Equal(user.SuspendedUntil))
+
+	_, err = s.SetUserStatus(ctx, id, models.UserStatusActive, "", time.Time{})
+	require.NoError(t, err)
+
+	user, err = s.UserById(ctx, id)
+	require.NoError(t, err)
+	require.Equal(t, models.UserStatusActive, user.Status)
+	require.True(t, user.SuspendedUntil.IsZero())
+
+	_, err = s.SetUserStatus(ctx, uuid.NewString(), models.UserStatusBanned, "", time.Time{})
+	require.ErrorIs(t, err, storage.ErrUserNotFound)
+}
+
+func testDeleteUser(t *testing.T, s Storage) {
+	ctx := context.Background()
+
+	id := saveUser(t, s, "grace@example.com")
+
+	_, err := s.CreateVerificationToken(ctx, id, uuid.NewString(), now().Add(time.Hour))
+	require.NoError(t, err)
+	_, err = s.CreateVerificationCode(ctx, id, models.CodeChannelEmail, []byte("code"), now().Add(time.Hour), models.CodeLimits{})
+	require.NoError(t, err)
+	require.NoError(t, s.SaveSecurityEvent(ctx, models.SecurityEvent{UserID: id, Type: models.SecurityEventLoginSuccess}))
+	_, _, err = s.TouchKnownDevice(ctx, models.KnownDevice{UserID: id, Fingerprint: "fp", LastSeenAt: now()})
+	require.NoError(t, err)
+
+	ok, err := s.DeleteUser(ctx, id)
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	_, err = s.UserById(ctx, id)
+	require.ErrorIs(t, err, storage.ErrUserNotFound)
+
+	_, err = s.VerificationCode(ctx, id, models.CodeChannelEmail)
+	require.ErrorIs(t, err, storage.ErrTokenNotFound)
+
+	events, err := s.SecurityEvents(ctx, id, 0, 10)
+	require.NoError(t, err)
+	require.Empty(t, events)
+
+	known, err := s.IsKnownDevice(ctx, id, "fp")
+	require.NoError(t, err)
+	require.False(t, known)
+
+	// повторное удаление ошибкой не считается
+	ok, err = s.DeleteUser(ctx, id)
+	require.NoError(t, err)
+	require.True(t, ok)
+}
+
+// Одновременные переходы по одной ссылке: подтверждает только один, остальные не находят токен
+func testVerificationTokenSingleUse(t *testing.T, s Storage) {
+	ctx := context.Background()
+
+	id := saveUser(t, s, "single@example.com")
+	token := uuid.NewString()
+	_, err := s.CreateVerificationToken(ctx, id, token, now().Add(time.Hour))
+	require.NoError(t, err)
+
+	const callers = 8
+	errs := make(chan error, callers)
+	var wg sync.WaitGroup
+	for range callers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := s.VerifyToken(ctx, token)
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	var verified int
+	for err := range errs {
+		if err == nil {
+			verified++
+			continue
+		}
+		require.ErrorIs(t, err, storage.ErrTokenNotFound)
+	}
+	require.Equal(t, 1, verified)
+}
+
+func testVerificationTokens(t *testing.T, s Storage) {
+	ctx := context.Background()
+
+	id := saveUser(t, s, "heidi@example.com")
+	other := saveUser(t, s, "ivan@example.com")
+
+	first := uuid.NewString()
+	_, err := s.CreateVerificationToken(ctx, id, first, now().Add(time.Hour))
+	require.NoError(t, err)
+
+	_, err = s.CreateVerificationToken(ctx, other, first, now().Add(time.Hour))
+	require.ErrorIs(t, err, storage.ErrTokenExists)
+
+	// новый токен отменяет прежние
+	second := uuid.NewString()
+	_, err = s.CreateVerificationToken(ctx, id, second, now().Add(time.Hour))
+	require.NoError(t, err)
+
+	_, err = s.VerifyToken(ctx, first)
+	require.ErrorIs(t, err, storage.ErrTokenNotFound)
+
+	_, err = s.CreateVerificationCode(ctx, id, models.CodeChannelEmail, []byte("code"), now().Add(time.Hour), models.CodeLimits{})
+	require.NoError(t, err)
+
+	userID, err := s.VerifyToken(ctx, second)
+	require.NoError(t, err)
+	require.Equal(t, id, userID)
+
+	user, err := s.UserById(ctx, id)
+	require.NoError(t, err)
+	require.True(t, user.Verified)
+
+	// код для того же адреса больше не нужен
+	_, err = s.VerificationCode(ctx, id, models.CodeChannelEmail)
+	require.ErrorIs(t, err, storage.ErrTokenNotFound)
+
+	_, err = s.VerifyToken(ctx, second)
+	require.ErrorIs(t, err, storage.ErrTokenNotFound)
+
+	expired := uuid.NewString()
+	_, err = s.CreateVerificationToken(ctx, other, expired, now().Add(-time.Minute))
+	require.NoError(t, err)
+
+	_, err = s.VerifyToken(ctx, expired)
+	require.ErrorIs(t, err, storage.ErrTokenExpired)
+
+	// просроченный токен удаляется при первой попытке
+	_, err = s.VerifyToken(ctx, expired)
+	require.ErrorIs(t, err, storage.ErrTokenNotFound)
+
+	user, err = s.UserById(ctx, other)
+	require.NoError(t, err)
+	require.False(t, user.Verified)
+
+	_, err = s.CreateVerificationToken(ctx, other, uuid.NewString(), now().Add(-time.Hour))
+	require.NoError(t, err)
+
+	purged, err := s.PurgeExpiredVerificationTokens(ctx, now())
+	require.NoError(t, err)
+	require.EqualValues(t, 1, purged)
+}
+
+func testVerificationCodes(t *testing.T, s Storage) {
+	ctx := context.Background()
+
+	id := saveUser(t, s, "judy@example.com")
+	expiresAt := now().Add(time.Hour)
+
+	_, err := s.CreateVerificationCode(ctx, uuid.NewString(), models.CodeChannelEmail, []byte("code"), expiresAt, models.CodeLimits{})
+	require.ErrorIs(t, err, storage.ErrUserNotFound)
+
+	_, err = s.VerificationCode(ctx, id, models.CodeChannelSMS)
+	require.ErrorIs(t, err, storage.ErrTokenNotFound)
+
+	_, err = s.AddVerificationCodeAttempt(ctx, id, models.CodeChannelSMS, 3)
+	require.ErrorIs(t, err, storage.ErrTooManyAttempts)
+
+	ok, err := s.CreateVerificationCode(ctx, id, models.CodeChannelSMS, []byte("sms"), expiresAt, models.CodeLimits{})
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	code, err := s.VerificationCode(ctx, id, models.CodeChannelSMS)
+	require.NoError(t, err)
+	require.Equal(t, id, code.UserID)
+	require.Equal(t, models.CodeChannelSMS, code.Channel)
+	require.Equal(t, []byte("sms"), code.CodeHash)
+	require.Zero(t, code.Attempts)
+	require.True(t, expiresAt.Equal(code.ExpiresAt))
+
+	for i := 1; i <= 3; i++ {
+		attempts, err := s.AddVerificationCodeAttempt(ctx, id, models.CodeChannelSMS, 3)
+		require.NoError(t, err)
+		require.Equal(t, i, attempts)
+	}
+
+	_, err = s.AddVerificationCodeAttempt(ctx, id, models.CodeChannelSMS, 3)
+	require.ErrorIs(t, err, storage.ErrTooManyAttempts)
+
+	// без окна (нулевые CodeLimits) новый код сбрасывает счётчик попыток
+	_, err = s.CreateVerificationCode(ctx, id, models.CodeChannelSMS, []byte("sms2"), expiresAt, models.CodeLimits{})
+	require.NoError(t, err)
+
+	code, err = s.VerificationCode(ctx, id, models.CodeChannelSMS)
+	require.NoError(t, err)
+	require.Zero(t, code.Attempts)
+	require.Equal(t, []byte("sms2"), code.CodeHash)
+
+	ok, err = s.ConsumeVerificationCode(ctx, id, models.CodeChannelSMS)
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	_, err = s.ConsumeVerificationCode(ctx, id, models.CodeChannelSMS)
+	require.ErrorIs(t, err, storage.ErrTokenNotFound)
+
+	user, err := s.UserById(ctx, id)
+	require.NoError(t, err)
+	require.True(t, user.PhoneVerified)
+	require.False(t, user.Verified)
+
+	// код второго фактора ничего не подтверждает
+	_, err = s.CreateVerificationCode(ctx, id, models.CodeChannelLoginChallenge, []byte("challenge"), expiresAt, models.CodeLimits{})
+	require.NoError(t, err)
+	_, err = s.ConsumeVerificationCode(ctx, id, models.CodeChannelLoginChallenge)
+	require.NoError(t, err)
+
+	user, err = s.UserById(ctx, id)
+	require.NoError(t, err)
+	require.False(t, user.Verified)
+
+	// код по email подтверждает адрес и отменяет ссылки из писем
+	token := uuid.NewString()
+	_, err = s.CreateVerificationToken(ctx, id, token, expiresAt)
+	require.NoError(t, err)
+	_, err = s.CreateVerificationCode(ctx, id, models.CodeChannelEmail, []byte("email"), expiresAt, models.CodeLimits{})
+	require.NoError(t, err)
+
+	_, err = s.ConsumeVerificationCode(ctx, id, models.CodeChannelEmail)
+	require.NoError(t, err)
+
+	user, err = s.UserById(ctx, id)
+	require.NoError(t, err)
+	require.True(t, user.Verified)
+
+	_, err = s.VerifyToken(ctx, token)
+	require.ErrorIs(t, err, storage.ErrTokenNotFound)
+
+	_, err = s.CreateVerificationCode(ctx, id, models.CodeChannelEmail, []byte("old"), now().Add(-time.Hour), models.CodeLimits{})
+	require.NoError(t, err)
+
+	purged, err := s.PurgeExpiredVerificationCodes(ctx, now())
+	require.NoError(t, err)
+	require.EqualValues(t, 1, purged)
+}
+
+func testVerificationCodeLimits(t *testing.T, s Storage) {
+	ctx := context.Background()
+
+	id := saveUser(t, s, "kate@example.com")
+	expiresAt := now().Add(time.Hour)
+
+	// повторная отправка раньше паузы отклоняется
+	cooldown := models.CodeLimits{ResendCooldown: time.Hour, Window: time.Hour, MaxIssues: 10}
+	_, err := s.CreateVerificationCode(ctx, id, models.CodeChannelSMS, []byte("sms"), expiresAt, cooldown)
+	require.NoError(t, err)
+	_, err = s.CreateVerificationCode(ctx, id, models.CodeChannelSMS, []byte("sms2"), expiresAt, cooldown)
+	require.ErrorIs(t, err, storage.ErrTooManyCodes)
+
+	code, err := s.VerificationCode(ctx, id, models.CodeChannelSMS)
+	require.NoError(t, err)
+	require.Equal(t, []byte("sms"), code.CodeHash)
+
+	// в окне выпускается не больше MaxIssues кодов, а попытки ввода не сбрасываются
+	limits := models.CodeLimits{Window: time.Hour, MaxIssues: 3}
+	_, err = s.CreateVerificationCode(ctx, id, models.CodeChannelEmail, []byte("1"), expiresAt, limits)
+	require.NoError(t, err)
+
+	_, err = s.AddVerificationCodeAttempt(ctx, id, models.CodeChannelEmail, 3)
+	require.NoError(t, err)
+
+	for _, hash := range []string{"2", "3"} {
+		_, err = s.CreateVerificationCode(ctx, id, models.CodeChannelEmail, []byte(hash), expiresAt, limits)
+		require.NoError(t, err)
+	}
+
+	code, err = s.VerificationCode(ctx, id, models.CodeChannelEmail)
+	require.NoError(t, err)
+	require.Equal(t, []byte("3"), code.CodeHash)
+	require.Equal(t, 1, code.Attempts)
+	require.Equal(t, 3, code.Issues)
+
+	_, err = s.CreateVerificationCode(ctx, id, models.CodeChannelEmail, []byte("4"), expiresAt, limits)
+	require.ErrorIs(t, err, storage.ErrTooManyCodes)
+
+	// с новым окном счётчики начинаются заново
+	_, err = s.CreateVerificationCode(ctx, id, models.CodeChannelEmail, []byte("5"), expiresAt, models.CodeLimits{MaxIssues: 3})
+	require.NoError(t, err)
+
+	code, err = s.VerificationCode(ctx, id, models.CodeChannelEmail)
+	require.NoError(t, err)
+	require.Zero(t, code.Attempts)
+	require.Equal(t, 1, code.Issues)
+}
+
+func testUsernames(t *testing.T, s Storage) {
+	ctx := context.Background()
+
+	alice := saveUser(t, s, "alice@example.com")
+	bob := saveUser(t, s, "bob@example.com")
+
+	start := now()
+	cooldown := 24 * time.Hour
+	hold := 7 * 24 * time.Hour
+
+	err := s.ChangeUsername(ctx, uuid.NewString(), "ghost", "ghost", start, cooldown, hold)
+	require.ErrorIs(t, err, storage.ErrUserNotFound)
+
+	require.NoError(t, s.ChangeUsername(ctx, alice, "alice", "a1ice", start, cooldown, hold))
+
+	user, err := s.UserByUsername(ctx, "alice")
+	require.NoError(t, err)
+	require.Equal(t, alice, user.ID)
+	require.True(t, start.Equal(user.UsernameChangedAt))
+
+	_, err = s.UserByUsername(ctx, "nobody")
+	require.ErrorIs(t, err, storage.ErrUserNotFound)
+
+	// тот же хэндл - ничего не меняется, и ограничение частоты не срабатывает
+	require.NoError(t, s.ChangeUsername(ctx, alice, "alice", "a1ice", start.Add(time.Minute), cooldown, hold))
+
+	err = s.ChangeUsername(ctx, alice, "alicia", "a1icia", start.Add(time.Hour), cooldown, hold)
+	require.ErrorIs(t, err, storage.ErrUsernameChangeTooSoon)
+
+	err = s.ChangeUsername(ctx, bob, "alice", "a1ice", start, cooldown, hold)
+	require.ErrorIs(t, err, storage.ErrUsernameTaken)
+
+	later := start.Add(cooldown + time.Hour)
+	require.NoError(t, s.ChangeUsername(ctx, alice, "alicia", "a1icia", later, cooldown, hold))
+
+	history, err := s.UsernameHistory(ctx, alice)
+	require.NoError(t, err)
+	require.Len(t, history, 1)
+	require.Equal(t, "alice", history[0].Username)
+	require.True(t, later.Equal(history[0].ChangedAt))
+	require.True(t, later.Add(hold).Equal(history[0].HeldUntil))
+
+	// прежний хэндл удерживается за владельцем
+	available, err := s.UsernameAvailable(ctx, bob, "a1ice", later)
+	require.NoError(t, err)
+	require.False(t, available)
+
+	available, err = s.UsernameAvailable(ctx, alice, "a1ice", later)
+	require.NoError(t, err)
+	require.True(t, available)
+
+	available, err = s.UsernameAvailable(ctx, bob, "a1icia", later)
+	require.NoError(t, err)
+	require.False(t, available)
+
+	err = s.ChangeUsername(ctx, bob, "alice", "a1ice", later, cooldown, hold)
+	require.ErrorIs(t, err, storage.ErrUsernameTaken)
+
+	// после hold хэндл освобождается
+	require.NoError(t, s.ChangeUsername(ctx, bob, "alice", "a1ice", later.Add(hold+time.Hour), cooldown, hold))
+
+	history, err = s.UsernameHistory(ctx, bob)
+	require.NoError(t, err)
+	require.Empty(t, history)
+}
+
+func testEmailStatus(t *testing.T, s Storage) {
+	ctx := context.Background()
+
+	id := saveUser(t, s, "kate@example.com")
+	at := now()
+
+	n, err := s.SetEmailStatus(ctx, "", "kate@example.com", models.EmailStatusComplained, "spam report", at)
+	require.NoError(t, err)
+	require.EqualValues(t, 1, n)
+
+	// complained не понижается до bounced
+	n, err = s.SetEmailStatus(ctx, "", "kate@example.com", models.EmailStatusBounced, "hard bounce", at.Add(time.Minute))
+	require.NoError(t, err)
+	require.Zero(t, n)
+
+	// отчёт старше записанного не применяется
+	n, err = s.SetEmailStatus(ctx, id, "kate@example.com", models.EmailStatusOK, "", at.Add(-time.Minute))
+	require.NoError(t, err)
+	require.Zero(t, n)
+
+	// адрес у пользователя уже другой
+	n, err = s.SetEmailStatus(ctx, id, "other@example.com", models.EmailStatusBounced, "", at.Add(time.Minute))
+	require.NoError(t, err)
+	require.Zero(t, n)
+
+	user, err := s.UserById(ctx, id)
+	require.NoError(t, err)
+	require.Equal(t, models.EmailStatusComplained, user.EmailStatus)
+	require.Equal(t, "spam report", user.EmailStatusReason)
+	require.False(t, user.EmailDeliverable())
+
+	require.NoError(t, s.ResetEmailStatus(ctx, id))
+
+	user, err = s.UserById(ctx, id)
+	require.NoError(t, err)
+	require.Equal(t, models.EmailStatusOK, user.EmailStatus)
+
+	require.ErrorIs(t, s.ResetEmailStatus(ctx, uuid.NewString()), storage.ErrUserNotFound)
+}
+
+func testSecurityEvents(t *testing.T, s Storage) {
+	ctx := context.Background()
+
+	id := saveUser(t, s, "leo@example.com")
+	other := saveUser(t, s, "mia@example.com")
+
+	_, err := s.LastSecurityEvent(ctx, id, models.SecurityEventLoginFailure)
+	require.ErrorIs(t, err, storage.ErrEventNotFound)
+
+	since := now().Add(-time.Second)
+
+	for i := 0; i < 3; i++ {
+		require.NoError(t, s.SaveSecurityEvent(ctx, models.SecurityEvent{
+			UserID: id, Type: models.SecurityEventLoginFailure, Login: "leo@example.com", IP: "10.0.0.1", UserAgent: "test",
+		}))
+	}
+	require.NoError(t, s.SaveSecurityEvent(ctx, models.SecurityEvent{
+		UserID: other, Type: models.SecurityEventLoginFailure, IP: "10.0.0.1", Details: map[string]string{"reason": "password"},
+	}))
+	// попытка входа под несуществующим пользователем
+	require.NoError(t, s.SaveSecurityEvent(ctx, models.SecurityEvent{Type: models.SecurityEventLoginFailure, Login: "nobody", IP: "10.0.0.2"}))
+
+	events, err := s.SecurityEvents(ctx, id, 0, 2)
+	require.NoError(t, err)
+	require.Len(t, events, 2)
+	require.Greater(t, events[0].ID, events[1].ID)
+	require.Equal(t, id, events[0].UserID)
+	require.Equal(t, "leo@example.com", events[0].Login)
+	require.NotNil(t, events[0].Details)
+	require.False(t, events[0].CreatedAt.IsZero())
+
+	page, err := s.SecurityEvents(ctx, id, events[1].ID, 2)
+	require.NoError(t, err)
+	require.Len(t, page, 1)
+	require.Less(t, page[0].ID, events[1].ID)
+
+	last, err := s.LastSecurityEvent(ctx, other, models.SecurityEventLoginFailure)
+	require.NoError(t, err)
+	require.Equal(t, map[string]string{"reason": "password"}, last.Details)
+
+	count, err := s.CountRecentSecurityEvents(ctx, id, "", models.SecurityEventLoginFailure, since)
+	require.NoError(t, err)
+	require.Equal(t, 3, count)
+
+	count, err = s.CountRecentSecurityEvents(ctx, "", "10.0.0.1", models.SecurityEventLoginFailure, since)
+	require.NoError(t, err)
+	require.Equal(t, 4, count)
+
+	count, err = s.CountRecentSecurityEvents(ctx, other, "10.0.0.2", models.SecurityEventLoginFailure, since)
+	require.NoError(t, err)
+	require.Equal(t, 2, count)
+
+	count, err = s.CountRecentSecurityEvents(ctx, id, "", models.SecurityEventLoginFailure, now().Add(time.Minute))
+	require.NoError(t, err)
+	require.Zero(t, count)
+
+	purged, err := s.PurgeSecurityEvents(ctx, now().Add(time.Minute))
+	require.NoError(t, err)
+	require.EqualValues(t, 5, purged)
+}
+
+func testKnownDevices(t *testing.T, s Storage) {
+	ctx := context.Background()
+
+	id := saveUser(t, s, "nick@example.com")
+	seen := now()
+
+	isNew, knownBefore, err := s.TouchKnownDevice(ctx, models.KnownDevice{UserID: id, Fingerprint: "laptop", UserAgent: "ua", IP: "10.0.0.1", LastSeenAt: seen})
+	require.NoError(t, err)
+	require.True(t, isNew)
+	require.Zero(t, knownBefore)
+
+	isNew, _, err = s.TouchKnownDevice(ctx, models.KnownDevice{UserID: id, Fingerprint: "laptop", UserAgent: "ua", IP: "10.0.0.2", LastSeenAt: seen.Add(time.Minute)})
+	require.NoError(t, err)
+	require.False(t, isNew)
+
+	isNew, knownBefore, err = s.TouchKnownDevice(ctx, models.KnownDevice{UserID: id, Fingerprint: "phone", LastSeenAt: seen})
+	require.NoError(t, err)
+	require.True(t, isNew)
+	require.Equal(t, 1, knownBefore)
+
+	known, err := s.IsKnownDevice(ctx, id, "phone")
+	require.NoError(t, err)
+	require.True(t, known)
+
+	known, err = s.IsKnownDevice(ctx, id, "tablet")
+	require.NoError(t, err)
+	require.False(t, known)
+}
+
+func testSessionRevokeTokens(t *testing.T, s Storage) {
+	ctx := context.Background()
+
+	id := saveUser(t, s, "olga@example.com")
+
+	_, _, err := s.TouchKnownDevice(ctx, models.KnownDevice{UserID: id, Fingerprint: "stolen", LastSeenAt: now()})
+	require.NoError(t, err)
+
+	token := uuid.NewString()
+	require.NoError(t, s.CreateSessionRevokeToken(ctx, id, "stolen", token, now().Add(time.Hour)))
+	require.NoError(t, s.CreateSessionRevokeToken(ctx, id, "other", uuid.NewString(), now().Add(time.Hour)))
+
+	userID, err := s.ConsumeSessionRevokeToken(ctx, token)
+	require.NoError(t, err)
+	require.Equal(t, id, userID)
+
+	known, err := s.IsKnownDevice(ctx, id, "stolen")
+	require.NoError(t, err)
+	require.False(t, known)
+
+	_, err = s.ConsumeSessionRevokeToken(ctx, token)
+	require.ErrorIs(t, err, storage.ErrTokenNotFound)
+
+	// остальные токены пользователя удалены вместе с погашенным
+	purged, err := s.PurgeExpiredSessionRevokeTokens(ctx, now().Add(2*time.Hour))
+	require.NoError(t, err)
+	require.Zero(t, purged)
+
+	expired := uuid.NewString()
+	require.NoError(t, s.CreateSessionRevokeToken(ctx, id, "stolen", expired, now().Add(-time.Minute)))
+
+	_, err = s.ConsumeSessionRevokeToken(ctx, expired)
+	require.ErrorIs(t, err, storage.ErrTokenExpired)
+
+	_, err = s.ConsumeSessionRevokeToken(ctx, expired)
+	require.ErrorIs(t, err, storage.ErrTokenNotFound)
+}
+
+func testOutbox(t *testing.T, s Storage) {
+	ctx := context.Background()
+
+	for _, aggregate := range []string{"a", "a", "b"} {
+		require.NoError(t, s.SaveOutboxMessage(ctx, models.OutboxMessage{
+			AggregateID: aggregate, Topic: "events", Kind: "user.registered", Payload: []byte(aggregate),
+		}))
+	}
+
+	count, oldest, err := s.OutboxBacklog(ctx)
+	require.NoError(t, err)
+	require.EqualValues(t, 3, count)
+	require.False(t, oldest.IsZero())
+
+	// created_at и next_attempt_at проставляет хранилище
+	pending, err := s.PendingOutboxMessages(ctx, now().Add(time.Second), 10)
+	require.NoError(t, err)
+	require.Len(t, pending, 3)
+	require.Less(t, pending[0].ID, pending[1].ID)
+	require.Less(t, pending[1].ID, pending[2].ID)
+	require.Equal(t, "a", pending[0].AggregateID)
+	require.Equal(t, []byte("a"), pending[0].Payload)
+	require.NotNil(t, pending[0].Headers)
+
+	// первое сообщение a ждёт повтора - второе a тоже ждёт, чтобы не нарушить порядок
+	require.NoError(t, s.MarkOutboxFailed(ctx, pending[0].ID, "broker is down", now().Add(time.Hour)))
+
+	retry, err := s.PendingOutboxMessages(ctx, now().Add(time.Second), 10)
+	require.NoError(t, err)
+	require.Len(t, retry, 1)
+	require.Equal(t, "b", retry[0].AggregateID)
+
+	publishedAt := now()
+	require.NoError(t, s.MarkOutboxPublished(ctx, []int64{retry[0].ID}, publishedAt))
+
+	count, _, err = s.OutboxBacklog(ctx)
+	require.NoError(t, err)
+	require.EqualValues(t, 2, count)
+
+	retry, err = s.PendingOutboxMessages(ctx, now().Add(2*time.Hour), 1)
+	require.NoError(t, err)
+	require.Len(t, retry, 1)
+	require.Equal(t, pending[0].ID, retry[0].ID)
+	require.Equal(t, 1, retry[0].Attempts)
+
+	purged, err := s.PurgePublishedOutbox(ctx, publishedAt.Add(time.Second))
+	require.NoError(t, err)
+	require.EqualValues(t, 1, purged)
+}
+
+func testInTx(t *testing.T, s Storage) {
+	ctx := context.Background()
+	errRollback := errors.New("rollback")
+
+	var rolledBack string
+	err := s.InTx(ctx, func(ctx context.Context) error {
+		id, err := s.SaveUser(ctx, "tx", "tx@example.com", "tx@example.com", []byte("hash"))
+		require.NoError(t, err)
+		rolledBack = id
+
+		// вложенный InTx работает во внешней транзакции
+		require.NoError(t, s.InTx(ctx, func(ctx context.Context) error {
+			return s.SaveOutboxMessage(ctx, models.OutboxMessage{AggregateID: id, Topic: "events", Kind: "user.registered", Payload: []byte("{}")})
+		}))
+
+		_, err = s.UserById(ctx, id)
+		require.NoError(t, err)
+
+		return errRollback
+	})
+	require.ErrorIs(t, err, errRollback)
+
+	_, err = s.UserById(ctx, rolledBack)
+	require.ErrorIs(t, err, storage.ErrUserNotFound)
+
+	count, _, err := s.OutboxBacklog(ctx)
+	require.NoError(t, err)
+	require.Zero(t, count)
+
+	var committed string
+	require.NoError(t, s.InTx(ctx, func(ctx context.Context) error {
+		id, err := s.SaveUser(ctx, "tx", "tx@example.com", "tx@example.com", []byte("hash"))
+		committed = id
+		return err
+	}))
+
+	_, err = s.UserById(ctx, committed)
+	require.NoError(t, err)
+
+	// ошибка внутри транзакции доходит до вызывающего с прежним значением
+	err = s.InTx(ctx, func(ctx context.Context) error {
+		_, err := s.SaveUser(ctx, "tx", "tx@example.com", "tx@example.com", []byte("hash"))
+		return err
+	})
+	require.ErrorIs(t, err, storage.ErrUserExists)
+}
@@ -0,0 +1,185 @@
+package storagetest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/DenisBochko/yandex_SSO/internal/adapter"
+	webhooksapp "github.com/DenisBochko/yandex_SSO/internal/app/webhooks"
+	"github.com/DenisBochko/yandex_SSO/internal/domain/models"
+	"github.com/DenisBochko/yandex_SSO/internal/services/webhooks"
+	"github.com/DenisBochko/yandex_SSO/internal/storage"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+)
+
+// WebhookStorage - хранилище подписок и доставок вебхуков
+type WebhookStorage interface {
+	webhooks.Storage
+	webhooksapp.Storage
+	adapter.WebhookStorage
+
+	PurgeWebhookDeliveries(ctx context.Context, before time.Time) (int64, error)
+}
+
+// RunWebhooks прогоняет набор тестов хранилища вебхуков. newStorage вызывается в каждом подтесте
+// и должна возвращать пустое хранилище.
+func RunWebhooks(t *testing.T, newStorage func(t *testing.T) WebhookStorage) {
+	t.Run("Subscriptions", func(t *testing.T) {
+		testWebhookSubscriptions(t, newStorage(t))
+	})
+	t.Run("Deliveries", func(t *testing.T) {
+		testWebhookDeliveries(t, newStorage(t))
+	})
+}
+
+func testWebhookSubscriptions(t *testing.T, s WebhookStorage) {
+	ctx := context.Background()
+
+	id, err := s.SaveWebhookSubscription(ctx, models.WebhookSubscription{
+		URL:         "https://partner.example.com/hook",
+		EventTypes:  []string{string(models.UserEventRegistered), string(models.UserEventDeleted)},
+		Secret:      "secret",
+		Description: "partner",
+		Active:      true,
+	})
+	require.NoError(t, err)
+	require.NotEmpty(t, id)
+
+	sub, err := s.WebhookSubscription(ctx, id)
+	require.NoError(t, err)
+	require.Equal(t, "https://partner.example.com/hook", sub.URL)
+	require.Equal(t, []string{string(models.UserEventRegistered), string(models.UserEventDeleted)}, sub.EventTypes)
+	require.Equal(t, "partner", sub.Description)
+	require.True(t, sub.Active)
+	require.Empty(t, sub.Secret)
+	require.False(t, sub.CreatedAt.IsZero())
+
+	_, err = s.WebhookSubscription(ctx, uuid.NewString())
+	require.ErrorIs(t, err, storage.ErrSubscriptionNotFound)
+
+	_, err = s.WebhookSubscription(ctx, "not-a-uuid")
+	require.ErrorIs(t, err, storage.ErrSubscriptionNotFound)
+
+	sub.URL = "https://partner.example.com/v2"
+	sub.EventTypes = []string{string(models.UserEventVerified)}
+	sub.Active = false
+	require.NoError(t, s.UpdateWebhookSubscription(ctx, sub))
+
+	updated, err := s.WebhookSubscription(ctx, id)
+	require.NoError(t, err)
+	require.Equal(t, sub.URL, updated.URL)
+	require.Equal(t, sub.EventTypes, updated.EventTypes)
+	require.False(t, updated.Active)
+
+	err = s.UpdateWebhookSubscription(ctx, models.WebhookSubscription{ID: uuid.NewString(), EventTypes: []string{}})
+	require.ErrorIs(t, err, storage.ErrSubscriptionNotFound)
+
+	otherID, err := s.SaveWebhookSubscription(ctx, models.WebhookSubscription{
+		URL: "https://other.example.com/hook", EventTypes: []string{string(models.UserEventUpdated)}, Secret: "secret", Active: true,
+	})
+	require.NoError(t, err)
+
+	subs, err := s.WebhookSubscriptions(ctx)
+	require.NoError(t, err)
+	require.Len(t, subs, 2)
+	require.ElementsMatch(t, []string{id, otherID}, []string{subs[0].ID, subs[1].ID})
+
+	require.NoError(t, s.DeleteWebhookSubscription(ctx, id))
+	require.ErrorIs(t, s.DeleteWebhookSubscription(ctx, id), storage.ErrSubscriptionNotFound)
+
+	_, err = s.WebhookSubscription(ctx, id)
+	require.ErrorIs(t, err, storage.ErrSubscriptionNotFound)
+}
+
+func testWebhookDeliveries(t *testing.T, s WebhookStorage) {
+	ctx := context.Background()
+
+	id, err := s.SaveWebhookSubscription(ctx, models.WebhookSubscription{
+		URL: "https://partner.example.com/hook", EventTypes: []string{string(models.UserEventRegistered)}, Secret: "secret", Active: true,
+	})
+	require.NoError(t, err)
+
+	// выключенная подписка доставок не получает
+	_, err = s.SaveWebhookSubscription(ctx, models.WebhookSubscription{
+		URL: "https://off.example.com/hook", EventTypes: []string{string(models.UserEventRegistered)}, Secret: "secret", Active: false,
+	})
+	require.NoError(t, err)
+
+	payload := []byte(`{"id":"event-1"}`)
+
+	n, err := s.EnqueueWebhookDeliveries(ctx, "event-1", string(models.UserEventRegistered), payload)
+	require.NoError(t, err)
+	require.EqualValues(t, 1, n)
+
+	// повтор того же события доставки не дублирует
+	n, err = s.EnqueueWebhookDeliveries(ctx, "event-1", string(models.UserEventRegistered), payload)
+	require.NoError(t, err)
+	require.Zero(t, n)
+
+	n, err = s.EnqueueWebhookDeliveries(ctx, "event-2", string(models.UserEventDeleted), payload)
+	require.NoError(t, err)
+	require.Zero(t, n)
+
+	pending, err := s.PendingWebhookDeliveries(ctx, now().Add(time.Second), 10)
+	require.NoError(t, err)
+	require.Len(t, pending, 1)
+
+	delivery := pending[0]
+	require.Equal(t, id, delivery.SubscriptionID)
+	require.Equal(t, "event-1", delivery.EventID)
+	require.JSONEq(t, string(payload), string(delivery.Payload))
+	require.Equal(t, models.WebhookDeliveryPending, delivery.Status)
+	require.Equal(t, "https://partner.example.com/hook", delivery.URL)
+	require.Equal(t, "secret", delivery.Secret)
+
+	failed := models.WebhookDeliveryAttempt{StatusCode: 500, Error: "server error", Duration: 120 * time.Millisecond}
+	require.NoError(t, s.MarkWebhookFailed(ctx, delivery.ID, failed, now().Add(time.Hour), false))
+
+	// следующая попытка ещё не наступила
+	pending, err = s.PendingWebhookDeliveries(ctx, now().Add(time.Second), 10)
+	require.NoError(t, err)
+	require.Empty(t, pending)
+
+	require.NoError(t, s.MarkWebhookDelivered(ctx, delivery.ID, models.WebhookDeliveryAttempt{StatusCode: 200}, now()))
+
+	deliveries, err := s.WebhookDeliveries(ctx, id, models.WebhookDeliveryDelivered, 0, 10)
+	require.NoError(t, err)
+	require.Len(t, deliveries, 1)
+	require.Equal(t, 2, deliveries[0].Attempts)
+	require.False(t, deliveries[0].DeliveredAt.IsZero())
+
+	deliveries, err = s.WebhookDeliveries(ctx, id, models.WebhookDeliveryDead, 0, 10)
+	require.NoError(t, err)
+	require.Empty(t, deliveries)
+
+	attempts, err := s.WebhookDeliveryAttempts(ctx, delivery.ID)
+	require.NoError(t, err)
+	require.Len(t, attempts, 2)
+	require.Equal(t, 1, attempts[0].Attempt)
+	require.Equal(t, 500, attempts[0].StatusCode)
+	require.Equal(t, "server error", attempts[0].Error)
+	require.Equal(t, 120*time.Millisecond, attempts[0].Duration)
+	require.Equal(t, 2, attempts[1].Attempt)
+
+	require.NoError(t, s.RedeliverWebhook(ctx, delivery.ID, now()))
+	require.ErrorIs(t, s.RedeliverWebhook(ctx, delivery.ID+1000, now()), storage.ErrDeliveryNotFound)
+
+	pending, err = s.PendingWebhookDeliveries(ctx, now().Add(time.Second), 10)
+	require.NoError(t, err)
+	require.Len(t, pending, 1)
+	require.Zero(t, pending[0].Attempts)
+
+	// ожидающие доставки не удаляются
+	purged, err := s.PurgeWebhookDeliveries(ctx, now().Add(time.Hour))
+	require.NoError(t, err)
+	require.Zero(t, purged)
+
+	require.NoError(t, s.MarkWebhookFailed(ctx, delivery.ID, failed, now(), true))
+
+	purged, err = s.PurgeWebhookDeliveries(ctx, now().Add(time.Hour))
+	require.NoError(t, err)
+	require.EqualValues(t, 1, purged)
+}
@@ -0,0 +1,292 @@
+// Package usercache - кэш пользователей по id перед основным хранилищем (user_cache в конфиге).
+//
+// Запись ищется сначала в LRU в памяти процесса, затем в redis, и только потом в хранилище.
+// Одновременные промахи по одному id выполняют один запрос к хранилищу (singleflight).
+// Изменение пользователя удаляет запись из redis и рассылает id через pub/sub, по которому
+// все реплики удаляют его из своего LRU.
+//
+// Чтобы запрос, начатый до изменения, не положил в redis старые данные после сброса,
+// у каждого id есть поколение: сброс его увеличивает, а запись в redis выполняется,
+// только если поколение не изменилось с начала чтения из хранилища.
+package usercache
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/DenisBochko/yandex_SSO/internal/config"
+	"github.com/DenisBochko/yandex_SSO/internal/domain/models"
+	"github.com/DenisBochko/yandex_SSO/lib/lru"
+	"github.com/DenisBochko/yandex_SSO/pkg/metrics"
+
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+	"golang.org/x/sync/singleflight"
+)
+
+var (
+	localHitsTotal   = metrics.NewCounter("user_cache_local_hits_total")
+	redisHitsTotal   = metrics.NewCounter("user_cache_redis_hits_total")
+	missesTotal      = metrics.NewCounter("user_cache_misses_total")
+	redisErrorsTotal = metrics.NewCounter("user_cache_redis_errors_total") // при ошибке redis чтение идёт в хранилище
+)
+
+// invalidateChannel - канал pub/sub, по которому реплики узнают об изменённых пользователях
+const invalidateChannel = "user_cache:invalidate"
+
+// redisTimeout ограничивает обращения к redis, которые не привязаны к запросу клиента
+const redisTimeout = 5 * time.Second
+
+// Ключи одного id содержат его в фигурных скобках, чтобы в redis cluster попасть в один слот
+func valueKey(id string) string {
+	return "user_cache:{" + id + "}"
+}
+
+func generationKey(id string) string {
+	return "user_cache_gen:{" + id + "}"
+}
+
+// storeScript записывает значение, только если поколение не изменилось с начала чтения
+var storeScript = redis.NewScript(`
+if (redis.call('GET', KEYS[2]) or '0') == ARGV[1] then
+    redis.call('SET', KEYS[1], ARGV[2], 'PX', ARGV[3])
+end
+return 0
+`)
+
+// invalidateScript удаляет значение и увеличивает поколение. Поколение живёт дольше любого
+// чтения из хранилища, после истечения оно начинается с нуля, что тоже безопасно.
+var invalidateScript = redis.NewScript(`
+redis.call('DEL', KEYS[1])
+redis.call('INCR', KEYS[2])
+redis.call('PEXPIRE', KEYS[2], ARGV[1])
+return 0
+`)
+
+// Loader читает пользователя из основного хранилища
+type Loader func(ctx context.Context, id string) (models.User, error)
+
+type Cache struct {
+	log    *zap.Logger
+	client redis.UniversalClient
+	ttl    time.Duration
+	local  *lru.Cache[string, models.User]
+	group  singleflight.Group
+
+	// invalidations растёт при каждом сбросе: запись, прочитанная до сброса, в LRU не попадает
+	invalidations atomic.Uint64
+
+	pubsub *redis.PubSub
+	done   chan struct{}
+}
+
+type txKey struct{}
+
+// pendingIDs - пользователи, изменённые в ещё не зафиксированной транзакции
+type pendingIDs struct {
+	mu  sync.Mutex
+	ids []string
+}
+
+// New подписывается на сбросы других реплик. Подписка живёт до Close.
+func New(ctx context.Context, log *zap.Logger, client redis.UniversalClient, cfg *config.UserCacheConfig) (*Cache, error) {
+	pubsub := client.Subscribe(ctx, invalidateChannel)
+	if _, err := pubsub.Receive(ctx); err != nil {
+		pubsub.Close()
+		return nil, fmt.Errorf("failed to subscribe to user cache invalidations: %w", err)
+	}
+
+	c := &Cache{
+		log:    log.With(zap.String("component", "user cache")),
+		client: client,
+		ttl:    cfg.TTL,
+		local:  lru.New[string, models.User](cfg.LocalSize, cfg.LocalTTL),
+		pubsub: pubsub,
+		done:   make(chan struct{}),
+	}
+
+	go c.listen()
+
+	return c, nil
+}
+
+// Close отписывается от сбросов
+func (c *Cache) Close() {
+	c.pubsub.Close()
+	<-c.done
+}
+
+// User возвращает пользователя из кэша или загружает его через load и кэширует.
+// Внутри InTx кэш не используется: транзакция должна видеть свои изменения.
+func (c *Cache) User(ctx context.Context, id string, load Loader) (models.User, error) {
+	if _, ok := ctx.Value(txKey{}).(*pendingIDs); ok {
+		return load(ctx, id)
+	}
+
+	if user, ok := c.local.Get(id); ok {
+		localHitsTotal.Add(1)
+		return user, nil
+	}
+
+	user, err, _ := c.group.Do(id, func() (any, error) {
+		return c.fetch(id, load)
+	})
+	if err != nil {
+		return models.User{}, err
+	}
+
+	return user.(models.User), nil
+}
+
+// fetch читает пользователя из redis или хранилища. Результат получают все ожидающие этот id,
+// поэтому контекст не берётся из запроса, пришедшего первым: его отмена не должна ронять остальные.
+// Без storage.WithReplicaReads чтение идёт в primary: устаревшая копия с реплики жила бы в кэше весь TTL.
+func (c *Cache) fetch(id string, load Loader) (models.User, error) {
+	seq := c.invalidations.Load()
+
+	ctx, cancel := context.WithTimeout(context.Background(), redisTimeout)
+	defer cancel()
+
+	user, generation, found, redisErr := c.fromRedis(ctx, id)
+	if redisErr != nil {
+		redisErrorsTotal.Add(1)
+		c.log.Warn("failed to read user from redis", zap.String("id", id), zap.Error(redisErr))
+	}
+
+	if found {
+		redisHitsTotal.Add(1)
+	} else {
+		missesTotal.Add(1)
+
+		var err error
+		user, err = load(ctx, id)
+		if err != nil {
+			return models.User{}, err
+		}
+
+		if redisErr == nil {
+			c.store(ctx, id, generation, user)
+		}
+	}
+
+	if c.invalidations.Load() == seq {
+		c.local.Add(id, user)
+	}
+
+	return user, nil
+}
+
+// fromRedis читает запись и текущее поколение id одним запросом
+func (c *Cache) fromRedis(ctx context.Context, id string) (models.User, string, bool, error) {
+	values, err := c.client.MGet(ctx, valueKey(id), generationKey(id)).Result()
+	if err != nil {
+		return models.User{}, "", false, err
+	}
+
+	generation := "0"
+	if g, ok := values[1].(string); ok {
+		generation = g
+	}
+
+	raw, ok := values[0].(string)
+	if !ok {
+		return models.User{}, generation, false, nil
+	}
+
+	var user models.User
+	if err := json.Unmarshal([]byte(raw), &user); err != nil {
+		// запись прежнего формата: перечитываем из хранилища
+		return models.User{}, generation, false, nil
+	}
+
+	return user, generation, true, nil
+}
+
+func (c *Cache) store(ctx context.Context, id string, generation string, user models.User) {
+	value, err := json.Marshal(user)
+	if err != nil {
+		c.log.Warn("failed to marshal user", zap.String("id", id), zap.Error(err))
+		return
+	}
+
+	keys := []string{valueKey(id), generationKey(id)}
+	if err := storeScript.Run(ctx, c.client, keys, generation, value, c.ttl.Milliseconds()).Err(); err != nil {
+		redisErrorsTotal.Add(1)
+		c.log.Warn("failed to cache user", zap.String("id", id), zap.Error(err))
+	}
+}
+
+// Invalidate сбрасывает пользователей ids на всех репликах. Внутри InTx сброс откладывается
+// до конца транзакции: раньше другой запрос успел бы закэшировать ещё не изменённую запись.
+func (c *Cache) Invalidate(ctx context.Context, ids ...string) {
+	if pending, ok := ctx.Value(txKey{}).(*pendingIDs); ok {
+		pending.mu.Lock()
+		pending.ids = append(pending.ids, ids...)
+		pending.mu.Unlock()
+		return
+	}
+
+	c.invalidations.Add(1)
+	for _, id := range ids {
+		c.local.Remove(id)
+	}
+
+	// изменение уже записано, поэтому сброс не должен прерываться вместе с запросом клиента
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), redisTimeout)
+	defer cancel()
+
+	for _, id := range ids {
+		if id == "" {
+			continue
+		}
+
+		keys := []string{valueKey(id), generationKey(id)}
+		// поколение должно пережить любое чтение из хранилища, начатое до сброса
+		err := invalidateScript.Run(ctx, c.client, keys, (c.ttl + time.Minute).Milliseconds()).Err()
+		if err == nil {
+			err = c.client.Publish(ctx, invalidateChannel, id).Err()
+		}
+		if err != nil {
+			redisErrorsTotal.Add(1)
+			c.log.Error("failed to invalidate cached user", zap.String("id", id), zap.Error(err))
+		}
+	}
+}
+
+// InTx выполняет fn через inTx хранилища. Чтения внутри идут мимо кэша, а сброс изменённых
+// пользователей выполняется после завершения транзакции, в том числе неудачного.
+func (c *Cache) InTx(ctx context.Context, inTx func(ctx context.Context, fn func(ctx context.Context) error) error, fn func(ctx context.Context) error) error {
+	if _, ok := ctx.Value(txKey{}).(*pendingIDs); ok {
+		return inTx(ctx, fn)
+	}
+
+	pending := &pendingIDs{}
+	err := inTx(context.WithValue(ctx, txKey{}, pending), fn)
+
+	if len(pending.ids) > 0 {
+		c.Invalidate(ctx, pending.ids...)
+	}
+
+	return err
+}
+
+// listen удаляет из LRU пользователей, изменённых на других репликах. После переподключения
+// к redis сообщения за время разрыва потеряны, поэтому LRU очищается целиком.
+func (c *Cache) listen() {
+	defer close(c.done)
+
+	for msg := range c.pubsub.ChannelWithSubscriptions() {
+		c.invalidations.Add(1)
+
+		switch msg := msg.(type) {
+		case *redis.Message:
+			c.local.Remove(msg.Payload)
+		case *redis.Subscription:
+			c.local.Purge()
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package usercache
+
+import (
+	"context"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/DenisBochko/yandex_SSO/internal/config"
+	"github.com/DenisBochko/yandex_SSO/internal/domain/models"
+
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// Тесты запускаются на настоящем redis, только если задан SSO_TEST_REDIS_ADDR, например localhost:6379.
+// Используется база 15, она очищается перед тестом.
+func newCache(t *testing.T) (*Cache, *redis.Client) {
+	addr := os.Getenv("SSO_TEST_REDIS_ADDR")
+	if addr == "" {
+		t.Skip("SSO_TEST_REDIS_ADDR is not set")
+	}
+
+	client := redis.NewClient(&redis.Options{Addr: addr, Password: os.Getenv("SSO_TEST_REDIS_PASS"), DB: 15})
+	t.Cleanup(func() { client.Close() })
+	require.NoError(t, client.FlushDB(context.Background()).Err())
+
+	return newReplica(t, client), client
+}
+
+// newReplica создаёт ещё один кэш поверх того же redis, как на соседней реплике
+func newReplica(t *testing.T, client *redis.Client) *Cache {
+	c, err := New(context.Background(), zap.NewNop(), client, &config.UserCacheConfig{TTL: time.Minute, LocalTTL: time.Minute, LocalSize: 100})
+	require.NoError(t, err)
+	t.Cleanup(c.Close)
+	return c
+}
+
+// loader считает обращения к хранилищу
+type loader struct {
+	calls atomic.Int32
+	name  atomic.Value
+	delay time.Duration
+}
+
+func (l *loader) load(ctx context.Context, id string) (models.User, error) {
+	l.calls.Add(1)
+	time.Sleep(l.delay)
+	name, _ := l.name.Load().(string)
+	return models.User{ID: id, Name: name}, nil
+}
+
+func TestReadThrough(t *testing.T) {
+	a, client := newCache(t)
+	b := newReplica(t, client)
+	ctx := context.Background()
+
+	l := &loader{}
+	l.name.Store("alice")
+
+	user, err := a.User(ctx, "1", l.load)
+	require.NoError(t, err)
+	require.Equal(t, "alice", user.Name)
+
+	// повтор - из LRU, соседняя реплика - из redis
+	_, err = a.User(ctx, "1", l.load)
+	require.NoError(t, err)
+	user, err = b.User(ctx, "1", l.load)
+	require.NoError(t, err)
+	require.Equal(t, "alice", user.Name)
+	require.EqualValues(t, 1, l.calls.Load())
+
+	l.name.Store("bob")
+	a.Invalidate(ctx, "1")
+
+	// сброс доходит до LRU соседней реплики через pub/sub
+	require.Eventually(t, func() bool {
+		user, err := b.User(ctx, "1", l.load)
+		return err == nil && user.Name == "bob"
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestSingleflight(t *testing.T) {
+	c, _ := newCache(t)
+	l := &loader{delay: 50 * time.Millisecond}
+
+	var wg sync.WaitGroup
+	for range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := c.User(context.Background(), "1", l.load)
+			require.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+
+	require.EqualValues(t, 1, l.calls.Load())
+}
+
+// Чтение, начатое до изменения, не оставляет в redis старую запись
+func TestInvalidateDuringLoad(t *testing.T) {
+	c, client := newCache(t)
+	ctx := context.Background()
+
+	l := &loader{delay: 100 * time.Millisecond}
+	l.name.Store("alice")
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		c.User(ctx, "1", l.load)
+	}()
+
+	time.Sleep(30 * time.Millisecond)
+	c.Invalidate(ctx, "1")
+	<-done
+
+	require.Zero(t, client.Exists(ctx, valueKey("1")).Val())
+}
+
+func TestInTx(t *testing.T) {
+	c, client := newCache(t)
+	ctx := context.Background()
+
+	l := &loader{}
+	_, err := c.User(ctx, "1", l.load)
+	require.NoError(t, err)
+
+	inTx := func(ctx context.Context, fn func(ctx context.Context) error) error { return fn(ctx) }
+	err = c.InTx(ctx, inTx, func(ctx context.Context) error {
+		// внутри транзакции кэш не используется, сброс откладывается
+		_, err := c.User(ctx, "1", l.load)
+		require.NoError(t, err)
+		require.EqualValues(t, 2, l.calls.Load())
+
+		c.Invalidate(ctx, "1")
+		require.EqualValues(t, 1, client.Exists(ctx, valueKey("1")).Val())
+		return nil
+	})
+	require.NoError(t, err)
+
+	require.Zero(t, client.Exists(ctx, valueKey("1")).Val())
+}
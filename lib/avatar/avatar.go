@@ -0,0 +1,42 @@
+// Package avatar готовит загруженное фото профиля к хранению: обрезает до квадрата 512x512
+// и кодирует в PNG или JPEG. Общий для всех хранилищ фото, чтобы результат не зависел от бэкенда.
+package avatar
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	_ "image/jpeg"
+	_ "image/png"
+
+	"github.com/disintegration/imaging"
+)
+
+// Size - сторона квадрата, до которого сжимается фото
+const Size = 512
+
+// Prepare декодирует фото, сжимает его до Size x Size и кодирует обратно.
+// PNG остаётся PNG, всё остальное сохраняется в JPEG. Возвращает байты и их content type.
+func Prepare(photo []byte, contentType string) ([]byte, string, error) {
+	img, _, err := image.Decode(bytes.NewReader(photo))
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to decode image: %w", err)
+	}
+
+	resized := imaging.Fill(img, Size, Size, imaging.Center, imaging.Lanczos)
+
+	var buf bytes.Buffer
+	switch contentType {
+	case "image/png":
+		err = imaging.Encode(&buf, resized, imaging.PNG)
+	default:
+		contentType = "image/jpeg"
+		err = imaging.Encode(&buf, resized, imaging.JPEG)
+	}
+
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to encode resized image: %w", err)
+	}
+
+	return buf.Bytes(), contentType, nil
+}
@@ -0,0 +1,53 @@
+package avatar
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func testPNG(t *testing.T, w, h int) []byte {
+	t.Helper()
+
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for x := 0; x < w; x++ {
+		for y := 0; y < h; y++ {
+			img.Set(x, y, color.RGBA{R: uint8(x), G: uint8(y), B: 128, A: 255})
+		}
+	}
+
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, img))
+	return buf.Bytes()
+}
+
+func TestPrepare(t *testing.T) {
+	photo := testPNG(t, 800, 300)
+
+	out, contentType, err := Prepare(photo, "image/png")
+	require.NoError(t, err)
+	require.Equal(t, "image/png", contentType)
+
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(out))
+	require.NoError(t, err)
+	require.Equal(t, "png", format)
+	require.Equal(t, Size, cfg.Width)
+	require.Equal(t, Size, cfg.Height)
+
+	out, contentType, err = Prepare(photo, "image/webp")
+	require.NoError(t, err)
+	require.Equal(t, "image/jpeg", contentType)
+
+	_, format, err = image.DecodeConfig(bytes.NewReader(out))
+	require.NoError(t, err)
+	require.Equal(t, "jpeg", format)
+}
+
+func TestPrepareRejectsGarbage(t *testing.T) {
+	_, _, err := Prepare([]byte("not an image"), "image/png")
+	require.ErrorContains(t, err, "failed to decode image")
+}
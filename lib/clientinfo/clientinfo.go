@@ -0,0 +1,155 @@
+package clientinfo
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net"
+	"strings"
+
+	"github.com/DenisBochko/yandex_SSO/lib/iplist"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+type contextKey string
+
+const contextTrustedProxiesKey contextKey = "trusted_proxies"
+
+// Info - сведения о клиенте, от которого пришёл gRPC запрос
+type Info struct {
+	IP        string
+	UserAgent string
+	DeviceID  string // из заголовка x-device-id, его выставляют мобильные и десктопные клиенты
+	TraceID   string // trace id из traceparent (W3C Trace Context) или x-request-id
+
+	AcceptLanguage string // предпочтительные языки клиента для писем, формат заголовка Accept-Language
+}
+
+// WithTrustedProxies возвращает контекст, в котором FromContext доверяет x-forwarded-for и x-real-ip
+// от адресов из proxies
+func WithTrustedProxies(ctx context.Context, proxies *iplist.List) context.Context {
+	return context.WithValue(ctx, contextTrustedProxiesKey, proxies)
+}
+
+// UnaryServerInterceptor передаёт список доверенных прокси (grpc.trusted_proxies) в контекст
+// запроса. Должен стоять в цепочке раньше обработчиков, которые вызывают FromContext.
+func UnaryServerInterceptor(proxies *iplist.List) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		return handler(WithTrustedProxies(ctx, proxies), req)
+	}
+}
+
+// FromContext извлекает IP и user agent клиента из входящего gRPC контекста.
+//
+// IP - адрес соединения. Если соединение пришло от доверенного прокси (WithTrustedProxies),
+// адрес берётся из x-forwarded-for: справа налево пропускаются доверенные прокси, первый
+// недоверенный адрес считается клиентом. Без x-forwarded-for используется x-real-ip. Заголовки
+// от остальных адресов игнорируются: их может подставить сам клиент. User agent берётся из
+// x-user-agent, который выставляет grpc-gateway, иначе - из user-agent.
+func FromContext(ctx context.Context) Info {
+	var info Info
+
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		info.IP = p.Addr.String()
+		if host, _, err := net.SplitHostPort(info.IP); err == nil {
+			info.IP = host
+		}
+	}
+
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if proxies, _ := ctx.Value(contextTrustedProxiesKey).(*iplist.List); proxies != nil && proxies.Contains(info.IP) {
+			if v := md.Get("x-forwarded-for"); len(v) > 0 {
+				info.IP = forwardedClient(strings.Split(strings.Join(v, ","), ","), proxies, info.IP)
+			} else if v := strings.TrimSpace(first(md, "x-real-ip")); v != "" {
+				info.IP = v
+			}
+		}
+
+		info.UserAgent = first(md, "x-user-agent")
+		if info.UserAgent == "" {
+			info.UserAgent = first(md, "user-agent")
+		}
+
+		info.DeviceID = strings.TrimSpace(first(md, "x-device-id"))
+		info.TraceID = traceID(md)
+
+		// grpc-gateway передаёт HTTP заголовок с префиксом grpcgateway-
+		info.AcceptLanguage = first(md, "accept-language")
+		if info.AcceptLanguage == "" {
+			info.AcceptLanguage = first(md, "grpcgateway-accept-language")
+		}
+	}
+
+	return info
+}
+
+// forwardedClient возвращает самый правый адрес цепочки x-forwarded-for, который не входит в proxies.
+// Если доверенные все, клиентом считается самый левый.
+func forwardedClient(chain []string, proxies *iplist.List, peerIP string) string {
+	client := peerIP
+	for i := len(chain) - 1; i >= 0; i-- {
+		addr := strings.TrimSpace(chain[i])
+		if addr == "" {
+			continue
+		}
+
+		client = addr
+		if !proxies.Contains(addr) {
+			break
+		}
+	}
+
+	return client
+}
+
+// Fingerprint возвращает отпечаток устройства клиента.
+// Если клиент прислал x-device-id, отпечаток строится по нему. Иначе - по user agent и сети
+// (IPPrefix), чтобы смена адреса внутри одной сети провайдера не выглядела новым устройством.
+func (i Info) Fingerprint() string {
+	var source string
+	if i.DeviceID != "" {
+		source = "device:" + i.DeviceID
+	} else {
+		source = "ua:" + i.UserAgent + "|net:" + IPPrefix(i.IP)
+	}
+
+	sum := sha256.Sum256([]byte(source))
+	return hex.EncodeToString(sum[:])
+}
+
+// IPPrefix возвращает сеть адреса: /24 для IPv4 и /48 для IPv6.
+// Для некорректного адреса возвращается он сам.
+func IPPrefix(ip string) string {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return ip
+	}
+
+	if v4 := parsed.To4(); v4 != nil {
+		return (&net.IPNet{IP: v4.Mask(net.CIDRMask(24, 32)), Mask: net.CIDRMask(24, 32)}).String()
+	}
+
+	return (&net.IPNet{IP: parsed.Mask(net.CIDRMask(48, 128)), Mask: net.CIDRMask(48, 128)}).String()
+}
+
+// traceID берёт trace id из traceparent ("00-<trace id>-<span id>-<flags>"),
+// а если его нет или он некорректен - из x-request-id
+func traceID(md metadata.MD) string {
+	if parts := strings.Split(strings.TrimSpace(first(md, "traceparent")), "-"); len(parts) == 4 && len(parts[1]) == 32 {
+		if _, err := hex.DecodeString(parts[1]); err == nil && parts[1] != strings.Repeat("0", 32) {
+			return parts[1]
+		}
+	}
+
+	return strings.TrimSpace(first(md, "x-request-id"))
+}
+
+func first(md metadata.MD, key string) string {
+	if v := md.Get(key); len(v) > 0 {
+		return v[0]
+	}
+	return ""
+}
@@ -0,0 +1,102 @@
+package clientinfo
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/DenisBochko/yandex_SSO/lib/iplist"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+func TestFromContextPeer(t *testing.T) {
+	ctx := peer.NewContext(context.Background(), &peer.Peer{
+		Addr: &net.TCPAddr{IP: net.ParseIP("10.0.0.5"), Port: 51234},
+	})
+	ctx = metadata.NewIncomingContext(ctx, metadata.Pairs("user-agent", "grpc-go/1.71.1"))
+
+	info := FromContext(ctx)
+	require.Equal(t, "10.0.0.5", info.IP)
+	require.Equal(t, "grpc-go/1.71.1", info.UserAgent)
+}
+
+func TestFromContextForwarded(t *testing.T) {
+	proxies, err := iplist.Parse(strings.NewReader("10.0.0.0/8"))
+	require.NoError(t, err)
+
+	forwarded := func(peerIP string, pairs ...string) context.Context {
+		ctx := peer.NewContext(context.Background(), &peer.Peer{
+			Addr: &net.TCPAddr{IP: net.ParseIP(peerIP), Port: 51234},
+		})
+		ctx = metadata.NewIncomingContext(ctx, metadata.Pairs(pairs...))
+		return WithTrustedProxies(ctx, proxies)
+	}
+
+	info := FromContext(forwarded("10.0.0.5",
+		"x-forwarded-for", "203.0.113.7, 10.0.0.1",
+		"user-agent", "grpc-go/1.71.1",
+		"x-user-agent", "Mozilla/5.0",
+	))
+	require.Equal(t, "203.0.113.7", info.IP)
+	require.Equal(t, "Mozilla/5.0", info.UserAgent)
+
+	// адрес, подставленный клиентом левее, не принимается: клиент - первый недоверенный справа
+	require.Equal(t, "198.51.100.9", FromContext(forwarded("10.0.0.5", "x-forwarded-for", "1.1.1.1, 198.51.100.9")).IP)
+	require.Equal(t, "203.0.113.8", FromContext(forwarded("10.0.0.5", "x-real-ip", "203.0.113.8")).IP)
+
+	// заголовки от недоверенного адреса игнорируются
+	require.Equal(t, "198.51.100.1", FromContext(forwarded("198.51.100.1", "x-forwarded-for", "203.0.113.7")).IP)
+	require.Equal(t, "198.51.100.1", FromContext(forwarded("198.51.100.1", "x-real-ip", "203.0.113.7")).IP)
+
+	// без списка доверенных прокси - тоже
+	ctx := peer.NewContext(context.Background(), &peer.Peer{Addr: &net.TCPAddr{IP: net.ParseIP("10.0.0.5"), Port: 51234}})
+	ctx = metadata.NewIncomingContext(ctx, metadata.Pairs("x-forwarded-for", "203.0.113.7"))
+	require.Equal(t, "10.0.0.5", FromContext(ctx).IP)
+}
+
+func TestFromContextTraceID(t *testing.T) {
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(
+		"traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"x-request-id", "req-1",
+	))
+	require.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", FromContext(ctx).TraceID)
+
+	ctx = metadata.NewIncomingContext(context.Background(), metadata.Pairs(
+		"traceparent", "00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"x-request-id", "req-1",
+	))
+	require.Equal(t, "req-1", FromContext(ctx).TraceID)
+}
+
+func TestFromContextEmpty(t *testing.T) {
+	require.Equal(t, Info{}, FromContext(context.Background()))
+}
+
+func TestIPPrefix(t *testing.T) {
+	require.Equal(t, "203.0.113.0/24", IPPrefix("203.0.113.7"))
+	require.Equal(t, "2001:db8:abcd::/48", IPPrefix("2001:db8:abcd:12::1"))
+	require.Equal(t, "not-an-ip", IPPrefix("not-an-ip"))
+}
+
+func TestFingerprint(t *testing.T) {
+	home := Info{IP: "203.0.113.7", UserAgent: "Mozilla/5.0"}
+	sameNetwork := Info{IP: "203.0.113.99", UserAgent: "Mozilla/5.0"}
+	otherNetwork := Info{IP: "198.51.100.7", UserAgent: "Mozilla/5.0"}
+
+	require.Equal(t, home.Fingerprint(), sameNetwork.Fingerprint())
+	require.NotEqual(t, home.Fingerprint(), otherNetwork.Fingerprint())
+
+	// с x-device-id адрес не учитывается
+	phone := Info{IP: "203.0.113.7", UserAgent: "app/1.0", DeviceID: "abc"}
+	roaming := Info{IP: "198.51.100.7", UserAgent: "app/1.1", DeviceID: "abc"}
+	require.Equal(t, phone.Fingerprint(), roaming.Fingerprint())
+}
+
+func TestFromContextAcceptLanguage(t *testing.T) {
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("grpcgateway-accept-language", "ru-RU,ru;q=0.9"))
+	require.Equal(t, "ru-RU,ru;q=0.9", FromContext(ctx).AcceptLanguage)
+}
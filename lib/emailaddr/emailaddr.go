@@ -0,0 +1,89 @@
+package emailaddr
+
+import (
+	"errors"
+	"strings"
+)
+
+var ErrInvalidEmail = errors.New("invalid email")
+
+// Normalizer приводит адреса к двум формам:
+//   - отображаемой: без пробелов по краям и с доменом в нижнем регистре, локальная часть как ввёл пользователь;
+//   - канонической: целиком в нижнем регистре, по ней ищутся пользователи и проверяется уникальность.
+//
+// С ProviderRules каноническая форма дополнительно учитывает правила почтовых провайдеров,
+// которые доставляют разные написания в один ящик (точки и +теги в Gmail, алиасы доменов Яндекса).
+type Normalizer struct {
+	ProviderRules bool
+}
+
+// Normalize возвращает отображаемую и каноническую форму адреса
+func (n Normalizer) Normalize(raw string) (string, string, error) {
+	raw = strings.TrimSpace(raw)
+
+	at := strings.LastIndexByte(raw, '@')
+	if at <= 0 || at == len(raw)-1 || strings.ContainsAny(raw, " \t\r\n<>") {
+		return "", "", ErrInvalidEmail
+	}
+
+	local, domain := raw[:at], strings.ToLower(raw[at+1:])
+	if strings.Contains(local, "@") || !strings.Contains(domain, ".") || strings.HasPrefix(domain, ".") || strings.HasSuffix(domain, ".") {
+		return "", "", ErrInvalidEmail
+	}
+
+	display := local + "@" + domain
+
+	canonicalLocal := strings.ToLower(local)
+	if n.ProviderRules {
+		canonicalLocal, domain = providerCanonical(canonicalLocal, domain)
+	}
+
+	if canonicalLocal == "" {
+		return "", "", ErrInvalidEmail
+	}
+
+	return display, canonicalLocal + "@" + domain, nil
+}
+
+// Canonical возвращает только каноническую форму адреса
+func (n Normalizer) Canonical(raw string) (string, error) {
+	_, canonical, err := n.Normalize(raw)
+	return canonical, err
+}
+
+var yandexDomains = map[string]bool{
+	"yandex.ru":  true,
+	"yandex.com": true,
+	"yandex.by":  true,
+	"yandex.kz":  true,
+	"yandex.ua":  true,
+	"ya.ru":      true,
+}
+
+// providerCanonical применяет правила провайдера к адресу в нижнем регистре
+func providerCanonical(local string, domain string) (string, string) {
+	switch {
+	case domain == "gmail.com" || domain == "googlemail.com":
+		// Gmail игнорирует точки и всё после +
+		local = stripTag(local)
+		local = strings.ReplaceAll(local, ".", "")
+		domain = "gmail.com"
+	case yandexDomains[domain]:
+		// Яндекс не различает точки и дефисы в логине, доставляет +теги и обслуживает несколько доменов
+		local = stripTag(local)
+		local = strings.ReplaceAll(local, ".", "-")
+		domain = "yandex.ru"
+	case domain == "outlook.com" || domain == "hotmail.com" || domain == "live.com":
+		local = stripTag(local)
+	}
+
+	return local, domain
+}
+
+func stripTag(local string) string {
+	if i := strings.IndexByte(local, '+'); i >= 0 {
+		return local[:i]
+	}
+
+	return local
+}
@@ -0,0 +1,45 @@
+package emailaddr
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalize(t *testing.T) {
+	display, canonical, err := Normalizer{}.Normalize("  Bob.Smith+news@Gmail.COM ")
+	require.NoError(t, err)
+	require.Equal(t, "Bob.Smith+news@gmail.com", display)
+	require.Equal(t, "bob.smith+news@gmail.com", canonical)
+}
+
+func TestNormalizeProviderRules(t *testing.T) {
+	n := Normalizer{ProviderRules: true}
+
+	tests := []struct {
+		raw  string
+		want string
+	}{
+		{"Bob.Smith+news@Gmail.COM", "bobsmith@gmail.com"},
+		{"bobsmith@googlemail.com", "bobsmith@gmail.com"},
+		{"Ivan.Petrov+shop@ya.ru", "ivan-petrov@yandex.ru"},
+		{"ivan-petrov@yandex.com", "ivan-petrov@yandex.ru"},
+		{"alice+work@outlook.com", "alice@outlook.com"},
+		{"first.last+tag@example.com", "first.last+tag@example.com"},
+	}
+
+	for _, tt := range tests {
+		got, err := n.Canonical(tt.raw)
+		require.NoError(t, err, tt.raw)
+		require.Equal(t, tt.want, got, tt.raw)
+	}
+}
+
+func TestNormalizeInvalid(t *testing.T) {
+	n := Normalizer{ProviderRules: true}
+
+	for _, raw := range []string{"", "bob", "@example.com", "bob@", "bob@localhost", "bob@@example.com", "bob smith@example.com", "+tag@gmail.com"} {
+		_, _, err := n.Normalize(raw)
+		require.ErrorIs(t, err, ErrInvalidEmail, raw)
+	}
+}
@@ -0,0 +1,87 @@
+package envelope
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Заголовки сообщения Kafka с метаданными события.
+// Полезная нагрузка - сообщение protobuf, схема которого определяется парой event-type и schema-version.
+const (
+	HeaderEventID       = "event-id"
+	HeaderEventType     = "event-type"
+	HeaderSchemaVersion = "schema-version"
+	HeaderOccurredAt    = "occurred-at" // RFC 3339 с наносекундами, UTC
+	HeaderTraceID       = "trace-id"
+	HeaderProducer      = "producer"
+	HeaderContentType   = "content-type"
+
+	ContentTypeProtobuf = "application/x-protobuf"
+)
+
+var (
+	ErrMissingHeader = errors.New("missing envelope header")
+	ErrInvalidHeader = errors.New("invalid envelope header")
+)
+
+// Envelope - метаданные события
+type Envelope struct {
+	ID            string
+	Type          string
+	SchemaVersion int
+	OccurredAt    time.Time
+	TraceID       string // пустой, если событие возникло не из запроса
+	Producer      string
+	ContentType   string
+}
+
+// Headers возвращает заголовки сообщения. Пустой trace id не передаётся.
+func (e Envelope) Headers() map[string]string {
+	headers := map[string]string{
+		HeaderEventID:       e.ID,
+		HeaderEventType:     e.Type,
+		HeaderSchemaVersion: strconv.Itoa(e.SchemaVersion),
+		HeaderOccurredAt:    e.OccurredAt.UTC().Format(time.RFC3339Nano),
+		HeaderProducer:      e.Producer,
+		HeaderContentType:   e.ContentType,
+	}
+	if e.TraceID != "" {
+		headers[HeaderTraceID] = e.TraceID
+	}
+
+	return headers
+}
+
+// FromHeaders разбирает заголовки сообщения. Обязательны id, тип и версия схемы.
+func FromHeaders(headers map[string]string) (Envelope, error) {
+	e := Envelope{
+		ID:          headers[HeaderEventID],
+		Type:        headers[HeaderEventType],
+		TraceID:     headers[HeaderTraceID],
+		Producer:    headers[HeaderProducer],
+		ContentType: headers[HeaderContentType],
+	}
+
+	for _, name := range []string{HeaderEventID, HeaderEventType, HeaderSchemaVersion} {
+		if headers[name] == "" {
+			return Envelope{}, fmt.Errorf("%w: %s", ErrMissingHeader, name)
+		}
+	}
+
+	version, err := strconv.Atoi(headers[HeaderSchemaVersion])
+	if err != nil || version < 1 {
+		return Envelope{}, fmt.Errorf("%w: %s", ErrInvalidHeader, HeaderSchemaVersion)
+	}
+	e.SchemaVersion = version
+
+	if v := headers[HeaderOccurredAt]; v != "" {
+		e.OccurredAt, err = time.Parse(time.RFC3339Nano, v)
+		if err != nil {
+			return Envelope{}, fmt.Errorf("%w: %s", ErrInvalidHeader, HeaderOccurredAt)
+		}
+	}
+
+	return e, nil
+}
@@ -0,0 +1,42 @@
+package envelope
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHeadersRoundTrip(t *testing.T) {
+	e := Envelope{
+		ID:            "0f8fad5b-d9cb-469f-a165-70867728950e",
+		Type:          "user.registered",
+		SchemaVersion: 2,
+		OccurredAt:    time.Date(2025, 4, 1, 12, 30, 0, 123456789, time.UTC),
+		TraceID:       "4bf92f3577b34da6a3ce929d0e0e4736",
+		Producer:      "sso",
+		ContentType:   ContentTypeProtobuf,
+	}
+
+	parsed, err := FromHeaders(e.Headers())
+	require.NoError(t, err)
+	require.Equal(t, e, parsed)
+}
+
+func TestHeadersWithoutTraceID(t *testing.T) {
+	headers := Envelope{ID: "1", Type: "user.deleted", SchemaVersion: 1, OccurredAt: time.Now()}.Headers()
+
+	_, ok := headers[HeaderTraceID]
+	require.False(t, ok)
+}
+
+func TestFromHeadersErrors(t *testing.T) {
+	_, err := FromHeaders(map[string]string{HeaderEventID: "1", HeaderSchemaVersion: "1"})
+	require.ErrorIs(t, err, ErrMissingHeader)
+
+	_, err = FromHeaders(map[string]string{HeaderEventID: "1", HeaderEventType: "user.deleted", HeaderSchemaVersion: "v1"})
+	require.ErrorIs(t, err, ErrInvalidHeader)
+
+	_, err = FromHeaders(map[string]string{HeaderEventID: "1", HeaderEventType: "user.deleted", HeaderSchemaVersion: "1", HeaderOccurredAt: "yesterday"})
+	require.ErrorIs(t, err, ErrInvalidHeader)
+}
@@ -0,0 +1,169 @@
+package geoip
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/netip"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var ErrNotFound = errors.New("location not found")
+
+// Location - координаты в градусах
+type Location struct {
+	Latitude  float64
+	Longitude float64
+}
+
+type block struct {
+	prefix   netip.Prefix
+	location Location
+}
+
+// DB - локальная база геолокации по подсетям.
+// Читается из CSV с заголовком, в котором есть колонки network, latitude и longitude,
+// например GeoLite2-City-Blocks-IPv4.csv и GeoLite2-City-Blocks-IPv6.csv от MaxMind.
+// Подсети не должны пересекаться.
+type DB struct {
+	blocks []block // отсортированы по первому адресу подсети
+}
+
+// Load читает базу из одного или нескольких CSV файлов
+func Load(paths ...string) (*DB, error) {
+	db := &DB{}
+
+	for _, path := range paths {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open geoip database: %w", err)
+		}
+
+		err = db.read(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+
+	db.sort()
+
+	return db, nil
+}
+
+// Parse читает базу из CSV в формате Load
+func Parse(r io.Reader) (*DB, error) {
+	db := &DB{}
+	if err := db.read(r); err != nil {
+		return nil, err
+	}
+	db.sort()
+
+	return db, nil
+}
+
+func (db *DB) read(r io.Reader) error {
+	reader := csv.NewReader(r)
+	reader.ReuseRecord = true
+
+	header, err := reader.Read()
+	if err != nil {
+		return fmt.Errorf("failed to read header: %w", err)
+	}
+
+	network, latitude, longitude := -1, -1, -1
+	for i, name := range header {
+		switch strings.TrimSpace(name) {
+		case "network":
+			network = i
+		case "latitude":
+			latitude = i
+		case "longitude":
+			longitude = i
+		}
+	}
+	if network < 0 || latitude < 0 || longitude < 0 {
+		return errors.New("header must contain network, latitude and longitude columns")
+	}
+
+	for {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read record: %w", err)
+		}
+
+		// у части подсетей в GeoLite2 координат нет
+		if record[latitude] == "" || record[longitude] == "" {
+			continue
+		}
+
+		prefix, err := netip.ParsePrefix(record[network])
+		if err != nil {
+			return fmt.Errorf("invalid network %q: %w", record[network], err)
+		}
+
+		lat, err := strconv.ParseFloat(record[latitude], 64)
+		if err != nil {
+			return fmt.Errorf("invalid latitude %q: %w", record[latitude], err)
+		}
+
+		lon, err := strconv.ParseFloat(record[longitude], 64)
+		if err != nil {
+			return fmt.Errorf("invalid longitude %q: %w", record[longitude], err)
+		}
+
+		db.blocks = append(db.blocks, block{prefix: prefix.Masked(), location: Location{Latitude: lat, Longitude: lon}})
+	}
+}
+
+func (db *DB) sort() {
+	sort.Slice(db.blocks, func(i, j int) bool {
+		return db.blocks[i].prefix.Addr().Less(db.blocks[j].prefix.Addr())
+	})
+}
+
+// Lookup возвращает координаты подсети, в которую входит адрес
+func (db *DB) Lookup(ip string) (Location, error) {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return Location{}, ErrNotFound
+	}
+	addr = addr.Unmap()
+
+	// последняя подсеть, начинающаяся не позже addr
+	i := sort.Search(len(db.blocks), func(i int) bool {
+		return addr.Less(db.blocks[i].prefix.Addr())
+	}) - 1
+
+	if i < 0 || !db.blocks[i].prefix.Contains(addr) {
+		return Location{}, ErrNotFound
+	}
+
+	return db.blocks[i].location, nil
+}
+
+// Len возвращает количество подсетей в базе
+func (db *DB) Len() int {
+	return len(db.blocks)
+}
+
+const earthRadiusKm = 6371.0
+
+// DistanceKm - расстояние между точками по поверхности Земли (формула гаверсинусов)
+func DistanceKm(a, b Location) float64 {
+	lat1, lat2 := a.Latitude*math.Pi/180, b.Latitude*math.Pi/180
+	dLat := lat2 - lat1
+	dLon := (b.Longitude - a.Longitude) * math.Pi / 180
+
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLon/2)*math.Sin(dLon/2)
+
+	return 2 * earthRadiusKm * math.Asin(math.Sqrt(h))
+}
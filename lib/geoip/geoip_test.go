@@ -0,0 +1,51 @@
+package geoip
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const blocks = `network,geoname_id,latitude,longitude,accuracy_radius
+198.51.100.0/24,524901,55.7522,37.6156,20
+203.0.113.0/25,2643743,51.5085,-0.1257,50
+203.0.113.128/25,,,,
+2001:db8::/32,1850147,35.6895,139.6917,100
+`
+
+func TestLookup(t *testing.T) {
+	db, err := Parse(strings.NewReader(blocks))
+	require.NoError(t, err)
+	require.Equal(t, 3, db.Len())
+
+	moscow, err := db.Lookup("198.51.100.42")
+	require.NoError(t, err)
+	require.Equal(t, Location{Latitude: 55.7522, Longitude: 37.6156}, moscow)
+
+	london, err := db.Lookup("::ffff:203.0.113.10")
+	require.NoError(t, err)
+	require.Equal(t, 51.5085, london.Latitude)
+
+	tokyo, err := db.Lookup("2001:db8:1::1")
+	require.NoError(t, err)
+	require.Equal(t, 139.6917, tokyo.Longitude)
+
+	for _, ip := range []string{"203.0.113.200", "192.0.2.1", "10.0.0.1", "garbage"} {
+		_, err := db.Lookup(ip)
+		require.ErrorIs(t, err, ErrNotFound, ip)
+	}
+}
+
+func TestParseInvalidHeader(t *testing.T) {
+	_, err := Parse(strings.NewReader("cidr,lat,lon\n"))
+	require.Error(t, err)
+}
+
+func TestDistanceKm(t *testing.T) {
+	moscow := Location{Latitude: 55.7522, Longitude: 37.6156}
+	london := Location{Latitude: 51.5085, Longitude: -0.1257}
+
+	require.InDelta(t, 2500, DistanceKm(moscow, london), 25)
+	require.Zero(t, DistanceKm(moscow, moscow))
+}
@@ -0,0 +1,114 @@
+package handle
+
+import (
+	"errors"
+	"strings"
+)
+
+var (
+	ErrInvalidHandle  = errors.New("invalid handle")
+	ErrReservedHandle = errors.New("handle is reserved")
+)
+
+const (
+	MinLength = 3
+	MaxLength = 30
+)
+
+// defaultReserved - имена, которые нельзя занять: служебные адреса и то,
+// что пользователи могут принять за официальный аккаунт
+var defaultReserved = []string{
+	"admin", "administrator", "root", "system", "support", "help", "security",
+	"api", "sso", "auth", "login", "logout", "register", "signup", "signin",
+	"account", "accounts", "settings", "profile", "user", "users", "me",
+	"moderator", "staff", "official", "info", "contact", "null", "undefined",
+}
+
+// Validator проверяет хэндлы пользователей (user_name в ссылках на профиль).
+//
+// Хэндл состоит из латинских букв, цифр и подчёркиваний, начинается с буквы
+// и хранится в нижнем регистре. Кроме самого хэндла вычисляется его скелет
+// (Skeleton) - форма, в которой похожие символы (0 и o, 1, l и i) склеены.
+// Уникальность проверяется по скелету, чтобы нельзя было занять "j0hn_doe" рядом с "johndoe".
+type Validator struct {
+	reserved map[string]struct{}
+}
+
+// New создаёт Validator со встроенным списком зарезервированных имён и дополнительными extra
+func New(extra ...string) *Validator {
+	v := &Validator{reserved: make(map[string]struct{}, len(defaultReserved)+len(extra))}
+
+	for _, word := range append(defaultReserved, extra...) {
+		v.reserved[Skeleton(strings.ToLower(strings.TrimSpace(word)))] = struct{}{}
+	}
+
+	return v
+}
+
+// Normalize проверяет хэндл и возвращает его каноническую форму и скелет
+func (v *Validator) Normalize(raw string) (handle string, skeleton string, err error) {
+	handle = Fold(raw)
+
+	if len(handle) < MinLength || len(handle) > MaxLength {
+		return "", "", ErrInvalidHandle
+	}
+
+	for i := 0; i < len(handle); i++ {
+		c := handle[i]
+		switch {
+		case c >= 'a' && c <= 'z':
+		case c >= '0' && c <= '9', c == '_':
+			if i == 0 {
+				return "", "", ErrInvalidHandle
+			}
+		default:
+			// в том числе любые не-ASCII символы: кириллическая "а" неотличима от латинской
+			return "", "", ErrInvalidHandle
+		}
+	}
+
+	if strings.HasSuffix(handle, "_") || strings.Contains(handle, "__") {
+		return "", "", ErrInvalidHandle
+	}
+
+	skeleton = Skeleton(handle)
+	if _, ok := v.reserved[skeleton]; ok {
+		return "", "", ErrReservedHandle
+	}
+
+	return handle, skeleton, nil
+}
+
+// Fold приводит введённый хэндл к виду, в котором он хранится, без проверки правил.
+// Нужен для поиска: хэндл, занятый до добавления слова в список зарезервированных, должен находиться.
+func Fold(raw string) string {
+	return strings.ToLower(strings.TrimPrefix(strings.TrimSpace(raw), "@"))
+}
+
+// Skeleton сводит визуально похожие символы к одному и убирает подчёркивания.
+// Ожидает хэндл в нижнем регистре.
+func Skeleton(handle string) string {
+	var b strings.Builder
+	b.Grow(len(handle))
+
+	for i := 0; i < len(handle); i++ {
+		c := handle[i]
+		switch c {
+		case '_':
+			continue
+		case '0':
+			c = 'o'
+		case '1', 'i':
+			c = 'l'
+		case '5':
+			c = 's'
+		case 'm':
+			// "rn" в некоторых шрифтах не отличить от "m"
+			b.WriteString("rn")
+			continue
+		}
+		b.WriteByte(c)
+	}
+
+	return b.String()
+}
@@ -0,0 +1,54 @@
+package handle
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalize(t *testing.T) {
+	v := New()
+
+	tests := []struct {
+		raw      string
+		handle   string
+		skeleton string
+	}{
+		{"John_Doe", "john_doe", "johndoe"},
+		{"@bob42", "bob42", "bob42"},
+		{"  w1ll0w ", "w1ll0w", "wlllow"},
+		{"emma", "emma", "ernrna"},
+	}
+
+	for _, tt := range tests {
+		handle, skeleton, err := v.Normalize(tt.raw)
+		require.NoError(t, err, tt.raw)
+		require.Equal(t, tt.handle, handle, tt.raw)
+		require.Equal(t, tt.skeleton, skeleton, tt.raw)
+	}
+}
+
+func TestNormalizeInvalid(t *testing.T) {
+	v := New()
+
+	for _, raw := range []string{"", "ab", "1abc", "_abc", "abc_", "a__b", "bob@x.com", "jоhn", "bob-smith", "abcdefghijklmnopqrstuvwxyz12345"} {
+		_, _, err := v.Normalize(raw)
+		require.ErrorIs(t, err, ErrInvalidHandle, raw)
+	}
+}
+
+func TestNormalizeReserved(t *testing.T) {
+	v := New("acme")
+
+	for _, raw := range []string{"admin", "Adm1n", "ADMIN", "acme", "supp0rt", "r00t"} {
+		_, _, err := v.Normalize(raw)
+		require.ErrorIs(t, err, ErrReservedHandle, raw)
+	}
+}
+
+func TestSkeletonConfusables(t *testing.T) {
+	require.Equal(t, Skeleton("johndoe"), Skeleton("j0hn_doe"))
+	require.Equal(t, Skeleton("modern"), Skeleton("rnodern"))
+	require.Equal(t, Skeleton("bill"), Skeleton("b1ll"))
+	require.NotEqual(t, Skeleton("bob"), Skeleton("rob"))
+}
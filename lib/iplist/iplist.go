@@ -0,0 +1,85 @@
+package iplist
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/netip"
+	"os"
+	"strings"
+)
+
+// List - набор адресов и подсетей, например список известных прокси, Tor exit-узлов
+// или адресов, с которых шёл перебор паролей
+type List struct {
+	prefixes []netip.Prefix
+}
+
+// Load читает список из файла: один адрес или подсеть в CIDR-нотации на строку,
+// пустые строки и текст после # пропускаются
+func Load(path string) (*List, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open ip list: %w", err)
+	}
+	defer f.Close()
+
+	return Parse(f)
+}
+
+// Parse читает список в формате Load
+func Parse(r io.Reader) (*List, error) {
+	list := &List{}
+
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		entry, _, _ := strings.Cut(scanner.Text(), "#")
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		if !strings.Contains(entry, "/") {
+			addr, err := netip.ParseAddr(entry)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", line, err)
+			}
+			list.prefixes = append(list.prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+
+		prefix, err := netip.ParsePrefix(entry)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		list.prefixes = append(list.prefixes, prefix.Masked())
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read ip list: %w", err)
+	}
+
+	return list, nil
+}
+
+// Contains сообщает, входит ли адрес в список. Некорректный адрес не входит никуда.
+func (l *List) Contains(ip string) bool {
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+
+	for _, prefix := range l.prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Len возвращает количество записей в списке
+func (l *List) Len() int {
+	return len(l.prefixes)
+}
@@ -0,0 +1,33 @@
+package iplist
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParse(t *testing.T) {
+	list, err := Parse(strings.NewReader(`
+# tor exit nodes
+203.0.113.7
+198.51.100.0/24 # hosting
+2001:db8::/32
+`))
+	require.NoError(t, err)
+	require.Equal(t, 3, list.Len())
+
+	require.True(t, list.Contains("203.0.113.7"))
+	require.True(t, list.Contains("198.51.100.200"))
+	require.True(t, list.Contains("::ffff:198.51.100.1"))
+	require.True(t, list.Contains("2001:db8:1::1"))
+
+	require.False(t, list.Contains("203.0.113.8"))
+	require.False(t, list.Contains("192.0.2.1"))
+	require.False(t, list.Contains("not-an-ip"))
+}
+
+func TestParseInvalid(t *testing.T) {
+	_, err := Parse(strings.NewReader("203.0.113.7\n300.1.1.1\n"))
+	require.ErrorContains(t, err, "line 2")
+}
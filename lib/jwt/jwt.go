@@ -9,7 +9,8 @@ import (
 )
 
 // NewToken creates new JWT token for given user and app.
-func NewToken(user models.User, appSecret string, duration time.Duration) (string, error) {
+// session describes how and when the user authenticated (auth_time, amr, acr claims).
+func NewToken(user models.User, session models.Session, appSecret string, duration time.Duration) (string, error) {
 	token := jwt.New(jwt.SigningMethodHS256)
 
 	// Добавляем в токен всю необходимую информацию
@@ -21,6 +22,11 @@ func NewToken(user models.User, appSecret string, duration time.Duration) (strin
 	claims["verified"] = user.Verified
 	claims["avatar"] = user.Avatar
 	claims["exp"] = time.Now().Add(duration).Unix()
+	if !session.AuthTime.IsZero() {
+		claims["auth_time"] = session.AuthTime.Unix()
+	}
+	claims["amr"] = session.AMR
+	claims["acr"] = session.ACR
 	// claims["app_id"] = app.ID
 
 	// Подписываем токен, используя секретный ключ приложения
@@ -22,7 +22,15 @@ func TestNewToken(t *testing.T) {
 		Avatar:   "avatar.png",
 	}
 
-	tokenStr, err := NewToken(user, secret, duration)
+	authTime := time.Now().Add(-time.Minute)
+	session := models.Session{
+		UserID:   user.ID,
+		AuthTime: authTime,
+		AMR:      []string{models.AMRPassword},
+		ACR:      models.ACRSingleFactor,
+	}
+
+	tokenStr, err := NewToken(user, session, secret, duration)
 	require.NoError(t, err)
 	require.NotEmpty(t, tokenStr)
 
@@ -48,4 +56,10 @@ func TestNewToken(t *testing.T) {
 	require.True(t, ok)
 	expTime := time.Unix(int64(expFloat), 0)
 	require.WithinDuration(t, time.Now().Add(duration), expTime, 2*time.Second)
+
+	authTimeFloat, ok := claims["auth_time"].(float64)
+	require.True(t, ok)
+	require.Equal(t, authTime.Unix(), int64(authTimeFloat))
+	require.Equal(t, []any{models.AMRPassword}, claims["amr"])
+	require.Equal(t, models.ACRSingleFactor, claims["acr"])
 }
\ No newline at end of file
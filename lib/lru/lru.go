@@ -0,0 +1,111 @@
+// Package lru - потокобезопасный кэш ограниченного размера с временем жизни записей.
+// При переполнении вытесняется запись, которую дольше всех не читали.
+package lru
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+type Cache[K comparable, V any] struct {
+	size int
+	ttl  time.Duration
+	now  func() time.Time
+
+	mu    sync.Mutex
+	items map[K]*list.Element
+	order *list.List // в начале - последние прочитанные
+}
+
+type entry[K comparable, V any] struct {
+	key     K
+	value   V
+	expires time.Time
+}
+
+// New создаёт кэш на size записей, каждая живёт ttl после добавления
+func New[K comparable, V any](size int, ttl time.Duration) *Cache[K, V] {
+	return &Cache[K, V]{
+		size:  max(size, 1),
+		ttl:   ttl,
+		now:   time.Now,
+		items: make(map[K]*list.Element),
+		order: list.New(),
+	}
+}
+
+// Get возвращает значение, если запись есть и ещё не истекла
+func (c *Cache[K, V]) Get(key K) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.items[key]
+	if !ok {
+		var zero V
+		return zero, false
+	}
+
+	e := el.Value.(*entry[K, V])
+	if !c.now().Before(e.expires) {
+		c.remove(el)
+		var zero V
+		return zero, false
+	}
+
+	c.order.MoveToFront(el)
+	return e.value, true
+}
+
+// Add добавляет или заменяет запись
+func (c *Cache[K, V]) Add(key K, value V) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	expires := c.now().Add(c.ttl)
+
+	if el, ok := c.items[key]; ok {
+		e := el.Value.(*entry[K, V])
+		e.value, e.expires = value, expires
+		c.order.MoveToFront(el)
+		return
+	}
+
+	c.items[key] = c.order.PushFront(&entry[K, V]{key: key, value: value, expires: expires})
+
+	if c.order.Len() > c.size {
+		c.remove(c.order.Back())
+	}
+}
+
+// Remove удаляет запись, если она есть
+func (c *Cache[K, V]) Remove(key K) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.items[key]; ok {
+		c.remove(el)
+	}
+}
+
+// Purge удаляет все записи
+func (c *Cache[K, V]) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.items = make(map[K]*list.Element)
+	c.order.Init()
+}
+
+// Len возвращает число записей, включая истёкшие, но ещё не вытесненные
+func (c *Cache[K, V]) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.order.Len()
+}
+
+func (c *Cache[K, V]) remove(el *list.Element) {
+	c.order.Remove(el)
+	delete(c.items, el.Value.(*entry[K, V]).key)
+}
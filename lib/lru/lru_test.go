@@ -0,0 +1,60 @@
+package lru
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEvictsLeastRecentlyUsed(t *testing.T) {
+	c := New[string, int](2, time.Minute)
+
+	c.Add("a", 1)
+	c.Add("b", 2)
+
+	// a прочитана последней, вытесняется b
+	_, ok := c.Get("a")
+	require.True(t, ok)
+	c.Add("c", 3)
+
+	_, ok = c.Get("b")
+	require.False(t, ok)
+
+	v, ok := c.Get("a")
+	require.True(t, ok)
+	require.Equal(t, 1, v)
+	require.Equal(t, 2, c.Len())
+
+	c.Remove("a")
+	_, ok = c.Get("a")
+	require.False(t, ok)
+
+	c.Purge()
+	require.Zero(t, c.Len())
+}
+
+func TestExpires(t *testing.T) {
+	now := time.Now()
+	c := New[string, int](10, time.Second)
+	c.now = func() time.Time { return now }
+
+	c.Add("a", 1)
+	now = now.Add(999 * time.Millisecond)
+	_, ok := c.Get("a")
+	require.True(t, ok)
+
+	now = now.Add(time.Millisecond)
+	_, ok = c.Get("a")
+	require.False(t, ok)
+	require.Zero(t, c.Len())
+
+	// повторное добавление продлевает запись
+	c.Add("b", 1)
+	now = now.Add(900 * time.Millisecond)
+	c.Add("b", 2)
+	now = now.Add(900 * time.Millisecond)
+	v, ok := c.Get("b")
+	require.True(t, ok)
+	require.Equal(t, 2, v)
+}
@@ -0,0 +1,208 @@
+package mailtemplate
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	texttemplate "text/template"
+
+	"golang.org/x/text/language"
+)
+
+var (
+	ErrUnknownTemplate = errors.New("unknown mail template")
+	ErrNoSubject       = errors.New("mail template does not define a subject")
+)
+
+// Rendered - готовое письмо
+type Rendered struct {
+	Locale  string
+	Subject string
+	Text    string
+	HTML    string // пустая, если у шаблона нет HTML версии
+}
+
+type template struct {
+	text *texttemplate.Template
+	html *htmltemplate.Template
+}
+
+// Set - набор шаблонов писем с вариантами для разных языков.
+//
+// Файлы лежат в каталогах языков: <locale>/<name>.txt - текстовая версия, которая
+// должна определить блок {{define "subject"}}, и необязательная <locale>/<name>.html.
+// Каждый шаблон обязан быть на языке по умолчанию; в остальных языках может быть
+// только часть шаблонов - недостающие берутся из языка по умолчанию.
+type Set struct {
+	defaultLocale string
+	locales       []string // язык по умолчанию первый
+	matcher       language.Matcher
+	templates     map[string]map[string]template // имя -> язык -> шаблон
+}
+
+// Load читает шаблоны из fsys
+func Load(fsys fs.FS, defaultLocale string) (*Set, error) {
+	s := &Set{
+		defaultLocale: defaultLocale,
+		templates:     make(map[string]map[string]template),
+	}
+
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read mail templates: %w", err)
+	}
+
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		if err := s.loadLocale(fsys, entry.Name()); err != nil {
+			return nil, err
+		}
+	}
+
+	for name, variants := range s.templates {
+		if _, ok := variants[defaultLocale]; !ok {
+			return nil, fmt.Errorf("mail template %q has no variant for default locale %q", name, defaultLocale)
+		}
+	}
+
+	// язык по умолчанию первым: его выбирает matcher, когда ничего не подошло
+	locales := make([]string, 0)
+	for name := range s.localeSet() {
+		if name != defaultLocale {
+			locales = append(locales, name)
+		}
+	}
+	sort.Strings(locales)
+	s.locales = append([]string{defaultLocale}, locales...)
+
+	tags := make([]language.Tag, 0, len(s.locales))
+	for _, locale := range s.locales {
+		tag, err := language.Parse(locale)
+		if err != nil {
+			return nil, fmt.Errorf("invalid mail template locale %q: %w", locale, err)
+		}
+		tags = append(tags, tag)
+	}
+	s.matcher = language.NewMatcher(tags)
+
+	return s, nil
+}
+
+func (s *Set) loadLocale(fsys fs.FS, locale string) error {
+	files, err := fs.Glob(fsys, path.Join(locale, "*.txt"))
+	if err != nil {
+		return fmt.Errorf("failed to list mail templates: %w", err)
+	}
+
+	for _, file := range files {
+		name := strings.TrimSuffix(path.Base(file), ".txt")
+
+		text, err := texttemplate.ParseFS(fsys, file)
+		if err != nil {
+			return fmt.Errorf("failed to parse mail template %s: %w", file, err)
+		}
+		if text.Lookup("subject") == nil {
+			return fmt.Errorf("%w: %s", ErrNoSubject, file)
+		}
+
+		t := template{text: text}
+
+		htmlFile := path.Join(locale, name+".html")
+		if _, err := fs.Stat(fsys, htmlFile); err == nil {
+			if t.html, err = htmltemplate.ParseFS(fsys, htmlFile); err != nil {
+				return fmt.Errorf("failed to parse mail template %s: %w", htmlFile, err)
+			}
+		}
+
+		if s.templates[name] == nil {
+			s.templates[name] = make(map[string]template)
+		}
+		s.templates[name][locale] = t
+	}
+
+	return nil
+}
+
+func (s *Set) localeSet() map[string]bool {
+	set := make(map[string]bool)
+	for _, variants := range s.templates {
+		for locale := range variants {
+			set[locale] = true
+		}
+	}
+	return set
+}
+
+// Locales возвращает доступные языки, язык по умолчанию первым
+func (s *Set) Locales() []string {
+	return s.locales
+}
+
+// Has сообщает, есть ли шаблон с таким именем
+func (s *Set) Has(name string) bool {
+	_, ok := s.templates[name]
+	return ok
+}
+
+// Match выбирает язык из доступных по значению заголовка Accept-Language.
+// Пустой или некорректный заголовок - язык по умолчанию.
+func (s *Set) Match(acceptLanguage string) string {
+	tags, _, err := language.ParseAcceptLanguage(acceptLanguage)
+	if err != nil || len(tags) == 0 {
+		return s.defaultLocale
+	}
+
+	_, index, confidence := s.matcher.Match(tags...)
+	if confidence == language.No {
+		return s.defaultLocale
+	}
+
+	return s.locales[index]
+}
+
+// Render отрисовывает шаблон name на языке, лучше всего подходящем под acceptLanguage
+func (s *Set) Render(name string, acceptLanguage string, data any) (Rendered, error) {
+	variants, ok := s.templates[name]
+	if !ok {
+		return Rendered{}, fmt.Errorf("%w: %s", ErrUnknownTemplate, name)
+	}
+
+	locale := s.Match(acceptLanguage)
+	t, ok := variants[locale]
+	if !ok {
+		locale = s.defaultLocale
+		t = variants[locale]
+	}
+
+	r := Rendered{Locale: locale}
+
+	var buf bytes.Buffer
+	if err := t.text.ExecuteTemplate(&buf, "subject", data); err != nil {
+		return Rendered{}, fmt.Errorf("failed to render subject of %s: %w", name, err)
+	}
+	// перевод строки в теме сломает заголовок письма
+	r.Subject = strings.Join(strings.Fields(buf.String()), " ")
+
+	buf.Reset()
+	if err := t.text.Execute(&buf, data); err != nil {
+		return Rendered{}, fmt.Errorf("failed to render %s: %w", name, err)
+	}
+	r.Text = strings.TrimSpace(buf.String()) + "\n"
+
+	if t.html != nil {
+		buf.Reset()
+		if err := t.html.Execute(&buf, data); err != nil {
+			return Rendered{}, fmt.Errorf("failed to render html of %s: %w", name, err)
+		}
+		r.HTML = buf.String()
+	}
+
+	return r, nil
+}
@@ -0,0 +1,61 @@
+package mailtemplate
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/require"
+)
+
+func templates() fstest.MapFS {
+	return fstest.MapFS{
+		"en/welcome.txt":  {Data: []byte(`{{define "subject"}}Welcome, {{.Name}}{{end}}Hello, {{.Name}}!`)},
+		"en/welcome.html": {Data: []byte(`<p>Hello, {{.Name}}!</p>`)},
+		"en/plain.txt":    {Data: []byte(`{{define "subject"}}Plain{{end}}Only text`)},
+		"ru/welcome.txt":  {Data: []byte(`{{define "subject"}}Добро пожаловать, {{.Name}}{{end}}Привет, {{.Name}}!`)},
+		"ru/welcome.html": {Data: []byte(`<p>Привет, {{.Name}}!</p>`)},
+	}
+}
+
+func TestRenderLocales(t *testing.T) {
+	set, err := Load(templates(), "en")
+	require.NoError(t, err)
+	require.Equal(t, []string{"en", "ru"}, set.Locales())
+	require.True(t, set.Has("plain"))
+
+	data := map[string]string{"Name": "<Ann>"}
+
+	r, err := set.Render("welcome", "ru-RU,ru;q=0.9,en;q=0.8", data)
+	require.NoError(t, err)
+	require.Equal(t, "ru", r.Locale)
+	require.Equal(t, "Добро пожаловать, <Ann>", r.Subject)
+	require.Equal(t, "Привет, <Ann>!\n", r.Text)
+	require.Equal(t, "<p>Привет, &lt;Ann&gt;!</p>", r.HTML)
+
+	r, err = set.Render("welcome", "de-DE", data)
+	require.NoError(t, err)
+	require.Equal(t, "en", r.Locale)
+
+	r, err = set.Render("welcome", "", data)
+	require.NoError(t, err)
+	require.Equal(t, "en", r.Locale)
+
+	// шаблона нет на русском - берётся язык по умолчанию, HTML версии нет
+	r, err = set.Render("plain", "ru", data)
+	require.NoError(t, err)
+	require.Equal(t, "en", r.Locale)
+	require.Equal(t, "Only text\n", r.Text)
+	require.Empty(t, r.HTML)
+
+	_, err = set.Render("missing", "en", data)
+	require.ErrorIs(t, err, ErrUnknownTemplate)
+}
+
+func TestLoadValidation(t *testing.T) {
+	_, err := Load(fstest.MapFS{"en/welcome.txt": {Data: []byte(`no subject`)}}, "en")
+	require.ErrorIs(t, err, ErrNoSubject)
+
+	// шаблон обязан быть на языке по умолчанию
+	_, err = Load(fstest.MapFS{"ru/welcome.txt": {Data: []byte(`{{define "subject"}}x{{end}}`)}}, "en")
+	require.Error(t, err)
+}
@@ -0,0 +1,63 @@
+package netguard
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"syscall"
+)
+
+// ErrForbiddenAddress - адрес во внутренней сети: запрос туда позволил бы через сервис
+// обращаться к его окружению (SSRF)
+var ErrForbiddenAddress = errors.New("address is not public")
+
+// sharedAddressSpace - 100.64.0.0/10 (RFC 6598), адреса за NAT провайдера и в некоторых облаках
+var sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+// CheckAddr возвращает ErrForbiddenAddress для loopback, частных, link-local, multicast
+// и неопределённых адресов. IPv4, записанный как IPv6 (::ffff:a.b.c.d), проверяется как IPv4.
+func CheckAddr(addr netip.Addr) error {
+	addr = addr.Unmap()
+
+	if !addr.IsValid() || addr.IsUnspecified() || addr.IsLoopback() || addr.IsPrivate() ||
+		addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() || addr.IsInterfaceLocalMulticast() ||
+		addr.IsMulticast() || sharedAddressSpace.Contains(addr) || (addr.Is4() && addr.As4()[0] == 0) {
+		return fmt.Errorf("%w: %s", ErrForbiddenAddress, addr)
+	}
+
+	return nil
+}
+
+// CheckHost проверяет все адреса, в которые разрешается host. Если хоть один из них внутренний,
+// возвращается ErrForbiddenAddress: иначе DNS с несколькими записями обходил бы проверку.
+func CheckHost(ctx context.Context, host string) error {
+	if addr, err := netip.ParseAddr(host); err == nil {
+		return CheckAddr(addr)
+	}
+
+	addrs, err := net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+	if err != nil {
+		return fmt.Errorf("failed to resolve %s: %w", host, err)
+	}
+
+	for _, addr := range addrs {
+		if err := CheckAddr(addr); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Control для net.Dialer: проверяет адрес, к которому действительно идёт подключение.
+// Проверка при создании подписки этого не заменяет: DNS может вернуть другой адрес позже (DNS rebinding).
+func Control(network string, address string, c syscall.RawConn) error {
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrForbiddenAddress, address)
+	}
+
+	return CheckAddr(addrPort.Addr())
+}
@@ -0,0 +1,35 @@
+package netguard
+
+import (
+	"context"
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckAddr(t *testing.T) {
+	forbidden := []string{
+		"127.0.0.1", "10.1.2.3", "172.16.0.1", "192.168.1.1", "169.254.169.254", "100.64.0.1",
+		"0.0.0.0", "0.1.2.3", "224.0.0.1", "::1", "::", "fe80::1", "fc00::1", "::ffff:127.0.0.1", "::ffff:10.0.0.1",
+	}
+	for _, ip := range forbidden {
+		require.ErrorIs(t, CheckAddr(netip.MustParseAddr(ip)), ErrForbiddenAddress, ip)
+	}
+
+	for _, ip := range []string{"203.0.113.7", "8.8.8.8", "2001:4860:4860::8888"} {
+		require.NoError(t, CheckAddr(netip.MustParseAddr(ip)), ip)
+	}
+}
+
+func TestCheckHost(t *testing.T) {
+	require.ErrorIs(t, CheckHost(context.Background(), "127.0.0.1"), ErrForbiddenAddress)
+	require.ErrorIs(t, CheckHost(context.Background(), "localhost"), ErrForbiddenAddress)
+	require.NoError(t, CheckHost(context.Background(), "203.0.113.7"))
+}
+
+func TestControl(t *testing.T) {
+	require.ErrorIs(t, Control("tcp", "127.0.0.1:443", nil), ErrForbiddenAddress)
+	require.ErrorIs(t, Control("tcp", "[::1]:443", nil), ErrForbiddenAddress)
+	require.NoError(t, Control("tcp", "203.0.113.7:443", nil))
+}
@@ -0,0 +1,32 @@
+package otp
+
+import (
+	"crypto/rand"
+	"errors"
+	"math/big"
+	"strings"
+)
+
+var ErrInvalidLength = errors.New("code length must be positive")
+
+// Generate возвращает случайный числовой код заданной длины.
+// Ведущие нули допустимы, поэтому код нужно хранить и сравнивать как строку.
+func Generate(length int) (string, error) {
+	if length <= 0 {
+		return "", ErrInvalidLength
+	}
+
+	var sb strings.Builder
+	sb.Grow(length)
+
+	ten := big.NewInt(10)
+	for range length {
+		n, err := rand.Int(rand.Reader, ten)
+		if err != nil {
+			return "", err
+		}
+		sb.WriteByte(byte('0' + n.Int64()))
+	}
+
+	return sb.String(), nil
+}
@@ -0,0 +1,24 @@
+package otp
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGenerate(t *testing.T) {
+	for _, length := range []int{1, 4, 6, 8} {
+		code, err := Generate(length)
+		require.NoError(t, err)
+		require.Len(t, code, length)
+
+		for _, r := range code {
+			require.True(t, r >= '0' && r <= '9', "unexpected symbol %q in code %q", r, code)
+		}
+	}
+}
+
+func TestGenerateInvalidLength(t *testing.T) {
+	_, err := Generate(0)
+	require.ErrorIs(t, err, ErrInvalidLength)
+}
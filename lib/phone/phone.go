@@ -0,0 +1,70 @@
+package phone
+
+import (
+	"errors"
+	"strings"
+)
+
+var ErrInvalidPhone = errors.New("invalid phone number")
+
+// Normalizer приводит номера телефонов к формату E.164 (+79991234567).
+//
+// Номера в международном формате (+7..., 007...) принимаются как есть.
+// Номера без кода страны считаются местными: у них отбрасывается префикс
+// выхода на междугороднюю связь (TrunkPrefix, например 8 в России)
+// и добавляется DefaultCountryCode.
+type Normalizer struct {
+	DefaultCountryCode string // код страны без плюса, например "7"
+	TrunkPrefix        string // например "8" для России или "0" для большинства стран Европы
+}
+
+// Normalize возвращает номер в формате E.164
+func (n Normalizer) Normalize(raw string) (string, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return "", ErrInvalidPhone
+	}
+
+	international := false
+	switch {
+	case strings.HasPrefix(raw, "+"):
+		international = true
+		raw = raw[1:]
+	case strings.HasPrefix(raw, "00"):
+		international = true
+		raw = raw[2:]
+	}
+
+	var digits strings.Builder
+	for _, r := range raw {
+		switch {
+		case r >= '0' && r <= '9':
+			digits.WriteRune(r)
+		case r == ' ' || r == '-' || r == '(' || r == ')' || r == '.':
+			// разделители, которые пользователи любят ставить в номерах
+		default:
+			return "", ErrInvalidPhone
+		}
+	}
+
+	number := digits.String()
+
+	if !international {
+		if n.DefaultCountryCode == "" {
+			return "", ErrInvalidPhone
+		}
+
+		if n.TrunkPrefix != "" && strings.HasPrefix(number, n.TrunkPrefix) {
+			number = strings.TrimPrefix(number, n.TrunkPrefix)
+		}
+
+		number = n.DefaultCountryCode + number
+	}
+
+	// E.164: не больше 15 цифр, код страны не начинается с нуля
+	if len(number) < 8 || len(number) > 15 || number[0] == '0' {
+		return "", ErrInvalidPhone
+	}
+
+	return "+" + number, nil
+}
@@ -0,0 +1,40 @@
+package phone
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalize(t *testing.T) {
+	n := Normalizer{DefaultCountryCode: "7", TrunkPrefix: "8"}
+
+	tests := []struct {
+		raw  string
+		want string
+	}{
+		{"+7 (999) 123-45-67", "+79991234567"},
+		{"8 999 123 45 67", "+79991234567"},
+		{"9991234567", "+79991234567"},
+		{"0049 30 1234567", "+49301234567"},
+		{"+44 20 7946 0958", "+442079460958"},
+	}
+
+	for _, tt := range tests {
+		got, err := n.Normalize(tt.raw)
+		require.NoError(t, err, tt.raw)
+		require.Equal(t, tt.want, got, tt.raw)
+	}
+}
+
+func TestNormalizeInvalid(t *testing.T) {
+	n := Normalizer{DefaultCountryCode: "7", TrunkPrefix: "8"}
+
+	for _, raw := range []string{"", "+7 999 abc", "+123", "+1234567890123456", "+0123456789"} {
+		_, err := n.Normalize(raw)
+		require.ErrorIs(t, err, ErrInvalidPhone, raw)
+	}
+
+	_, err := Normalizer{}.Normalize("9991234567")
+	require.ErrorIs(t, err, ErrInvalidPhone)
+}
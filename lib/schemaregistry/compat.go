@@ -0,0 +1,188 @@
+package schemaregistry
+
+import (
+	"fmt"
+	"strings"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// Violation - изменение схемы, которое ломает потребителей старой или новой версии
+type Violation struct {
+	Path   string // путь к полю, например UserRegistered.profile.email
+	Reason string
+}
+
+func (v Violation) String() string {
+	return v.Path + ": " + v.Reason
+}
+
+// CompatibilityError перечисляет все нарушения совместимости между двумя версиями схемы
+type CompatibilityError struct {
+	Violations []Violation
+}
+
+func (e *CompatibilityError) Error() string {
+	parts := make([]string, 0, len(e.Violations))
+	for _, v := range e.Violations {
+		parts = append(parts, v.String())
+	}
+	return "incompatible schema change: " + strings.Join(parts, "; ")
+}
+
+// Compatible проверяет, что сообщение next можно читать кодом, написанным под prev, и наоборот.
+//
+// Правила (совместимость и бинарного, и JSON представления):
+//   - новые поля добавлять можно;
+//   - удалённое поле должно остаться в reserved - и номер, и имя, чтобы их не заняли снова;
+//   - у сохранённого поля нельзя менять имя, повторяемость, oneof и тип, кроме
+//     взаимозаменяемых на проводе (int32/int64/uint32/uint64/bool, sint32/sint64, string/bytes,
+//     fixed32/sfixed32, fixed64/sfixed64);
+//   - вложенные сообщения проверяются по тем же правилам.
+func Compatible(prev, next protoreflect.MessageDescriptor) error {
+	c := checker{visited: make(map[[2]protoreflect.FullName]bool)}
+	c.message(string(next.Name()), prev, next)
+
+	if len(c.violations) > 0 {
+		return &CompatibilityError{Violations: c.violations}
+	}
+	return nil
+}
+
+type checker struct {
+	violations []Violation
+	visited    map[[2]protoreflect.FullName]bool
+}
+
+func (c *checker) add(path string, format string, args ...any) {
+	c.violations = append(c.violations, Violation{Path: path, Reason: fmt.Sprintf(format, args...)})
+}
+
+func (c *checker) message(path string, prev, next protoreflect.MessageDescriptor) {
+	key := [2]protoreflect.FullName{prev.FullName(), next.FullName()}
+	if c.visited[key] {
+		return
+	}
+	c.visited[key] = true
+
+	prevFields := prev.Fields()
+	nextFields := next.Fields()
+
+	for i := 0; i < prevFields.Len(); i++ {
+		old := prevFields.Get(i)
+		fieldPath := path + "." + string(old.Name())
+
+		cur := nextFields.ByNumber(old.Number())
+		if cur == nil {
+			var missing []string
+			if !next.ReservedRanges().Has(old.Number()) {
+				missing = append(missing, "number")
+			}
+			if !next.ReservedNames().Has(old.Name()) {
+				missing = append(missing, "name")
+			}
+			if len(missing) > 0 {
+				c.add(fieldPath, "field %d removed without reserving its %s", old.Number(), strings.Join(missing, " and "))
+			}
+			continue
+		}
+
+		c.field(fieldPath, old, cur)
+	}
+
+	for i := 0; i < nextFields.Len(); i++ {
+		cur := nextFields.Get(i)
+		if prevFields.ByNumber(cur.Number()) != nil {
+			continue
+		}
+
+		fieldPath := path + "." + string(cur.Name())
+		if prev.ReservedRanges().Has(cur.Number()) {
+			c.add(fieldPath, "field reuses reserved number %d", cur.Number())
+		}
+		if prev.ReservedNames().Has(cur.Name()) {
+			c.add(fieldPath, "field reuses reserved name")
+		}
+	}
+}
+
+func (c *checker) field(path string, prev, next protoreflect.FieldDescriptor) {
+	if prev.Name() != next.Name() {
+		// бинарно совместимо, но ломает JSON и сгенерированный код потребителей
+		c.add(path, "field %d renamed to %q", prev.Number(), next.Name())
+	}
+
+	if prev.Cardinality() == protoreflect.Repeated || next.Cardinality() == protoreflect.Repeated {
+		if prev.Cardinality() != next.Cardinality() {
+			c.add(path, "cardinality changed from %s to %s", prev.Cardinality(), next.Cardinality())
+		}
+	}
+
+	if prev.IsMap() != next.IsMap() {
+		c.add(path, "changed between map and non-map")
+		return
+	}
+
+	if oneofName(prev) != oneofName(next) {
+		c.add(path, "moved from oneof %q to %q", oneofName(prev), oneofName(next))
+	}
+
+	if !wireCompatible(prev.Kind(), next.Kind()) {
+		c.add(path, "type changed from %s to %s", prev.Kind(), next.Kind())
+		return
+	}
+
+	switch prev.Kind() {
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		prevMsg, nextMsg := prev.Message(), next.Message()
+		// для известных типов (Timestamp и т.п.) достаточно совпадения имени
+		if strings.HasPrefix(string(prevMsg.FullName()), "google.protobuf.") || strings.HasPrefix(string(nextMsg.FullName()), "google.protobuf.") {
+			if prevMsg.FullName() != nextMsg.FullName() {
+				c.add(path, "type changed from %s to %s", prevMsg.FullName(), nextMsg.FullName())
+			}
+			return
+		}
+		c.message(path, prevMsg, nextMsg)
+	case protoreflect.EnumKind:
+		prevEnum, nextEnum := prev.Enum().Values(), next.Enum().Values()
+		for i := 0; i < prevEnum.Len(); i++ {
+			v := prevEnum.Get(i)
+			if nv := nextEnum.ByNumber(v.Number()); nv != nil && nv.Name() != v.Name() {
+				c.add(path, "enum value %d renamed from %s to %s", v.Number(), v.Name(), nv.Name())
+			}
+		}
+	}
+}
+
+func oneofName(f protoreflect.FieldDescriptor) protoreflect.Name {
+	// synthetic oneof - это proto3 optional, он не меняет кодирование
+	if o := f.ContainingOneof(); o != nil && !o.IsSynthetic() {
+		return o.Name()
+	}
+	return ""
+}
+
+// wireCompatible сообщает, читается ли значение одного типа как значение другого без потерь смысла
+func wireCompatible(a, b protoreflect.Kind) bool {
+	if a == b {
+		return true
+	}
+	group := func(k protoreflect.Kind) int {
+		switch k {
+		case protoreflect.Int32Kind, protoreflect.Int64Kind, protoreflect.Uint32Kind, protoreflect.Uint64Kind, protoreflect.BoolKind:
+			return 1
+		case protoreflect.Sint32Kind, protoreflect.Sint64Kind:
+			return 2
+		case protoreflect.StringKind, protoreflect.BytesKind:
+			return 3
+		case protoreflect.Fixed32Kind, protoreflect.Sfixed32Kind:
+			return 4
+		case protoreflect.Fixed64Kind, protoreflect.Sfixed64Kind:
+			return 5
+		}
+		return 0
+	}
+
+	ga := group(a)
+	return ga != 0 && ga == group(b)
+}
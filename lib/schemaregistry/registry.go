@@ -0,0 +1,406 @@
+// Package schemaregistry - локальный реестр схем событий.
+//
+// Каждая опубликованная версия схемы хранится снимком дескриптора protobuf в файле
+// <dir>/<subject>/v<N>.json, где subject - тип события (например, user.registered), а файл -
+// FileDescriptorSet в protojson. Первое сообщение первого файла набора - полезная нагрузка события,
+// остальные - сообщения, на которые она ссылается. Снимок не зависит от .proto файлов,
+// поэтому прежние версии остаются проверяемыми после любых правок исходников.
+package schemaregistry
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+var (
+	ErrNotRegistered   = errors.New("schema is not registered")
+	ErrSchemaChanged   = errors.New("schema differs from the registered version")
+	ErrVersionOrder    = errors.New("schema versions must go 1, 2, 3... without gaps")
+	ErrInvalidSnapshot = errors.New("invalid schema snapshot")
+)
+
+// Schema - версия схемы полезной нагрузки события
+type Schema struct {
+	Subject string
+	Version int
+	Message protoreflect.MessageDescriptor
+}
+
+type entry struct {
+	version int
+	set     *descriptorpb.FileDescriptorSet
+	message protoreflect.MessageDescriptor
+}
+
+// Registry - содержимое каталога схем
+type Registry struct {
+	dir      string
+	subjects map[string][]entry // версии по возрастанию
+}
+
+// Open читает каталог схем. Несуществующий каталог - пустой реестр.
+func Open(dir string) (*Registry, error) {
+	r := &Registry{dir: dir, subjects: make(map[string][]entry)}
+
+	subjects, err := os.ReadDir(dir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return r, nil
+		}
+		return nil, err
+	}
+
+	for _, subject := range subjects {
+		if !subject.IsDir() {
+			continue
+		}
+
+		files, err := os.ReadDir(filepath.Join(dir, subject.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		for _, file := range files {
+			version, ok := parseVersion(file.Name())
+			if !ok {
+				continue
+			}
+
+			path := filepath.Join(dir, subject.Name(), file.Name())
+			e, err := readEntry(path, version)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", path, err)
+			}
+			r.subjects[subject.Name()] = append(r.subjects[subject.Name()], e)
+		}
+
+		sort.Slice(r.subjects[subject.Name()], func(i, j int) bool {
+			return r.subjects[subject.Name()][i].version < r.subjects[subject.Name()][j].version
+		})
+	}
+
+	return r, nil
+}
+
+func parseVersion(name string) (int, bool) {
+	if !strings.HasPrefix(name, "v") || !strings.HasSuffix(name, ".json") {
+		return 0, false
+	}
+
+	version, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(name, "v"), ".json"))
+	if err != nil || version < 1 {
+		return 0, false
+	}
+	return version, true
+}
+
+func readEntry(path string, version int) (entry, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return entry{}, err
+	}
+
+	set := &descriptorpb.FileDescriptorSet{}
+	if err := protojson.Unmarshal(data, set); err != nil {
+		return entry{}, fmt.Errorf("%w: %v", ErrInvalidSnapshot, err)
+	}
+
+	message, err := rootMessage(set)
+	if err != nil {
+		return entry{}, err
+	}
+
+	return entry{version: version, set: set, message: message}, nil
+}
+
+func rootMessage(set *descriptorpb.FileDescriptorSet) (protoreflect.MessageDescriptor, error) {
+	if len(set.GetFile()) == 0 || len(set.GetFile()[0].GetMessageType()) == 0 {
+		return nil, fmt.Errorf("%w: no message", ErrInvalidSnapshot)
+	}
+
+	files, err := protodesc.NewFiles(set)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSnapshot, err)
+	}
+
+	root := set.GetFile()[0]
+	name := protoreflect.FullName(root.GetPackage()).Append(protoreflect.Name(root.GetMessageType()[0].GetName()))
+
+	desc, err := files.FindDescriptorByName(name)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSnapshot, err)
+	}
+
+	return desc.(protoreflect.MessageDescriptor), nil
+}
+
+// Subjects возвращает зарегистрированные типы событий
+func (r *Registry) Subjects() []string {
+	subjects := make([]string, 0, len(r.subjects))
+	for subject := range r.subjects {
+		subjects = append(subjects, subject)
+	}
+	sort.Strings(subjects)
+
+	return subjects
+}
+
+// Versions возвращает все версии схемы subject по возрастанию
+func (r *Registry) Versions(subject string) []Schema {
+	entries := r.subjects[subject]
+
+	schemas := make([]Schema, 0, len(entries))
+	for _, e := range entries {
+		schemas = append(schemas, Schema{Subject: subject, Version: e.version, Message: e.message})
+	}
+
+	return schemas
+}
+
+// Check сверяет схемы, которые публикует сервис, с реестром: каждая версия должна быть
+// зарегистрирована и совпадать со снимком. Изменённое сообщение без новой версии - ошибка.
+func (r *Registry) Check(schemas ...Schema) error {
+	var errs []error
+
+	for _, s := range schemas {
+		e, ok := r.find(s.Subject, s.Version)
+		if !ok {
+			errs = append(errs, fmt.Errorf("%s v%d: %w", s.Subject, s.Version, ErrNotRegistered))
+			continue
+		}
+
+		if !proto.Equal(Snapshot(s.Message), e.set) {
+			errs = append(errs, fmt.Errorf("%s v%d: %w", s.Subject, s.Version, ErrSchemaChanged))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// CheckHistory проверяет, что версии каждого типа идут подряд и каждая совместима с предыдущей
+func (r *Registry) CheckHistory() error {
+	var errs []error
+
+	for _, subject := range r.Subjects() {
+		entries := r.subjects[subject]
+
+		for i, e := range entries {
+			if e.version != i+1 {
+				errs = append(errs, fmt.Errorf("%s: %w", subject, ErrVersionOrder))
+				break
+			}
+			if i == 0 {
+				continue
+			}
+
+			if err := Compatible(entries[i-1].message, e.message); err != nil {
+				errs = append(errs, fmt.Errorf("%s v%d -> v%d: %w", subject, entries[i-1].version, e.version, err))
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Register записывает новую версию схемы в каталог. Уже зарегистрированная и не изменившаяся
+// версия пропускается (false). Версия должна быть следующей по порядку и совместимой с предыдущей.
+func (r *Registry) Register(s Schema) (bool, error) {
+	if e, ok := r.find(s.Subject, s.Version); ok {
+		if !proto.Equal(Snapshot(s.Message), e.set) {
+			return false, fmt.Errorf("%s v%d: %w, bump the version", s.Subject, s.Version, ErrSchemaChanged)
+		}
+		return false, nil
+	}
+
+	entries := r.subjects[s.Subject]
+	if s.Version != len(entries)+1 {
+		return false, fmt.Errorf("%s v%d: %w", s.Subject, s.Version, ErrVersionOrder)
+	}
+
+	if len(entries) > 0 {
+		if err := Compatible(entries[len(entries)-1].message, s.Message); err != nil {
+			return false, fmt.Errorf("%s v%d: %w", s.Subject, s.Version, err)
+		}
+	}
+
+	set := Snapshot(s.Message)
+	data, err := Marshal(set)
+	if err != nil {
+		return false, err
+	}
+
+	path := filepath.Join(r.dir, s.Subject, fmt.Sprintf("v%d.json", s.Version))
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return false, err
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return false, err
+	}
+
+	r.subjects[s.Subject] = append(entries, entry{version: s.Version, set: set, message: s.Message})
+
+	return true, nil
+}
+
+func (r *Registry) find(subject string, version int) (entry, bool) {
+	for _, e := range r.subjects[subject] {
+		if e.version == version {
+			return e, true
+		}
+	}
+	return entry{}, false
+}
+
+// Snapshot строит снимок схемы сообщения: его файл, урезанный до самого сообщения и того,
+// на что оно ссылается, и файлы зависимостей (например, google/protobuf/timestamp.proto).
+// Комментарии и позиции в исходнике в снимок не попадают.
+func Snapshot(message protoreflect.MessageDescriptor) *descriptorpb.FileDescriptorSet {
+	file := message.ParentFile()
+
+	// верхнеуровневые сообщения и перечисления файла, достижимые из message
+	keep := map[protoreflect.FullName]bool{}
+	deps := map[string]protoreflect.FileDescriptor{}
+
+	var walk func(md protoreflect.MessageDescriptor)
+	walk = func(md protoreflect.MessageDescriptor) {
+		top := topLevel(md)
+		if top.ParentFile().Path() != file.Path() {
+			deps[top.ParentFile().Path()] = top.ParentFile()
+			return
+		}
+		if keep[top.FullName()] {
+			return
+		}
+		keep[top.FullName()] = true
+
+		walkMessage(top.(protoreflect.MessageDescriptor), func(f protoreflect.FieldDescriptor) {
+			switch {
+			case f.Message() != nil:
+				walk(f.Message())
+			case f.Enum() != nil:
+				enum := topLevel(f.Enum())
+				if enum.ParentFile().Path() != file.Path() {
+					deps[enum.ParentFile().Path()] = enum.ParentFile()
+				} else {
+					keep[enum.FullName()] = true
+				}
+			}
+		})
+	}
+	walk(message)
+
+	full := protodesc.ToFileDescriptorProto(file)
+	pruned := &descriptorpb.FileDescriptorProto{
+		Name:    full.Name,
+		Package: full.Package,
+		Syntax:  full.Syntax,
+		Edition: full.Edition,
+		Options: full.Options,
+	}
+
+	// сообщение события всегда первое
+	for _, md := range full.GetMessageType() {
+		if md.GetName() == string(topLevel(message).Name()) {
+			pruned.MessageType = append(pruned.MessageType, md)
+		}
+	}
+	for _, md := range full.GetMessageType() {
+		if md.GetName() != string(topLevel(message).Name()) && keep[file.Package().Append(protoreflect.Name(md.GetName()))] {
+			pruned.MessageType = append(pruned.MessageType, md)
+		}
+	}
+	for _, ed := range full.GetEnumType() {
+		if keep[file.Package().Append(protoreflect.Name(ed.GetName()))] {
+			pruned.EnumType = append(pruned.EnumType, ed)
+		}
+	}
+
+	set := &descriptorpb.FileDescriptorSet{File: []*descriptorpb.FileDescriptorProto{pruned}}
+
+	paths := make([]string, 0, len(deps))
+	for path := range deps {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	pruned.Dependency = paths
+
+	added := map[string]bool{}
+	var addFile func(fd protoreflect.FileDescriptor)
+	addFile = func(fd protoreflect.FileDescriptor) {
+		if added[fd.Path()] {
+			return
+		}
+		added[fd.Path()] = true
+
+		imports := fd.Imports()
+		for i := 0; i < imports.Len(); i++ {
+			addFile(imports.Get(i).FileDescriptor)
+		}
+
+		fdp := protodesc.ToFileDescriptorProto(fd)
+		fdp.SourceCodeInfo = nil
+		set.File = append(set.File, fdp)
+	}
+	for _, path := range paths {
+		addFile(deps[path])
+	}
+
+	return set
+}
+
+// topLevel возвращает объявление верхнего уровня, внутри которого находится d
+func topLevel(d protoreflect.Descriptor) protoreflect.Descriptor {
+	for {
+		parent := d.Parent()
+		if _, ok := parent.(protoreflect.FileDescriptor); ok || parent == nil {
+			return d
+		}
+		d = parent
+	}
+}
+
+// walkMessage вызывает fn для полей сообщения и всех вложенных в него сообщений
+func walkMessage(md protoreflect.MessageDescriptor, fn func(f protoreflect.FieldDescriptor)) {
+	fields := md.Fields()
+	for i := 0; i < fields.Len(); i++ {
+		fn(fields.Get(i))
+	}
+
+	nested := md.Messages()
+	for i := 0; i < nested.Len(); i++ {
+		walkMessage(nested.Get(i), fn)
+	}
+}
+
+// Marshal сериализует снимок в JSON с постоянным форматированием, чтобы диффы в каталоге были читаемы
+func Marshal(set *descriptorpb.FileDescriptorSet) ([]byte, error) {
+	data, err := protojson.Marshal(set)
+	if err != nil {
+		return nil, err
+	}
+
+	// protojson намеренно вносит случайные пробелы, нормализуем их
+	var compact, out bytes.Buffer
+	if err := json.Compact(&compact, data); err != nil {
+		return nil, err
+	}
+	if err := json.Indent(&out, compact.Bytes(), "", "  "); err != nil {
+		return nil, err
+	}
+	out.WriteByte('\n')
+
+	return out.Bytes(), nil
+}
@@ -0,0 +1,203 @@
+package schemaregistry
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+func field(name string, number int32, typ descriptorpb.FieldDescriptorProto_Type) *descriptorpb.FieldDescriptorProto {
+	return &descriptorpb.FieldDescriptorProto{
+		Name:   proto.String(name),
+		Number: proto.Int32(number),
+		Label:  descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+		Type:   typ.Enum(),
+	}
+}
+
+func messageField(name string, number int32, typeName string) *descriptorpb.FieldDescriptorProto {
+	f := field(name, number, descriptorpb.FieldDescriptorProto_TYPE_MESSAGE)
+	f.TypeName = proto.String(".test." + typeName)
+	return f
+}
+
+func reserve(md *descriptorpb.DescriptorProto, number int32, name string) *descriptorpb.DescriptorProto {
+	md.ReservedRange = append(md.ReservedRange, &descriptorpb.DescriptorProto_ReservedRange{Start: proto.Int32(number), End: proto.Int32(number + 1)})
+	md.ReservedName = append(md.ReservedName, name)
+	return md
+}
+
+// build собирает файл из сообщений и возвращает первое из них
+func build(t *testing.T, messages ...*descriptorpb.DescriptorProto) protoreflect.MessageDescriptor {
+	t.Helper()
+
+	file, err := protodesc.NewFile(&descriptorpb.FileDescriptorProto{
+		Name:        proto.String("test.proto"),
+		Package:     proto.String("test"),
+		Syntax:      proto.String("proto3"),
+		MessageType: messages,
+	}, nil)
+	require.NoError(t, err)
+
+	return file.Messages().Get(0)
+}
+
+func msg(name string, fields ...*descriptorpb.FieldDescriptorProto) *descriptorpb.DescriptorProto {
+	return &descriptorpb.DescriptorProto{Name: proto.String(name), Field: fields}
+}
+
+const (
+	tString = descriptorpb.FieldDescriptorProto_TYPE_STRING
+	tInt32  = descriptorpb.FieldDescriptorProto_TYPE_INT32
+	tInt64  = descriptorpb.FieldDescriptorProto_TYPE_INT64
+	tBool   = descriptorpb.FieldDescriptorProto_TYPE_BOOL
+)
+
+func v1(t *testing.T) protoreflect.MessageDescriptor {
+	return build(t,
+		msg("Event", field("user_id", 1, tString), field("count", 2, tInt32), messageField("profile", 3, "Profile")),
+		msg("Profile", field("name", 1, tString), field("verified", 2, tBool)),
+	)
+}
+
+func violations(t *testing.T, err error) []Violation {
+	t.Helper()
+
+	var compatErr *CompatibilityError
+	require.ErrorAs(t, err, &compatErr)
+	return compatErr.Violations
+}
+
+func TestCompatibleChanges(t *testing.T) {
+	tests := map[string]protoreflect.MessageDescriptor{
+		"add field": build(t,
+			msg("Event", field("user_id", 1, tString), field("count", 2, tInt32), messageField("profile", 3, "Profile"), field("ip", 4, tString)),
+			msg("Profile", field("name", 1, tString), field("verified", 2, tBool), field("email", 3, tString)),
+		),
+		"remove reserved field": build(t,
+			reserve(msg("Event", field("user_id", 1, tString), messageField("profile", 3, "Profile")), 2, "count"),
+			msg("Profile", field("name", 1, tString), field("verified", 2, tBool)),
+		),
+		"widen integer": build(t,
+			msg("Event", field("user_id", 1, tString), field("count", 2, tInt64), messageField("profile", 3, "Profile")),
+			msg("Profile", field("name", 1, tString), field("verified", 2, tBool)),
+		),
+	}
+
+	for name, next := range tests {
+		require.NoError(t, Compatible(v1(t), next), name)
+	}
+}
+
+func TestIncompatibleChanges(t *testing.T) {
+	repeated := field("count", 2, tInt32)
+	repeated.Label = descriptorpb.FieldDescriptorProto_LABEL_REPEATED.Enum()
+
+	tests := map[string]struct {
+		next protoreflect.MessageDescriptor
+		path string
+	}{
+		"remove without reserving": {build(t,
+			msg("Event", field("user_id", 1, tString), messageField("profile", 3, "Profile")),
+			msg("Profile", field("name", 1, tString), field("verified", 2, tBool)),
+		), "Event.count"},
+		"rename": {build(t,
+			msg("Event", field("user_id", 1, tString), field("amount", 2, tInt32), messageField("profile", 3, "Profile")),
+			msg("Profile", field("name", 1, tString), field("verified", 2, tBool)),
+		), "Event.count"},
+		"change type": {build(t,
+			msg("Event", field("user_id", 1, tString), field("count", 2, tString), messageField("profile", 3, "Profile")),
+			msg("Profile", field("name", 1, tString), field("verified", 2, tBool)),
+		), "Event.count"},
+		"make repeated": {build(t,
+			msg("Event", field("user_id", 1, tString), repeated, messageField("profile", 3, "Profile")),
+			msg("Profile", field("name", 1, tString), field("verified", 2, tBool)),
+		), "Event.count"},
+		"nested change": {build(t,
+			msg("Event", field("user_id", 1, tString), field("count", 2, tInt32), messageField("profile", 3, "Profile")),
+			msg("Profile", field("name", 1, tString), field("verified", 2, tString)),
+		), "Event.profile.verified"},
+	}
+
+	for name, tt := range tests {
+		got := violations(t, Compatible(v1(t), tt.next))
+		require.Len(t, got, 1, name)
+		require.Equal(t, tt.path, got[0].Path, name)
+	}
+}
+
+func TestReuseOfReservedNumber(t *testing.T) {
+	prev := build(t, reserve(msg("Event", field("user_id", 1, tString)), 2, "count"))
+	next := build(t, reserve(msg("Event", field("user_id", 1, tString), field("total", 2, tInt64)), 3, "count"))
+
+	got := violations(t, Compatible(prev, next))
+	require.Len(t, got, 1)
+	require.Equal(t, "Event.total", got[0].Path)
+}
+
+func TestRegistry(t *testing.T) {
+	dir := t.TempDir()
+
+	r, err := Open(dir)
+	require.NoError(t, err)
+
+	registered, err := r.Register(Schema{Subject: "user.registered", Version: 1, Message: v1(t)})
+	require.NoError(t, err)
+	require.True(t, registered)
+
+	// повторная регистрация той же схемы ничего не меняет
+	registered, err = r.Register(Schema{Subject: "user.registered", Version: 1, Message: v1(t)})
+	require.NoError(t, err)
+	require.False(t, registered)
+
+	next := build(t,
+		msg("Event", field("user_id", 1, tString), field("count", 2, tInt32), messageField("profile", 3, "Profile"), field("ip", 4, tString)),
+		msg("Profile", field("name", 1, tString), field("verified", 2, tBool)),
+	)
+
+	// изменённая схема под старой версией
+	_, err = r.Register(Schema{Subject: "user.registered", Version: 1, Message: next})
+	require.ErrorIs(t, err, ErrSchemaChanged)
+
+	// пропуск версии
+	_, err = r.Register(Schema{Subject: "user.registered", Version: 3, Message: next})
+	require.ErrorIs(t, err, ErrVersionOrder)
+
+	_, err = r.Register(Schema{Subject: "user.registered", Version: 2, Message: next})
+	require.NoError(t, err)
+
+	// несовместимая версия не регистрируется
+	broken := build(t, msg("Event", field("user_id", 1, tInt32)))
+	_, err = r.Register(Schema{Subject: "user.registered", Version: 3, Message: broken})
+	violations(t, err)
+
+	reopened, err := Open(dir)
+	require.NoError(t, err)
+	require.Equal(t, []string{"user.registered"}, reopened.Subjects())
+	require.Len(t, reopened.Versions("user.registered"), 2)
+	require.NoError(t, reopened.CheckHistory())
+	require.NoError(t, reopened.Check(Schema{Subject: "user.registered", Version: 2, Message: next}))
+	require.ErrorIs(t, reopened.Check(Schema{Subject: "user.registered", Version: 1, Message: next}), ErrSchemaChanged)
+	require.ErrorIs(t, reopened.Check(Schema{Subject: "user.deleted", Version: 1, Message: next}), ErrNotRegistered)
+}
+
+func TestSnapshotKeepsOnlyReachableMessages(t *testing.T) {
+	md := build(t,
+		msg("Event", field("user_id", 1, tString), messageField("profile", 2, "Profile")),
+		msg("Profile", field("name", 1, tString)),
+		msg("Unrelated", field("x", 1, tString)),
+	)
+
+	set := Snapshot(md)
+	require.Len(t, set.GetFile(), 1)
+
+	var names []string
+	for _, m := range set.GetFile()[0].GetMessageType() {
+		names = append(names, m.GetName())
+	}
+	require.Equal(t, []string{"Event", "Profile"}, names)
+}
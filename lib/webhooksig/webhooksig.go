@@ -0,0 +1,107 @@
+package webhooksig
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Заголовки запроса вебхука
+const (
+	HeaderSignature = "X-Webhook-Signature" // t=<unix-время>,v1=<hex HMAC-SHA256>
+	HeaderEventID   = "X-Webhook-Event-Id"
+	HeaderEventType = "X-Webhook-Event-Type"
+	HeaderDelivery  = "X-Webhook-Delivery" // id доставки, одинаковый у повторных попыток
+)
+
+const (
+	secretPrefix = "whsec_"
+	secretBytes  = 32
+)
+
+var (
+	ErrMalformedSignature = errors.New("malformed webhook signature")
+	ErrInvalidSignature   = errors.New("invalid webhook signature")
+	ErrSignatureExpired   = errors.New("webhook signature timestamp is out of tolerance")
+)
+
+// GenerateSecret создаёт случайный секрет подписки
+func GenerateSecret() (string, error) {
+	b := make([]byte, secretBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate webhook secret: %w", err)
+	}
+
+	return secretPrefix + hex.EncodeToString(b), nil
+}
+
+// Sign возвращает значение заголовка X-Webhook-Signature.
+// Подписывается строка "<unix-время>.<тело>": время не даёт повторить перехваченный запрос позже.
+func Sign(secret string, timestamp time.Time, body []byte) string {
+	ts := strconv.FormatInt(timestamp.Unix(), 10)
+	return "t=" + ts + ",v1=" + hex.EncodeToString(mac(secret, ts, body))
+}
+
+// Verify проверяет подпись запроса на стороне получателя.
+// tolerance - допустимое расхождение времени подписи и now, 0 - не проверять.
+func Verify(secret string, header string, body []byte, now time.Time, tolerance time.Duration) error {
+	var ts string
+	var signatures [][]byte
+
+	for _, part := range strings.Split(header, ",") {
+		key, value, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			return ErrMalformedSignature
+		}
+
+		switch key {
+		case "t":
+			ts = value
+		case "v1":
+			// при смене секрета заголовок может содержать несколько подписей
+			sig, err := hex.DecodeString(value)
+			if err != nil {
+				return ErrMalformedSignature
+			}
+			signatures = append(signatures, sig)
+		}
+	}
+
+	unix, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil || len(signatures) == 0 {
+		return ErrMalformedSignature
+	}
+
+	if tolerance > 0 {
+		diff := now.Sub(time.Unix(unix, 0))
+		if diff < 0 {
+			diff = -diff
+		}
+		if diff > tolerance {
+			return ErrSignatureExpired
+		}
+	}
+
+	expected := mac(secret, ts, body)
+	for _, sig := range signatures {
+		if hmac.Equal(sig, expected) {
+			return nil
+		}
+	}
+
+	return ErrInvalidSignature
+}
+
+func mac(secret string, ts string, body []byte) []byte {
+	h := hmac.New(sha256.New, []byte(secret))
+	h.Write([]byte(ts))
+	h.Write([]byte{'.'})
+	h.Write(body)
+	return h.Sum(nil)
+}
@@ -0,0 +1,45 @@
+package webhooksig
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSignAndVerify(t *testing.T) {
+	secret, err := GenerateSecret()
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(secret, "whsec_"))
+
+	now := time.Unix(1700000000, 0)
+	body := []byte(`{"type":"user.registered"}`)
+
+	header := Sign(secret, now, body)
+	require.True(t, strings.HasPrefix(header, "t=1700000000,v1="))
+
+	require.NoError(t, Verify(secret, header, body, now.Add(time.Minute), 5*time.Minute))
+	require.ErrorIs(t, Verify(secret, header, []byte(`{"type":"user.deleted"}`), now, 5*time.Minute), ErrInvalidSignature)
+	require.ErrorIs(t, Verify("whsec_other", header, body, now, 5*time.Minute), ErrInvalidSignature)
+	require.ErrorIs(t, Verify(secret, header, body, now.Add(time.Hour), 5*time.Minute), ErrSignatureExpired)
+	require.NoError(t, Verify(secret, header, body, now.Add(time.Hour), 0))
+}
+
+func TestVerifyAcceptsAnyOfSeveralSignatures(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	body := []byte("{}")
+
+	oldSig := strings.TrimPrefix(Sign("whsec_old", now, body), "t=1700000000,")
+	newSig := strings.TrimPrefix(Sign("whsec_new", now, body), "t=1700000000,")
+
+	require.NoError(t, Verify("whsec_new", "t=1700000000,"+oldSig+","+newSig, body, now, time.Minute))
+}
+
+func TestVerifyMalformed(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+
+	for _, header := range []string{"", "t=abc,v1=00", "t=1700000000", "t=1700000000,v1=zz", "garbage"} {
+		require.ErrorIs(t, Verify("whsec_x", header, nil, now, 0), ErrMalformedSignature, header)
+	}
+}
@@ -4,8 +4,11 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"strconv"
+	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/metadata"
@@ -20,19 +23,76 @@ const (
 	ContextNameKey     contextKey = "name"
 	ContextVerifiedKey contextKey = "verified"
 	ContextAvatarKey   contextKey = "avatar"
+	ContextAuthTimeKey contextKey = "auth_time" // time.Time, нулевое для токенов без auth_time
+	ContextAMRKey      contextKey = "amr"       // []string
+	ContextACRKey      contextKey = "acr"       // string
+
+	contextInterceptorKey contextKey = "interceptor" // *AuthInterceptor, для RequireStepUp
 )
 
+// ReasonStepUpRequired - значение ErrorInfo.Reason в ошибке метода, требующего повторного входа.
+// Клиент должен вызвать Reauthenticate и повторить запрос с новым access токеном.
+const ReasonStepUpRequired = "STEP_UP_REQUIRED"
+
+// StepUpPolicy - методы, которые доступны только в течение MaxAge после ввода учётных данных
+type StepUpPolicy struct {
+	Methods []string
+	MaxAge  time.Duration
+}
+
 // var unauthenticatedMethods = map[string]bool{
 // 	"/auth.Auth/Register": true,
 // 	"/auth.Auth/Login":    true,
 // }
 
+// AccountStatusChecker проверяет, что учётная запись из токена не заблокирована.
+// Access токен живёт до своего exp, поэтому без такой проверки заблокированный пользователь
+// продолжает работать до истечения токена.
+type AccountStatusChecker interface {
+	CheckAccountStatus(ctx context.Context, userID string) error
+}
+
 type AuthInterceptor struct {
 	appSecret             string
 	unauthenticatedRoutes map[string]bool
+	statusChecker         AccountStatusChecker
+	stepUpRoutes          map[string]bool
+	stepUpMaxAge          time.Duration
+	optionalToken         bool
+}
+
+// Option - дополнительная настройка AuthInterceptor
+type Option func(*AuthInterceptor)
+
+// WithAccountStatusChecker включает проверку статуса учётной записи на каждом запросе
+func WithAccountStatusChecker(checker AccountStatusChecker) Option {
+	return func(i *AuthInterceptor) {
+		i.statusChecker = checker
+	}
+}
+
+// WithOptionalToken пропускает запросы без токена. Переданный токен проверяется как обычно,
+// в том числе статус учётной записи: заблокированный пользователь не может пользоваться
+// уже выданным access токеном, даже если проверка токена на всех методах выключена.
+// Методы из StepUpPolicy.Methods токен требуют и в этом режиме.
+func WithOptionalToken() Option {
+	return func(i *AuthInterceptor) {
+		i.optionalToken = true
+	}
 }
 
-func NewAuthInterceptor(secret string, publicRoutes []string) (*AuthInterceptor, error) {
+// WithStepUp требует свежий auth_time в токене для методов из policy.Methods
+func WithStepUp(policy StepUpPolicy) Option {
+	return func(i *AuthInterceptor) {
+		i.stepUpRoutes = make(map[string]bool, len(policy.Methods))
+		for _, m := range policy.Methods {
+			i.stepUpRoutes[m] = true
+		}
+		i.stepUpMaxAge = policy.MaxAge
+	}
+}
+
+func NewAuthInterceptor(secret string, publicRoutes []string, opts ...Option) (*AuthInterceptor, error) {
 	if secret == "" {
 		return nil, errors.New("secret cannot be empty")
 	}
@@ -42,10 +102,16 @@ func NewAuthInterceptor(secret string, publicRoutes []string) (*AuthInterceptor,
 		routes[r] = true
 	}
 
-	return &AuthInterceptor{
+	interceptor := &AuthInterceptor{
 		appSecret:             secret,
 		unauthenticatedRoutes: routes,
-	}, nil
+	}
+
+	for _, opt := range opts {
+		opt(interceptor)
+	}
+
+	return interceptor, nil
 }
 
 func (i *AuthInterceptor) UnaryAuthMiddleware(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
@@ -55,14 +121,23 @@ func (i *AuthInterceptor) UnaryAuthMiddleware(ctx context.Context, req any, info
 	}
 
 	// получение метаданных из контекста
+	// методы step-up без токена не вызываются даже с WithOptionalToken
+	optional := i.optionalToken && !i.stepUpRoutes[info.FullMethod]
+
 	md, ok := metadata.FromIncomingContext(ctx)
 	if !ok {
+		if optional {
+			return handler(ctx, req)
+		}
 		return nil, status.Error(codes.Unauthenticated, "metadata is not provided")
 	}
 
 	// извлечение токена из метаданных
 	token := md["authorization"]
 	if len(token) == 0 {
+		if optional {
+			return handler(ctx, req)
+		}
 		return nil, status.Error(codes.Unauthenticated, "authorization token is not provided")
 	}
 
@@ -101,17 +176,88 @@ func (i *AuthInterceptor) UnaryAuthMiddleware(ctx context.Context, req any, info
 	}
 	// exp := claims["exp"].(float64) // JWT числовые значения возвращаются как float64
 
+	// auth_time, amr и acr есть только в токенах, выпущенных после их добавления
+	var authTime time.Time
+	if v, ok := claims["auth_time"].(float64); ok {
+		authTime = time.Unix(int64(v), 0)
+	}
+	var amr []string
+	if v, ok := claims["amr"].([]any); ok {
+		for _, m := range v {
+			if s, ok := m.(string); ok {
+				amr = append(amr, s)
+			}
+		}
+	}
+	acr, _ := claims["acr"].(string)
+
+	if i.stepUpRoutes[info.FullMethod] && !i.isFresh(authTime) {
+		return nil, i.stepUpRequired()
+	}
+
+	// проверка статуса учётной записи (блокировка, бан)
+	if i.statusChecker != nil {
+		if err := i.statusChecker.CheckAccountStatus(ctx, userID); err != nil {
+			return nil, status.Error(codes.PermissionDenied, err.Error())
+		}
+	}
+
 	// добавляем данные пользователя в контекст, так мы можем использовать их в последующих grpc методах
 	ctx = context.WithValue(ctx, ContextUserIDKey, userID)
 	ctx = context.WithValue(ctx, ContextEmailKey, email)
 	ctx = context.WithValue(ctx, ContextNameKey, name)
 	ctx = context.WithValue(ctx, ContextVerifiedKey, verified)
 	ctx = context.WithValue(ctx, ContextAvatarKey, avatar)
+	ctx = context.WithValue(ctx, ContextAuthTimeKey, authTime)
+	ctx = context.WithValue(ctx, ContextAMRKey, amr)
+	ctx = context.WithValue(ctx, ContextACRKey, acr)
+	ctx = context.WithValue(ctx, contextInterceptorKey, i)
 
 	// вызываем следующий обработчик в цепочке
 	return handler(ctx, req)
 }
 
+// RequireStepUp проверяет свежесть auth_time из обработчика, когда step-up нужен не для всего метода,
+// а для части запросов (например, смены email в UpdateUser). Без проверенного токена в контексте
+// возвращает codes.Unauthenticated, при устаревшем auth_time - ту же ошибку, что и для методов из StepUpPolicy.
+func RequireStepUp(ctx context.Context) error {
+	i, ok := ctx.Value(contextInterceptorKey).(*AuthInterceptor)
+	if !ok {
+		return status.Error(codes.Unauthenticated, "authorization token is not provided")
+	}
+
+	authTime, _ := ctx.Value(ContextAuthTimeKey).(time.Time)
+	if !i.isFresh(authTime) {
+		return i.stepUpRequired()
+	}
+
+	return nil
+}
+
+// isFresh сообщает, что учётные данные вводились не раньше stepUpMaxAge назад
+func (i *AuthInterceptor) isFresh(authTime time.Time) bool {
+	return !authTime.IsZero() && time.Since(authTime) <= i.stepUpMaxAge
+}
+
+// stepUpRequired - ошибка Unauthenticated с ErrorInfo, по которой клиент отличает
+// необходимость повторного входа от просроченного или неверного токена
+func (i *AuthInterceptor) stepUpRequired() error {
+	st := status.New(codes.Unauthenticated, "step-up authentication required")
+
+	detailed, err := st.WithDetails(&errdetails.ErrorInfo{
+		Reason: ReasonStepUpRequired,
+		Domain: "sso",
+		Metadata: map[string]string{
+			"max_age": strconv.Itoa(int(i.stepUpMaxAge.Seconds())),
+		},
+	})
+	if err != nil {
+		return st.Err()
+	}
+
+	return detailed.Err()
+}
+
 // ValidateToken проверяет валидность JWT токена и возвращает claims
 func ValidateToken(tokenString string, appSecret string) (jwt.MapClaims, error) {
 	// Парсим токен
@@ -0,0 +1,106 @@
+package authinterceptor
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const secret = "secret"
+
+type blockedUsers map[string]bool
+
+func (b blockedUsers) CheckAccountStatus(ctx context.Context, userID string) error {
+	if b[userID] {
+		return errors.New("account is blocked")
+	}
+	return nil
+}
+
+func newToken(t *testing.T, userID string) string {
+	return newTokenAt(t, userID, time.Now())
+}
+
+func newTokenAt(t *testing.T, userID string, authTime time.Time) string {
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"uid":       userID,
+		"email":     userID + "@example.com",
+		"name":      userID,
+		"verified":  true,
+		"avatar":    "",
+		"exp":       time.Now().Add(time.Minute).Unix(),
+		"auth_time": authTime.Unix(),
+	})
+	signed, err := token.SignedString([]byte(secret))
+	require.NoError(t, err)
+	return signed
+}
+
+func call(i *AuthInterceptor, token string) error {
+	return callMethod(i, "/auth.Users/GetUserById", token, func(ctx context.Context, req any) (any, error) { return nil, nil })
+}
+
+func callMethod(i *AuthInterceptor, method string, token string, handler grpc.UnaryHandler) error {
+	ctx := context.Background()
+	if token != "" {
+		ctx = metadata.NewIncomingContext(ctx, metadata.Pairs("authorization", "Bearer "+token))
+	}
+	_, err := i.UnaryAuthMiddleware(ctx, nil, &grpc.UnaryServerInfo{FullMethod: method}, handler)
+	return err
+}
+
+func TestAccountStatus(t *testing.T) {
+	checker := blockedUsers{"blocked": true}
+
+	required, err := NewAuthInterceptor(secret, nil, WithAccountStatusChecker(checker))
+	require.NoError(t, err)
+	optional, err := NewAuthInterceptor(secret, nil, WithAccountStatusChecker(checker), WithOptionalToken())
+	require.NoError(t, err)
+
+	for name, i := range map[string]*AuthInterceptor{"required": required, "optional": optional} {
+		t.Run(name, func(t *testing.T) {
+			require.NoError(t, call(i, newToken(t, "active")))
+			require.Equal(t, codes.PermissionDenied, status.Code(call(i, newToken(t, "blocked"))))
+			require.Equal(t, codes.Unauthenticated, status.Code(call(i, "garbage")))
+		})
+	}
+
+	// без токена проходят только запросы в необязательном режиме
+	require.Equal(t, codes.Unauthenticated, status.Code(call(required, "")))
+	require.NoError(t, call(optional, ""))
+}
+
+func TestStepUp(t *testing.T) {
+	i, err := NewAuthInterceptor(secret, nil, WithOptionalToken(), WithStepUp(StepUpPolicy{
+		Methods: []string{"/auth.Users/DeleteUser"},
+		MaxAge:  5 * time.Minute,
+	}))
+	require.NoError(t, err)
+
+	ok := func(ctx context.Context, req any) (any, error) { return nil, nil }
+	fresh := newToken(t, "user")
+	stale := newTokenAt(t, "user", time.Now().Add(-time.Hour))
+
+	// метод step-up требует токен и в необязательном режиме
+	require.Equal(t, codes.Unauthenticated, status.Code(callMethod(i, "/auth.Users/DeleteUser", "", ok)))
+	require.NoError(t, callMethod(i, "/auth.Users/DeleteUser", fresh, ok))
+
+	err = callMethod(i, "/auth.Users/DeleteUser", stale, ok)
+	require.Equal(t, codes.Unauthenticated, status.Code(err))
+	require.Equal(t, ReasonStepUpRequired, status.Convert(err).Details()[0].(*errdetails.ErrorInfo).Reason)
+
+	// проверка части запросов в обработчике
+	requireStepUp := func(ctx context.Context, req any) (any, error) { return nil, RequireStepUp(ctx) }
+	require.NoError(t, callMethod(i, "/auth.Users/UpdateUser", fresh, requireStepUp))
+	require.Equal(t, codes.Unauthenticated, status.Code(callMethod(i, "/auth.Users/UpdateUser", stale, requireStepUp)))
+	require.Equal(t, codes.Unauthenticated, status.Code(callMethod(i, "/auth.Users/UpdateUser", "", requireStepUp)))
+}
@@ -2,7 +2,13 @@ package kafka
 
 import (
 	"context"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/tls"
+	"crypto/x509"
 	"errors"
+	"fmt"
+	"os"
 	"time"
 
 	"github.com/IBM/sarama"
@@ -10,83 +16,259 @@ import (
 )
 
 type KafkaConfig struct {
-	Brokers []string `yaml:"KAFKA_BROKERS" env-required:"true"`
-	Topic   string   `yaml:"KAFKA_TOPIC" env-required:"true"`
+	Brokers      []string `yaml:"KAFKA_BROKERS" env-required:"true"`
+	Topic        string   `yaml:"KAFKA_TOPIC" env-required:"true"`
+	AccountTopic string   `yaml:"KAFKA_ACCOUNT_TOPIC" env-default:"account-status"`
+	SmsTopic     string   `yaml:"KAFKA_SMS_TOPIC" env-default:"sms"`
+	SignInTopic  string   `yaml:"KAFKA_SIGNIN_TOPIC" env-default:"new-sign-in"`
+	UserTopic    string   `yaml:"KAFKA_USER_EVENTS_TOPIC" env-default:"user-events"`
+
+	CommandResultsTopic string `yaml:"KAFKA_COMMAND_RESULTS_TOPIC" env-default:"account-command-results"` // итоги входящих команд
+	DeadLetterTopic     string `yaml:"KAFKA_DEAD_LETTER_TOPIC" env-default:"sso-dead-letter"`             // входящие сообщения, которые невозможно обработать
+
+	// Топики, которые сервис читает
+	DeliveryStatusTopic string `yaml:"KAFKA_DELIVERY_STATUS_TOPIC" env-default:"email-delivery-status"` // отчёты почтового сервиса о доставке
+	CommandsTopic       string `yaml:"KAFKA_COMMANDS_TOPIC" env-default:"account-commands"`             // команды над учётными записями от других сервисов
+	ConsumerGroup       string `yaml:"KAFKA_CONSUMER_GROUP" env-default:"sso"`
+
+	// Подключение
+	Version       string `yaml:"KAFKA_VERSION" env-default:"2.1.0"` // версия протокола брокеров
+	ClientID      string `yaml:"KAFKA_CLIENT_ID" env-default:"sso"`
+	SASLMechanism string `yaml:"KAFKA_SASL_MECHANISM" env:"KAFKA_SASL_MECHANISM"` // пусто, PLAIN, SCRAM-SHA-256 или SCRAM-SHA-512
+	SASLUser      string `yaml:"KAFKA_SASL_USER" env:"KAFKA_SASL_USER"`
+	SASLPass      string `yaml:"KAFKA_SASL_PASS" env:"KAFKA_SASL_PASS"`
+	TLS           bool   `yaml:"KAFKA_TLS" env:"KAFKA_TLS" env-default:"false"`
+	TLSCAFile     string `yaml:"KAFKA_TLS_CA_FILE"`   // пусто - системные корневые сертификаты
+	TLSCertFile   string `yaml:"KAFKA_TLS_CERT_FILE"` // клиентский сертификат для mTLS
+	TLSKeyFile    string `yaml:"KAFKA_TLS_KEY_FILE"`
+	TLSInsecure   bool   `yaml:"KAFKA_TLS_INSECURE" env-default:"false"` // не проверять сертификат брокера (только для разработки)
+
+	// Создание топиков. Параметры по умолчанию действуют для всех топиков,
+	// KAFKA_TOPIC_OVERRIDES меняет их для отдельных топиков (ключ - имя топика)
+	CreateTopics   bool                   `yaml:"KAFKA_CREATE_TOPICS" env-default:"true"`
+	TopicDefaults  TopicConfig            `yaml:"KAFKA_TOPIC_DEFAULTS"`
+	TopicOverrides map[string]TopicConfig `yaml:"KAFKA_TOPIC_OVERRIDES"`
+
+	// Продюсер
+	RequiredAcks string        `yaml:"KAFKA_REQUIRED_ACKS" env-default:"all"` // all, leader или none
+	Idempotent   bool          `yaml:"KAFKA_IDEMPOTENT" env-default:"true"`   // без дублей при повторах, требует acks all
+	Compression  string        `yaml:"KAFKA_COMPRESSION" env-default:"none"`  // none, gzip, snappy, lz4 или zstd
+	Retries      int           `yaml:"KAFKA_RETRIES" env-default:"5"`
+	RetryBackoff time.Duration `yaml:"KAFKA_RETRY_BACKOFF" env-default:"100ms"`
+	Timeout      time.Duration `yaml:"KAFKA_PRODUCER_TIMEOUT" env-default:"10s"` // ожидание подтверждения брокера
+
+	// Асинхронный продюсер для топиков с большим потоком событий: сообщения копятся
+	// в пачки и отправляются без ожидания подтверждения каждого
+	AsyncTopics []string      `yaml:"KAFKA_ASYNC_TOPICS"`
+	BatchSize   int           `yaml:"KAFKA_BATCH_SIZE" env-default:"500"`      // сообщений в пачке
+	BatchBytes  int           `yaml:"KAFKA_BATCH_BYTES" env-default:"1048576"` // байт в пачке
+	Linger      time.Duration `yaml:"KAFKA_LINGER" env-default:"50ms"`         // сколько ждать заполнения пачки
+}
+
+// Topics возвращает все топики, в которые пишет сервис
+func (c KafkaConfig) Topics() []string {
+	return []string{c.Topic, c.AccountTopic, c.SmsTopic, c.SignInTopic, c.UserTopic, c.CommandResultsTopic, c.DeadLetterTopic}
 }
 
+// NewSyncProducer создаёт продюсер, который ждёт подтверждения каждого сообщения
 func NewSyncProducer(ctx context.Context, log *zap.Logger, cfg KafkaConfig) (sarama.SyncProducer, error) {
-	brokers := cfg.Brokers
+	config, err := producerConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	// Сообщения с ключом (id пользователя) попадают в одну партицию и читаются по порядку
+	config.Producer.Return.Successes = true
 
-	if len(brokers) == 0 {
-		return nil, sarama.ErrBrokerNotFound
+	producer, err := sarama.NewSyncProducer(cfg.Brokers, config)
+	if err != nil {
+		log.Error("failed to create kafka producer", zap.Error(err))
+		return nil, err
 	}
 
-	// Конфигурация Kafka
-	config := sarama.NewConfig()
-	config.Version = sarama.V2_1_0_0 // или та версия, которая используется в твоём Kafka
-	config.Producer.Partitioner = sarama.NewRandomPartitioner
-	config.Producer.Retry.Max = 5
-	config.Producer.Retry.Backoff = 100 * time.Millisecond
-	config.Producer.Return.Successes = true
-	config.Producer.RequiredAcks = sarama.WaitForAll
+	log.Info("Kafka producer created", zap.Strings("brokers", cfg.Brokers), zap.String("compression", cfg.Compression), zap.Bool("idempotent", cfg.Idempotent))
+	return producer, nil
+}
 
-	// Создаём топик, если его нет
-	if err := createTopic(cfg, config, log); err != nil {
-		log.Error("failed to create topic", zap.Error(err))
+// NewAsyncProducer создаёт продюсер, отправляющий сообщения пачками (KAFKA_BATCH_SIZE, KAFKA_LINGER).
+// Об успешной доставке он не сообщает, ошибки доставки нужно читать из Errors(),
+// иначе продюсер остановится.
+func NewAsyncProducer(ctx context.Context, log *zap.Logger, cfg KafkaConfig) (sarama.AsyncProducer, error) {
+	config, err := producerConfig(cfg)
+	if err != nil {
 		return nil, err
 	}
+	config.Producer.Return.Successes = false
+	config.Producer.Return.Errors = true
+	config.Producer.Flush.Messages = cfg.BatchSize
+	config.Producer.Flush.Bytes = cfg.BatchBytes
+	config.Producer.Flush.Frequency = cfg.Linger
 
-	// Создание продюсера
-	producer, err := sarama.NewSyncProducer(brokers, config)
+	producer, err := sarama.NewAsyncProducer(cfg.Brokers, config)
 	if err != nil {
-		log.Error("failed to create kafka producer", zap.Error(err))
+		log.Error("failed to create async kafka producer", zap.Error(err))
 		return nil, err
 	}
 
-	log.Info("Kafka producer created", zap.Strings("brokers", brokers), zap.String("topic", cfg.Topic))
+	log.Info("Kafka async producer created", zap.Strings("brokers", cfg.Brokers), zap.Strings("topics", cfg.AsyncTopics), zap.Int("batchSize", cfg.BatchSize))
 	return producer, nil
 }
 
-// createTopic создаёт топик, если он не существует
-func createTopic(cfg KafkaConfig, config *sarama.Config, log *zap.Logger) error {
-	admin, err := sarama.NewClusterAdmin(cfg.Brokers, config)
+// producerConfig - общие настройки синхронного и асинхронного продюсеров
+func producerConfig(cfg KafkaConfig) (*sarama.Config, error) {
+	if len(cfg.Brokers) == 0 {
+		return nil, sarama.ErrBrokerNotFound
+	}
+
+	config, err := clientConfig(cfg)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	defer admin.Close()
 
-	topicDetail := &sarama.TopicDetail{
-		NumPartitions:     5,
-		ReplicationFactor: 3,
+	config.Producer.Partitioner = sarama.NewHashPartitioner
+	config.Producer.Retry.Max = cfg.Retries
+	config.Producer.Retry.Backoff = cfg.RetryBackoff
+	if cfg.Timeout > 0 {
+		config.Producer.Timeout = cfg.Timeout
 	}
 
-	err = admin.CreateTopic(cfg.Topic, topicDetail, false)
-	if err != nil {
-		if errors.Is(err, sarama.ErrTopicAlreadyExists) {
-			log.Info("topic already exists", zap.String("topic", cfg.Topic))
-			return nil
+	switch cfg.RequiredAcks {
+	case "all", "":
+		config.Producer.RequiredAcks = sarama.WaitForAll
+	case "leader":
+		config.Producer.RequiredAcks = sarama.WaitForLocal
+	case "none":
+		config.Producer.RequiredAcks = sarama.NoResponse
+	default:
+		return nil, fmt.Errorf("unknown KAFKA_REQUIRED_ACKS %q", cfg.RequiredAcks)
+	}
+
+	codec, ok := compressionCodecs[cfg.Compression]
+	if !ok {
+		return nil, fmt.Errorf("unknown KAFKA_COMPRESSION %q", cfg.Compression)
+	}
+	config.Producer.Compression = codec
+
+	// Идемпотентный продюсер не пишет дубли при повторах и сохраняет порядок в партиции.
+	// Брокер гарантирует это только при одном запросе в полёте на соединение
+	if cfg.Idempotent {
+		if config.Producer.RequiredAcks != sarama.WaitForAll {
+			return nil, errors.New("idempotent kafka producer requires KAFKA_REQUIRED_ACKS all")
+		}
+		if cfg.Retries == 0 {
+			return nil, errors.New("idempotent kafka producer requires KAFKA_RETRIES > 0")
 		}
-		return err
+		config.Producer.Idempotent = true
+		config.Net.MaxOpenRequests = 1
 	}
 
-	log.Info("topic created", zap.String("topic", cfg.Topic))
-	return nil
+	if err := config.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid kafka producer config: %w", err)
+	}
+
+	return config, nil
+}
+
+var compressionCodecs = map[string]sarama.CompressionCodec{
+	"":       sarama.CompressionNone,
+	"none":   sarama.CompressionNone,
+	"gzip":   sarama.CompressionGZIP,
+	"snappy": sarama.CompressionSnappy,
+	"lz4":    sarama.CompressionLZ4,
+	"zstd":   sarama.CompressionZSTD,
+}
+
+// clientConfig - версия протокола, id клиента, SASL и TLS. Общие для продюсеров, consumer group и администрирования
+func clientConfig(cfg KafkaConfig) (*sarama.Config, error) {
+	config := sarama.NewConfig()
+
+	config.Version = sarama.V2_1_0_0
+	if cfg.Version != "" {
+		version, err := sarama.ParseKafkaVersion(cfg.Version)
+		if err != nil {
+			return nil, fmt.Errorf("invalid KAFKA_VERSION: %w", err)
+		}
+		config.Version = version
+	}
+	if cfg.ClientID != "" {
+		config.ClientID = cfg.ClientID
+	}
+
+	switch cfg.SASLMechanism {
+	case "":
+	case sarama.SASLTypePlaintext:
+		config.Net.SASL.Enable = true
+		config.Net.SASL.Mechanism = sarama.SASLTypePlaintext
+	case sarama.SASLTypeSCRAMSHA256:
+		config.Net.SASL.Enable = true
+		config.Net.SASL.Mechanism = sarama.SASLTypeSCRAMSHA256
+		config.Net.SASL.SCRAMClientGeneratorFunc = func() sarama.SCRAMClient { return newScramClient(sha256.New) }
+	case sarama.SASLTypeSCRAMSHA512:
+		config.Net.SASL.Enable = true
+		config.Net.SASL.Mechanism = sarama.SASLTypeSCRAMSHA512
+		config.Net.SASL.SCRAMClientGeneratorFunc = func() sarama.SCRAMClient { return newScramClient(sha512.New) }
+	default:
+		return nil, fmt.Errorf("unknown KAFKA_SASL_MECHANISM %q", cfg.SASLMechanism)
+	}
+	config.Net.SASL.User = cfg.SASLUser
+	config.Net.SASL.Password = cfg.SASLPass
+
+	if cfg.TLS {
+		tlsConfig, err := newTLSConfig(cfg)
+		if err != nil {
+			return nil, err
+		}
+		config.Net.TLS.Enable = true
+		config.Net.TLS.Config = tlsConfig
+	}
+
+	return config, nil
 }
 
-func NewAsyncProducer(ctx context.Context, cfg KafkaConfig) (sarama.AsyncProducer, error) {
-	brokers := cfg.Brokers
+func newTLSConfig(cfg KafkaConfig) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: cfg.TLSInsecure,
+	}
+
+	if cfg.TLSCAFile != "" {
+		pem, err := os.ReadFile(cfg.TLSCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read KAFKA_TLS_CA_FILE: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errors.New("KAFKA_TLS_CA_FILE contains no certificates")
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if cfg.TLSCertFile != "" || cfg.TLSKeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.TLSCertFile, cfg.TLSKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load kafka client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
 
-	if len(brokers) == 0 {
+// NewConsumerGroup создаёт consumer group. Новая группа читает топики с самого начала,
+// смещения фиксируются только после обработки сообщения (MarkMessage).
+func NewConsumerGroup(cfg KafkaConfig) (sarama.ConsumerGroup, error) {
+	if len(cfg.Brokers) == 0 {
 		return nil, sarama.ErrBrokerNotFound
 	}
 
-	config := sarama.NewConfig()
-	config.Producer.Partitioner = sarama.NewRandomPartitioner
-	config.Producer.RequiredAcks = sarama.WaitForAll
-	config.Producer.Return.Successes = true
-	producer, err := sarama.NewAsyncProducer(brokers, config)
+	config, err := clientConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	config.Consumer.Offsets.Initial = sarama.OffsetOldest
+	config.Consumer.Return.Errors = true
+	config.Consumer.Group.Rebalance.GroupStrategies = []sarama.BalanceStrategy{sarama.NewBalanceStrategySticky()}
 
-	return producer, err
+	return sarama.NewConsumerGroup(cfg.Brokers, cfg.ConsumerGroup, config)
 }
 
 func PrepareMessage(topic string, message []byte) *sarama.ProducerMessage {
@@ -0,0 +1,158 @@
+package kafka
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"hash"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// scramClient - клиентская сторона SCRAM (RFC 5802) для SASL/SCRAM-SHA-256 и SCRAM-SHA-512.
+// Имя и пароль не проходят SASLprep, поэтому должны состоять из печатных ASCII символов.
+type scramClient struct {
+	hash func() hash.Hash
+
+	user, password, authzID string
+	nonce                   string // задаётся в тестах, иначе генерируется
+
+	step            int
+	clientFirstBare string
+	serverSignature []byte
+	done            bool
+}
+
+func newScramClient(h func() hash.Hash) *scramClient {
+	return &scramClient{hash: h}
+}
+
+func (c *scramClient) Begin(user, password, authzID string) error {
+	c.user, c.password, c.authzID = user, password, authzID
+	c.step = 0
+	c.done = false
+	return nil
+}
+
+func (c *scramClient) Step(challenge string) (string, error) {
+	c.step++
+
+	switch c.step {
+	case 1:
+		return c.clientFirst()
+	case 2:
+		return c.clientFinal(challenge)
+	case 3:
+		return "", c.verifyServerFinal(challenge)
+	}
+
+	return "", errors.New("scram: unexpected step")
+}
+
+func (c *scramClient) Done() bool {
+	return c.done
+}
+
+func (c *scramClient) gs2Header() string {
+	if c.authzID == "" {
+		return "n,,"
+	}
+	return "n,a=" + escapeScramName(c.authzID) + ","
+}
+
+func (c *scramClient) clientFirst() (string, error) {
+	if c.nonce == "" {
+		buf := make([]byte, 24)
+		if _, err := rand.Read(buf); err != nil {
+			return "", fmt.Errorf("scram: failed to generate nonce: %w", err)
+		}
+		c.nonce = base64.RawStdEncoding.EncodeToString(buf)
+	}
+
+	c.clientFirstBare = "n=" + escapeScramName(c.user) + ",r=" + c.nonce
+	return c.gs2Header() + c.clientFirstBare, nil
+}
+
+func (c *scramClient) clientFinal(serverFirst string) (string, error) {
+	attrs := parseScramAttrs(serverFirst)
+	if e, ok := attrs["e"]; ok {
+		return "", fmt.Errorf("scram: server error: %s", e)
+	}
+
+	nonce := attrs["r"]
+	if !strings.HasPrefix(nonce, c.nonce) || len(nonce) == len(c.nonce) {
+		return "", errors.New("scram: server nonce does not extend client nonce")
+	}
+	salt, err := base64.StdEncoding.DecodeString(attrs["s"])
+	if err != nil || len(salt) == 0 {
+		return "", errors.New("scram: invalid salt")
+	}
+	iterations, err := strconv.Atoi(attrs["i"])
+	if err != nil || iterations < 1 {
+		return "", errors.New("scram: invalid iteration count")
+	}
+
+	saltedPassword := pbkdf2.Key([]byte(c.password), salt, iterations, c.hash().Size(), c.hash)
+	clientKey := c.hmac(saltedPassword, "Client Key")
+	storedKey := c.sum(clientKey)
+
+	withoutProof := "c=" + base64.StdEncoding.EncodeToString([]byte(c.gs2Header())) + ",r=" + nonce
+	authMessage := c.clientFirstBare + "," + serverFirst + "," + withoutProof
+
+	clientSignature := c.hmac(storedKey, authMessage)
+	proof := make([]byte, len(clientKey))
+	for i := range clientKey {
+		proof[i] = clientKey[i] ^ clientSignature[i]
+	}
+
+	c.serverSignature = c.hmac(c.hmac(saltedPassword, "Server Key"), authMessage)
+
+	return withoutProof + ",p=" + base64.StdEncoding.EncodeToString(proof), nil
+}
+
+func (c *scramClient) verifyServerFinal(serverFinal string) error {
+	attrs := parseScramAttrs(serverFinal)
+	if e, ok := attrs["e"]; ok {
+		return fmt.Errorf("scram: server error: %s", e)
+	}
+
+	signature, err := base64.StdEncoding.DecodeString(attrs["v"])
+	if err != nil || subtle.ConstantTimeCompare(signature, c.serverSignature) != 1 {
+		return errors.New("scram: invalid server signature")
+	}
+
+	c.done = true
+	return nil
+}
+
+func (c *scramClient) hmac(key []byte, data string) []byte {
+	mac := hmac.New(c.hash, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+func (c *scramClient) sum(data []byte) []byte {
+	h := c.hash()
+	h.Write(data)
+	return h.Sum(nil)
+}
+
+func parseScramAttrs(message string) map[string]string {
+	attrs := make(map[string]string)
+	for _, part := range strings.Split(message, ",") {
+		if len(part) >= 2 && part[1] == '=' {
+			attrs[part[:1]] = part[2:]
+		}
+	}
+	return attrs
+}
+
+// escapeScramName экранирует запятую и знак равенства в имени пользователя
+func escapeScramName(name string) string {
+	return strings.NewReplacer("=", "=3D", ",", "=2C").Replace(name)
+}
@@ -0,0 +1,49 @@
+package kafka
+
+import (
+	"crypto/sha256"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// Пример обмена из RFC 7677, раздел 3
+func TestScramClientSHA256(t *testing.T) {
+	client := newScramClient(sha256.New)
+	client.nonce = "rOprNGfwEbeRWgbNEkqO"
+	require.NoError(t, client.Begin("user", "pencil", ""))
+
+	first, err := client.Step("")
+	require.NoError(t, err)
+	require.Equal(t, "n,,n=user,r=rOprNGfwEbeRWgbNEkqO", first)
+
+	final, err := client.Step("r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,s=W22ZaJ0SNY7soEsUEjb6gQ==,i=4096")
+	require.NoError(t, err)
+	require.Equal(t, "c=biws,r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,p=dHzbZapWIk4jUhN+Ute9ytag9zjfMHgsqmmiz7AndVQ=", final)
+	require.False(t, client.Done())
+
+	_, err = client.Step("v=6rriTRBi23WpRR/wtup+mMhUZUn/dB5nLTJRsjl95G4=")
+	require.NoError(t, err)
+	require.True(t, client.Done())
+}
+
+func TestScramClientRejectsForgedServer(t *testing.T) {
+	client := newScramClient(sha256.New)
+	client.nonce = "rOprNGfwEbeRWgbNEkqO"
+	require.NoError(t, client.Begin("user", "pencil", ""))
+
+	_, err := client.Step("")
+	require.NoError(t, err)
+
+	_, err = client.Step("r=someoneElsesNonce,s=W22ZaJ0SNY7soEsUEjb6gQ==,i=4096")
+	require.Error(t, err)
+
+	require.NoError(t, client.Begin("user", "pencil", ""))
+	_, err = client.Step("")
+	require.NoError(t, err)
+	_, err = client.Step("r=rOprNGfwEbeRWgbNEkqO%hvYDpWUa2RaTCAfuxFIlj)hNlF$k0,s=W22ZaJ0SNY7soEsUEjb6gQ==,i=4096")
+	require.NoError(t, err)
+	_, err = client.Step("v=AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA=")
+	require.Error(t, err)
+	require.False(t, client.Done())
+}
@@ -0,0 +1,171 @@
+package kafka
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/IBM/sarama"
+	"go.uber.org/zap"
+)
+
+// TopicConfig - параметры топика. Нулевые значения в KAFKA_TOPIC_OVERRIDES
+// берутся из KAFKA_TOPIC_DEFAULTS, нулевые Retention и CleanupPolicy - настройки брокера.
+type TopicConfig struct {
+	Partitions        int32         `yaml:"PARTITIONS" env-default:"5"`
+	ReplicationFactor int16         `yaml:"REPLICATION_FACTOR" env-default:"3"`
+	Retention         time.Duration `yaml:"RETENTION"`      // retention.ms, отрицательное - хранить бессрочно
+	CleanupPolicy     string        `yaml:"CLEANUP_POLICY"` // delete, compact или "compact,delete"
+}
+
+// TopicConfig возвращает итоговые параметры топика
+func (c KafkaConfig) TopicConfig(topic string) TopicConfig {
+	result := c.TopicDefaults
+
+	override, ok := c.TopicOverrides[topic]
+	if !ok {
+		return result
+	}
+
+	if override.Partitions != 0 {
+		result.Partitions = override.Partitions
+	}
+	if override.ReplicationFactor != 0 {
+		result.ReplicationFactor = override.ReplicationFactor
+	}
+	if override.Retention != 0 {
+		result.Retention = override.Retention
+	}
+	if override.CleanupPolicy != "" {
+		result.CleanupPolicy = override.CleanupPolicy
+	}
+
+	return result
+}
+
+// entries - настройки топика на стороне брокера, которыми управляет сервис
+func (t TopicConfig) entries() map[string]*string {
+	entries := make(map[string]*string)
+
+	if t.Retention != 0 {
+		ms := int64(-1)
+		if t.Retention > 0 {
+			ms = t.Retention.Milliseconds()
+		}
+		value := strconv.FormatInt(ms, 10)
+		entries["retention.ms"] = &value
+	}
+	if t.CleanupPolicy != "" {
+		value := t.CleanupPolicy
+		entries["cleanup.policy"] = &value
+	}
+
+	return entries
+}
+
+// EnsureTopics приводит топики, в которые пишет сервис, к конфигу (KAFKA_CREATE_TOPICS).
+// Отсутствующие топики создаются. У существующих добавляются партиции, если их меньше,
+// и обновляются retention и cleanup policy. Уменьшить число партиций или сменить
+// фактор репликации Kafka не позволяет - об этом пишется предупреждение.
+func EnsureTopics(log *zap.Logger, cfg KafkaConfig) error {
+	if !cfg.CreateTopics {
+		return nil
+	}
+
+	config, err := clientConfig(cfg)
+	if err != nil {
+		return err
+	}
+
+	admin, err := sarama.NewClusterAdmin(cfg.Brokers, config)
+	if err != nil {
+		return err
+	}
+	defer admin.Close()
+
+	existing, err := admin.ListTopics()
+	if err != nil {
+		return fmt.Errorf("failed to list topics: %w", err)
+	}
+
+	for _, topic := range cfg.Topics() {
+		want := cfg.TopicConfig(topic)
+		log := log.With(zap.String("topic", topic))
+
+		current, ok := existing[topic]
+		if !ok {
+			if err := createTopic(admin, topic, want); err != nil {
+				log.Error("failed to create topic", zap.Error(err))
+				return err
+			}
+			log.Info("topic created", zap.Int32("partitions", want.Partitions), zap.Int16("replicationFactor", want.ReplicationFactor))
+			continue
+		}
+
+		if err := updateTopic(log, admin, config.Version, topic, current, want); err != nil {
+			log.Error("failed to update topic", zap.Error(err))
+			return err
+		}
+	}
+
+	return nil
+}
+
+func createTopic(admin sarama.ClusterAdmin, topic string, want TopicConfig) error {
+	err := admin.CreateTopic(topic, &sarama.TopicDetail{
+		NumPartitions:     want.Partitions,
+		ReplicationFactor: want.ReplicationFactor,
+		ConfigEntries:     want.entries(),
+	}, false)
+	if err != nil {
+		// топик могла создать другая реплика сервиса
+		if errors.Is(err, sarama.ErrTopicAlreadyExists) {
+			return nil
+		}
+		return err
+	}
+
+	return nil
+}
+
+func updateTopic(log *zap.Logger, admin sarama.ClusterAdmin, version sarama.KafkaVersion, topic string, current sarama.TopicDetail, want TopicConfig) error {
+	switch {
+	case want.Partitions > current.NumPartitions:
+		// новые партиции меняют распределение ключей: порядок сообщений одного пользователя
+		// гарантируется только для сообщений, отправленных после изменения
+		if err := admin.CreatePartitions(topic, want.Partitions, nil, false); err != nil {
+			return fmt.Errorf("failed to add partitions: %w", err)
+		}
+		log.Info("topic partitions added", zap.Int32("from", current.NumPartitions), zap.Int32("to", want.Partitions))
+	case want.Partitions < current.NumPartitions:
+		log.Warn("topic has more partitions than configured", zap.Int32("partitions", current.NumPartitions), zap.Int32("configured", want.Partitions))
+	}
+
+	if want.ReplicationFactor != current.ReplicationFactor {
+		log.Warn("topic replication factor differs from config", zap.Int16("replicationFactor", current.ReplicationFactor), zap.Int16("configured", want.ReplicationFactor))
+	}
+
+	changes := make(map[string]sarama.IncrementalAlterConfigsEntry)
+	for name, value := range want.entries() {
+		if old := current.ConfigEntries[name]; old == nil || *old != *value {
+			changes[name] = sarama.IncrementalAlterConfigsEntry{Operation: sarama.IncrementalAlterConfigsOperationSet, Value: value}
+		}
+	}
+	if len(changes) == 0 {
+		return nil
+	}
+
+	// AlterConfig сбросил бы остальные настройки топика, а инкрементальное изменение есть с Kafka 2.3
+	if !version.IsAtLeast(sarama.V2_3_0_0) {
+		log.Warn("topic config differs from config, but KAFKA_VERSION is below 2.3 and it cannot be updated")
+		return nil
+	}
+
+	if err := admin.IncrementalAlterConfig(sarama.TopicResource, topic, changes, false); err != nil {
+		return fmt.Errorf("failed to update topic config: %w", err)
+	}
+	log.Info("topic config updated", zap.Int("entries", len(changes)))
+
+	return nil
+}
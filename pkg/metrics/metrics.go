@@ -0,0 +1,74 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"net/http"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Метрики публикуются через expvar и отдаются в JSON по /debug/vars.
+// Счётчики и датчики регистрируются один раз при старте: expvar паникует на повторном имени.
+
+// NewCounter регистрирует монотонный счётчик
+func NewCounter(name string) *expvar.Int {
+	return expvar.NewInt(name)
+}
+
+// NewGauge регистрирует значение, которое может расти и убывать
+func NewGauge(name string) *expvar.Float {
+	return expvar.NewFloat(name)
+}
+
+type MetricsConfig struct {
+	Addr string `yaml:"METRICS_ADDR" env:"METRICS_ADDR"` // например ":9090", пустой - сервер метрик не запускается
+}
+
+// Server отдаёт /debug/vars
+type Server struct {
+	log    *zap.Logger
+	server *http.Server
+}
+
+func NewServer(log *zap.Logger, cfg MetricsConfig) *Server {
+	mux := http.NewServeMux()
+	mux.Handle("/debug/vars", expvar.Handler())
+
+	return &Server{
+		log: log,
+		server: &http.Server{
+			Addr:              cfg.Addr,
+			Handler:           mux,
+			ReadHeaderTimeout: 5 * time.Second,
+		},
+	}
+}
+
+// Run блокируется до вызова Stop. Без адреса возвращается сразу.
+func (s *Server) Run() {
+	if s.server.Addr == "" {
+		return
+	}
+
+	s.log.Info("metrics server is running", zap.String("addr", s.server.Addr))
+
+	if err := s.server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		s.log.Error("metrics server failed", zap.Error(err))
+	}
+}
+
+func (s *Server) Stop() {
+	if s.server.Addr == "" {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if err := s.server.Shutdown(ctx); err != nil {
+		s.log.Warn("failed to stop metrics server", zap.Error(err))
+	}
+}
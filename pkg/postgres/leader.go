@@ -0,0 +1,87 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Leader выбирает одну реплику из нескольких с помощью session-level advisory lock.
+// Блокировка живёт, пока жива сессия, поэтому лидер держит одно соединение из пула
+// до вызова Release. Если лидер падает, Postgres снимает блокировку вместе с сессией
+// и её забирает следующая реплика.
+//
+// Leader не потокобезопасен: им должна пользоваться одна горутина.
+type Leader struct {
+	pool *pgxpool.Pool
+	name string
+	key  int64
+	conn *pgxpool.Conn
+}
+
+// NewLeader создаёт выборы лидера для задачи name. Реплики с одинаковым name конкурируют за одну блокировку.
+func NewLeader(pool *pgxpool.Pool, name string) *Leader {
+	h := fnv.New64a()
+	h.Write([]byte(name))
+
+	return &Leader{
+		pool: pool,
+		name: name,
+		key:  int64(h.Sum64()),
+	}
+}
+
+// TryAcquire не блокируется и сообщает, является ли текущая реплика лидером.
+// Повторные вызовы лидера только проверяют, что сессия с блокировкой ещё жива.
+func (l *Leader) TryAcquire(ctx context.Context) (bool, error) {
+	if l.conn != nil {
+		if err := l.conn.Ping(ctx); err == nil {
+			return true, nil
+		}
+
+		// сессия потеряна вместе с блокировкой, соединение больше не пригодно
+		l.conn.Conn().Close(ctx)
+		l.conn.Release()
+		l.conn = nil
+	}
+
+	conn, err := l.pool.Acquire(ctx)
+	if err != nil {
+		return false, fmt.Errorf("failed to acquire connection for leader election %q: %w", l.name, err)
+	}
+
+	var acquired bool
+	if err := conn.QueryRow(ctx, "SELECT pg_try_advisory_lock($1)", l.key).Scan(&acquired); err != nil {
+		conn.Release()
+		return false, fmt.Errorf("failed to take advisory lock %q: %w", l.name, err)
+	}
+
+	if !acquired {
+		conn.Release()
+		return false, nil
+	}
+
+	l.conn = conn
+
+	return true, nil
+}
+
+// Release отдаёт лидерство и возвращает соединение в пул
+func (l *Leader) Release(ctx context.Context) error {
+	if l.conn == nil {
+		return nil
+	}
+
+	defer func() {
+		l.conn.Release()
+		l.conn = nil
+	}()
+
+	if _, err := l.conn.Exec(ctx, "SELECT pg_advisory_unlock($1)", l.key); err != nil {
+		return fmt.Errorf("failed to release advisory lock %q: %w", l.name, err)
+	}
+
+	return nil
+}
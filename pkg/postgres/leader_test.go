@@ -0,0 +1,49 @@
+package postgres
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/stretchr/testify/require"
+)
+
+// Запускается на настоящем postgres, только если задан SSO_TEST_POSTGRES_DSN
+func TestLeader(t *testing.T) {
+	dsn := os.Getenv("SSO_TEST_POSTGRES_DSN")
+	if dsn == "" {
+		t.Skip("SSO_TEST_POSTGRES_DSN is not set")
+	}
+
+	ctx := context.Background()
+	pool, err := pgxpool.New(ctx, dsn)
+	require.NoError(t, err)
+	t.Cleanup(pool.Close)
+
+	first := NewLeader(pool, "sso-test-leader")
+	second := NewLeader(pool, "sso-test-leader")
+	t.Cleanup(func() {
+		first.Release(ctx)
+		second.Release(ctx)
+	})
+
+	ok, err := first.TryAcquire(ctx)
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	// повторный вызов лидера только проверяет сессию
+	ok, err = first.TryAcquire(ctx)
+	require.NoError(t, err)
+	require.True(t, ok)
+
+	ok, err = second.TryAcquire(ctx)
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	require.NoError(t, first.Release(ctx))
+
+	ok, err = second.TryAcquire(ctx)
+	require.NoError(t, err)
+	require.True(t, ok)
+}
@@ -0,0 +1,232 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/DenisBochko/yandex_SSO/pkg/metrics"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.uber.org/zap"
+)
+
+var (
+	replicaReadsTotal = metrics.NewCounter("postgres_replica_reads_total")
+	primaryReadsTotal = metrics.NewCounter("postgres_primary_fallback_reads_total") // чтения, для которых не нашлось подходящей реплики
+	healthyReplicas   = metrics.NewGauge("postgres_healthy_replicas")
+)
+
+// primaryLSNQuery - позиция WAL на primary в байтах
+const primaryLSNQuery = `SELECT (pg_current_wal_lsn() - '0/0')::int8`
+
+// replicaStateQuery - находится ли реплика в восстановлении, до какой позиции WAL применены изменения
+// и принимает ли она WAL от primary прямо сейчас. Равенство полученного и применённого WAL
+// отставание не доказывает: с отключённым приёмником реплика применила всё полученное, но получать перестала.
+const replicaStateQuery = `
+    SELECT pg_is_in_recovery(),
+        COALESCE((pg_last_wal_replay_lsn() - '0/0')::int8, 0),
+        EXISTS (SELECT 1 FROM pg_stat_wal_receiver WHERE status = 'streaming')`
+
+// errNotStreaming - приёмник WAL на реплике отключён: данные на ней перестали обновляться
+var errNotStreaming = errors.New("replica is not streaming WAL from primary")
+
+// walSample - позиция WAL на primary в момент проверки
+type walSample struct {
+	at  time.Time
+	lsn int64
+}
+
+// Replicas выбирает пул для запросов только на чтение: реплики из POSTGRES_REPLICAS по кругу.
+// В фоне раз в POSTGRES_REPLICA_CHECK_INTERVAL проверяет, что реплика отвечает, получает WAL от primary
+// и отстаёт не больше чем на POSTGRES_REPLICA_MAX_LAG. Если подходящих реплик нет, чтение идёт в primary.
+//
+// Отставание считается по позициям WAL, которые primary сообщал на прошлых проверках: это возраст
+// самой старой из них, до которой реплика ещё не дошла. Время последней применённой транзакции
+// для этого не подходит - на простаивающем primary оно не меняется. Точность - POSTGRES_REPLICA_CHECK_INTERVAL.
+type Replicas struct {
+	log      *zap.Logger
+	primary  *pgxpool.Pool
+	replicas []*replica
+	maxLag   time.Duration
+	interval time.Duration
+	next     atomic.Uint64
+	samples  []walSample // позиции WAL на primary за последние maxLag + interval, по возрастанию; меняет только check
+
+	stop context.CancelFunc
+	done chan struct{}
+}
+
+type replica struct {
+	pool    *pgxpool.Pool
+	addr    string // host:port без пароля, для логов
+	healthy atomic.Bool
+}
+
+// NewReplicas подключается к репликам и сразу проверяет их. Недоступная при старте реплика
+// не ошибка: она начнёт получать запросы, когда пройдёт проверку.
+func NewReplicas(ctx context.Context, log *zap.Logger, primary *pgxpool.Pool, config PostgresCfg) (*Replicas, error) {
+	r := &Replicas{
+		log:      log.With(zap.String("component", "postgres replicas")),
+		primary:  primary,
+		maxLag:   config.ReplicaMaxLag,
+		interval: config.ReplicaCheckInterval,
+		done:     make(chan struct{}),
+	}
+
+	for _, dsn := range config.Replicas {
+		pool, err := pgxpool.New(ctx, dsn)
+		if err != nil {
+			r.closePools()
+			return nil, fmt.Errorf("unable to connect to replica: %w", err)
+		}
+
+		cfg := pool.Config().ConnConfig
+		r.replicas = append(r.replicas, &replica{pool: pool, addr: fmt.Sprintf("%s:%d", cfg.Host, cfg.Port)})
+	}
+
+	r.check(ctx)
+
+	ctx, r.stop = context.WithCancel(context.Background())
+	go r.run(ctx)
+
+	return r, nil
+}
+
+// Reader возвращает следующую по кругу подходящую реплику или primary
+func (r *Replicas) Reader() *pgxpool.Pool {
+	if n := uint64(len(r.replicas)); n > 0 {
+		start := r.next.Add(1)
+		for i := range n {
+			if rep := r.replicas[(start+i)%n]; rep.healthy.Load() {
+				replicaReadsTotal.Add(1)
+				return rep.pool
+			}
+		}
+	}
+
+	primaryReadsTotal.Add(1)
+	return r.primary
+}
+
+// Close останавливает проверки и закрывает пулы реплик. Primary закрывает тот, кто его создал.
+func (r *Replicas) Close() {
+	r.stop()
+	<-r.done
+	r.closePools()
+}
+
+func (r *Replicas) run(ctx context.Context) {
+	defer close(r.done)
+
+	if len(r.replicas) == 0 {
+		return
+	}
+
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			r.check(ctx)
+		}
+	}
+}
+
+// check измеряет отставание каждой реплики и обновляет признак пригодности
+func (r *Replicas) check(ctx context.Context) {
+	if len(r.replicas) == 0 {
+		return
+	}
+
+	r.samplePrimary(ctx, time.Now())
+
+	var healthy int
+	for _, rep := range r.replicas {
+		lag, err := r.lag(ctx, rep)
+		ok := err == nil && lag <= r.maxLag
+		if ok {
+			healthy++
+		}
+
+		if ok == rep.healthy.Swap(ok) {
+			continue
+		}
+
+		switch {
+		case ok:
+			r.log.Info("replica is available for reads", zap.String("replica", rep.addr), zap.Duration("lag", lag))
+		case err != nil:
+			r.log.Warn("replica is unavailable, reading from other replicas or primary", zap.String("replica", rep.addr), zap.Error(err))
+		default:
+			r.log.Warn("replica lags behind, reading from other replicas or primary", zap.String("replica", rep.addr), zap.Duration("lag", lag))
+		}
+	}
+
+	healthyReplicas.Set(float64(healthy))
+}
+
+// samplePrimary запоминает текущую позицию WAL на primary. Позиции старше maxLag + interval
+// не нужны: реплика, не дошедшая до следующей за ними, и так отстаёт больше maxLag.
+// Если primary не ответил, отставание считается по прежним позициям.
+func (r *Replicas) samplePrimary(ctx context.Context, now time.Time) {
+	ctx, cancel := context.WithTimeout(ctx, r.interval)
+	defer cancel()
+
+	var lsn int64
+	if err := r.primary.QueryRow(ctx, primaryLSNQuery).Scan(&lsn); err != nil {
+		r.log.Warn("failed to get WAL position of primary", zap.Error(err))
+	} else {
+		r.samples = append(r.samples, walSample{at: now, lsn: lsn})
+	}
+
+	keepFrom := now.Add(-(r.maxLag + r.interval))
+	for len(r.samples) > 1 && r.samples[0].at.Before(keepFrom) {
+		r.samples = r.samples[1:]
+	}
+}
+
+func (r *Replicas) lag(ctx context.Context, rep *replica) (time.Duration, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.interval)
+	defer cancel()
+
+	var inRecovery, streaming bool
+	var replayed int64
+	if err := rep.pool.QueryRow(ctx, replicaStateQuery).Scan(&inRecovery, &replayed, &streaming); err != nil {
+		return 0, err
+	}
+
+	// реплику повысили: данные на ней не старее, чем на прежнем primary
+	if !inRecovery {
+		return 0, nil
+	}
+
+	if !streaming {
+		return 0, errNotStreaming
+	}
+
+	return r.lagBehind(replayed, time.Now()), nil
+}
+
+// lagBehind - возраст самой старой позиции primary, которую реплика ещё не применила.
+// Ноль, если она дошла до всех известных позиций.
+func (r *Replicas) lagBehind(replayed int64, now time.Time) time.Duration {
+	for _, sample := range r.samples {
+		if sample.lsn > replayed {
+			return now.Sub(sample.at)
+		}
+	}
+
+	return 0
+}
+
+func (r *Replicas) closePools() {
+	for _, rep := range r.replicas {
+		rep.pool.Close()
+	}
+}
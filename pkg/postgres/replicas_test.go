@@ -0,0 +1,29 @@
+package postgres
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLagBehind(t *testing.T) {
+	now := time.Now()
+	r := &Replicas{samples: []walSample{
+		{at: now.Add(-6 * time.Second), lsn: 100},
+		{at: now.Add(-4 * time.Second), lsn: 100},
+		{at: now.Add(-2 * time.Second), lsn: 250},
+	}}
+
+	// дошла до последней позиции primary
+	require.Zero(t, r.lagBehind(250, now))
+	require.Zero(t, r.lagBehind(300, now))
+
+	// не применила то, что primary записал после второй проверки
+	require.Equal(t, 2*time.Second, r.lagBehind(100, now))
+
+	// primary простаивал, но реплика отстала ещё до первой проверки
+	require.Equal(t, 6*time.Second, r.lagBehind(50, now))
+
+	require.Zero(t, (&Replicas{}).lagBehind(0, now))
+}
@@ -2,31 +2,158 @@ package redisClient
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
 	"fmt"
+	"os"
+	"time"
 
 	"github.com/redis/go-redis/v9"
 	"go.uber.org/zap"
 )
 
+// Режимы подключения (REDIS_MODE)
+const (
+	ModeSingle   = "single"   // один узел REDIS_HOST:REDIS_PORT
+	ModeSentinel = "sentinel" // мастер REDIS_MASTER_NAME, адрес которого сообщают sentinel из REDIS_ADDRS
+	ModeCluster  = "cluster"  // redis cluster, REDIS_ADDRS - начальный список узлов
+)
+
 type RedisClientCfg struct {
-	Host     string `yaml:"REDIS_HOST" env-required:"true"`
-	Port     string `yaml:"REDIS_PORT" env-required:"true"`
+	Mode     string `yaml:"REDIS_MODE" env:"REDIS_MODE" env-default:"single"`
+	Host     string `yaml:"REDIS_HOST"` // только для single
+	Port     string `yaml:"REDIS_PORT"`
+	Username string `yaml:"REDIS_USER" env:"REDIS_USER"` // пользователь ACL, пусто - default
 	Password string `yaml:"REDIS_PASS" env-required:"true"`
-	DB       int    `yaml:"REDIS_DB" env-required:"true"`
+	DB       int    `yaml:"REDIS_DB" env-required:"true"` // в режиме cluster должна быть 0
+
+	Addrs            []string `yaml:"REDIS_ADDRS" env:"REDIS_ADDRS" env-separator:","` // адреса sentinel или узлов cluster
+	MasterName       string   `yaml:"REDIS_MASTER_NAME" env:"REDIS_MASTER_NAME"`
+	SentinelPassword string   `yaml:"REDIS_SENTINEL_PASS" env:"REDIS_SENTINEL_PASS"` // если sentinel требует пароль
+
+	TLS         bool   `yaml:"REDIS_TLS" env:"REDIS_TLS" env-default:"false"`
+	TLSCAFile   string `yaml:"REDIS_TLS_CA_FILE"`   // пусто - системные корневые сертификаты
+	TLSCertFile string `yaml:"REDIS_TLS_CERT_FILE"` // клиентский сертификат для mTLS
+	TLSKeyFile  string `yaml:"REDIS_TLS_KEY_FILE"`
+	TLSInsecure bool   `yaml:"REDIS_TLS_INSECURE" env-default:"false"` // не проверять сертификат сервера (только для разработки)
+
+	// При старте redis может подниматься одновременно с сервисом: подключение повторяется
+	// ConnectAttempts раз, пауза начинается с ConnectBackoff и удваивается
+	ConnectAttempts int           `yaml:"REDIS_CONNECT_ATTEMPTS" env-default:"5"`
+	ConnectBackoff  time.Duration `yaml:"REDIS_CONNECT_BACKOFF" env-default:"1s"`
 }
 
-func New(ctx context.Context, log *zap.Logger, config RedisClientCfg) *redis.Client {
-	rdb := redis.NewClient(&redis.Options{
-		Addr:     fmt.Sprintf("%s:%s", config.Host, config.Port),
-		Password: config.Password,
-		DB:       config.DB,
-	})
+// New подключается к redis в режиме REDIS_MODE и проверяет подключение.
+// Если redis так и не ответил, клиент закрывается и возвращается ошибка.
+func New(ctx context.Context, log *zap.Logger, config RedisClientCfg) (redis.UniversalClient, error) {
+	opts := &redis.UniversalOptions{
+		Addrs:            config.Addrs,
+		Username:         config.Username,
+		Password:         config.Password,
+		DB:               config.DB,
+		MasterName:       config.MasterName,
+		SentinelPassword: config.SentinelPassword,
+	}
+
+	if config.TLS {
+		tlsConfig, err := newTLSConfig(config)
+		if err != nil {
+			return nil, err
+		}
+		opts.TLSConfig = tlsConfig
+	}
+
+	var rdb redis.UniversalClient
+	switch config.Mode {
+	case ModeSingle, "":
+		if config.Host == "" {
+			return nil, errors.New("REDIS_HOST is required in single mode")
+		}
+		opts.Addrs = []string{fmt.Sprintf("%s:%s", config.Host, config.Port)}
+		rdb = redis.NewClient(opts.Simple())
+	case ModeSentinel:
+		if config.MasterName == "" || len(config.Addrs) == 0 {
+			return nil, errors.New("REDIS_MASTER_NAME and REDIS_ADDRS are required in sentinel mode")
+		}
+		rdb = redis.NewFailoverClient(opts.Failover())
+	case ModeCluster:
+		if len(config.Addrs) == 0 {
+			return nil, errors.New("REDIS_ADDRS is required in cluster mode")
+		}
+		if config.DB != 0 {
+			return nil, errors.New("REDIS_DB must be 0 in cluster mode")
+		}
+		rdb = redis.NewClusterClient(opts.Cluster())
+	default:
+		return nil, fmt.Errorf("unknown REDIS_MODE %q", config.Mode)
+	}
+
+	if err := ping(ctx, log, rdb, config); err != nil {
+		rdb.Close()
+		return nil, err
+	}
+
+	log.Info("connected to redis", zap.String("mode", config.Mode), zap.Strings("addrs", opts.Addrs))
+	return rdb, nil
+}
+
+// ping проверяет подключение, повторяя попытки с удваивающейся паузой
+func ping(ctx context.Context, log *zap.Logger, rdb redis.UniversalClient, config RedisClientCfg) error {
+	attempts := max(config.ConnectAttempts, 1)
+	backoff := config.ConnectBackoff
+
+	var err error
+	for attempt := 1; ; attempt++ {
+		if err = rdb.Ping(ctx).Err(); err == nil {
+			return nil
+		}
+		if attempt == attempts {
+			break
+		}
+
+		log.Warn("redis is not available yet, retrying",
+			zap.Int("attempt", attempt),
+			zap.Duration("backoff", backoff),
+			zap.Error(err),
+		)
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("failed to connect to redis: %w", ctx.Err())
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+
+	return fmt.Errorf("failed to connect to redis after %d attempts: %w", attempts, err)
+}
+
+func newTLSConfig(cfg RedisClientCfg) (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: cfg.TLSInsecure,
+	}
+
+	if cfg.TLSCAFile != "" {
+		pem, err := os.ReadFile(cfg.TLSCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read REDIS_TLS_CA_FILE: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errors.New("REDIS_TLS_CA_FILE contains no certificates")
+		}
+		tlsConfig.RootCAs = pool
+	}
 
-	if response := rdb.Ping(ctx); response.Err() != nil {
-		log.Error("failed to connect to redis", zap.Error(response.Err()))
-		return nil
+	if cfg.TLSCertFile != "" || cfg.TLSKeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.TLSCertFile, cfg.TLSKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load redis client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
 	}
 
-	log.Info("connected to redis", zap.String("host", config.Host), zap.String("port", config.Port))
-	return rdb
+	return tlsConfig, nil
 }
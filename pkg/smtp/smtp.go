@@ -0,0 +1,245 @@
+package smtp
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"mime"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Режимы шифрования соединения (SMTP_TLS)
+const (
+	TLSNone     = "none"     // без шифрования, для локальной SMTP-ловушки
+	TLSStartTLS = "starttls" // обычно порт 587
+	TLSImplicit = "tls"      // обычно порт 465
+)
+
+type SmtpConfig struct {
+	Host         string        `yaml:"SMTP_HOST" env:"SMTP_HOST" env-default:"localhost"`
+	Port         int           `yaml:"SMTP_PORT" env:"SMTP_PORT" env-default:"1025"`
+	User         string        `yaml:"SMTP_USER" env:"SMTP_USER"`
+	Pass         string        `yaml:"SMTP_PASS" env:"SMTP_PASS"`
+	From         string        `yaml:"SMTP_FROM" env:"SMTP_FROM" env-default:"SSO <no-reply@localhost>"`
+	TLS          string        `yaml:"SMTP_TLS" env:"SMTP_TLS" env-default:"none"`
+	Timeout      time.Duration `yaml:"SMTP_TIMEOUT" env-default:"10s"`
+	Retries      int           `yaml:"SMTP_RETRIES" env-default:"3"`           // повторов после первой неудачи
+	RetryBackoff time.Duration `yaml:"SMTP_RETRY_BACKOFF" env-default:"500ms"` // удваивается с каждым повтором
+}
+
+// ErrPermanent - сервер отказался принимать письмо (ответ 5xx), повтор не поможет
+var ErrPermanent = errors.New("smtp permanent failure")
+
+// Message - письмо с текстовой и HTML версиями. Пустая HTML версия - только текст.
+type Message struct {
+	To      string
+	Subject string
+	Text    string
+	HTML    string
+}
+
+// Client отправляет письма по SMTP. Соединение открывается на каждое письмо,
+// поэтому недоступный сервер не мешает запуску сервиса.
+type Client struct {
+	cfg  SmtpConfig
+	from *mail.Address
+}
+
+func New(cfg SmtpConfig) (*Client, error) {
+	from, err := mail.ParseAddress(cfg.From)
+	if err != nil {
+		return nil, fmt.Errorf("invalid smtp from address: %w", err)
+	}
+
+	switch cfg.TLS {
+	case TLSNone, TLSStartTLS, TLSImplicit:
+	default:
+		return nil, fmt.Errorf("unknown smtp tls mode %q", cfg.TLS)
+	}
+
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+
+	return &Client{cfg: cfg, from: from}, nil
+}
+
+// Send отправляет письмо, повторяя попытку при сетевых ошибках и временных отказах (4xx)
+// с экспоненциальной задержкой. Постоянный отказ (5xx) возвращается сразу как ErrPermanent.
+func (c *Client) Send(ctx context.Context, msg Message) error {
+	to, err := mail.ParseAddress(msg.To)
+	if err != nil {
+		return fmt.Errorf("%w: invalid recipient: %v", ErrPermanent, err)
+	}
+
+	data, err := c.build(to, msg)
+	if err != nil {
+		return err
+	}
+
+	delay := c.cfg.RetryBackoff
+	for attempt := 0; ; attempt++ {
+		err = c.send(ctx, to.Address, data)
+		if err == nil || errors.Is(err, ErrPermanent) || attempt >= c.cfg.Retries {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%w (last error: %v)", ctx.Err(), err)
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
+
+func (c *Client) send(ctx context.Context, to string, data []byte) error {
+	addr := net.JoinHostPort(c.cfg.Host, strconv.Itoa(c.cfg.Port))
+	dialer := net.Dialer{Timeout: c.cfg.Timeout}
+
+	var conn net.Conn
+	var err error
+	if c.cfg.TLS == TLSImplicit {
+		conn, err = (&tls.Dialer{NetDialer: &dialer, Config: &tls.Config{ServerName: c.cfg.Host}}).DialContext(ctx, "tcp", addr)
+	} else {
+		conn, err = dialer.DialContext(ctx, "tcp", addr)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to connect to smtp server: %w", err)
+	}
+
+	deadline := time.Now().Add(c.cfg.Timeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	conn.SetDeadline(deadline)
+
+	client, err := smtp.NewClient(conn, c.cfg.Host)
+	if err != nil {
+		conn.Close()
+		return classify("greeting", err)
+	}
+	defer client.Close()
+
+	if c.cfg.TLS == TLSStartTLS {
+		if err := client.StartTLS(&tls.Config{ServerName: c.cfg.Host}); err != nil {
+			return classify("starttls", err)
+		}
+	}
+
+	if c.cfg.User != "" {
+		// PlainAuth отказывается передавать пароль без TLS на удалённый хост
+		if err := client.Auth(smtp.PlainAuth("", c.cfg.User, c.cfg.Pass, c.cfg.Host)); err != nil {
+			return classify("auth", err)
+		}
+	}
+
+	if err := client.Mail(c.from.Address); err != nil {
+		return classify("mail from", err)
+	}
+	if err := client.Rcpt(to); err != nil {
+		return classify("rcpt to", err)
+	}
+
+	w, err := client.Data()
+	if err != nil {
+		return classify("data", err)
+	}
+	if _, err := w.Write(data); err != nil {
+		return classify("data", err)
+	}
+	if err := w.Close(); err != nil {
+		return classify("data", err)
+	}
+
+	return client.Quit()
+}
+
+// classify помечает ответы 5xx как постоянные ошибки
+func classify(stage string, err error) error {
+	var protoErr *textproto.Error
+	if errors.As(err, &protoErr) && protoErr.Code >= 500 {
+		return fmt.Errorf("%w: %s: %v", ErrPermanent, stage, err)
+	}
+	return fmt.Errorf("smtp %s failed: %w", stage, err)
+}
+
+// build собирает письмо в формате MIME: multipart/alternative с текстом и HTML
+func (c *Client) build(to *mail.Address, msg Message) ([]byte, error) {
+	var buf bytes.Buffer
+
+	header := func(key, value string) {
+		buf.WriteString(key + ": " + value + "\r\n")
+	}
+
+	header("From", c.from.String())
+	header("To", to.String())
+	header("Subject", mime.QEncoding.Encode("utf-8", msg.Subject))
+	header("Date", time.Now().Format(time.RFC1123Z))
+	header("Message-ID", "<"+randomID()+"@"+domain(c.from.Address)+">")
+	header("MIME-Version", "1.0")
+
+	if msg.HTML == "" {
+		header("Content-Type", "text/plain; charset=utf-8")
+		header("Content-Transfer-Encoding", "quoted-printable")
+		buf.WriteString("\r\n")
+		if err := writeQuotedPrintable(&buf, msg.Text); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+
+	boundary := randomID()
+	header("Content-Type", `multipart/alternative; boundary="`+boundary+`"`)
+	buf.WriteString("\r\n")
+
+	for _, part := range []struct{ contentType, body string }{
+		{"text/plain; charset=utf-8", msg.Text},
+		{"text/html; charset=utf-8", msg.HTML},
+	} {
+		buf.WriteString("--" + boundary + "\r\n")
+		header("Content-Type", part.contentType)
+		header("Content-Transfer-Encoding", "quoted-printable")
+		buf.WriteString("\r\n")
+		if err := writeQuotedPrintable(&buf, part.body); err != nil {
+			return nil, err
+		}
+		buf.WriteString("\r\n")
+	}
+	buf.WriteString("--" + boundary + "--\r\n")
+
+	return buf.Bytes(), nil
+}
+
+func writeQuotedPrintable(buf *bytes.Buffer, body string) error {
+	w := quotedprintable.NewWriter(buf)
+	body = strings.ReplaceAll(strings.ReplaceAll(body, "\r\n", "\n"), "\n", "\r\n")
+	if _, err := w.Write([]byte(body)); err != nil {
+		return fmt.Errorf("failed to encode message body: %w", err)
+	}
+	return w.Close()
+}
+
+func randomID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func domain(address string) string {
+	if i := strings.LastIndexByte(address, '@'); i >= 0 {
+		return address[i+1:]
+	}
+	return "localhost"
+}
@@ -0,0 +1,45 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+type SqliteConfig struct {
+	Path        string        `yaml:"SQLITE_PATH" env:"SQLITE_PATH" env-default:"./data/sso.db"`
+	BusyTimeout time.Duration `yaml:"SQLITE_BUSY_TIMEOUT" env:"SQLITE_BUSY_TIMEOUT" env-default:"5s"` // сколько ждать, пока база занята другой записью
+}
+
+// New открывает файл базы, при необходимости создавая его. Миграции применяет internal/migrations.
+// Внешние ключи включены, журнал - WAL: чтение не ждёт записи. Транзакции открываются
+// с BEGIN IMMEDIATE и сразу берут блокировку записи, поэтому не падают с SQLITE_BUSY посередине.
+func New(ctx context.Context, config SqliteConfig) (*sql.DB, error) {
+	if dir := filepath.Dir(config.Path); dir != "." {
+		if err := os.MkdirAll(dir, 0o750); err != nil {
+			return nil, fmt.Errorf("failed to create database directory: %w", err)
+		}
+	}
+
+	dsn := fmt.Sprintf("file:%s?_foreign_keys=1&_journal_mode=WAL&_synchronous=NORMAL&_txlock=immediate&_busy_timeout=%d",
+		config.Path,
+		config.BusyTimeout.Milliseconds(),
+	)
+
+	db, err := sql.Open("sqlite3", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open database: %w", err)
+	}
+
+	if err := db.PingContext(ctx); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("unable to open database: %w", err)
+	}
+
+	return db, nil
+}